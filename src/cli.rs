@@ -0,0 +1,1640 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+//! Non-interactive mode for scripted cleanup, e.g. over SSH or from cron
+//!
+//! Runs a single operation, prints its report to stdout and returns an exit
+//! code. Settings not given as flags come from the active profile.
+
+use std::fs::{self, File};
+use std::io::{self, BufRead, BufWriter, IsTerminal, Write};
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+use std::time::{Duration, Instant, SystemTime};
+
+use crate::core::{
+    accessed_within, audit_modlist_versions, compare_reports, delete_meta_files_with,
+    delete_old_versions_with, delete_orphaned_mods_with, detect_cross_folder_duplicates,
+    detect_identical_files, detect_orphaned_mods_by_game, exclude_in_use_groups,
+    exclude_in_use_orphans, exclude_last_copy_groups, exclude_last_copy_orphans,
+    exclude_listed_groups, exclude_listed_orphans, exclude_recently_accessed_groups,
+    exclude_required_groups, find_modlist_files, find_modlists_in_folder, find_orphaned_meta_files,
+    folder_links, format_size, free_space_summary, generic_mod_file,
+    get_all_mod_files_with_progress, get_game_folders, is_flat_library, is_in_folders,
+    is_mo2_instance, is_system_trash, load_mo2_instance, looks_like_wabbajack_install,
+    match_orphans_by_hash, parse_mod_filename, parse_wabbajack_file, read_only_folders,
+    recycle_bin_subdir, require_backup, restore_backup, save_cleanup_report,
+    scan_folders_for_duplicates_with_progress, system_trash_dir, unique_footprint,
+    which_modlists_use, write_cross_folder_duplicates, write_duplicates_json,
+    write_duplicates_report, write_group_plan, write_identical_files, write_largest_orphans,
+    write_modlist_uses, write_orphaned_csv, write_orphaned_report, write_report_diff,
+    write_skipped_files, write_unique_footprints, write_version_mismatches, Config, DeletionResult,
+    DuplicateScanOptions, FileOps, GameEntry, HashCache, KeepOrder, KeepPolicy, ModFile, ModGroup,
+    ModlistInfo, OldVersionScanResult, ParseOptions, Profile, RealFileOps, ScanResult,
+    ScanSnapshot, SimulatedFileOps, DEFAULT_RECYCLE_BIN_TEMPLATE, PINS_FILE_NAME,
+    RECYCLE_BIN_DIR_NAME,
+};
+
+/// Exit code for a run that finished without errors
+pub const EXIT_OK: i32 = 0;
+/// Exit code for a run that failed or finished with deletion errors
+pub const EXIT_FAILED: i32 = 1;
+/// Exit code for invalid command line flags
+pub const EXIT_USAGE: i32 = 2;
+
+pub const USAGE: &str = "\
+Usage: wabbajack-library-cleaner [-scan | -clean] [-orphaned | -meta | -dupes | -identical] [options]
+       wabbajack-library-cleaner -restore <folder>
+       wabbajack-library-cleaner -which <file> [-wabbajack <dir> | -modlists <dir>]
+       wabbajack-library-cleaner -version-audit [-dir <folder>] [-wabbajack <dir> | -modlists <dir>]
+
+  -scan              List old versions of each mod
+  -clean             Remove old versions (or orphaned archives with -orphaned)
+  -orphaned          List archives no selected modlist uses
+  -meta              List .meta files whose archive is gone; -clean removes
+                     them. -min-size doesn't apply
+  -dupes             List archives saved in more than one folder, matched by
+                     ModID, FileID and size; -clean keeps one copy of each
+  -identical         List files with the same contents under different names,
+                     such as re-downloads; only files of equal size are
+                     hashed. -clean keeps the newest copy of each
+  -dir <folder>      Downloads or game folder; defaults to the profile's
+  -wabbajack <dir>   Wabbajack folder with the modlists; defaults to the profile's.
+                     An installed MO2 instance works too: the archives its
+                     mods were installed from count as used
+  -modlists <dir>    Folder of .wabbajack files to use instead of the Wabbajack
+                     folder's; folders directly inside it are searched too
+  -min-size <MB>     Only include groups or archives of at least this size
+  -keep <N>          Keep the N newest versions of each mod; defaults to the
+                     profile's, normally 1
+  -keep-oldest       Keep the oldest versions instead. Versions pinned in
+                     wlc-pins.txt are kept whichever this is
+  -depth <N>         Also scan subfolders of each game folder, up to N levels
+                     deep; defaults to the profile's, normally 0
+  -json <file>       Also write the old versions found as JSON
+  -show-skipped      List the files whose names couldn't be read and why:
+                     no-dash, no-modid, no-timestamp, bad-extension or
+                     temp-file. -json always includes them
+  -csv <file>        With -orphaned, also write every used and orphaned
+                     archive as CSV
+  -diff <file>       Show what changed since the run that last saved <file>,
+                     then save this run's results to it
+  -hash              With -orphaned, hash unmatched archives and keep those
+                     a modlist lists by hash
+  -inspect           Read the meta.ini inside archives with no ModID in their
+                     name and no .meta file. Slow; .7z and .rar need 7-Zip
+  -review            With -clean, ask about each mod's old versions: y to
+                     remove them, n to keep them, a to remove these and all
+                     remaining, q to stop without removing anything more
+  -aggressive        Clean old versions the version heuristics would keep,
+                     such as same-version re-uploads or files with
+                     conflicting descriptors. Pins, modlists and the other
+                     safety checks still apply; the scan lists these groups
+  -unsafe-delete-all-old
+                     Turn off the old version safety checks. Each cleanup
+                     has to be confirmed at the prompt, so -yes is refused
+  -safe              Never delete permanently: move files to the recycle bin
+                     even if the profile turns it off, and stop if there's
+                     none. New profiles have safe mode on
+  -simulate          Go through -clean without moving or deleting anything,
+                     listing the files that would be removed. The RESULT
+                     line counts them as if they were
+  -yes               Don't ask before removing files
+  -include-hidden    Also scan folders starting with . or __ as game folders
+  -resume            In the window, skip the folders an interrupted scan of
+                     several folders already finished
+  -profile <name>    Use this saved profile instead of the last one used,
+                     here and in the window
+  -quiet             Print only the RESULT line and questions on stdout
+  -log-level <level> Least severe log messages shown: error, warn, info
+                     (the default, or the config's log_level) or debug
+  -log <file>        Append log messages to <file> instead of stderr; - for
+                     stderr. A folder such as logs/ gets
+                     wabbajack-library-cleaner.log inside it. The file is
+                     rotated once it reaches log_max_size_mb (5) and log_keep
+                     (10) old copies are kept, as set in the config
+  -trace <file>      Write why each file was kept or removed to <file>, one
+                     JSON line per decision
+  -restore <folder>  Move the files in a WLC_RecycleBin folder back
+  -which <file>      List the modlists that use an archive and the version
+                     each expects
+  -version-audit     List the mods the selected modlists expect in another
+                     file than the one downloaded, by FileID, so they can be
+                     downloaded again. Deletes nothing
+
+Scans and cleanups end with a line for scripts, e.g.
+RESULT deleted=12 freed=3456789 failed=0
+where freed is in bytes. The exit code is 0 when nothing failed, 1 when a
+folder or file failed and 2 for invalid flags.
+
+Without -scan, -clean, -orphaned, -restore, -which or -version-audit the window
+opens as usual.";
+
+/// What a scan or cleanup run removed, printed last for scripts
+#[derive(Debug, Clone, Copy, Default, PartialEq)]
+pub struct RunSummary {
+    pub deleted: usize,
+    /// Bytes deleted or moved
+    pub freed: u64,
+    /// Files that couldn't be removed, and folders or steps that failed
+    pub failed: usize,
+}
+
+impl RunSummary {
+    fn add(&mut self, result: &DeletionResult) {
+        self.deleted += result.deleted_count;
+        self.freed += result.space_freed;
+        self.failed += result.failed.len() + result.errors.len();
+    }
+
+    pub fn exit_code(&self) -> i32 {
+        if self.failed > 0 {
+            EXIT_FAILED
+        } else {
+            EXIT_OK
+        }
+    }
+}
+
+impl std::fmt::Display for RunSummary {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(
+            f,
+            "RESULT deleted={} freed={} failed={}",
+            self.deleted, self.freed, self.failed
+        )
+    }
+}
+
+/// Largest orphans listed again right before asking to remove them
+const CONFIRM_EXAMPLES: usize = 10;
+
+/// How often the scan progress line is redrawn
+const PROGRESS_INTERVAL: Duration = Duration::from_millis(500);
+
+/// Operation and settings chosen on the command line
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct CliOptions {
+    pub scan: bool,
+    pub clean: bool,
+    pub orphaned: bool,
+    /// Look for `.meta` files whose archive is gone instead of old versions
+    pub meta: bool,
+    /// Look for archives saved in more than one folder instead of old versions
+    pub dupes: bool,
+    /// Look for byte-identical files under different names instead of old versions
+    pub identical: bool,
+    /// List the files the old version scan couldn't read, with the reason
+    pub show_skipped: bool,
+    pub dir: Option<PathBuf>,
+    pub wabbajack_dir: Option<PathBuf>,
+    /// Folder of saved modlists, used instead of the Wabbajack folder's
+    pub modlists_dir: Option<PathBuf>,
+    /// Where to write the old version report as JSON
+    pub json: Option<PathBuf>,
+    /// Where to write the orphan report as CSV
+    pub csv: Option<PathBuf>,
+    /// Snapshot of the previous run to compare with, then overwrite
+    pub diff: Option<PathBuf>,
+    /// Ask about each old version group instead of once per folder
+    pub review: bool,
+    /// Never delete permanently, whatever the profile says
+    pub safe: bool,
+    /// Go through a cleanup without changing any files
+    pub simulate: bool,
+    /// Minimum size in bytes
+    pub min_size: u64,
+    /// Newest versions kept per mod, overriding the profile's
+    pub keep: Option<usize>,
+    /// Keep the oldest versions of each mod instead of the newest
+    pub keep_oldest: bool,
+    /// Levels of subfolders scanned in each game folder, overriding the profile's
+    pub depth: Option<usize>,
+    pub yes: bool,
+    /// Leave the report off stdout, keeping only the RESULT line
+    pub quiet: bool,
+    /// Hash archives left unmatched; also on when the profile asks for it
+    pub hash: bool,
+    /// Look inside unrecognized archives for a `meta.ini`; also on when the profile asks for it
+    pub inspect: bool,
+    /// Recycle bin folder to move back to where its files came from
+    pub restore: Option<PathBuf>,
+    /// Archive to list the modlists of
+    pub which: Option<PathBuf>,
+    /// List mods whose downloads aren't the file the modlists expect
+    pub version_audit: bool,
+    /// Saved profile to use instead of the active one
+    pub profile: Option<String>,
+    /// Where to write each file decision as JSON lines
+    pub trace: Option<PathBuf>,
+    /// Scan folders starting with `.` or `__` as game folders too
+    pub include_hidden: bool,
+    /// Let the window reuse the folders an interrupted scan finished
+    pub resume: bool,
+    /// Turn off the old version safety checks; never combined with `yes`
+    pub unsafe_delete_all_old: bool,
+    /// Clean old versions only the suspicious version heuristics would keep
+    pub aggressive: bool,
+}
+
+/// Read the command line flags. Returns `None` when no operation was asked for.
+pub fn parse_args(args: impl IntoIterator<Item = String>) -> Result<Option<CliOptions>, String> {
+    let options = parse_flags(args)?;
+    Ok(options.has_operation().then_some(options))
+}
+
+/// Read the command line flags, whether or not they ask for an operation
+///
+/// The window reads the flags it shares with the command line from here too.
+/// Flags take one or two dashes. Arguments this mode doesn't know, such as
+/// `-log`, are left for the rest of the program.
+pub fn parse_flags(args: impl IntoIterator<Item = String>) -> Result<CliOptions, String> {
+    let mut options = CliOptions::default();
+    let mut args = args.into_iter();
+
+    while let Some(arg) = args.next() {
+        let flag = arg.strip_prefix("--").or_else(|| arg.strip_prefix('-'));
+        let (name, inline_value) = match flag.map(|f| f.split_once('=')) {
+            Some(Some((name, value))) => (name, Some(value.to_string())),
+            Some(None) => (flag.unwrap_or_default(), None),
+            None => continue,
+        };
+        let mut value = |flag: &str| {
+            inline_value
+                .clone()
+                .or_else(|| args.next())
+                .ok_or_else(|| format!("-{} needs a value", flag))
+        };
+
+        match name {
+            "scan" => options.scan = true,
+            "clean" => options.clean = true,
+            "orphaned" => options.orphaned = true,
+            "version-audit" => options.version_audit = true,
+            "meta" => options.meta = true,
+            "dupes" => options.dupes = true,
+            "show-skipped" => options.show_skipped = true,
+            "identical" => options.identical = true,
+            "yes" | "y" => options.yes = true,
+            "quiet" | "q" => options.quiet = true,
+            "hash" => options.hash = true,
+            "inspect" => options.inspect = true,
+            "review" => options.review = true,
+            "safe" => options.safe = true,
+            "aggressive" => options.aggressive = true,
+            "unsafe-delete-all-old" => options.unsafe_delete_all_old = true,
+            "simulate" => options.simulate = true,
+            "keep-oldest" => options.keep_oldest = true,
+            "include-hidden" => options.include_hidden = true,
+            "resume" => options.resume = true,
+            "dir" => options.dir = Some(value(name)?.into()),
+            "wabbajack" => options.wabbajack_dir = Some(value(name)?.into()),
+            "modlists" => options.modlists_dir = Some(value(name)?.into()),
+            "json" => options.json = Some(value(name)?.into()),
+            "csv" => options.csv = Some(value(name)?.into()),
+            "diff" => options.diff = Some(value(name)?.into()),
+            "restore" => options.restore = Some(value(name)?.into()),
+            "which" => options.which = Some(value(name)?.into()),
+            "profile" => options.profile = Some(value(name)?),
+            "trace" => options.trace = Some(value(name)?.into()),
+            "min-size" => {
+                let text = value(name)?;
+                let mb: u64 = text
+                    .trim()
+                    .parse()
+                    .map_err(|_| format!("-min-size must be a whole number of MB: {}", text))?;
+                options.min_size = mb
+                    .checked_mul(1024 * 1024)
+                    .ok_or_else(|| format!("-min-size is too large: {}", text))?;
+            }
+            "keep" => {
+                let text = value(name)?;
+                let keep = text
+                    .trim()
+                    .parse()
+                    .ok()
+                    .filter(|&n: &usize| n >= 1)
+                    .ok_or_else(|| {
+                        format!("-keep must be a whole number of at least 1: {}", text)
+                    })?;
+                options.keep = Some(keep);
+            }
+            "depth" => {
+                let text = value(name)?;
+                let depth = text.trim().parse().map_err(|_| {
+                    format!("-depth must be a whole number of folder levels: {}", text)
+                })?;
+                options.depth = Some(depth);
+            }
+            _ => {}
+        }
+    }
+
+    if options.meta && (options.orphaned || !(options.scan || options.clean)) {
+        return Err(
+            "-meta is its own scan; use it with -scan or -clean, without -orphaned".to_string(),
+        );
+    }
+    if options.dupes
+        && (options.orphaned || options.meta || options.review || !(options.scan || options.clean))
+    {
+        return Err("-dupes is its own scan; use it with -scan or -clean, without -orphaned, -meta or -review".to_string());
+    }
+    if options.identical
+        && (options.orphaned
+            || options.meta
+            || options.dupes
+            || options.review
+            || !(options.scan || options.clean))
+    {
+        return Err("-identical is its own scan; use it with -scan or -clean, without -orphaned, -meta, -dupes or -review".to_string());
+    }
+    if (options.orphaned || options.meta || options.dupes || options.identical)
+        && options.json.is_some()
+    {
+        return Err("-json only reports old versions; use it with -scan or -clean".to_string());
+    }
+    if (options.orphaned || options.meta || options.dupes || options.identical)
+        && options.show_skipped
+    {
+        return Err(
+            "-show-skipped only applies to the old version scan; use it with -scan or -clean"
+                .to_string(),
+        );
+    }
+    if options.unsafe_delete_all_old && options.yes {
+        return Err("-unsafe-delete-all-old turns off the safety checks and needs each cleanup confirmed; use it without -yes".to_string());
+    }
+    if options.review && (!options.clean || options.orphaned || options.yes) {
+        return Err("-review asks about old versions before removing them; use it with -clean, without -orphaned or -yes".to_string());
+    }
+    if options.review && options.quiet {
+        return Err("-review asks questions -quiet would hide; use one or the other".to_string());
+    }
+    if !options.orphaned && options.csv.is_some() {
+        return Err("-csv only reports orphaned archives; use it with -orphaned".to_string());
+    }
+
+    if options.version_audit
+        && (options.scan
+            || options.clean
+            || options.orphaned
+            || options.restore.is_some()
+            || options.which.is_some())
+    {
+        return Err("-version-audit is its own report; use it without -scan, -clean, -orphaned, -restore or -which".to_string());
+    }
+
+    Ok(options)
+}
+
+impl CliOptions {
+    /// Whether the flags ask for a command line run instead of the window
+    pub fn has_operation(&self) -> bool {
+        self.scan
+            || self.clean
+            || self.orphaned
+            || self.version_audit
+            || self.restore.is_some()
+            || self.which.is_some()
+    }
+}
+
+/// Run the chosen operation and return the process exit code
+pub fn run(options: &CliOptions) -> i32 {
+    if let Some(backup) = &options.restore {
+        return run_restore(backup);
+    }
+
+    let mut config = Config::load();
+    if let Some(name) = &options.profile {
+        if !config.switch_profile(name) {
+            eprintln!("Profile not found: {}", name);
+            return EXIT_USAGE;
+        }
+    }
+    let mut profile = config.active().clone();
+    profile.safe_mode |= options.safe;
+    let mut parse = ParseOptions::with_extensions(&config.archive_extensions);
+    parse.inspect_archives = options.inspect || profile.inspect_archives;
+
+    if let Some(file) = &options.which {
+        return run_which(options, &profile, file);
+    }
+
+    let Some(dir) = options
+        .dir
+        .clone()
+        .or_else(|| profile.downloads_dir.clone())
+    else {
+        eprintln!("No folder to clean. Pass -dir <folder>.\n\n{}", USAGE);
+        return EXIT_USAGE;
+    };
+    if looks_like_wabbajack_install(&dir) {
+        eprintln!(
+            "Warning: {} looks like the Wabbajack installation folder. -dir takes the \
+             downloads folder; pass the installation folder with -wabbajack.",
+            dir.display()
+        );
+    }
+
+    let result = if options.version_audit {
+        run_version_audit(options, &profile, &parse, &dir)
+    } else if options.orphaned {
+        run_orphaned(options, &profile, &parse, &config, &dir)
+    } else if options.meta {
+        run_orphaned_meta(options, &profile, &dir)
+    } else if options.dupes {
+        run_cross_folder_duplicates(options, &profile, &parse, &config, &dir)
+    } else if options.identical {
+        run_identical_files(options, &profile, &parse, &config, &dir)
+    } else {
+        run_old_versions(options, &profile, &parse, &config, &dir)
+    };
+    match result {
+        Ok(summary) => {
+            println!("{}", summary);
+            summary.exit_code()
+        }
+        Err(e) => {
+            eprintln!("Error: {}", e);
+            EXIT_FAILED
+        }
+    }
+}
+
+fn run_old_versions(
+    options: &CliOptions,
+    profile: &Profile,
+    parse: &ParseOptions,
+    config: &Config,
+    dir: &Path,
+) -> Result<RunSummary, String> {
+    let pins = &config.pins;
+    if !pins.is_empty() && !options.quiet {
+        println!(
+            "Keeping {} pinned version(s) from {}",
+            pins.len(),
+            PINS_FILE_NAME
+        );
+    }
+    if options.unsafe_delete_all_old {
+        eprintln!(
+            "Warning: -unsafe-delete-all-old is on; old versions are removed without the safety checks"
+        );
+    }
+    let keep_order = if options.keep_oldest {
+        KeepOrder::Oldest
+    } else {
+        profile.keep_order
+    };
+    let scan_options = DuplicateScanOptions {
+        split_version_schemes: profile.split_version_schemes,
+        unsafe_delete_all_old: options.unsafe_delete_all_old,
+        aggressive: options.aggressive,
+        group_strategy: profile.group_strategy,
+        keep_versions: options.keep.unwrap_or(profile.keep_versions),
+        keep_policy: KeepPolicy {
+            order: keep_order,
+            newest_by: profile.newest_by,
+            pins: pins.clone(),
+        },
+        subfolder_depth: options.depth.unwrap_or(profile.subfolder_depth),
+        parse: parse.clone(),
+    };
+    // The modlists protect last copies and required FileIDs, so cleaning
+    // without them would delete archives a modlist still needs
+    let all_modlists = if options.clean {
+        load_all_modlists(options, profile).map_err(|e| {
+            format!(
+                "{}; refusing to clean without the modlists that protect needed archives",
+                e
+            )
+        })?
+    } else {
+        Vec::new()
+    };
+    let modlists = select_modlists(all_modlists.clone(), profile);
+
+    let mut stdout = report_output(options);
+    let mut summary = RunSummary::default();
+    let mut accept_all = false;
+    let mut planned = OldVersionScanResult::default();
+    let folders = game_folders(dir, options.include_hidden)?;
+    let read_only = if options.clean {
+        unmapped_read_only_folders(profile, &folders, &modlists, &config.games)
+    } else {
+        Vec::new()
+    };
+    let scanned = ProgressLine::run(options, |progress| {
+        scan_folders_for_duplicates_with_progress(&folders, &scan_options, progress)
+    });
+    for (folder, scanned) in scanned {
+        let mut result = match scanned {
+            Ok(result) => result,
+            Err(e) => {
+                eprintln!("Failed to scan {}: {}", folder.display(), e);
+                summary.failed += 1;
+                continue;
+            }
+        };
+        result
+            .duplicates
+            .retain(|g| g.space_to_free >= options.min_size);
+        for name in exclude_in_use_groups(&mut result.duplicates, profile.in_use_minutes) {
+            eprintln!("Keeping {}: possibly in use (modified moments ago)", name);
+        }
+        if options.clean {
+            let mut kept = exclude_recently_accessed_groups(
+                &mut result.duplicates,
+                profile.protect_accessed_days,
+            );
+            kept.extend(exclude_listed_groups(
+                &mut result.duplicates,
+                &config.exclusions,
+            ));
+            kept.extend(exclude_last_copy_groups(&mut result.duplicates, &modlists));
+            if profile.protect_required_versions {
+                kept.extend(exclude_required_groups(
+                    &mut result.duplicates,
+                    &all_modlists,
+                ));
+            }
+            for name in kept {
+                eprintln!("Keeping {}", name);
+            }
+        }
+        result.update_totals();
+        planned
+            .skipped_files
+            .extend(result.skipped_files.iter().cloned());
+        planned
+            .vanished_files
+            .extend(result.vanished_files.iter().cloned());
+        planned
+            .heuristic_groups
+            .extend(result.heuristic_groups.iter().cloned());
+        if result.duplicates.is_empty() {
+            continue;
+        }
+
+        writeln!(stdout, "\n== {} ==", folder.display()).map_err(|e| e.to_string())?;
+        planned.duplicates.extend(result.duplicates.iter().cloned());
+        if options.review {
+            let reviewed = review_groups(
+                std::mem::take(&mut result.duplicates),
+                &mut accept_all,
+                // Locked only while reviewing; confirm locks stdin itself
+                &mut io::stdin().lock(),
+                &mut stdout,
+            )
+            .map_err(|e| e.to_string())?;
+            let Some(accepted) = reviewed else {
+                writeln!(stdout, "Stopped; nothing more is removed.").map_err(|e| e.to_string())?;
+                break;
+            };
+            result.duplicates = accepted;
+            result.update_totals();
+            if result.duplicates.is_empty() {
+                continue;
+            }
+        } else {
+            write_duplicates_report(&mut stdout, &result).map_err(|e| e.to_string())?;
+        }
+
+        if options.clean && read_only.contains(&folder) {
+            writeln!(stdout, "Read-only folder; nothing is removed.").map_err(|e| e.to_string())?;
+        } else if options.clean {
+            let recycle_bin = recycle_bin_for(profile, dir, "old-versions", &game_name(&folder));
+            require_backup(profile.safe_mode, recycle_bin.as_deref())?;
+            print_free_space(
+                &mut stdout,
+                &folder,
+                result.total_space,
+                recycle_bin.is_some(),
+            )?;
+            let prompt = format!(
+                "Remove {} old versions ({})?",
+                result.total_files,
+                format_size(result.total_space)
+            );
+            // Reviewed groups were already confirmed one by one
+            confirm_and_delete(
+                &mut stdout,
+                options,
+                profile,
+                dir,
+                (!options.review).then_some(prompt.as_str()),
+                &mut summary,
+                |ops| {
+                    delete_old_versions_with(
+                        &result.duplicates,
+                        profile.safe_mode,
+                        recycle_bin.as_deref(),
+                        None,
+                        ops,
+                    )
+                },
+            )?;
+        }
+    }
+
+    if options.show_skipped {
+        write_skipped_files(&mut stdout, &planned.skipped_files).map_err(|e| e.to_string())?;
+        writeln!(
+            stdout,
+            "Removed while scanning: {}",
+            planned.vanished_files.len()
+        )
+        .map_err(|e| e.to_string())?;
+        for name in &planned.vanished_files {
+            writeln!(stdout, "  {}", name).map_err(|e| e.to_string())?;
+        }
+    }
+    if let Some(path) = &options.json {
+        planned.update_totals();
+        save_json(path, &planned).map_err(|e| format!("Failed to write {:?}: {}", path, e))?;
+    }
+    if let Some(path) = &options.diff {
+        diff_with_snapshot(&mut stdout, path, |s| s.record_old_versions(&planned))?;
+    }
+
+    Ok(summary)
+}
+
+/// Ask about each group before its old versions are removed
+///
+/// Returns the groups the user accepted, or `None` if they quit. Answering
+/// "a" accepts this group and every later one, including in later folders.
+/// Running out of input counts as quitting.
+fn review_groups(
+    groups: Vec<ModGroup>,
+    accept_all: &mut bool,
+    input: &mut impl BufRead,
+    out: &mut impl Write,
+) -> io::Result<Option<Vec<ModGroup>>> {
+    let mut accepted = Vec::new();
+    for group in groups {
+        if *accept_all {
+            accepted.push(group);
+            continue;
+        }
+
+        writeln!(out)?;
+        write_group_plan(out, &group)?;
+        loop {
+            write!(
+                out,
+                "Remove {} old versions ({})? [y/n/a/q] ",
+                group.newest_idx,
+                format_size(group.space_to_free)
+            )?;
+            out.flush()?;
+            let mut answer = String::new();
+            if input.read_line(&mut answer)? == 0 {
+                return Ok(None);
+            }
+            match answer.trim().to_lowercase().as_str() {
+                "y" | "yes" => accepted.push(group),
+                "n" | "no" | "" => {}
+                "a" | "all" => {
+                    *accept_all = true;
+                    accepted.push(group);
+                }
+                "q" | "quit" => return Ok(None),
+                _ => {
+                    writeln!(out, "Answer y, n, a or q.")?;
+                    continue;
+                }
+            }
+            break;
+        }
+    }
+    Ok(Some(accepted))
+}
+
+fn save_json(path: &Path, result: &OldVersionScanResult) -> io::Result<()> {
+    let mut w = BufWriter::new(File::create(path)?);
+    write_duplicates_json(&mut w, result)?;
+    w.flush()
+}
+
+/// File system changes for a cleanup: real ones, or only recorded with -simulate
+fn file_ops(options: &CliOptions) -> Box<dyn FileOps> {
+    if options.simulate {
+        Box::new(SimulatedFileOps::new())
+    } else {
+        Box::new(RealFileOps)
+    }
+}
+
+/// Where a run's report goes: stdout, or nowhere with -quiet
+fn report_output(options: &CliOptions) -> Box<dyn Write> {
+    if options.quiet {
+        Box::new(io::sink())
+    } else {
+        Box::new(io::stdout().lock())
+    }
+}
+
+/// Print what changed since the snapshot at `path`, then replace it with this run's
+///
+/// Sections this run didn't scan keep their previous contents.
+fn diff_with_snapshot(
+    out: &mut impl Write,
+    path: &Path,
+    record: impl FnOnce(&mut ScanSnapshot),
+) -> Result<(), String> {
+    let previous = if path.exists() {
+        Some(ScanSnapshot::load(path).map_err(|e| format!("Failed to read {:?}: {}", path, e))?)
+    } else {
+        None
+    };
+    let mut snapshot = previous.clone().unwrap_or_default();
+    record(&mut snapshot);
+
+    match &previous {
+        Some(previous) => {
+            writeln!(out, "\n== Changes since the previous scan ==").map_err(|e| e.to_string())?;
+            write_report_diff(out, &compare_reports(previous, &snapshot))
+                .map_err(|e| e.to_string())?;
+        }
+        None => eprintln!("No previous scan at {}; saving this one", path.display()),
+    }
+    snapshot
+        .save(path)
+        .map_err(|e| format!("Failed to write {:?}: {}", path, e))
+}
+
+fn save_csv(path: &Path, result: &ScanResult) -> io::Result<()> {
+    let mut w = BufWriter::new(File::create(path)?);
+    write_orphaned_csv(&mut w, result)?;
+    w.flush()
+}
+
+fn run_orphaned(
+    options: &CliOptions,
+    profile: &Profile,
+    parse: &ParseOptions,
+    config: &Config,
+    dir: &Path,
+) -> Result<RunSummary, String> {
+    let modlists = load_modlists(options, profile)?;
+    if modlists.is_empty() {
+        return Err("No modlists to protect; refusing to look for orphans".to_string());
+    }
+
+    let (folders, files) = scan_files(options, profile, parse, dir)?;
+    let mut result = detect_orphaned_mods_by_game(&files, &modlists, &folders, &config.games);
+    if options.hash || profile.hash_unmatched {
+        let cache = HashCache::default_path()
+            .map(|path| HashCache::open(&path))
+            .unwrap_or_default();
+        let rescued = match_orphans_by_hash(&mut result, &modlists, &cache);
+        eprintln!("Kept {} archives matched by hash", rescued);
+        if let Err(e) = cache.save() {
+            eprintln!("Failed to save hash cache: {:#}", e);
+        }
+    }
+    result.skip_small_orphans(options.min_size);
+    for name in exclude_in_use_orphans(&mut result.orphaned_mods, profile.in_use_minutes) {
+        eprintln!("Keeping {}: possibly in use (modified moments ago)", name);
+    }
+
+    if options.clean {
+        let now = SystemTime::now();
+        let mut kept = Vec::new();
+        result.orphaned_mods.retain(|m| {
+            let recent = accessed_within(&m.file, profile.protect_accessed_days, now);
+            if recent {
+                kept.push(m.file.file_name.clone());
+            }
+            !recent
+        });
+        kept.extend(exclude_listed_orphans(
+            &mut result.orphaned_mods,
+            &config.exclusions,
+        ));
+        kept.extend(exclude_last_copy_orphans(
+            &mut result.orphaned_mods,
+            &files,
+            &modlists,
+        ));
+        let read_only = unmapped_read_only_folders(profile, &folders, &modlists, &config.games);
+        result.orphaned_mods.retain(|m| {
+            let listed = is_in_folders(&m.file, &read_only, &folders);
+            if listed {
+                kept.push(m.file.file_name.clone());
+            }
+            !listed
+        });
+        for name in kept {
+            eprintln!("Keeping {}", name);
+        }
+    }
+    result.orphaned_size = result.orphaned_mods.iter().map(|m| m.file.size).sum();
+
+    let mut stdout = report_output(options);
+    write_orphaned_report(&mut stdout, &result).map_err(|e| e.to_string())?;
+    if modlists.len() > 1 {
+        writeln!(stdout).map_err(|e| e.to_string())?;
+        write_unique_footprints(&mut stdout, &unique_footprint(&modlists, &result))
+            .map_err(|e| e.to_string())?;
+    }
+    if let Some(path) = &options.csv {
+        save_csv(path, &result).map_err(|e| format!("Failed to write {:?}: {}", path, e))?;
+    }
+    if let Some(path) = &options.diff {
+        diff_with_snapshot(&mut stdout, path, |s| s.record_orphan_scan(&result))?;
+    }
+
+    if !options.clean || result.orphaned_mods.is_empty() {
+        return Ok(RunSummary::default());
+    }
+    let recycle_bin = recycle_bin_for(profile, dir, "orphaned", "all");
+    require_backup(profile.safe_mode, recycle_bin.as_deref())?;
+    print_free_space(
+        &mut stdout,
+        dir,
+        result.orphaned_size,
+        recycle_bin.is_some(),
+    )?;
+    write_largest_orphans(&mut stdout, &result.orphaned_mods, CONFIRM_EXAMPLES)
+        .map_err(|e| e.to_string())?;
+    let prompt = format!(
+        "Remove {} orphaned archives ({})?",
+        result.orphaned_mods.len(),
+        format_size(result.orphaned_size)
+    );
+    let mut summary = RunSummary::default();
+    confirm_and_delete(
+        &mut stdout,
+        options,
+        profile,
+        dir,
+        Some(&prompt),
+        &mut summary,
+        |ops| {
+            delete_orphaned_mods_with(
+                &result.orphaned_mods,
+                profile.safe_mode,
+                recycle_bin.as_deref(),
+                None,
+                ops,
+            )
+        },
+    )?;
+    Ok(summary)
+}
+
+/// Folders cleanups only report on, when the profile protects folders no modlist's game maps to
+fn unmapped_read_only_folders(
+    profile: &Profile,
+    folders: &[PathBuf],
+    modlists: &[ModlistInfo],
+    games: &[GameEntry],
+) -> Vec<PathBuf> {
+    if !profile.read_only_unmapped_folders {
+        return Vec::new();
+    }
+    let read_only = read_only_folders(folders, modlists, games);
+    for folder in &read_only {
+        eprintln!(
+            "Folder {} not mapped to a modlist game; treating it as read-only",
+            folder.display()
+        );
+    }
+    read_only
+}
+
+/// Show the free space before a cleanup, so it's clear what the cleanup gains
+fn print_free_space(
+    out: &mut impl Write,
+    path: &Path,
+    bytes: u64,
+    recycled: bool,
+) -> Result<(), String> {
+    match free_space_summary(path, bytes, recycled) {
+        Ok(summary) => writeln!(out, "{}", summary).map_err(|e| e.to_string()),
+        Err(e) => {
+            eprintln!("Failed to read free space on {}: {}", path.display(), e);
+            Ok(())
+        }
+    }
+}
+
+/// List or remove the `.meta` files left behind by deleted archives
+fn run_orphaned_meta(
+    options: &CliOptions,
+    profile: &Profile,
+    dir: &Path,
+) -> Result<RunSummary, String> {
+    let folders = game_folders(dir, options.include_hidden)?;
+    let meta_files = find_orphaned_meta_files(&folders);
+    let size: u64 = meta_files
+        .iter()
+        .filter_map(|path| fs::metadata(path).ok())
+        .map(|m| m.len())
+        .sum();
+
+    let mut stdout = report_output(options);
+    writeln!(
+        stdout,
+        "Orphaned .meta files: {} ({})",
+        meta_files.len(),
+        format_size(size)
+    )
+    .map_err(|e| e.to_string())?;
+    for path in &meta_files {
+        writeln!(stdout, "  {}", path.display()).map_err(|e| e.to_string())?;
+    }
+
+    if !options.clean || meta_files.is_empty() {
+        return Ok(RunSummary::default());
+    }
+    let recycle_bin = recycle_bin_for(profile, dir, "meta", "all");
+    require_backup(profile.safe_mode, recycle_bin.as_deref())?;
+    let prompt = format!("Remove {} orphaned .meta files?", meta_files.len());
+    let mut summary = RunSummary::default();
+    confirm_and_delete(
+        &mut stdout,
+        options,
+        profile,
+        dir,
+        Some(&prompt),
+        &mut summary,
+        |ops| delete_meta_files_with(&meta_files, profile.safe_mode, recycle_bin.as_deref(), ops),
+    )?;
+    Ok(summary)
+}
+
+/// List or remove archives saved in more than one folder, keeping one copy of each
+fn run_cross_folder_duplicates(
+    options: &CliOptions,
+    profile: &Profile,
+    parse: &ParseOptions,
+    config: &Config,
+    dir: &Path,
+) -> Result<RunSummary, String> {
+    let (folders, files) = scan_files(options, profile, parse, dir)?;
+    let mut duplicates = detect_cross_folder_duplicates(&files, &folders, &config.games);
+    duplicates.retain(|d| d.reclaimable >= options.min_size);
+
+    let mut stdout = report_output(options);
+    write_cross_folder_duplicates(&mut stdout, &duplicates).map_err(|e| e.to_string())?;
+    if !options.clean || duplicates.is_empty() {
+        return Ok(RunSummary::default());
+    }
+    let groups = duplicates.iter().map(|d| d.to_group()).collect();
+    remove_extra_copies(
+        &mut stdout,
+        options,
+        profile,
+        config,
+        dir,
+        groups,
+        "duplicates",
+        "duplicate",
+    )
+}
+
+/// List or remove byte-identical archives saved under different names, keeping the newest of each
+fn run_identical_files(
+    options: &CliOptions,
+    profile: &Profile,
+    parse: &ParseOptions,
+    config: &Config,
+    dir: &Path,
+) -> Result<RunSummary, String> {
+    let (_, files) = scan_files(options, profile, parse, dir)?;
+    let cache = HashCache::default_path()
+        .map(|path| HashCache::open(&path))
+        .unwrap_or_default();
+    let mut identical = detect_identical_files(&files, &cache);
+    if let Err(e) = cache.save() {
+        eprintln!("Failed to save hash cache: {:#}", e);
+    }
+    identical.retain(|d| d.reclaimable >= options.min_size);
+
+    let mut stdout = report_output(options);
+    write_identical_files(&mut stdout, &identical).map_err(|e| e.to_string())?;
+    if !options.clean || identical.is_empty() {
+        return Ok(RunSummary::default());
+    }
+    let groups = identical.iter().map(|d| d.to_group()).collect();
+    remove_extra_copies(
+        &mut stdout,
+        options,
+        profile,
+        config,
+        dir,
+        groups,
+        "identical",
+        "identical",
+    )
+}
+
+/// Remove all but the kept copy in each group, once confirmed
+///
+/// `operation` names the cleanup's recycle bin folder and `kind` the copies
+/// in the prompt.
+#[allow(clippy::too_many_arguments)]
+fn remove_extra_copies(
+    out: &mut impl Write,
+    options: &CliOptions,
+    profile: &Profile,
+    config: &Config,
+    dir: &Path,
+    mut groups: Vec<ModGroup>,
+    operation: &str,
+    kind: &str,
+) -> Result<RunSummary, String> {
+    for name in exclude_listed_groups(&mut groups, &config.exclusions) {
+        eprintln!("Keeping {}", name);
+    }
+    if groups.is_empty() {
+        return Ok(RunSummary::default());
+    }
+    let total_files: usize = groups.iter().map(|g| g.newest_idx).sum();
+    let total_space: u64 = groups.iter().map(|g| g.space_to_free).sum();
+    let recycle_bin = recycle_bin_for(profile, dir, operation, "all");
+    require_backup(profile.safe_mode, recycle_bin.as_deref())?;
+    print_free_space(out, dir, total_space, recycle_bin.is_some())?;
+    let prompt = format!(
+        "Remove {} {} copies ({})?",
+        total_files,
+        kind,
+        format_size(total_space)
+    );
+    let mut summary = RunSummary::default();
+    confirm_and_delete(
+        out,
+        options,
+        profile,
+        dir,
+        Some(&prompt),
+        &mut summary,
+        |ops| {
+            delete_old_versions_with(
+                &groups,
+                profile.safe_mode,
+                recycle_bin.as_deref(),
+                None,
+                ops,
+            )
+        },
+    )?;
+    Ok(summary)
+}
+
+/// List mods whose archive on disk isn't the file version an active modlist requires
+fn run_version_audit(
+    options: &CliOptions,
+    profile: &Profile,
+    parse: &ParseOptions,
+    dir: &Path,
+) -> Result<RunSummary, String> {
+    let modlists = load_modlists(options, profile)?;
+    let (_, files) = scan_files(options, profile, parse, dir)?;
+
+    let mismatches: Vec<_> = modlists
+        .iter()
+        .flat_map(|modlist| audit_modlist_versions(modlist, &files))
+        .collect();
+    let mut stdout = report_output(options);
+    write_version_mismatches(&mut stdout, &mismatches).map_err(|e| e.to_string())?;
+    Ok(RunSummary::default())
+}
+
+/// Print the modlists that use an archive, from all modlists rather than the selection
+fn run_which(options: &CliOptions, profile: &Profile, file: &Path) -> i32 {
+    let file_name = file
+        .file_name()
+        .map(|n| n.to_string_lossy().to_string())
+        .unwrap_or_default();
+    let modlists = match load_all_modlists(options, profile) {
+        Ok(modlists) => modlists,
+        Err(e) => {
+            eprintln!("Error: {}", e);
+            return EXIT_FAILED;
+        }
+    };
+
+    let mut mod_file =
+        parse_mod_filename(&file_name).unwrap_or_else(|| generic_mod_file(&file_name));
+    // The .meta next to the archive lets a hash match it
+    mod_file.full_path = file.to_path_buf();
+
+    let uses = which_modlists_use(&mod_file, &modlists);
+    let mut stdout = report_output(options);
+    match write_modlist_uses(&mut stdout, &file_name, &uses) {
+        Ok(()) => EXIT_OK,
+        Err(e) => {
+            eprintln!("Error: {}", e);
+            EXIT_FAILED
+        }
+    }
+}
+
+/// Game folders to scan, saying so when a flat library is scanned as one
+fn game_folders(dir: &Path, include_hidden: bool) -> Result<Vec<PathBuf>, String> {
+    let folders = get_game_folders(dir, include_hidden).map_err(|e| e.to_string())?;
+    if folders.is_empty() {
+        return Err(format!("No archives or game folders in {}", dir.display()));
+    }
+    if is_flat_library(dir, &folders) {
+        eprintln!(
+            "No game folders in {}; scanning its archives as one folder",
+            dir.display()
+        );
+    }
+    for (link, target) in folder_links(&folders) {
+        eprintln!(
+            "Warning: {} is a link to {}; free space is that of the drive it points to",
+            link.display(),
+            target.display()
+        );
+    }
+    log::debug!("Scanning {} folder(s) in {:?}", folders.len(), dir);
+    Ok(folders)
+}
+
+/// Game folders of `dir` and every archive in them, with a progress line while scanning
+fn scan_files(
+    options: &CliOptions,
+    profile: &Profile,
+    parse: &ParseOptions,
+    dir: &Path,
+) -> Result<(Vec<PathBuf>, Vec<ModFile>), String> {
+    let folders = game_folders(dir, options.include_hidden)?;
+    let depth = options.depth.unwrap_or(profile.subfolder_depth);
+    let files = ProgressLine::run(options, |progress| {
+        get_all_mod_files_with_progress(&folders, parse, depth, progress)
+    })
+    .map_err(|e| e.to_string())?;
+    Ok((folders, files))
+}
+
+fn run_restore(backup: &Path) -> i32 {
+    let result = match restore_backup(backup) {
+        Ok(result) => result,
+        Err(e) => {
+            eprintln!("Error: {:#}", e);
+            return EXIT_FAILED;
+        }
+    };
+    println!("Restored {} files", result.restored);
+    for path in &result.conflicts {
+        eprintln!(
+            "  Not restored, a file already exists at {}",
+            path.display()
+        );
+    }
+    for error in &result.errors {
+        eprintln!("  {}", error);
+    }
+    if result.conflicts.is_empty() && result.errors.is_empty() {
+        EXIT_OK
+    } else {
+        EXIT_FAILED
+    }
+}
+
+/// Modlists to protect: the profile's selection, or every modlist found
+fn load_modlists(options: &CliOptions, profile: &Profile) -> Result<Vec<ModlistInfo>, String> {
+    Ok(select_modlists(
+        load_all_modlists(options, profile)?,
+        profile,
+    ))
+}
+
+/// The profile's selected modlists, or all of them when none are selected
+fn select_modlists(mut modlists: Vec<ModlistInfo>, profile: &Profile) -> Vec<ModlistInfo> {
+    if !profile.selected_modlists.is_empty() {
+        // An MO2 instance is the only "modlist" there is; the selection is for .wabbajack files
+        modlists.retain(|ml| {
+            profile.selected_modlists.contains(&ml.name) || is_mo2_instance(&ml.file_path)
+        });
+    }
+    log::debug!(
+        "Protecting modlists: {}",
+        modlists
+            .iter()
+            .map(|ml| ml.name.as_str())
+            .collect::<Vec<_>>()
+            .join(", ")
+    );
+    modlists
+}
+
+/// Every modlist in the Wabbajack or modlists folder, or the mods an MO2 instance has installed
+fn load_all_modlists(options: &CliOptions, profile: &Profile) -> Result<Vec<ModlistInfo>, String> {
+    let files = if let Some(dir) = &options.modlists_dir {
+        find_modlists_in_folder(dir)
+    } else {
+        let wabbajack_dir = options
+            .wabbajack_dir
+            .clone()
+            .or_else(|| profile.wabbajack_dir.clone())
+            .ok_or("No Wabbajack folder. Pass -wabbajack <folder> or -modlists <folder>.")?;
+        if is_mo2_instance(&wabbajack_dir) {
+            return load_mo2_instance(&wabbajack_dir)
+                .map(|info| vec![info])
+                .map_err(|e| format!("{:#}", e));
+        }
+        find_modlist_files(&wabbajack_dir)
+    };
+
+    Ok(files
+        .map_err(|e| e.to_string())?
+        .iter()
+        .filter_map(|path| {
+            parse_wabbajack_file(path)
+                .map_err(|e| log::debug!("Skipping modlist {:?}: {:#}", path, e))
+                .ok()
+        })
+        .collect())
+}
+
+fn game_name(folder: &Path) -> String {
+    folder
+        .file_name()
+        .map(|n| n.to_string_lossy().to_string())
+        .unwrap_or_default()
+}
+
+/// This cleanup's recycle bin folder, or `None` when the profile deletes permanently
+/// and safe mode is off
+fn recycle_bin_for(profile: &Profile, dir: &Path, operation: &str, game: &str) -> Option<PathBuf> {
+    if !profile.move_to_recycle_bin && !profile.safe_mode {
+        return None;
+    }
+    if let Some(trash) = system_trash_dir().filter(|_| profile.use_system_trash) {
+        return Some(trash);
+    }
+    let now = chrono::Local::now();
+    let subdir = recycle_bin_subdir(&profile.recycle_bin_template, operation, game, now)
+        .or_else(|e| {
+            eprintln!("{}. Using the default folder name.", e);
+            recycle_bin_subdir(DEFAULT_RECYCLE_BIN_TEMPLATE, operation, game, now)
+        })
+        .ok()?;
+    Some(dir.join(RECYCLE_BIN_DIR_NAME).join(subdir))
+}
+
+/// Ask with `prompt` unless the run is scripted, then delete and report
+///
+/// `None` skips the question, for cleanups the user has already confirmed.
+/// The deletion's totals are added to `summary`.
+fn confirm_and_delete(
+    out: &mut impl Write,
+    options: &CliOptions,
+    profile: &Profile,
+    dir: &Path,
+    prompt: Option<&str>,
+    summary: &mut RunSummary,
+    delete: impl FnOnce(&dyn FileOps) -> DeletionResult,
+) -> Result<(), String> {
+    let skip_prompt = options.yes || options.simulate;
+    if let Some(prompt) = prompt.filter(|_| !skip_prompt) {
+        if !confirm(prompt) {
+            writeln!(out, "Skipped.").map_err(|e| e.to_string())?;
+            return Ok(());
+        }
+    }
+    let ops = file_ops(options);
+    let deletion = delete(ops.as_ref());
+    finish_deletion(out, profile, dir, &deletion, ops.as_ref(), summary)
+}
+
+/// Print a deletion's outcome, save its report and add it to the run's summary
+fn finish_deletion(
+    out: &mut impl Write,
+    profile: &Profile,
+    dir: &Path,
+    result: &DeletionResult,
+    ops: &dyn FileOps,
+    summary: &mut RunSummary,
+) -> Result<(), String> {
+    summary.add(result);
+    let verb = match (ops.is_simulated(), result.recycle_bin_path.is_some()) {
+        (true, true) => "Would move",
+        (true, false) => "Would delete",
+        (false, true) => "Moved",
+        (false, false) => "Deleted",
+    };
+    writeln!(
+        out,
+        "{} {} files ({})",
+        verb,
+        result.deleted_count,
+        format_size(result.space_freed)
+    )
+    .map_err(|e| e.to_string())?;
+    if ops.is_simulated() {
+        for (path, _) in &result.removed {
+            writeln!(out, "  {}", path.display()).map_err(|e| e.to_string())?;
+        }
+        return Ok(());
+    }
+    for error in &result.errors {
+        eprintln!("  {}", error);
+    }
+    if !result.failed.is_empty() {
+        eprintln!("Failed to delete {} files (see log):", result.failed.len());
+        for (path, error) in &result.failed {
+            eprintln!("  {}: {}", path.display(), error);
+        }
+    }
+
+    let report_dir = profile
+        .cleanup_report_dir
+        .clone()
+        .or_else(|| {
+            result
+                .recycle_bin_path
+                .clone()
+                .filter(|dir| !is_system_trash(dir))
+        })
+        .unwrap_or_else(|| dir.to_path_buf());
+    match save_cleanup_report(&report_dir, result) {
+        Ok(path) => {
+            writeln!(out, "Report saved to {}", path.display()).map_err(|e| e.to_string())?
+        }
+        Err(e) => eprintln!("Failed to save cleanup report: {}", e),
+    }
+
+    Ok(())
+}
+
+/// "Scanned 5000/42000 files..." kept on one terminal line while a scan runs
+///
+/// Drawn on stderr, since the report holds stdout, and redrawn at most every
+/// `PROGRESS_INTERVAL`.
+struct ProgressLine {
+    /// When the line was last drawn, and how long it was
+    last_drawn: Mutex<Option<(Instant, usize)>>,
+}
+
+impl ProgressLine {
+    /// A progress line, or `None` when the output isn't a terminal or the run is scripted
+    fn for_run(options: &CliOptions) -> Option<Self> {
+        let interactive = io::stdout().is_terminal() && io::stderr().is_terminal();
+        (interactive && !options.yes && !options.quiet && options.json.is_none()).then(|| Self {
+            last_drawn: Mutex::new(None),
+        })
+    }
+
+    fn update(&self, done: usize, total: usize) {
+        let mut last_drawn = self.last_drawn.lock().unwrap_or_else(|e| e.into_inner());
+        let now = Instant::now();
+        let recent = last_drawn.is_some_and(|(at, _)| now.duration_since(at) < PROGRESS_INTERVAL);
+        if recent && done < total {
+            return;
+        }
+        let line = format!("Scanned {}/{} files...", done, total);
+        eprint!("\r{}", line);
+        *last_drawn = Some((now, line.len()));
+    }
+
+    /// Run `scan` with a progress line for this run, cleared once it's done
+    fn run<T>(options: &CliOptions, scan: impl FnOnce(&(dyn Fn(usize, usize) + Sync)) -> T) -> T {
+        let progress = Self::for_run(options);
+        let result = scan(&|done, total| {
+            if let Some(progress) = &progress {
+                progress.update(done, total);
+            }
+        });
+        if let Some(progress) = &progress {
+            progress.finish();
+        }
+        result
+    }
+
+    /// Clear the line so the report starts on an empty one
+    fn finish(&self) {
+        let last_drawn = self.last_drawn.lock().unwrap_or_else(|e| e.into_inner());
+        if let Some((_, len)) = *last_drawn {
+            eprint!("\r{}\r", " ".repeat(len));
+        }
+    }
+}
+
+/// Ask on stdin; anything but "y" or "yes", including no input at all, is no
+fn confirm(prompt: &str) -> bool {
+    print!("{} [y/N] ", prompt);
+    io::stdout().flush().ok();
+    let mut answer = String::new();
+    if io::stdin().lock().read_line(&mut answer).is_err() {
+        return false;
+    }
+    matches!(answer.trim().to_lowercase().as_str(), "y" | "yes")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn args(list: &[&str]) -> Vec<String> {
+        list.iter().map(|s| s.to_string()).collect()
+    }
+
+    #[test]
+    fn test_parse_args() {
+        let options = parse_args(args(&[
+            "-clean",
+            "-dir",
+            "F:\\Wabbajack\\Skyrim",
+            "--min-size=50",
+            "-yes",
+        ]))
+        .unwrap()
+        .unwrap();
+        assert!(options.clean && options.yes && !options.scan);
+        assert_eq!(options.dir, Some(PathBuf::from("F:\\Wabbajack\\Skyrim")));
+        assert_eq!(options.min_size, 50 * 1024 * 1024);
+
+        // No operation: the window opens, other flags are left alone
+        assert_eq!(
+            parse_args(args(&["--profile", "Work", "--trace", "t.jsonl"])).unwrap(),
+            None
+        );
+        let options = parse_flags(args(&["-profile", "Work"])).unwrap();
+        assert_eq!(options.profile.as_deref(), Some("Work"));
+        let options = parse_flags(args(&["--profile=Work"])).unwrap();
+        assert_eq!(options.profile.as_deref(), Some("Work"));
+        assert!(parse_flags(args(&["--profile"])).is_err());
+        let options = parse_flags(args(&["-trace", "t.jsonl"])).unwrap();
+        assert_eq!(options.trace, Some(PathBuf::from("t.jsonl")));
+        let options = parse_flags(args(&["--resume", "-include-hidden"])).unwrap();
+        assert!(options.resume && options.include_hidden);
+
+        let options = parse_args(args(&["-clean", "-safe"])).unwrap().unwrap();
+        assert!(options.safe);
+        let options = parse_args(args(&["-clean", "-simulate"])).unwrap().unwrap();
+        assert!(options.simulate && !options.yes);
+        let options = parse_args(args(&["-clean", "-aggressive"]))
+            .unwrap()
+            .unwrap();
+        assert!(options.aggressive && !options.unsafe_delete_all_old);
+        let options = parse_args(args(&["-clean", "--unsafe-delete-all-old"]))
+            .unwrap()
+            .unwrap();
+        assert!(options.unsafe_delete_all_old);
+        assert!(parse_args(args(&["-clean", "-unsafe-delete-all-old", "-yes"])).is_err());
+        let options = parse_args(args(&["-scan", "-identical"])).unwrap().unwrap();
+        assert!(options.identical);
+        assert!(parse_args(args(&["-identical"])).is_err());
+        assert!(parse_args(args(&["-scan", "-identical", "-dupes"])).is_err());
+        let options = parse_args(args(&["-scan", "-show-skipped"]))
+            .unwrap()
+            .unwrap();
+        assert!(options.show_skipped);
+        assert!(parse_args(args(&["-scan", "-orphaned", "-show-skipped"])).is_err());
+
+        let options = parse_args(args(&["-version-audit"])).unwrap().unwrap();
+        assert!(options.version_audit && !options.scan);
+        assert!(parse_args(args(&["-clean", "-version-audit"])).is_err());
+
+        assert!(parse_args(args(&["-scan", "-min-size", "lots"])).is_err());
+        assert!(parse_args(args(&["-scan", "-min-size", "18446744073709551615"])).is_err());
+        assert!(parse_args(args(&["-scan", "-dir"])).is_err());
+        assert!(parse_args(args(&["-scan", "-keep", "0"])).is_err());
+        let options = parse_args(args(&["-scan", "-keep", "2"])).unwrap().unwrap();
+        assert_eq!(options.keep, Some(2));
+        let options = parse_args(args(&["-scan", "-depth", "3"]))
+            .unwrap()
+            .unwrap();
+        assert_eq!(options.depth, Some(3));
+        assert!(parse_args(args(&["-scan", "-depth", "-1"])).is_err());
+        assert!(parse_args(args(&["-orphaned", "-json", "out.json"])).is_err());
+        assert!(parse_args(args(&["-scan", "-csv", "out.csv"])).is_err());
+        let options = parse_args(args(&["-orphaned", "-diff", "last.json"]))
+            .unwrap()
+            .unwrap();
+        assert_eq!(options.diff, Some(PathBuf::from("last.json")));
+        let options = parse_args(args(&["-orphaned", "-csv", "out.csv"]))
+            .unwrap()
+            .unwrap();
+        assert_eq!(options.csv, Some(PathBuf::from("out.csv")));
+
+        let options = parse_args(args(&["-scan", "-json=out.json"]))
+            .unwrap()
+            .unwrap();
+        assert_eq!(options.json, Some(PathBuf::from("out.json")));
+
+        let options = parse_args(args(&["-orphaned", "-modlists", "D:\\Modlists"]))
+            .unwrap()
+            .unwrap();
+        assert_eq!(options.modlists_dir, Some(PathBuf::from("D:\\Modlists")));
+
+        let options = parse_args(args(&["-which", "SkyUI-12604-5-2-1700000000.7z"]))
+            .unwrap()
+            .unwrap();
+        assert!(!options.scan && !options.clean);
+        assert_eq!(
+            options.which,
+            Some(PathBuf::from("SkyUI-12604-5-2-1700000000.7z"))
+        );
+
+        let options = parse_args(args(&["-clean", "-meta"])).unwrap().unwrap();
+        assert!(options.meta);
+        assert!(parse_args(args(&["-meta"])).is_err());
+        assert!(parse_args(args(&["-scan", "-orphaned", "-meta"])).is_err());
+
+        let options = parse_args(args(&["-clean", "-review"])).unwrap().unwrap();
+        assert!(options.review);
+        assert!(parse_args(args(&["-scan", "-review"])).is_err());
+        assert!(parse_args(args(&["-clean", "-review", "-yes"])).is_err());
+        assert!(parse_args(args(&["-clean", "-orphaned", "-review"])).is_err());
+        assert!(parse_args(args(&["-clean", "-review", "-quiet"])).is_err());
+        let options = parse_args(args(&[
+            "-scan",
+            "-quiet",
+            "-log-level",
+            "debug",
+            "-log",
+            "-",
+        ]))
+        .unwrap()
+        .unwrap();
+        assert!(options.quiet);
+
+        let options = parse_args(args(&["-restore", "WLC_RecycleBin/2025-01-01_10-00-00"]))
+            .unwrap()
+            .unwrap();
+        assert!(!options.scan && !options.clean);
+        assert_eq!(
+            options.restore,
+            Some(PathBuf::from("WLC_RecycleBin/2025-01-01_10-00-00"))
+        );
+    }
+
+    #[test]
+    fn test_run_summary() {
+        let mut summary = RunSummary::default();
+        assert_eq!(summary.to_string(), "RESULT deleted=0 freed=0 failed=0");
+        assert_eq!(summary.exit_code(), EXIT_OK);
+
+        summary.add(&DeletionResult {
+            deleted_count: 12,
+            space_freed: 3456789,
+            ..Default::default()
+        });
+        assert_eq!(summary.exit_code(), EXIT_OK);
+        summary.add(&DeletionResult {
+            failed: vec![(PathBuf::from("Locked.7z"), "File is locked".to_string())],
+            ..Default::default()
+        });
+        assert_eq!(
+            summary.to_string(),
+            "RESULT deleted=12 freed=3456789 failed=1"
+        );
+        assert_eq!(summary.exit_code(), EXIT_FAILED);
+    }
+
+    #[test]
+    fn test_review_groups() {
+        let group = |key: &str| ModGroup {
+            mod_key: key.to_string(),
+            files: Vec::new(),
+            newest_idx: 1,
+            space_to_free: 10,
+        };
+        let groups = || vec![group("a"), group("b"), group("c")];
+        let keys = |groups: Vec<ModGroup>| -> Vec<String> {
+            groups.into_iter().map(|g| g.mod_key).collect()
+        };
+        let mut out = Vec::new();
+
+        let mut accept_all = false;
+        let mut input = io::Cursor::new("y\nmaybe\nn\ny\n");
+        let accepted = review_groups(groups(), &mut accept_all, &mut input, &mut out).unwrap();
+        assert_eq!(keys(accepted.unwrap()), vec!["a", "c"]);
+
+        let mut input = io::Cursor::new("n\na\n");
+        let accepted = review_groups(groups(), &mut accept_all, &mut input, &mut out).unwrap();
+        assert_eq!(keys(accepted.unwrap()), vec!["b", "c"]);
+        assert!(accept_all);
+        let accepted = review_groups(groups(), &mut accept_all, &mut input, &mut out).unwrap();
+        assert_eq!(accepted.unwrap().len(), 3);
+
+        let mut accept_all = false;
+        let mut input = io::Cursor::new("y\nq\n");
+        assert!(
+            review_groups(groups(), &mut accept_all, &mut input, &mut out)
+                .unwrap()
+                .is_none()
+        );
+        let mut input = io::Cursor::new("y\n");
+        assert!(
+            review_groups(groups(), &mut accept_all, &mut input, &mut out)
+                .unwrap()
+                .is_none()
+        );
+    }
+}
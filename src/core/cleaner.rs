@@ -5,45 +5,1054 @@
 // the Free Software Foundation, either version 3 of the License, or
 // (at your option) any later version.
 
+use std::collections::{HashMap, HashSet};
 use std::fs;
-use std::path::Path;
+use std::io;
+use std::path::{Component, Path, PathBuf};
+use std::time::{Duration, SystemTime};
 
-use crate::core::types::{DeletionResult, ModFile, ModGroup, OrphanedMod};
+use crate::core::exclusions::Exclusions;
+use crate::core::fsops::{FileOps, RealFileOps};
+use crate::core::meta::{protection_reason_for_with, read_meta_for};
+use crate::core::parser::{archive_parts_with, split_archive_part};
+use crate::core::restore::save_backup_manifest;
+use crate::core::scanner::game_folder_of;
+use crate::core::trace::trace;
+use crate::core::trash::is_system_trash;
+use crate::core::types::{
+    CleanupPlan, DeletionResult, ModFile, ModGroup, ModlistInfo, OrphanedMod,
+};
+
+/// Name of the folder inside the downloads directory that receives moved files
+pub const RECYCLE_BIN_DIR_NAME: &str = "WLC_RecycleBin";
+
+/// Default name of each cleanup's folder inside the recycle bin
+pub const DEFAULT_RECYCLE_BIN_TEMPLATE: &str = "{date}";
+
+/// Placeholders supported in recycle bin folder templates
+pub const RECYCLE_BIN_PLACEHOLDERS: &[&str] = &["{date}", "{operation}", "{game}"];
+
+/// Build a cleanup's folder inside the recycle bin from a naming template
+///
+/// `{date}` becomes the local time, `{operation}` the kind of cleanup and
+/// `{game}` the game folder name. `/` nests folders. Unsafe characters in
+/// substituted values are replaced; a template that would still produce an
+/// unsafe or escaping path is rejected.
+pub fn recycle_bin_subdir(
+    template: &str,
+    operation: &str,
+    game: &str,
+    now: chrono::DateTime<chrono::Local>,
+) -> Result<PathBuf, String> {
+    let mut unknown = template.to_string();
+    for placeholder in RECYCLE_BIN_PLACEHOLDERS {
+        unknown = unknown.replace(placeholder, "");
+    }
+    if unknown.contains('{') || unknown.contains('}') {
+        return Err(format!(
+            "Unknown placeholder in recycle bin template '{}'. Supported: {}",
+            template,
+            RECYCLE_BIN_PLACEHOLDERS.join(", ")
+        ));
+    }
+
+    let name = template
+        .replace('\\', "/")
+        .replace("{date}", &now.format("%Y-%m-%d_%H-%M-%S").to_string())
+        .replace("{operation}", &sanitize_path_part(operation))
+        .replace("{game}", &sanitize_path_part(game));
+
+    let mut path = PathBuf::new();
+    for part in name.split('/') {
+        let part = part.trim();
+        let is_unsafe = part.is_empty()
+            || part.ends_with('.')
+            || part
+                .chars()
+                .any(|c| c.is_control() || "<>:\"|?*".contains(c))
+            || !matches!(
+                Path::new(part).components().next(),
+                Some(Component::Normal(_))
+            );
+        if is_unsafe {
+            return Err(format!(
+                "Recycle bin template '{}' doesn't produce a safe folder name",
+                template
+            ));
+        }
+        path.push(part);
+    }
+
+    Ok(path)
+}
+
+/// Replace characters that aren't allowed in Windows file names
+fn sanitize_path_part(value: &str) -> String {
+    let cleaned: String = value
+        .chars()
+        .map(|c| {
+            if c.is_control() || "<>:\"/\\|?*".contains(c) {
+                '_'
+            } else {
+                c
+            }
+        })
+        .collect();
+    let cleaned = cleaned.trim().trim_end_matches('.').to_string();
+    if cleaned.is_empty() {
+        "unknown".to_string()
+    } else {
+        cleaned
+    }
+}
 
 /// Check if a file is locked (being used by another process)
 pub fn is_file_locked(path: &Path) -> bool {
-    // Try to open the file for writing
-    fs::OpenOptions::new()
-        .read(true)
-        .write(true)
-        .open(path)
-        .is_err()
+    RealFileOps.is_locked(path)
+}
+
+/// Leading bytes of a zip archive's first local file header
+const ZIP_MAGIC: &[u8] = b"PK\x03\x04";
+
+/// Leading bytes of every 7-Zip archive
+const SEVEN_ZIP_MAGIC: &[u8] = b"7z\xBC\xAF\x27\x1C";
+
+/// Leading bytes shared by RAR 4 and RAR 5 archives
+const RAR_MAGIC: &[u8] = b"Rar!\x1A\x07";
+
+/// Check that an archive looks intact: not empty, a readable central
+/// directory for .zip and the right header for .7z and .rar
+///
+/// Logs which check failed so a corrupt download can be spotted.
+pub fn is_valid_archive(path: &Path) -> bool {
+    is_valid_archive_with(path, &RealFileOps)
+}
+
+/// Check that an archive looks intact, reading it through `ops`
+pub fn is_valid_archive_with(path: &Path, ops: &dyn FileOps) -> bool {
+    match archive_integrity_error(path, ops) {
+        Some(reason) => {
+            log::error!("Archive failed integrity check ({}): {:?}", reason, path);
+            false
+        }
+        None => true,
+    }
+}
+
+fn archive_integrity_error(path: &Path, ops: &dyn FileOps) -> Option<String> {
+    let mut file = match ops.open(path) {
+        Ok(file) => file,
+        Err(e) => return Some(format!("cannot open: {}", e)),
+    };
+    match ops.metadata(path) {
+        Ok(info) if info.size == 0 => return Some("file is empty".to_string()),
+        Ok(_) => {}
+        Err(e) => return Some(format!("cannot read metadata: {}", e)),
+    }
+
+    let name = path
+        .file_name()
+        .map(|n| n.to_string_lossy().to_lowercase())
+        .unwrap_or_default();
+    // Only the first part of a split archive carries the header, and a split
+    // zip's central directory sits in its last part
+    let (name, is_split) = match split_archive_part(&name) {
+        Some((base, _)) => (base, true),
+        None => (name.as_str(), false),
+    };
+
+    let magic = if name.ends_with(".zip") {
+        if !is_split {
+            return zip::ZipArchive::new(io::BufReader::new(file))
+                .err()
+                .map(|e| format!("unreadable zip central directory: {}", e));
+        }
+        ZIP_MAGIC
+    } else if name.ends_with(".7z") {
+        SEVEN_ZIP_MAGIC
+    } else if name.ends_with(".rar") {
+        RAR_MAGIC
+    } else {
+        return None;
+    };
+
+    let mut header = vec![0u8; magic.len()];
+    if io::Read::read_exact(&mut file, &mut header).is_err() || header != magic {
+        return Some(format!(
+            "missing {} header",
+            name.rsplit('.').next().unwrap_or("archive")
+        ));
+    }
+    None
+}
+
+/// Space available to the current user on the drive holding `path`, in bytes
+#[cfg(windows)]
+pub fn free_space(path: &Path) -> io::Result<u64> {
+    use std::os::windows::ffi::OsStrExt;
+
+    #[link(name = "kernel32")]
+    extern "system" {
+        fn GetDiskFreeSpaceExW(
+            directory: *const u16,
+            free_to_caller: *mut u64,
+            total: *mut u64,
+            total_free: *mut u64,
+        ) -> i32;
+    }
+
+    // A junction to another drive has that drive's free space
+    let path = resolve_links(path);
+    let wide: Vec<u16> = path.as_os_str().encode_wide().chain(Some(0)).collect();
+    let mut available = 0u64;
+    // SAFETY: `wide` is NUL-terminated and the unused outputs may be null
+    let ok = unsafe {
+        GetDiskFreeSpaceExW(
+            wide.as_ptr(),
+            &mut available,
+            std::ptr::null_mut(),
+            std::ptr::null_mut(),
+        )
+    };
+    if ok == 0 {
+        return Err(io::Error::last_os_error());
+    }
+    Ok(available)
+}
+
+/// Space available to the current user on the drive holding `path`, in bytes
+#[cfg(not(windows))]
+pub fn free_space(path: &Path) -> io::Result<u64> {
+    // POSIX output in 1024-byte blocks; the fourth column is the available space
+    let output = std::process::Command::new("df")
+        .arg("-Pk")
+        .arg(path)
+        .output()?;
+    if !output.status.success() {
+        return Err(io::Error::other(
+            String::from_utf8_lossy(&output.stderr).trim().to_string(),
+        ));
+    }
+    String::from_utf8_lossy(&output.stdout)
+        .lines()
+        .nth(1)
+        .and_then(|line| line.split_whitespace().nth(3))
+        .and_then(|blocks| blocks.parse::<u64>().ok())
+        .map(|blocks| blocks * 1024)
+        .ok_or_else(|| io::Error::new(io::ErrorKind::InvalidData, "Unexpected df output"))
+}
+
+/// Describe the free space on the drive holding `path` before and after freeing `bytes`
+///
+/// Recycled files stay on disk until the recycle bin is emptied, which the
+/// description points out.
+pub fn free_space_summary(path: &Path, bytes: u64, recycled: bool) -> io::Result<String> {
+    let free = free_space(path)?;
+    Ok(format!(
+        "Free now: {}, after cleanup: ~{}{}",
+        format_size(free),
+        format_size(free.saturating_add(bytes)),
+        if recycled {
+            " once the recycle bin is emptied"
+        } else {
+            ""
+        }
+    ))
+}
+
+/// Nearest existing folder at or above `path`, so a backup folder that isn't created yet can be queried
+fn existing_ancestor(path: &Path) -> Option<&Path> {
+    path.ancestors().find(|p| p.exists())
+}
+
+/// `path` with symlinks and junctions resolved, so it names the drive the files are really on
+///
+/// Parts below the nearest existing folder are kept as given, and `path` is
+/// returned unchanged when it can't be resolved.
+pub fn resolve_links(path: &Path) -> PathBuf {
+    let Some(existing) = existing_ancestor(path) else {
+        return path.to_path_buf();
+    };
+    let Ok(resolved) = fs::canonicalize(existing) else {
+        return path.to_path_buf();
+    };
+    let resolved = strip_verbatim_prefix(resolved);
+    match path.strip_prefix(existing) {
+        Ok(rest) if !rest.as_os_str().is_empty() => resolved.join(rest),
+        _ => resolved,
+    }
+}
+
+/// Turn the `\\?\` paths `canonicalize` returns on Windows back into drive and share paths
+#[cfg(windows)]
+fn strip_verbatim_prefix(path: PathBuf) -> PathBuf {
+    let text = path.to_string_lossy().into_owned();
+    if let Some(share) = text.strip_prefix(r"\\?\UNC\") {
+        PathBuf::from(format!(r"\\{}", share))
+    } else if let Some(local) = text.strip_prefix(r"\\?\") {
+        PathBuf::from(local)
+    } else {
+        path
+    }
+}
+
+#[cfg(not(windows))]
+fn strip_verbatim_prefix(path: PathBuf) -> PathBuf {
+    path
+}
+
+/// Whether `a` and `b` live on the same volume, judged by their nearest existing folders
+#[cfg(unix)]
+pub fn same_volume(a: &Path, b: &Path) -> bool {
+    use std::os::unix::fs::MetadataExt;
+
+    let device = |p: &Path| {
+        existing_ancestor(p)
+            .and_then(|p| fs::metadata(p).ok())
+            .map(|m| m.dev())
+    };
+    matches!((device(a), device(b)), (Some(x), Some(y)) if x == y)
+}
+
+/// Whether `a` and `b` live on the same volume, judged by their drive or share prefix
+#[cfg(not(unix))]
+pub fn same_volume(a: &Path, b: &Path) -> bool {
+    let prefix = |p: &Path| match p.components().next() {
+        Some(Component::Prefix(prefix)) => {
+            Some(prefix.as_os_str().to_string_lossy().to_lowercase())
+        }
+        _ => None,
+    };
+    // A junction lives on the drive it points to, not the one it's listed on
+    let (a, b) = (resolve_links(a), resolve_links(b));
+    matches!((prefix(a.as_path()), prefix(b.as_path())), (Some(x), Some(y)) if x == y)
+}
+
+/// Describe a move of `bytes` from `source` into the backup folder `dest`
+///
+/// Gives the destination's free space and warns when it shares a volume with
+/// the source, since moved files then keep using the same disk.
+pub fn backup_preview(source: &Path, dest: &Path, bytes: u64) -> String {
+    let mut preview = format!("Moving {} to '{}'", format_size(bytes), dest.display());
+    if let Some(free) = existing_ancestor(dest).and_then(|p| free_space(p).ok()) {
+        preview.push_str(&format!(" ({} free there)", format_size(free)));
+    }
+    if check_backup_space(source, dest, bytes).is_err() {
+        preview.push_str(". The destination doesn't have room for it");
+    }
+    if same_volume(source, dest) {
+        preview.push_str(
+            ". Same drive as the downloads: this frees space only after you delete the backup folder",
+        );
+    }
+    preview
+}
+
+/// Fail when moving `bytes` from `source` would overfill the backup folder `dest`
+///
+/// A move within one volume takes no extra space, and a drive whose free
+/// space can't be read isn't held against the move.
+pub fn check_backup_space(source: &Path, dest: &Path, bytes: u64) -> Result<(), String> {
+    if same_volume(source, dest) {
+        return Ok(());
+    }
+    match existing_ancestor(dest).and_then(|p| free_space(p).ok()) {
+        Some(free) if free < bytes => Err(format!(
+            "Not enough space for the backup in '{}': {} free, {} to move",
+            dest.display(),
+            format_size(free),
+            format_size(bytes)
+        )),
+        _ => Ok(()),
+    }
+}
+
+/// Pick the backup root with the most free space for a batch of `needed` bytes
+///
+/// Roots that don't exist or can't be queried are passed over. Fails with a
+/// description of every root when none can hold the batch.
+pub fn choose_backup_root(roots: &[PathBuf], needed: u64) -> Result<PathBuf, String> {
+    choose_backup_root_with(roots, needed, free_space)
+}
+
+fn choose_backup_root_with(
+    roots: &[PathBuf],
+    needed: u64,
+    free_space: impl Fn(&Path) -> io::Result<u64>,
+) -> Result<PathBuf, String> {
+    let mut best: Option<(&PathBuf, u64)> = None;
+    let mut details = Vec::new();
+
+    for root in roots {
+        if !root.is_dir() {
+            details.push(format!("{} (not found)", root.display()));
+            continue;
+        }
+        match free_space(root) {
+            Ok(space) => {
+                details.push(format!("{} ({} free)", root.display(), format_size(space)));
+                if best.is_none_or(|(_, most)| space > most) {
+                    best = Some((root, space));
+                }
+            }
+            Err(e) => details.push(format!("{} ({})", root.display(), e)),
+        }
+    }
+
+    match best {
+        Some((root, space)) if space >= needed => {
+            log::info!(
+                "Moving {} to {} ({} free)",
+                format_size(needed),
+                root.display(),
+                format_size(space)
+            );
+            Ok(root.clone())
+        }
+        _ => Err(format!(
+            "No backup location can hold {}: {}",
+            format_size(needed),
+            if details.is_empty() {
+                "none configured".to_string()
+            } else {
+                details.join(", ")
+            }
+        )),
+    }
+}
+
+/// Move a file, copying it when the destination is on another drive
+pub(crate) fn move_file(from: &Path, to: &Path) -> io::Result<()> {
+    move_file_with(&RealFileOps, from, to)
+}
+
+fn move_file_with(ops: &dyn FileOps, from: &Path, to: &Path) -> io::Result<()> {
+    if ops.rename(from, to).is_ok() {
+        return Ok(());
+    }
+    ops.copy(from, to)?;
+    if let Err(e) = ops.remove_file(from) {
+        let _ = ops.remove_file(to);
+        return Err(e);
+    }
+    Ok(())
+}
+
+/// Check that files can be created and removed in a directory
+pub fn check_write_access(dir: &Path) -> Result<(), String> {
+    let probe = dir.join(format!(".wlc_write_test_{}", std::process::id()));
+
+    fs::File::create(&probe).map_err(|e| format!("Cannot write to {:?}: {}", dir, e))?;
+    fs::remove_file(&probe).map_err(|e| format!("Cannot delete files in {:?}: {}", dir, e))?;
+
+    Ok(())
+}
+
+/// Refuse a permanent deletion while safe mode is on
+///
+/// `recycle_bin_dir` is where the cleanup would move its files; `None` means
+/// they would be deleted for good.
+pub fn require_backup(safe_mode: bool, recycle_bin_dir: Option<&Path>) -> Result<(), String> {
+    if safe_mode && recycle_bin_dir.is_none() {
+        return Err(
+            "Safe mode is on and no recycle bin folder is available, so nothing was removed"
+                .to_string(),
+        );
+    }
+    Ok(())
+}
+
+/// Probe the downloads folder and the recycle bin root for write access
+///
+/// Returns a description of every location that failed the probe.
+pub fn check_cleanup_permissions(downloads_dir: &Path) -> Vec<String> {
+    let mut problems = Vec::new();
+
+    if let Err(e) = check_write_access(downloads_dir) {
+        problems.push(e);
+    }
+
+    let recycle_bin_root = downloads_dir.join(RECYCLE_BIN_DIR_NAME);
+    if recycle_bin_root.is_dir() {
+        if let Err(e) = check_write_access(&recycle_bin_root) {
+            problems.push(e);
+        }
+    }
+
+    for problem in &problems {
+        log::warn!("Permission check failed: {}", problem);
+    }
+
+    problems
+}
+
+/// Check if a file was found in one of the given game folders
+///
+/// A file in a subfolder counts as being in the nearest of `game_folders` above it.
+pub fn is_in_folders(file: &ModFile, folders: &[PathBuf], game_folders: &[PathBuf]) -> bool {
+    game_folder_of(&file.full_path, game_folders).is_some_and(|g| folders.contains(g))
+}
+
+/// Remove files in read-only folders from a cleanup plan
+///
+/// Returns the names of the files that were taken out of the plan.
+pub fn exclude_read_only(
+    plan: &mut CleanupPlan,
+    read_only_folders: &[PathBuf],
+    game_folders: &[PathBuf],
+) -> Vec<String> {
+    let excluded = exclude_from_plan(plan, |f| is_in_folders(f, read_only_folders, game_folders));
+    trace_excluded(&excluded, "in a read-only folder");
+    excluded
+}
+
+fn trace_excluded(file_names: &[String], reason: &str) {
+    for name in file_names {
+        trace(name, "check", "excluded", reason);
+    }
+}
+
+/// Check if a file was last accessed within the past `days` days
+///
+/// Relies on the file system's last-access time, which is often unreliable:
+/// it may be disabled (`noatime`), only updated once a day (`relatime`), or
+/// bumped by antivirus and backup tools. Returns `false` when the time isn't
+/// available, so protection quietly turns off rather than blocking cleanup.
+pub fn accessed_within(file: &ModFile, days: u32, now: SystemTime) -> bool {
+    if days == 0 {
+        return false;
+    }
+    let Ok(accessed) = fs::metadata(&file.full_path).and_then(|m| m.accessed()) else {
+        return false;
+    };
+    match now.duration_since(accessed) {
+        Ok(age) => age < Duration::from_secs(u64::from(days) * 24 * 60 * 60),
+        // Access time in the future: treat as just accessed
+        Err(_) => true,
+    }
+}
+
+/// Remove files accessed within the past `days` days from a cleanup plan
+///
+/// Returns the names of the excluded files. See [`accessed_within`] for the
+/// limits of last-access times.
+pub fn exclude_recently_accessed(plan: &mut CleanupPlan, days: u32) -> Vec<String> {
+    let now = SystemTime::now();
+    let excluded = exclude_from_plan(plan, |f| accessed_within(f, days, now));
+    trace_excluded(&excluded, "accessed recently");
+    excluded
+}
+
+/// Drop old version groups with a deletion candidate accessed within `days` days
+pub fn exclude_recently_accessed_groups(groups: &mut Vec<ModGroup>, days: u32) -> Vec<String> {
+    let now = SystemTime::now();
+    let excluded = exclude_groups(groups, |f| accessed_within(f, days, now));
+    trace_excluded(&excluded, "accessed recently");
+    excluded
+}
+
+/// Check if a file was written to within the past `minutes` minutes
+///
+/// Wabbajack writes downloads in place, so a full-sized archive modified
+/// moments ago may still be downloading. Uses the modification time seen by
+/// the scan, or reads it when the scan didn't record one.
+pub fn modified_within(file: &ModFile, minutes: u32, now: SystemTime) -> bool {
+    if minutes == 0 {
+        return false;
+    }
+    let modified = match file.modified {
+        Some(secs) => SystemTime::UNIX_EPOCH + Duration::from_secs(secs),
+        None => match fs::metadata(&file.full_path).and_then(|m| m.modified()) {
+            Ok(modified) => modified,
+            Err(_) => return false,
+        },
+    };
+    match now.duration_since(modified) {
+        Ok(age) => age < Duration::from_secs(u64::from(minutes) * 60),
+        // Modified in the future: treat as just written
+        Err(_) => true,
+    }
+}
+
+/// Remove files modified within the past `minutes` minutes from a cleanup plan
+///
+/// Returns the names of the excluded files. See [`modified_within`].
+pub fn exclude_in_use(plan: &mut CleanupPlan, minutes: u32) -> Vec<String> {
+    let now = SystemTime::now();
+    let excluded = exclude_from_plan(plan, |f| modified_within(f, minutes, now));
+    trace_excluded(&excluded, "possibly in use");
+    excluded
+}
+
+/// Keep old versions modified within the past `minutes` minutes
+///
+/// Only the fresh files are spared; the rest of their group is still removed.
+pub fn exclude_in_use_groups(groups: &mut Vec<ModGroup>, minutes: u32) -> Vec<String> {
+    let now = SystemTime::now();
+    let keep: HashSet<PathBuf> = groups
+        .iter()
+        .flat_map(|g| g.files[..g.newest_idx].iter())
+        .filter(|f| modified_within(f, minutes, now))
+        .map(|f| f.full_path.clone())
+        .collect();
+    let excluded = keep_group_candidates(groups, &keep);
+    trace_excluded(&excluded, "possibly in use");
+    excluded
+}
+
+/// Remove orphans modified within the past `minutes` minutes
+pub fn exclude_in_use_orphans(orphans: &mut Vec<OrphanedMod>, minutes: u32) -> Vec<String> {
+    let now = SystemTime::now();
+    let mut excluded = Vec::new();
+    orphans.retain(|m| {
+        let fresh = modified_within(&m.file, minutes, now);
+        if fresh {
+            excluded.push(m.file.file_name.clone());
+        }
+        !fresh
+    });
+    trace_excluded(&excluded, "possibly in use");
+    excluded
+}
+
+/// Remove files on the exclusion list from a cleanup plan
+///
+/// Returns the names of the excluded files.
+pub fn exclude_listed(plan: &mut CleanupPlan, exclusions: &Exclusions) -> Vec<String> {
+    let excluded = exclude_from_plan(plan, |f| exclusions.matches(f));
+    trace_excluded(&excluded, "on the exclusion list");
+    excluded
+}
+
+/// Drop old version groups with a deletion candidate on the exclusion list
+pub fn exclude_listed_groups(groups: &mut Vec<ModGroup>, exclusions: &Exclusions) -> Vec<String> {
+    let excluded = exclude_groups(groups, |f| exclusions.matches(f));
+    trace_excluded(&excluded, "on the exclusion list");
+    excluded
+}
+
+/// Remove orphans on the exclusion list
+pub fn exclude_listed_orphans(
+    orphans: &mut Vec<OrphanedMod>,
+    exclusions: &Exclusions,
+) -> Vec<String> {
+    let mut excluded = Vec::new();
+    orphans.retain(|m| {
+        let listed = exclusions.matches(&m.file);
+        if listed {
+            excluded.push(m.file.file_name.clone());
+        }
+        !listed
+    });
+    trace_excluded(&excluded, "on the exclusion list");
+    excluded
+}
+
+/// Remove orphans the user unticked, by path
+///
+/// Returns the names of the excluded files.
+pub fn exclude_unchecked_orphans(
+    orphans: &mut Vec<OrphanedMod>,
+    unchecked: &HashSet<PathBuf>,
+) -> Vec<String> {
+    let mut excluded = Vec::new();
+    orphans.retain(|m| {
+        let skip = unchecked.contains(&m.file.full_path);
+        if skip {
+            excluded.push(m.file.file_name.clone());
+        }
+        !skip
+    });
+    trace_excluded(&excluded, "unticked");
+    excluded
+}
+
+/// Remove orphans and old version groups whose deletion candidates match `protect`
+fn exclude_from_plan(plan: &mut CleanupPlan, protect: impl Fn(&ModFile) -> bool) -> Vec<String> {
+    let mut excluded = Vec::new();
+
+    plan.orphaned_mods.retain(|m| {
+        let protected = protect(&m.file);
+        if protected {
+            excluded.push(m.file.file_name.clone());
+        }
+        !protected
+    });
+    excluded.extend(exclude_groups(&mut plan.old_versions, &protect));
+    update_plan_totals(plan);
+
+    excluded
+}
+
+fn update_plan_totals(plan: &mut CleanupPlan) {
+    plan.orphaned_size = plan.orphaned_mods.iter().map(|m| m.file.size).sum();
+    plan.old_version_files = plan.old_versions.iter().map(|g| g.newest_idx).sum();
+    plan.old_version_size = plan.old_versions.iter().map(|g| g.space_to_free).sum();
+}
+
+fn exclude_groups(groups: &mut Vec<ModGroup>, protect: impl Fn(&ModFile) -> bool) -> Vec<String> {
+    let mut excluded = Vec::new();
+    groups.retain(|group| {
+        let candidates = &group.files[..group.newest_idx];
+        let protected = candidates.iter().any(&protect);
+        if protected {
+            excluded.extend(candidates.iter().map(|f| f.file_name.clone()));
+        }
+        !protected
+    });
+    excluded
+}
+
+/// Keys of the needed archives a file provides: its name and its ModID-FileID
+fn needed_archive_keys(file: &ModFile, modlists: &[ModlistInfo]) -> Vec<String> {
+    let mut keys = Vec::new();
+    if modlists
+        .iter()
+        .any(|ml| ml.used_file_names.contains(&file.file_name))
+    {
+        keys.push(file.file_name.clone());
+    }
+    if let Some(file_id) = &file.file_id {
+        let key = format!("{}-{}", file.mod_id, file_id);
+        if modlists
+            .iter()
+            .any(|ml| ml.used_mod_file_ids.contains(&key))
+        {
+            keys.push(key);
+        }
+    }
+    keys
+}
+
+/// Find planned deletions that would remove the last copy of a needed archive
+///
+/// An archive is needed when a modlist references its file name or its ModID
+/// and FileID. However the scans decided, every needed archive that is on
+/// disk must keep one copy; the latest planned copy of each is returned.
+pub fn last_copies<'a>(
+    planned: &[&'a ModFile],
+    on_disk: impl IntoIterator<Item = &'a ModFile>,
+    modlists: &[ModlistInfo],
+) -> Vec<&'a ModFile> {
+    let planned_paths: HashSet<&Path> = planned.iter().map(|f| f.full_path.as_path()).collect();
+    let mut remaining: HashSet<String> = on_disk
+        .into_iter()
+        .filter(|f| !planned_paths.contains(f.full_path.as_path()))
+        .flat_map(|f| needed_archive_keys(f, modlists))
+        .collect();
+
+    let mut last = Vec::new();
+    for file in planned.iter().rev() {
+        let keys = needed_archive_keys(file, modlists);
+        if keys.iter().any(|key| !remaining.contains(key)) {
+            remaining.extend(keys);
+            last.push(*file);
+        }
+    }
+    last
+}
+
+fn warn_last_copies(file_names: &[String]) {
+    for name in file_names {
+        log::warn!(
+            "!!! Cancelled deletion of {}: it is the last copy of an archive a selected modlist needs !!!",
+            name
+        );
+    }
+    trace_excluded(file_names, "last copy of a needed archive");
+}
+
+/// Cancel plan deletions that would remove the last copy of a needed archive
+///
+/// `mod_files` is everything on disk the plan was built from. Returns the
+/// names of the files taken out of the plan.
+pub fn exclude_last_copies(
+    plan: &mut CleanupPlan,
+    mod_files: &[ModFile],
+    modlists: &[ModlistInfo],
+) -> Vec<String> {
+    let planned: Vec<&ModFile> = plan
+        .orphaned_mods
+        .iter()
+        .map(|m| &m.file)
+        .chain(
+            plan.old_versions
+                .iter()
+                .flat_map(|g| g.files[..g.newest_idx].iter()),
+        )
+        .collect();
+    let keep: HashSet<PathBuf> = last_copies(&planned, mod_files, modlists)
+        .into_iter()
+        .map(|f| f.full_path.clone())
+        .collect();
+    if keep.is_empty() {
+        return Vec::new();
+    }
+
+    let mut excluded = exclude_orphans_in(&mut plan.orphaned_mods, &keep);
+    excluded.extend(keep_group_candidates(&mut plan.old_versions, &keep));
+    update_plan_totals(plan);
+    warn_last_copies(&excluded);
+    excluded
+}
+
+/// Cancel orphan deletions that would remove the last copy of a needed archive
+pub fn exclude_last_copy_orphans(
+    orphans: &mut Vec<OrphanedMod>,
+    mod_files: &[ModFile],
+    modlists: &[ModlistInfo],
+) -> Vec<String> {
+    let planned: Vec<&ModFile> = orphans.iter().map(|m| &m.file).collect();
+    let keep: HashSet<PathBuf> = last_copies(&planned, mod_files, modlists)
+        .into_iter()
+        .map(|f| f.full_path.clone())
+        .collect();
+
+    let excluded = exclude_orphans_in(orphans, &keep);
+    warn_last_copies(&excluded);
+    excluded
+}
+
+/// Cancel old version deletions that would remove the last copy of a needed archive
+///
+/// Only the files in `groups` are known to be on disk, so a copy elsewhere
+/// doesn't count; this errs towards keeping files.
+pub fn exclude_last_copy_groups(
+    groups: &mut Vec<ModGroup>,
+    modlists: &[ModlistInfo],
+) -> Vec<String> {
+    let planned: Vec<&ModFile> = groups
+        .iter()
+        .flat_map(|g| g.files[..g.newest_idx].iter())
+        .collect();
+    let keep: HashSet<PathBuf> = last_copies(
+        &planned,
+        groups.iter().flat_map(|g| g.files.iter()),
+        modlists,
+    )
+    .into_iter()
+    .map(|f| f.full_path.clone())
+    .collect();
+
+    let excluded = keep_group_candidates(groups, &keep);
+    warn_last_copies(&excluded);
+    excluded
+}
+
+/// Keep the plan's old versions whose exact FileID a parsed modlist downloads
+pub fn exclude_required(plan: &mut CleanupPlan, modlists: &[ModlistInfo]) -> Vec<String> {
+    let excluded = exclude_required_groups(&mut plan.old_versions, modlists);
+    update_plan_totals(plan);
+    excluded
+}
+
+/// Keep old versions whose exact FileID a parsed modlist downloads
+///
+/// Unlike [`exclude_last_copy_groups`], every parsed modlist counts, selected
+/// or not, and copies elsewhere don't matter: a modlist that asks for this
+/// exact file would have to download it again. The FileID comes from the
+/// file name, or its `.meta` when the name has none.
+pub fn exclude_required_groups(
+    groups: &mut Vec<ModGroup>,
+    modlists: &[ModlistInfo],
+) -> Vec<String> {
+    let mut required_by: HashMap<&str, &str> = HashMap::new();
+    for modlist in modlists {
+        for key in &modlist.used_mod_file_ids {
+            required_by.entry(key).or_insert(&modlist.name);
+        }
+    }
+    if required_by.is_empty() {
+        return Vec::new();
+    }
+
+    let mut keep = HashSet::new();
+    for file in groups.iter().flat_map(|g| g.files[..g.newest_idx].iter()) {
+        let file_id = file
+            .file_id
+            .clone()
+            .or_else(|| read_meta_for(&file.full_path).and_then(|meta| meta.file_id));
+        let Some(file_id) = file_id else {
+            continue;
+        };
+        let key = format!("{}-{}", file.mod_id, file_id);
+        if let Some(modlist) = required_by.get(key.as_str()) {
+            log::warn!(
+                "Keeping old version {}: modlist '{}' downloads this exact FileID",
+                file.file_name,
+                modlist
+            );
+            keep.insert(file.full_path.clone());
+        }
+    }
+
+    let excluded = keep_group_candidates(groups, &keep);
+    trace_excluded(&excluded, "exact FileID a parsed modlist downloads");
+    excluded
+}
+
+fn exclude_orphans_in(orphans: &mut Vec<OrphanedMod>, keep: &HashSet<PathBuf>) -> Vec<String> {
+    let mut excluded = Vec::new();
+    orphans.retain(|m| {
+        let kept = keep.contains(&m.file.full_path);
+        if kept {
+            excluded.push(m.file.file_name.clone());
+        }
+        !kept
+    });
+    excluded
+}
+
+/// Move the deletion candidates in `keep` to the kept end of their group
+///
+/// Only those files are spared; the rest of the group is still cleaned.
+/// Groups left with nothing to delete are dropped.
+fn keep_group_candidates(groups: &mut Vec<ModGroup>, keep: &HashSet<PathBuf>) -> Vec<String> {
+    let mut excluded = Vec::new();
+    for group in groups.iter_mut() {
+        for i in (0..group.newest_idx).rev() {
+            if keep.contains(&group.files[i].full_path) {
+                let file = group.files.remove(i);
+                group.newest_idx -= 1;
+                group.space_to_free -= file.size;
+                excluded.push(file.file_name.clone());
+                group.files.insert(group.newest_idx, file);
+            }
+        }
+    }
+    groups.retain(|g| g.newest_idx > 0);
+    excluded
+}
+
+/// Check that a file still has the size and modification time seen by the scan
+///
+/// Results may sit on screen for a while before cleanup runs. If Wabbajack
+/// replaced the archive with a new download under the same name meanwhile,
+/// the file on disk is no longer the one the user reviewed. The size of a
+/// multi-part archive is the total of its parts.
+fn verify_unchanged_since_scan(
+    file: &ModFile,
+    parts: &[PathBuf],
+    ops: &dyn FileOps,
+) -> Result<(), String> {
+    let info = ops
+        .metadata(&file.full_path)
+        .map_err(|e| format!("Failed to read file: {:?}: {}", file.full_path, e))?;
+    let mut size = info.size;
+    for part in parts.iter().skip(1) {
+        size += ops
+            .metadata(part)
+            .map_err(|e| format!("Failed to read file: {:?}: {}", part, e))?
+            .size;
+    }
+
+    let size_changed = size != file.size;
+    let time_changed = file.modified.is_some() && info.modified != file.modified;
+    if size_changed || time_changed {
+        log::warn!("{} modified since scan — skipping", file.file_name);
+        return Err(format!(
+            "Modified since scan — skipping: {}",
+            file.file_name
+        ));
+    }
+
+    Ok(())
 }
 
 /// Delete a single mod file and its associated .meta file
-fn delete_mod_file(file: &ModFile, recycle_bin_dir: Option<&Path>) -> Result<u64, String> {
+fn delete_mod_file(
+    file: &ModFile,
+    recycle_bin_dir: Option<&Path>,
+    ops: &dyn FileOps,
+) -> Result<Removal, String> {
+    let result = remove_mod_file(file, recycle_bin_dir, ops);
+    match &result {
+        Ok(_) if recycle_bin_dir.is_some() => trace(&file.file_name, "action", "recycled", ""),
+        Ok(_) => trace(&file.file_name, "action", "deleted", ""),
+        Err(e) => trace(&file.file_name, "action", "not deleted", e),
+    }
+    result
+}
+
+/// What removing one archive did
+#[derive(Debug)]
+struct Removal {
+    size: u64,
+    /// Parts moved into the recycle bin folder, with where each went
+    backed_up: Vec<(PathBuf, PathBuf)>,
+}
+
+fn remove_mod_file(
+    file: &ModFile,
+    recycle_bin_dir: Option<&Path>,
+    ops: &dyn FileOps,
+) -> Result<Removal, String> {
     let path = &file.full_path;
+    let mut backed_up = Vec::new();
 
-    if !path.exists() {
+    if !ops.exists(path) {
         return Err(format!("File no longer exists: {:?}", path));
     }
 
-    if is_file_locked(path) {
-        return Err(format!("File is locked: {:?}", path));
+    // A multi-part archive is only usable whole, so its parts go together
+    let parts = archive_parts_with(path, ops);
+    verify_unchanged_since_scan(file, &parts, ops)?;
+
+    if let Some(reason) = protection_reason_for_with(path, ops) {
+        log::warn!("Keeping {}: {}", file.file_name, reason);
+        return Err(format!("Kept {}: {}", file.file_name, reason));
+    }
+
+    if let Some(locked) = parts.iter().find(|part| ops.is_locked(part)) {
+        return Err(format!("File is locked: {:?}", locked));
     }
 
-    if let Some(recycle_bin) = recycle_bin_dir {
+    if let Some(trash) = recycle_bin_dir.filter(|dir| is_system_trash(dir)) {
+        // The desktop trash records where each file came from
+        move_parts(&parts, |part| ops.trash(part), ops)
+            .map_err(|e| format!("Failed to move file to the trash: {}", e))?;
+
+        for part in &parts {
+            let meta_full = format!("{}.meta", part.display());
+            let meta_path = Path::new(&meta_full);
+            if ops.exists(meta_path) {
+                let _ = ops.trash(meta_path);
+            }
+        }
+
+        log::info!(
+            "Moved to {}: {} ({})",
+            trash.display(),
+            file.file_name,
+            format_size(file.size)
+        );
+    } else if let Some(recycle_bin) = recycle_bin_dir {
         // Move to recycle bin folder
-        let dest_path = recycle_bin.join(&file.file_name);
-        fs::rename(path, &dest_path).map_err(|e| format!("Failed to move file: {}", e))?;
+        let dest_dir = backup_dest_dir(recycle_bin, &parts, ops);
+        if dest_dir != recycle_bin {
+            ops.create_dir_all(&dest_dir)
+                .map_err(|e| format!("Failed to create {:?}: {}", dest_dir, e))?;
+        }
+        let moved = move_parts(
+            &parts,
+            |part| {
+                let dest_path = dest_dir.join(part.file_name().unwrap_or_default());
+                move_file_with(ops, part, &dest_path).map(|_| dest_path)
+            },
+            ops,
+        )
+        .map_err(|e| format!("Failed to move file: {}", e))?;
+        backed_up = parts.iter().cloned().zip(moved).collect();
 
-        // Also move .meta file if exists
-        let meta_full = format!("{}.meta", path.display());
-        let meta_path = Path::new(&meta_full);
+        // Also move .meta files if they exist
+        for part in &parts {
+            let meta_full = format!("{}.meta", part.display());
+            let meta_path = Path::new(&meta_full);
 
-        if meta_path.exists() {
-            let dest_meta = recycle_bin.join(format!("{}.meta", file.file_name));
-            let _ = fs::rename(meta_path, dest_meta);
+            if ops.exists(meta_path) {
+                let meta_name = meta_path.file_name().unwrap_or_default();
+                let _ = move_file_with(ops, meta_path, &dest_dir.join(meta_name));
+            }
         }
 
         log::info!(
@@ -52,41 +1061,189 @@ fn delete_mod_file(file: &ModFile, recycle_bin_dir: Option<&Path>) -> Result<u64
             format_size(file.size)
         );
     } else {
-        // Permanently delete
-        fs::remove_file(path).map_err(|e| format!("Failed to delete file: {}", e))?;
+        // Permanently delete, setting every part aside first so a failure
+        // leaves the set complete
+        let staged = move_parts(
+            &parts,
+            |part| {
+                let staged_path = PathBuf::from(format!("{}.wlc-delete", part.display()));
+                ops.rename(part, &staged_path).map(|_| staged_path)
+            },
+            ops,
+        )
+        .map_err(|e| format!("Failed to delete file: {}", e))?;
+        let leftover: Vec<String> = staged
+            .iter()
+            .filter_map(|staged_path| {
+                ops.remove_file(staged_path)
+                    .err()
+                    .map(|e| format!("{:?} ({})", staged_path, e))
+            })
+            .collect();
 
-        // Also delete .meta file if exists
-        let meta_full = format!("{}.meta", path.display());
-        let meta_path = Path::new(&meta_full);
-        if meta_path.exists() {
-            let _ = fs::remove_file(meta_path);
+        // Also delete .meta files if they exist
+        for part in &parts {
+            let meta_full = format!("{}.meta", part.display());
+            let meta_path = Path::new(&meta_full);
+            if ops.exists(meta_path) {
+                let _ = ops.remove_file(meta_path);
+            }
         }
 
+        if !leftover.is_empty() {
+            return Err(format!(
+                "Failed to delete, left behind: {}",
+                leftover.join(", ")
+            ));
+        }
         log::info!("Deleted: {} ({})", file.file_name, format_size(file.size));
     }
 
-    Ok(file.size)
+    Ok(Removal {
+        size: file.size,
+        backed_up,
+    })
+}
+
+/// Folder in the recycle bin for `files`, so nothing already there is overwritten
+///
+/// Archives in different game folders can share a name, and a folder reused
+/// across cleanups still holds earlier ones. On a clash the files go to the
+/// first numbered subfolder where neither they nor their `.meta` files exist.
+fn backup_dest_dir(recycle_bin: &Path, files: &[PathBuf], ops: &dyn FileOps) -> PathBuf {
+    let taken = |dir: &Path| {
+        files.iter().filter_map(|f| f.file_name()).any(|name| {
+            let meta = format!("{}.meta", name.to_string_lossy());
+            ops.exists(&dir.join(name)) || ops.exists(&dir.join(meta))
+        })
+    };
+    if !taken(recycle_bin) {
+        return recycle_bin.to_path_buf();
+    }
+    (2..)
+        .map(|n: u32| recycle_bin.join(n.to_string()))
+        .find(|dir| !taken(dir))
+        .unwrap_or_else(|| recycle_bin.to_path_buf())
+}
+
+/// Move every part of an archive, or none of them
+///
+/// `move_part` moves one file and returns where it went. If a part fails,
+/// the parts already moved are put back.
+fn move_parts(
+    parts: &[PathBuf],
+    move_part: impl Fn(&Path) -> io::Result<PathBuf>,
+    ops: &dyn FileOps,
+) -> io::Result<Vec<PathBuf>> {
+    let mut moved = Vec::new();
+    for part in parts {
+        match move_part(part) {
+            Ok(dest) => moved.push(dest),
+            Err(e) => {
+                for (dest, original) in moved.iter().zip(parts) {
+                    if let Err(undo) = move_file_with(ops, dest, original) {
+                        log::error!("Failed to put back {:?}: {}", original, undo);
+                    }
+                }
+                return Err(e);
+            }
+        }
+    }
+    Ok(moved)
+}
+
+/// Create the recycle bin directory if one is used
+///
+/// Returns false, with the error recorded in `result`, if it can't be created.
+fn prepare_recycle_bin(
+    safe_mode: bool,
+    recycle_bin_dir: Option<&Path>,
+    result: &mut DeletionResult,
+    ops: &dyn FileOps,
+) -> bool {
+    if let Err(e) = require_backup(safe_mode, recycle_bin_dir) {
+        log::error!("{}", e);
+        result.errors.push(e);
+        return false;
+    }
+    if let Some(recycle_bin) = recycle_bin_dir {
+        if let Err(e) = ops.create_dir_all(recycle_bin) {
+            result
+                .errors
+                .push(format!("Failed to create Recycle Bin folder: {}", e));
+            return false;
+        }
+        result.recycle_bin_path = Some(recycle_bin.to_path_buf());
+        log::info!("Created Recycle Bin folder: {:?}", recycle_bin);
+    }
+    true
+}
+
+/// Record where each moved file came from so the recycle bin folder can be restored
+fn record_backup_manifest(
+    recycle_bin_dir: Option<&Path>,
+    result: &mut DeletionResult,
+    ops: &dyn FileOps,
+) {
+    let Some(recycle_bin) = recycle_bin_dir.filter(|dir| !is_system_trash(dir)) else {
+        return;
+    };
+    if result.backed_up.is_empty() || ops.is_simulated() {
+        return;
+    }
+    if let Err(e) = save_backup_manifest(recycle_bin, &result.backed_up) {
+        result
+            .errors
+            .push(format!("Failed to write restore manifest: {:#}", e));
+    }
+}
+
+/// Record a removed file in the totals and the list of moved files
+fn record_removal(result: &mut DeletionResult, file: &ModFile, removal: Removal) {
+    result.deleted_count += 1;
+    result.space_freed += removal.size;
+    result.removed.push((file.full_path.clone(), removal.size));
+    result.backed_up.extend(removal.backed_up);
+}
+
+/// Record a file that couldn't be deleted so the summary can list it
+fn record_failure(result: &mut DeletionResult, file: &ModFile, error: String) {
+    log::error!("Failed to delete {:?}: {}", file.full_path, error);
+    result.skipped.push(file.file_name.clone());
+    result.failed.push((file.full_path.clone(), error));
 }
 
 /// Delete orphaned mods
+///
+/// With `safe_mode` on nothing is deleted without a recycle bin folder.
 pub fn delete_orphaned_mods(
     orphaned_mods: &[OrphanedMod],
+    safe_mode: bool,
+    recycle_bin_dir: Option<&Path>,
+    progress_callback: Option<&dyn Fn(usize, usize)>,
+) -> DeletionResult {
+    delete_orphaned_mods_with(
+        orphaned_mods,
+        safe_mode,
+        recycle_bin_dir,
+        progress_callback,
+        &RealFileOps,
+    )
+}
+
+/// Delete orphaned mods, making file system changes through `ops`
+pub fn delete_orphaned_mods_with(
+    orphaned_mods: &[OrphanedMod],
+    safe_mode: bool,
     recycle_bin_dir: Option<&Path>,
     progress_callback: Option<&dyn Fn(usize, usize)>,
+    ops: &dyn FileOps,
 ) -> DeletionResult {
     let mut result = DeletionResult::default();
     let total = orphaned_mods.len();
 
-    // Create recycle bin directory if specified
-    if let Some(recycle_bin) = recycle_bin_dir {
-        if let Err(e) = fs::create_dir_all(recycle_bin) {
-            result
-                .errors
-                .push(format!("Failed to create Recycle Bin folder: {}", e));
-            return result;
-        }
-        result.recycle_bin_path = Some(recycle_bin.to_path_buf());
-        log::info!("Created Recycle Bin folder: {:?}", recycle_bin);
+    if !prepare_recycle_bin(safe_mode, recycle_bin_dir, &mut result, ops) {
+        return result;
     }
 
     for (i, orphaned) in orphaned_mods.iter().enumerate() {
@@ -94,26 +1251,41 @@ pub fn delete_orphaned_mods(
             cb(i + 1, total);
         }
 
-        match delete_mod_file(&orphaned.file, recycle_bin_dir) {
-            Ok(size) => {
-                result.deleted_count += 1;
-                result.space_freed += size;
-            }
-            Err(e) => {
-                result.skipped.push(orphaned.file.file_name.clone());
-                result.errors.push(e);
-            }
+        match delete_mod_file(&orphaned.file, recycle_bin_dir, ops) {
+            Ok(removal) => record_removal(&mut result, &orphaned.file, removal),
+            Err(e) => record_failure(&mut result, &orphaned.file, e),
         }
     }
 
+    record_backup_manifest(recycle_bin_dir, &mut result, ops);
     result
 }
 
 /// Delete old versions from mod groups
+///
+/// With `safe_mode` on nothing is deleted without a recycle bin folder.
 pub fn delete_old_versions(
     duplicates: &[ModGroup],
+    safe_mode: bool,
+    recycle_bin_dir: Option<&Path>,
+    progress_callback: Option<&dyn Fn(usize, usize)>,
+) -> DeletionResult {
+    delete_old_versions_with(
+        duplicates,
+        safe_mode,
+        recycle_bin_dir,
+        progress_callback,
+        &RealFileOps,
+    )
+}
+
+/// Delete old versions, making file system changes through `ops`
+pub fn delete_old_versions_with(
+    duplicates: &[ModGroup],
+    safe_mode: bool,
     recycle_bin_dir: Option<&Path>,
     progress_callback: Option<&dyn Fn(usize, usize)>,
+    ops: &dyn FileOps,
 ) -> DeletionResult {
     let mut result = DeletionResult::default();
 
@@ -125,16 +1297,8 @@ pub fn delete_old_versions(
 
     let total = files_to_delete.len();
 
-    // Create recycle bin directory if specified
-    if let Some(recycle_bin) = recycle_bin_dir {
-        if let Err(e) = fs::create_dir_all(recycle_bin) {
-            result
-                .errors
-                .push(format!("Failed to create Recycle Bin folder: {}", e));
-            return result;
-        }
-        result.recycle_bin_path = Some(recycle_bin.to_path_buf());
-        log::info!("Created Recycle Bin folder: {:?}", recycle_bin);
+    if !prepare_recycle_bin(safe_mode, recycle_bin_dir, &mut result, ops) {
+        return result;
     }
 
     for (i, file) in files_to_delete.iter().enumerate() {
@@ -143,31 +1307,172 @@ pub fn delete_old_versions(
         }
 
         // Validate before deletion
-        if !validate_deletion_safety(duplicates, file) {
-            result.skipped.push(file.file_name.clone());
-            result
-                .errors
-                .push(format!("Safety check failed for: {}", file.file_name));
+        if !validate_deletion_safety(duplicates, file, ops) {
+            record_failure(&mut result, file, "Safety check failed".to_string());
+            continue;
+        }
+
+        match delete_mod_file(file, recycle_bin_dir, ops) {
+            Ok(removal) => record_removal(&mut result, file, removal),
+            Err(e) => record_failure(&mut result, file, e),
+        }
+    }
+
+    record_kept_files(duplicates, &mut result);
+    record_backup_manifest(recycle_bin_dir, &mut result, ops);
+    result
+}
+
+/// Delete `.meta` files whose archive is gone
+///
+/// They go to the recycle bin folder or the system trash like archives do,
+/// and with `safe_mode` on nowhere else.
+pub fn delete_meta_files(
+    meta_files: &[PathBuf],
+    safe_mode: bool,
+    recycle_bin_dir: Option<&Path>,
+) -> DeletionResult {
+    delete_meta_files_with(meta_files, safe_mode, recycle_bin_dir, &RealFileOps)
+}
+
+/// Delete orphaned `.meta` files, making file system changes through `ops`
+pub fn delete_meta_files_with(
+    meta_files: &[PathBuf],
+    safe_mode: bool,
+    recycle_bin_dir: Option<&Path>,
+    ops: &dyn FileOps,
+) -> DeletionResult {
+    let mut result = DeletionResult::default();
+    if !prepare_recycle_bin(safe_mode, recycle_bin_dir, &mut result, ops) {
+        return result;
+    }
+
+    for path in meta_files {
+        let name = path
+            .file_name()
+            .unwrap_or_default()
+            .to_string_lossy()
+            .to_string();
+        let size = ops.metadata(path).map(|info| info.size).unwrap_or(0);
+        let removed = match recycle_bin_dir {
+            Some(trash) if is_system_trash(trash) => ops.trash(path).map(|_| None),
+            Some(recycle_bin) => {
+                let dest =
+                    backup_dest_dir(recycle_bin, std::slice::from_ref(path), ops).join(&name);
+                dest.parent()
+                    .map_or(Ok(()), |dir| ops.create_dir_all(dir))
+                    .and_then(|_| move_file_with(ops, path, &dest))
+                    .map(|_| Some(dest))
+            }
+            None => ops.remove_file(path).map(|_| None),
+        };
+        match removed {
+            Ok(dest) => {
+                trace(&name, "action", "removed orphaned .meta", "");
+                result.deleted_count += 1;
+                result.space_freed += size;
+                result.removed.push((path.clone(), size));
+                result
+                    .backed_up
+                    .extend(dest.map(|dest| (path.clone(), dest)));
+            }
+            Err(e) => {
+                log::error!("Failed to remove {:?}: {}", path, e);
+                result.skipped.push(name);
+                result.failed.push((path.clone(), e.to_string()));
+            }
+        }
+    }
+
+    record_backup_manifest(recycle_bin_dir, &mut result, ops);
+    result
+}
+
+/// Record the files each group keeps, for groups that lost a file
+fn record_kept_files(groups: &[ModGroup], result: &mut DeletionResult) {
+    for group in groups {
+        let removed_any = group.files[..group.newest_idx]
+            .iter()
+            .any(|f| result.removed.iter().any(|(path, _)| *path == f.full_path));
+        if removed_any {
+            result.kept.push((
+                group.mod_key.clone(),
+                group.files[group.newest_idx..]
+                    .iter()
+                    .map(|f| f.full_path.clone())
+                    .collect(),
+            ));
+        }
+    }
+}
+
+/// Execute a combined cleanup plan into a single recycle bin folder
+///
+/// Orphaned mods are removed first, then old versions of the used mods.
+/// With `safe_mode` on nothing is deleted without a recycle bin folder.
+pub fn delete_cleanup_plan(
+    plan: &CleanupPlan,
+    safe_mode: bool,
+    recycle_bin_dir: Option<&Path>,
+    progress_callback: Option<&dyn Fn(usize, usize)>,
+) -> DeletionResult {
+    delete_cleanup_plan_with(
+        plan,
+        safe_mode,
+        recycle_bin_dir,
+        progress_callback,
+        &RealFileOps,
+    )
+}
+
+/// Execute a combined cleanup plan, making file system changes through `ops`
+pub fn delete_cleanup_plan_with(
+    plan: &CleanupPlan,
+    safe_mode: bool,
+    recycle_bin_dir: Option<&Path>,
+    progress_callback: Option<&dyn Fn(usize, usize)>,
+    ops: &dyn FileOps,
+) -> DeletionResult {
+    let mut result = DeletionResult::default();
+
+    let old_files: Vec<&ModFile> = plan
+        .old_versions
+        .iter()
+        .flat_map(|group| group.files[..group.newest_idx].iter())
+        .collect();
+
+    let total = plan.orphaned_mods.len() + old_files.len();
+
+    if !prepare_recycle_bin(safe_mode, recycle_bin_dir, &mut result, ops) {
+        return result;
+    }
+
+    let orphaned = plan.orphaned_mods.iter().map(|o| (&o.file, false));
+    let old = old_files.into_iter().map(|f| (f, true));
+
+    for (i, (file, is_old_version)) in orphaned.chain(old).enumerate() {
+        if let Some(cb) = progress_callback {
+            cb(i + 1, total);
+        }
+
+        if is_old_version && !validate_deletion_safety(&plan.old_versions, file, ops) {
+            record_failure(&mut result, file, "Safety check failed".to_string());
             continue;
         }
 
-        match delete_mod_file(file, recycle_bin_dir) {
-            Ok(size) => {
-                result.deleted_count += 1;
-                result.space_freed += size;
-            }
-            Err(e) => {
-                result.skipped.push(file.file_name.clone());
-                result.errors.push(e);
-            }
+        match delete_mod_file(file, recycle_bin_dir, ops) {
+            Ok(removal) => record_removal(&mut result, file, removal),
+            Err(e) => record_failure(&mut result, file, e),
         }
     }
 
+    record_kept_files(&plan.old_versions, &mut result);
+    record_backup_manifest(recycle_bin_dir, &mut result, ops);
     result
 }
 
-/// Validate that we're not deleting the newest file in a group
-fn validate_deletion_safety(duplicates: &[ModGroup], file: &ModFile) -> bool {
+/// Validate that we're not deleting a file the group keeps
+fn validate_deletion_safety(duplicates: &[ModGroup], file: &ModFile, ops: &dyn FileOps) -> bool {
     for group in duplicates {
         if group.files.len() <= 1 {
             continue;
@@ -180,9 +1485,9 @@ fn validate_deletion_safety(duplicates: &[ModGroup], file: &ModFile) -> bool {
             .position(|f| f.full_path == file.full_path);
 
         if let Some(idx) = file_idx {
-            // Make sure we're not deleting the newest file (newest_idx points to the file to keep)
+            // Make sure we're not deleting a kept file (newest_idx points to the oldest file to keep)
             // idx < newest_idx means file is older and safe to delete
-            // idx >= newest_idx means file is the newest (or beyond, which shouldn't happen)
+            // idx >= newest_idx means file is one of the kept newest files
             if idx >= group.newest_idx {
                 log::error!(
                     "Safety check failed: Attempting to delete newest file in group {}",
@@ -193,10 +1498,21 @@ fn validate_deletion_safety(duplicates: &[ModGroup], file: &ModFile) -> bool {
 
             // Verify newest still exists
             let newest = &group.files[group.newest_idx];
-            if !newest.full_path.exists() {
+            if !ops.exists(&newest.full_path) {
                 log::error!("Newest file doesn't exist: {:?}", newest.full_path);
                 return false;
             }
+
+            // Never throw away older copies in favour of a corrupt download
+            if let Some(latest) = group.files.last() {
+                if !is_valid_archive_with(&latest.full_path, ops) {
+                    log::error!(
+                        "Safety check failed: Newest file in group {} is not a valid archive",
+                        group.mod_key
+                    );
+                    return false;
+                }
+            }
         }
     }
 
@@ -227,7 +1543,6 @@ pub fn format_size(bytes: u64) -> String {
 }
 
 /// Convert timestamp to human-readable date
-#[allow(dead_code)]
 pub fn timestamp_to_date(timestamp: &str) -> String {
     timestamp
         .parse::<i64>()
@@ -240,6 +1555,8 @@ pub fn timestamp_to_date(timestamp: &str) -> String {
 #[cfg(test)]
 mod tests {
     use super::*;
+    use crate::core::fsops::{FileOp, MemoryFileOps, SimulatedFileOps};
+    use crate::core::types::modified_secs;
     use std::io::Write;
     use tempfile::tempdir;
 
@@ -272,6 +1589,80 @@ mod tests {
         assert!(!is_file_locked(&file_path));
     }
 
+    #[test]
+    fn test_is_valid_archive() {
+        let dir = tempdir().unwrap();
+
+        let zip_path = dir.path().join("good.zip");
+        let mut zip = zip::ZipWriter::new(fs::File::create(&zip_path).unwrap());
+        zip.start_file("readme.txt", zip::write::SimpleFileOptions::default())
+            .unwrap();
+        zip.write_all(b"hello").unwrap();
+        zip.finish().unwrap();
+        assert!(is_valid_archive(&zip_path));
+
+        // Truncated download: the central directory is missing
+        let bytes = fs::read(&zip_path).unwrap();
+        let truncated = dir.path().join("truncated.zip");
+        fs::write(&truncated, &bytes[..bytes.len() / 2]).unwrap();
+        assert!(!is_valid_archive(&truncated));
+
+        let seven_zip = dir.path().join("good.7z");
+        fs::write(&seven_zip, [SEVEN_ZIP_MAGIC, b"rest"].concat()).unwrap();
+        assert!(is_valid_archive(&seven_zip));
+
+        let rar = dir.path().join("bad.rar");
+        fs::write(&rar, b"not a rar").unwrap();
+        assert!(!is_valid_archive(&rar));
+
+        let empty = dir.path().join("empty.7z");
+        fs::write(&empty, b"").unwrap();
+        assert!(!is_valid_archive(&empty));
+    }
+
+    #[test]
+    fn test_delete_keeps_old_versions_when_newest_is_corrupt() {
+        let dir = tempdir().unwrap();
+        let make = |name: &str, content: &[u8]| {
+            let path = dir.path().join(name);
+            fs::write(&path, content).unwrap();
+            ModFile {
+                file_name: name.to_string(),
+                full_path: path,
+                mod_name: "test".to_string(),
+                mod_id: "123".to_string(),
+                file_id: None,
+                version: "1-0".to_string(),
+                timestamp: "1234567890".to_string(),
+                size: content.len() as u64,
+                is_patch: false,
+                modified: None,
+            }
+        };
+
+        let group = ModGroup {
+            mod_key: "123:test".to_string(),
+            files: vec![
+                make("test-123-1-0-1.7z", SEVEN_ZIP_MAGIC),
+                make("test-123-2-0-2.7z", b""),
+            ],
+            newest_idx: 1,
+            space_to_free: 6,
+        };
+
+        let result = delete_old_versions(&[group], false, None, None);
+        assert_eq!(result.deleted_count, 0);
+        assert_eq!(result.skipped, vec!["test-123-1-0-1.7z".to_string()]);
+        assert_eq!(
+            result.failed,
+            vec![(
+                dir.path().join("test-123-1-0-1.7z"),
+                "Safety check failed".to_string()
+            )]
+        );
+        assert!(dir.path().join("test-123-1-0-1.7z").exists());
+    }
+
     #[test]
     fn test_delete_mod_file_permanent() {
         let dir = tempdir().unwrap();
@@ -291,9 +1682,10 @@ mod tests {
             timestamp: "1234567890".to_string(),
             size: 12,
             is_patch: false,
+            modified: None,
         };
 
-        let result = delete_mod_file(&mod_file, None);
+        let result = delete_mod_file(&mod_file, None, &RealFileOps);
         assert!(result.is_ok());
         assert!(!file_path.exists());
     }
@@ -320,11 +1712,779 @@ mod tests {
             timestamp: "1234567890".to_string(),
             size: 12,
             is_patch: false,
+            modified: None,
         };
 
-        let result = delete_mod_file(&mod_file, Some(&recycle_bin_dir));
+        let result = delete_mod_file(&mod_file, Some(&recycle_bin_dir), &RealFileOps);
         assert!(result.is_ok());
         assert!(!file_path.exists());
         assert!(recycle_bin_dir.join("test-123-1-0-1234567890.7z").exists());
     }
+
+    #[test]
+    fn test_require_backup() {
+        let dir = tempdir().unwrap();
+        assert!(require_backup(true, Some(dir.path())).is_ok());
+        assert!(require_backup(true, None).is_err());
+        assert!(require_backup(false, None).is_ok());
+
+        // Every delete function checks it before touching a file
+        let mut result = DeletionResult::default();
+        assert!(!prepare_recycle_bin(
+            true,
+            None,
+            &mut result,
+            &SimulatedFileOps::new()
+        ));
+        assert_eq!(result.errors.len(), 1);
+        assert!(prepare_recycle_bin(
+            false,
+            None,
+            &mut result,
+            &SimulatedFileOps::new()
+        ));
+        let result = delete_meta_files_with(
+            &[dir.path().join("a.7z.meta")],
+            true,
+            None,
+            &SimulatedFileOps::new(),
+        );
+        assert_eq!(result.deleted_count, 0);
+        assert_eq!(result.errors.len(), 1);
+    }
+
+    #[test]
+    fn test_check_write_access() {
+        let dir = tempdir().unwrap();
+        assert!(check_write_access(dir.path()).is_ok());
+        // Probe file must not be left behind
+        assert_eq!(fs::read_dir(dir.path()).unwrap().count(), 0);
+
+        let missing = dir.path().join("missing");
+        assert!(check_write_access(&missing).is_err());
+        assert_eq!(check_cleanup_permissions(&missing).len(), 1);
+    }
+
+    #[test]
+    fn test_delete_cleanup_plan() {
+        let dir = tempdir().unwrap();
+        let recycle_bin_dir = dir.path().join("recycle_bin");
+
+        let make = |name: &str| {
+            let path = dir.path().join(name);
+            fs::write(&path, SEVEN_ZIP_MAGIC).unwrap();
+            ModFile {
+                file_name: name.to_string(),
+                full_path: path,
+                mod_name: "test".to_string(),
+                mod_id: "123".to_string(),
+                file_id: None,
+                version: "1-0".to_string(),
+                timestamp: "1234567890".to_string(),
+                size: SEVEN_ZIP_MAGIC.len() as u64,
+                is_patch: false,
+                modified: None,
+            }
+        };
+
+        let plan = CleanupPlan {
+            orphaned_mods: vec![OrphanedMod {
+                file: make("orphan-1-1-0-1.7z"),
+            }],
+            old_versions: vec![ModGroup {
+                mod_key: "123:test".to_string(),
+                files: vec![make("test-123-1-0-1.7z"), make("test-123-2-0-2.7z")],
+                newest_idx: 1,
+                space_to_free: 4,
+            }],
+            keep_versions: 1,
+            orphaned_size: 4,
+            old_version_files: 1,
+            old_version_size: 4,
+            target: None,
+        };
+
+        let result = delete_cleanup_plan(&plan, false, Some(&recycle_bin_dir), None);
+        assert_eq!(result.deleted_count, 2);
+        assert!(!result.has_failures());
+        assert!(recycle_bin_dir.join("orphan-1-1-0-1.7z").exists());
+        assert!(recycle_bin_dir.join("test-123-1-0-1.7z").exists());
+        assert!(dir.path().join("test-123-2-0-2.7z").exists());
+
+        let manifest = crate::core::restore::BackupManifest::load(&recycle_bin_dir).unwrap();
+        assert_eq!(
+            manifest.files.get("orphan-1-1-0-1.7z"),
+            Some(&dir.path().join("orphan-1-1-0-1.7z"))
+        );
+    }
+
+    #[test]
+    fn test_exclude_read_only() {
+        let file_in = |dir: &str, name: &str| ModFile {
+            file_name: name.to_string(),
+            full_path: PathBuf::from(dir).join(name),
+            mod_name: "test".to_string(),
+            mod_id: "123".to_string(),
+            file_id: None,
+            version: "1-0".to_string(),
+            timestamp: "1234567890".to_string(),
+            size: 10,
+            is_patch: false,
+            modified: None,
+        };
+
+        let mut plan = CleanupPlan {
+            orphaned_mods: vec![
+                OrphanedMod {
+                    file: file_in("/dl/Skyrim", "a.7z"),
+                },
+                OrphanedMod {
+                    file: file_in("/dl/Unknown", "b.7z"),
+                },
+                OrphanedMod {
+                    file: file_in("/dl/Unknown/Author", "e.7z"),
+                },
+            ],
+            old_versions: vec![ModGroup {
+                mod_key: "123:test".to_string(),
+                files: vec![
+                    file_in("/dl/Unknown", "c.7z"),
+                    file_in("/dl/Unknown", "d.7z"),
+                ],
+                newest_idx: 1,
+                space_to_free: 10,
+            }],
+            keep_versions: 1,
+            orphaned_size: 20,
+            old_version_files: 1,
+            old_version_size: 10,
+            target: None,
+        };
+
+        let game_folders = [PathBuf::from("/dl/Skyrim"), PathBuf::from("/dl/Unknown")];
+        let excluded = exclude_read_only(&mut plan, &[PathBuf::from("/dl/Unknown")], &game_folders);
+        // Files in a read-only folder's subfolders are protected too
+        assert_eq!(excluded, vec!["b.7z", "e.7z", "c.7z"]);
+        assert_eq!(plan.total_files(), 1);
+        assert_eq!(plan.total_size(), 10);
+    }
+
+    #[test]
+    fn test_exclude_last_copies() {
+        let file = |name: &str, file_id: Option<&str>| ModFile {
+            file_name: name.to_string(),
+            full_path: PathBuf::from("/dl/Skyrim").join(name),
+            mod_name: "test".to_string(),
+            mod_id: "123".to_string(),
+            file_id: file_id.map(str::to_string),
+            version: "1-0".to_string(),
+            timestamp: "1234567890".to_string(),
+            size: 10,
+            is_patch: false,
+            modified: None,
+        };
+        let modlist = ModlistInfo {
+            name: "List".to_string(),
+            used_file_names: ["b.7z".to_string()].into(),
+            used_mod_file_ids: ["123-77".to_string()].into(),
+            ..Default::default()
+        };
+
+        // A grouping bug marked the needed b.7z for deletion; a renamed copy
+        // of FileID 77 is the only file providing it
+        let mut plan = CleanupPlan {
+            orphaned_mods: vec![
+                OrphanedMod {
+                    file: file("renamed.7z", Some("77")),
+                },
+                OrphanedMod {
+                    file: file("unused.7z", None),
+                },
+            ],
+            old_versions: vec![ModGroup {
+                mod_key: "123:test".to_string(),
+                files: vec![file("a.7z", None), file("b.7z", None), file("c.7z", None)],
+                newest_idx: 2,
+                space_to_free: 20,
+            }],
+            keep_versions: 1,
+            orphaned_size: 20,
+            old_version_files: 2,
+            old_version_size: 20,
+            target: None,
+        };
+        let on_disk: Vec<ModFile> = plan
+            .orphaned_mods
+            .iter()
+            .map(|m| m.file.clone())
+            .chain(plan.old_versions[0].files.iter().cloned())
+            .collect();
+
+        let excluded = exclude_last_copies(&mut plan, &on_disk, &[modlist.clone()]);
+        assert_eq!(excluded, vec!["renamed.7z", "b.7z"]);
+        assert_eq!(plan.orphaned_mods.len(), 1);
+        assert_eq!(plan.old_versions[0].newest_idx, 1);
+        assert_eq!(plan.old_versions[0].files[0].file_name, "a.7z");
+        assert_eq!(plan.total_files(), 2);
+        assert_eq!(plan.total_size(), 20);
+
+        // A second copy of b.7z elsewhere lets the planned one go
+        let mut groups = vec![ModGroup {
+            mod_key: "123:test".to_string(),
+            files: vec![file("b.7z", None), file("c.7z", None)],
+            newest_idx: 1,
+            space_to_free: 10,
+        }];
+        assert_eq!(
+            exclude_last_copy_groups(&mut groups, &[modlist.clone()]),
+            vec!["b.7z"]
+        );
+        assert!(groups.is_empty());
+
+        let mut copy = file("b.7z", None);
+        copy.full_path = PathBuf::from("/dl/Other/b.7z");
+        let mut orphans = vec![OrphanedMod {
+            file: file("b.7z", None),
+        }];
+        let on_disk = vec![orphans[0].file.clone(), copy];
+        assert!(exclude_last_copy_orphans(&mut orphans, &on_disk, &[modlist]).is_empty());
+        assert_eq!(orphans.len(), 1);
+    }
+
+    #[test]
+    fn test_exclude_required_groups() {
+        let file = |name: &str, file_id: Option<&str>| ModFile {
+            file_name: name.to_string(),
+            full_path: PathBuf::from("/dl/Skyrim").join(name),
+            mod_name: "test".to_string(),
+            mod_id: "123".to_string(),
+            file_id: file_id.map(str::to_string),
+            version: "1-0".to_string(),
+            timestamp: "1234567890".to_string(),
+            size: 10,
+            is_patch: false,
+            modified: None,
+        };
+        let unselected = ModlistInfo {
+            name: "Old List".to_string(),
+            used_mod_file_ids: ["123-77".to_string()].into(),
+            ..Default::default()
+        };
+        let mut groups = vec![ModGroup {
+            mod_key: "123:test".to_string(),
+            files: vec![
+                file("a.7z", Some("76")),
+                file("b.7z", Some("77")),
+                file("c.7z", Some("78")),
+            ],
+            newest_idx: 2,
+            space_to_free: 20,
+        }];
+
+        let excluded = exclude_required_groups(&mut groups, &[unselected]);
+        assert_eq!(excluded, vec!["b.7z"]);
+        assert_eq!(groups[0].newest_idx, 1);
+        assert_eq!(groups[0].files[0].file_name, "a.7z");
+        assert_eq!(groups[0].space_to_free, 10);
+
+        assert!(exclude_required_groups(&mut groups, &[]).is_empty());
+    }
+
+    #[test]
+    fn test_accessed_within() {
+        let dir = tempdir().unwrap();
+        let file_path = dir.path().join("test-123-1-0-1234567890.7z");
+        fs::write(&file_path, b"data").unwrap();
+        let mut mod_file = ModFile {
+            file_name: "test-123-1-0-1234567890.7z".to_string(),
+            full_path: file_path,
+            mod_name: "test".to_string(),
+            mod_id: "123".to_string(),
+            file_id: None,
+            version: "1-0".to_string(),
+            timestamp: "1234567890".to_string(),
+            size: 4,
+            is_patch: false,
+            modified: None,
+        };
+
+        let now = SystemTime::now();
+        let later = now + Duration::from_secs(30 * 24 * 60 * 60);
+        assert!(accessed_within(&mod_file, 7, now));
+        assert!(!accessed_within(&mod_file, 7, later));
+        assert!(!accessed_within(&mod_file, 0, now));
+
+        // Missing access times never protect a file
+        mod_file.full_path = dir.path().join("missing.7z");
+        assert!(!accessed_within(&mod_file, 7, now));
+    }
+
+    #[test]
+    fn test_modified_within() {
+        let dir = tempdir().unwrap();
+        let file_path = dir.path().join("test-123-1-0-1234567890.7z");
+        fs::write(&file_path, b"data").unwrap();
+        let mut mod_file = ModFile {
+            file_name: "test-123-1-0-1234567890.7z".to_string(),
+            full_path: file_path,
+            mod_name: "test".to_string(),
+            mod_id: "123".to_string(),
+            file_id: None,
+            version: "1-0".to_string(),
+            timestamp: "1234567890".to_string(),
+            size: 4,
+            is_patch: false,
+            modified: None,
+        };
+
+        let now = SystemTime::now();
+        assert!(modified_within(&mod_file, 10, now));
+        assert!(!modified_within(
+            &mod_file,
+            10,
+            now + Duration::from_secs(11 * 60)
+        ));
+        assert!(!modified_within(&mod_file, 0, now));
+
+        // The scan's modification time wins over the file's
+        mod_file.modified = Some(1_000_000);
+        assert!(!modified_within(&mod_file, 10, now));
+
+        let mut orphans = vec![OrphanedMod {
+            file: ModFile {
+                modified: None,
+                ..mod_file.clone()
+            },
+        }];
+        assert_eq!(exclude_in_use_orphans(&mut orphans, 10).len(), 1);
+        assert!(orphans.is_empty());
+    }
+
+    #[test]
+    fn test_exclude_unchecked_orphans() {
+        let orphan = |name: &str| OrphanedMod {
+            file: ModFile {
+                full_path: PathBuf::from("downloads").join(name),
+                ..crate::core::parser::parse_mod_filename(name).unwrap()
+            },
+        };
+        let mut orphans = vec![
+            orphan("KeptMod-123-1-0-1600000000.7z"),
+            orphan("GoneMod-456-1-0-1600000000.7z"),
+        ];
+        let unchecked =
+            HashSet::from([PathBuf::from("downloads").join("KeptMod-123-1-0-1600000000.7z")]);
+
+        assert_eq!(
+            exclude_unchecked_orphans(&mut orphans, &unchecked),
+            vec!["KeptMod-123-1-0-1600000000.7z".to_string()]
+        );
+        assert_eq!(orphans.len(), 1);
+        assert_eq!(orphans[0].file.file_name, "GoneMod-456-1-0-1600000000.7z");
+    }
+
+    #[test]
+    fn test_delete_skips_file_modified_since_scan() {
+        let dir = tempdir().unwrap();
+        let file_path = dir.path().join("test-123-1-0-1234567890.7z");
+        fs::write(&file_path, b"old download").unwrap();
+        let metadata = fs::metadata(&file_path).unwrap();
+
+        let mod_file = ModFile {
+            file_name: "test-123-1-0-1234567890.7z".to_string(),
+            full_path: file_path.clone(),
+            mod_name: "test".to_string(),
+            mod_id: "123".to_string(),
+            file_id: None,
+            version: "1-0".to_string(),
+            timestamp: "1234567890".to_string(),
+            size: metadata.len(),
+            is_patch: false,
+            modified: modified_secs(&metadata),
+        };
+
+        // A new download replaced the file under the same name
+        fs::write(&file_path, b"new download, larger").unwrap();
+
+        let err = delete_mod_file(&mod_file, None, &RealFileOps).unwrap_err();
+        assert!(err.contains("Modified since scan"));
+        assert!(file_path.exists());
+    }
+
+    #[test]
+    fn test_delete_moves_all_archive_parts() {
+        let dir = tempdir().unwrap();
+        let first = dir.path().join("BigMod-123-1-0-1700000000.7z.001");
+        let second = dir.path().join("BigMod-123-1-0-1700000000.7z.002");
+        fs::write(&first, b"first part").unwrap();
+        fs::write(&second, b"second").unwrap();
+
+        let mod_file = ModFile {
+            full_path: first.clone(),
+            size: 16,
+            ..crate::core::parser::parse_mod_filename("BigMod-123-1-0-1700000000.7z.001").unwrap()
+        };
+        let orphans = vec![OrphanedMod { file: mod_file }];
+
+        let recycle_bin = dir.path().join(RECYCLE_BIN_DIR_NAME);
+        let result = delete_orphaned_mods(&orphans, false, Some(&recycle_bin), None);
+        assert!(result.failed.is_empty(), "{:?}", result.failed);
+        assert!(result.errors.is_empty(), "{:?}", result.errors);
+        assert_eq!(result.deleted_count, 1);
+        assert_eq!(result.space_freed, 16);
+        assert!(!first.exists() && !second.exists());
+        assert!(recycle_bin
+            .join("BigMod-123-1-0-1700000000.7z.002")
+            .exists());
+
+        let manifest = crate::core::restore::BackupManifest::load(&recycle_bin).unwrap();
+        assert_eq!(
+            manifest.files.get("BigMod-123-1-0-1700000000.7z.002"),
+            Some(&second)
+        );
+
+        // Undoing the cleanup brings back every part it moved
+        let originals: Vec<PathBuf> = result.backed_up.iter().map(|(p, _)| p.clone()).collect();
+        assert_eq!(originals, vec![first.clone(), second.clone()]);
+        let restored = crate::core::restore::restore_files(&recycle_bin, &originals).unwrap();
+        assert_eq!(restored.restored, 2);
+        assert!(first.exists() && second.exists());
+    }
+
+    #[test]
+    fn test_delete_keeps_same_named_archives_apart() {
+        let dir = tempdir().unwrap();
+        let name = "SkyUI-12604-5-2-1700000000.7z";
+        let recycle_bin = dir.path().join(RECYCLE_BIN_DIR_NAME).join("duplicates");
+        let orphans: Vec<OrphanedMod> = ["Skyrim", "Skyrim SE", "Skyrim VR"]
+            .iter()
+            .map(|game| {
+                let folder = dir.path().join(game);
+                fs::create_dir(&folder).unwrap();
+                fs::write(folder.join(name), game.as_bytes()).unwrap();
+                OrphanedMod {
+                    file: ModFile {
+                        full_path: folder.join(name),
+                        size: game.len() as u64,
+                        ..crate::core::parser::parse_mod_filename(name).unwrap()
+                    },
+                }
+            })
+            .collect();
+
+        let result = delete_orphaned_mods(&orphans, false, Some(&recycle_bin), None);
+        assert!(result.failed.is_empty(), "{:?}", result.failed);
+        assert_eq!(result.deleted_count, 3);
+        assert_eq!(fs::read(recycle_bin.join(name)).unwrap(), b"Skyrim");
+        assert_eq!(
+            fs::read(recycle_bin.join("2").join(name)).unwrap(),
+            b"Skyrim SE"
+        );
+        assert_eq!(
+            fs::read(recycle_bin.join("3").join(name)).unwrap(),
+            b"Skyrim VR"
+        );
+
+        let manifest = crate::core::restore::BackupManifest::load(&recycle_bin).unwrap();
+        assert_eq!(manifest.files.len(), 3);
+        assert_eq!(
+            manifest.files.get(&format!("2/{}", name)),
+            Some(&orphans[1].file.full_path)
+        );
+
+        let restored = crate::core::restore::restore_backup(&recycle_bin).unwrap();
+        assert_eq!(restored.restored, 3);
+        for orphan in &orphans {
+            assert!(orphan.file.full_path.exists());
+        }
+        assert!(!recycle_bin.exists());
+    }
+
+    #[test]
+    fn test_delete_simulated() {
+        let dir = tempdir().unwrap();
+        let path = dir.path().join("OldMod-123-1-0-1700000000.7z");
+        fs::write(&path, b"old mod").unwrap();
+        let mod_file = ModFile {
+            full_path: path.clone(),
+            size: 7,
+            ..crate::core::parser::parse_mod_filename("OldMod-123-1-0-1700000000.7z").unwrap()
+        };
+        let orphans = vec![OrphanedMod { file: mod_file }];
+
+        let recycle_bin = dir.path().join(RECYCLE_BIN_DIR_NAME);
+        let ops = SimulatedFileOps::new();
+        let result = delete_orphaned_mods_with(&orphans, false, Some(&recycle_bin), None, &ops);
+        assert!(result.errors.is_empty(), "{:?}", result.errors);
+        assert_eq!(result.deleted_count, 1);
+        assert_eq!(result.space_freed, 7);
+        assert!(path.exists());
+        assert!(!recycle_bin.exists());
+
+        let operations = ops.operations();
+        assert!(operations.contains(&FileOp::CreateDir(recycle_bin.clone())));
+        assert!(operations.contains(&FileOp::Move {
+            from: path.clone(),
+            to: recycle_bin.join("OldMod-123-1-0-1700000000.7z"),
+        }));
+
+        let ops = SimulatedFileOps::new();
+        let result = delete_orphaned_mods_with(&orphans, false, None, None, &ops);
+        assert_eq!(result.deleted_count, 1);
+        assert!(path.exists());
+        assert!(matches!(
+            ops.operations().last(),
+            Some(FileOp::Remove(removed)) if removed.starts_with(dir.path())
+        ));
+    }
+
+    #[test]
+    fn test_delete_reports_leftover_parts() {
+        /// Sets parts aside but can't remove them, like a file another program holds open
+        struct NoRemove;
+        impl FileOps for NoRemove {
+            fn create_dir_all(&self, dir: &Path) -> io::Result<()> {
+                fs::create_dir_all(dir)
+            }
+            fn rename(&self, from: &Path, to: &Path) -> io::Result<()> {
+                fs::rename(from, to)
+            }
+            fn copy(&self, from: &Path, to: &Path) -> io::Result<()> {
+                fs::copy(from, to).map(|_| ())
+            }
+            fn remove_file(&self, _path: &Path) -> io::Result<()> {
+                Err(io::Error::new(io::ErrorKind::PermissionDenied, "in use"))
+            }
+            fn trash(&self, path: &Path) -> io::Result<PathBuf> {
+                Ok(path.to_path_buf())
+            }
+        }
+
+        let dir = tempdir().unwrap();
+        let path = dir.path().join("OldMod-123-1-0-1700000000.7z");
+        fs::write(&path, b"old mod").unwrap();
+        let orphans = vec![OrphanedMod {
+            file: ModFile {
+                full_path: path.clone(),
+                size: 7,
+                ..crate::core::parser::parse_mod_filename("OldMod-123-1-0-1700000000.7z").unwrap()
+            },
+        }];
+
+        let result = delete_orphaned_mods_with(&orphans, false, None, None, &NoRemove);
+        assert_eq!(result.deleted_count, 0);
+        assert_eq!(result.space_freed, 0);
+        assert_eq!(result.failed.len(), 1);
+        assert!(result.failed[0]
+            .1
+            .contains("OldMod-123-1-0-1700000000.7z.wlc-delete"));
+    }
+
+    #[test]
+    fn test_deletion_safety_in_memory() {
+        let dir = Path::new("/downloads/Skyrim");
+        let file = |name: &str, size: u64| ModFile {
+            full_path: dir.join(name),
+            size,
+            modified: Some(1_700_000_000),
+            ..crate::core::parser::parse_mod_filename(name).unwrap()
+        };
+        let old = file("SkyUI-12604-5-1-1700000000.7z", 3);
+        let newest = file("SkyUI-12604-5-2-1700000001.7z", 8);
+        let group = ModGroup {
+            mod_key: "12604:skyui".to_string(),
+            files: vec![old.clone(), newest.clone()],
+            newest_idx: 1,
+            space_to_free: 3,
+        };
+        let groups = [group];
+
+        let ops = MemoryFileOps::new();
+        ops.add(&old.full_path, b"old", Some(1_700_000_000));
+        ops.add(
+            &newest.full_path,
+            b"7z\xBC\xAF\x27\x1Cab",
+            Some(1_700_000_000),
+        );
+        assert!(validate_deletion_safety(&groups, &old, &ops));
+        assert!(!validate_deletion_safety(&groups, &newest, &ops));
+        assert!(verify_unchanged_since_scan(&old, &[old.full_path.clone()], &ops).is_ok());
+
+        // The old file was replaced by a new download of another size
+        ops.add(&old.full_path, b"redownloaded", Some(1_700_000_000));
+        assert!(verify_unchanged_since_scan(&old, &[old.full_path.clone()], &ops).is_err());
+
+        // A corrupt newest file keeps the old versions
+        ops.add(&newest.full_path, b"garbage!", Some(1_700_000_000));
+        assert!(!validate_deletion_safety(&groups, &old, &ops));
+
+        // So does a newest file that is gone
+        ops.remove_file(&newest.full_path).unwrap();
+        assert!(!validate_deletion_safety(&groups, &old, &ops));
+    }
+
+    #[test]
+    fn test_remove_in_memory() {
+        let dir = Path::new("/downloads/Skyrim");
+        let first = dir.join("BigMod-123-1-0-1700000000.7z.001");
+        let second = dir.join("BigMod-123-1-0-1700000000.7z.002");
+        let file = ModFile {
+            full_path: first.clone(),
+            size: 6,
+            modified: Some(1_700_000_000),
+            ..crate::core::parser::parse_mod_filename("BigMod-123-1-0-1700000000.7z.001").unwrap()
+        };
+
+        // Parts, the .meta flags and the lock probe are all read through the ops
+        let ops = MemoryFileOps::new();
+        ops.add(&first, b"abc", Some(1_700_000_000));
+        ops.add(&second, b"def", Some(1_700_000_000));
+        let meta = dir.join("BigMod-123-1-0-1700000000.7z.001.meta");
+        ops.add(&meta, b"[General]\nremoved=true\n", None);
+        assert!(remove_mod_file(&file, None, &ops).is_err());
+        assert!(ops.exists(&first) && ops.exists(&second));
+
+        ops.remove_file(&meta).unwrap();
+        let removal = remove_mod_file(&file, None, &ops).unwrap();
+        assert_eq!(removal.size, 6);
+        assert!(!ops.exists(&first) && !ops.exists(&second));
+    }
+
+    #[test]
+    fn test_move_parts_is_all_or_nothing() {
+        let dir = tempdir().unwrap();
+        let parts: Vec<PathBuf> = ["a.7z.001", "a.7z.002", "a.7z.003"]
+            .iter()
+            .map(|name| dir.path().join(name))
+            .collect();
+        for part in &parts {
+            fs::write(part, b"part").unwrap();
+        }
+        let dest = dir.path().join("dest");
+        fs::create_dir(&dest).unwrap();
+
+        let err = move_parts(
+            &parts,
+            |part| {
+                if part.ends_with("a.7z.003") {
+                    return Err(io::Error::other("locked"));
+                }
+                let to = dest.join(part.file_name().unwrap());
+                move_file(part, &to).map(|_| to)
+            },
+            &RealFileOps,
+        );
+        assert!(err.is_err());
+        assert!(parts.iter().all(|part| part.exists()));
+        assert_eq!(fs::read_dir(&dest).unwrap().count(), 0);
+    }
+
+    #[test]
+    fn test_delete_meta_files() {
+        let dir = tempdir().unwrap();
+        let meta = dir.path().join("SkyUI-12604-5-1-1600000000.7z.meta");
+        fs::write(&meta, "[General]\n").unwrap();
+        let missing = dir.path().join("Gone.7z.meta");
+
+        let recycle_bin = dir.path().join(RECYCLE_BIN_DIR_NAME);
+        let result = delete_meta_files(&[meta.clone(), missing], false, Some(&recycle_bin));
+        assert_eq!(result.deleted_count, 1);
+        assert_eq!(result.skipped, vec!["Gone.7z.meta"]);
+        assert!(!meta.exists());
+        assert!(recycle_bin
+            .join("SkyUI-12604-5-1-1600000000.7z.meta")
+            .exists());
+    }
+
+    #[test]
+    fn test_recycle_bin_subdir() {
+        use chrono::TimeZone;
+        let now = chrono::Local.with_ymd_and_hms(2025, 3, 4, 5, 6, 7).unwrap();
+
+        assert_eq!(
+            recycle_bin_subdir(DEFAULT_RECYCLE_BIN_TEMPLATE, "orphaned", "all", now).unwrap(),
+            PathBuf::from("2025-03-04_05-06-07")
+        );
+        assert_eq!(
+            recycle_bin_subdir(
+                "{game}/{date}_{operation}",
+                "old-versions",
+                "Fallout: 4?",
+                now
+            )
+            .unwrap(),
+            PathBuf::from("Fallout_ 4_").join("2025-03-04_05-06-07_old-versions")
+        );
+
+        assert!(recycle_bin_subdir("{date}_{user}", "orphaned", "all", now).is_err());
+        assert!(recycle_bin_subdir("../{date}", "orphaned", "all", now).is_err());
+        assert!(recycle_bin_subdir("a//{date}", "orphaned", "all", now).is_err());
+        assert!(recycle_bin_subdir("{date}|x", "orphaned", "all", now).is_err());
+    }
+
+    #[test]
+    fn test_delete_keeps_archive_removed_from_nexus() {
+        let dir = tempdir().unwrap();
+        let file_path = dir.path().join("test-123-1-0-1234567890.7z");
+        fs::write(&file_path, b"test content").unwrap();
+        fs::write(
+            dir.path().join("test-123-1-0-1234567890.7z.meta"),
+            "[General]\nremoved=true\n",
+        )
+        .unwrap();
+
+        let mod_file = ModFile {
+            file_name: "test-123-1-0-1234567890.7z".to_string(),
+            full_path: file_path.clone(),
+            mod_name: "test".to_string(),
+            mod_id: "123".to_string(),
+            file_id: None,
+            version: "1-0".to_string(),
+            timestamp: "1234567890".to_string(),
+            size: 12,
+            is_patch: false,
+            modified: None,
+        };
+
+        let err = delete_mod_file(&mod_file, None, &RealFileOps).unwrap_err();
+        assert!(err.contains("cannot be re-downloaded"));
+        assert!(file_path.exists());
+    }
+
+    #[test]
+    fn test_choose_backup_root() {
+        let dir = tempdir().unwrap();
+        let small = dir.path().join("small");
+        let large = dir.path().join("large");
+        fs::create_dir(&small).unwrap();
+        fs::create_dir(&large).unwrap();
+        let roots = vec![small.clone(), large.clone(), dir.path().join("missing")];
+        let space = |p: &Path| Ok(if p == small { 100 } else { 500 });
+
+        assert_eq!(choose_backup_root_with(&roots, 200, space).unwrap(), large);
+        let err = choose_backup_root_with(&roots, 1000, space).unwrap_err();
+        assert!(err.starts_with("No backup location can hold"));
+        assert!(err.contains("not found"));
+        assert!(choose_backup_root_with(&[], 1, space).is_err());
+
+        assert!(free_space(dir.path()).unwrap() > 0);
+        let summary = free_space_summary(dir.path(), 1024, true).unwrap();
+        assert!(summary.starts_with("Free now: "));
+        assert!(summary.ends_with("once the recycle bin is emptied"));
+        assert!(free_space_summary(&dir.path().join("missing"), 0, false).is_err());
+    }
+
+    #[test]
+    fn test_backup_preview() {
+        let dir = tempfile::tempdir().unwrap();
+        let dest = dir.path().join(RECYCLE_BIN_DIR_NAME).join("2025-01-01");
+        assert!(same_volume(dir.path(), &dest));
+
+        let preview = backup_preview(dir.path(), &dest, 2048);
+        assert!(preview.starts_with("Moving 2.00 KB to "));
+        assert!(preview.contains(" free there)"));
+        assert!(preview.ends_with("only after you delete the backup folder"));
+        // Same drive: the move is a rename and needs no room
+        assert!(check_backup_space(dir.path(), &dest, u64::MAX).is_ok());
+    }
 }
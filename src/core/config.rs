@@ -0,0 +1,394 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+use std::collections::BTreeMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+
+use crate::core::cleaner::DEFAULT_RECYCLE_BIN_TEMPLATE;
+use crate::core::exclusions::Exclusions;
+use crate::core::games::{default_games, GameEntry};
+use crate::core::pins::Pins;
+use crate::core::types::{GroupStrategy, KeepOrder, NewestBy, ARCHIVE_EXTENSIONS};
+
+/// Name of the profile created when no config file exists
+pub const DEFAULT_PROFILE: &str = "Default";
+
+/// Log level used when neither the config nor the command line sets one
+pub const DEFAULT_LOG_LEVEL: &str = "info";
+
+const CONFIG_DIR_NAME: &str = "wabbajack-library-cleaner";
+const CONFIG_FILE_NAME: &str = "config.json";
+
+/// Folders and options for one Wabbajack setup
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct Profile {
+    pub wabbajack_dir: Option<PathBuf>,
+    pub downloads_dir: Option<PathBuf>,
+    /// Names of the modlists selected for protection
+    pub selected_modlists: Vec<String>,
+    pub move_to_recycle_bin: bool,
+    /// Never delete permanently: files always go to the recycle bin or trash.
+    /// On for new profiles; configs saved before it existed load with it off.
+    #[serde(default)]
+    pub safe_mode: bool,
+    /// Move files to the desktop trash instead of WLC_RecycleBin, where there is one
+    pub use_system_trash: bool,
+    pub include_uncompressed_size: bool,
+    /// Estimate orphaned space in the statistics when modlists are selected,
+    /// which matches every archive against them
+    pub estimate_orphans: bool,
+    /// Only report, never delete, in folders that don't map to a selected modlist's game
+    pub read_only_unmapped_folders: bool,
+    /// Split a mod's files into separate groups when their version schemes differ
+    pub split_version_schemes: bool,
+    /// How the old version scan groups files into versions of one mod
+    pub group_strategy: GroupStrategy,
+    /// Newest versions of each mod kept by old version cleanups
+    pub keep_versions: usize,
+    /// Whether old version cleanups keep the newest or the oldest versions
+    pub keep_order: KeepOrder,
+    /// Whether a file's name timestamp or its modification time orders versions
+    pub newest_by: NewestBy,
+    /// Keep old versions whose exact FileID any parsed modlist downloads,
+    /// selected or not
+    pub protect_required_versions: bool,
+    /// Name of each cleanup's folder inside WLC_RecycleBin
+    pub recycle_bin_template: String,
+    /// Never delete files last accessed within this many days; 0 turns it off
+    pub protect_accessed_days: u32,
+    /// Leave alone files modified within this many minutes, which Wabbajack
+    /// may still be downloading; 0 turns it off
+    pub in_use_minutes: u32,
+    /// Hash archives no modlist matches by name or ID and match them by content
+    pub hash_unmatched: bool,
+    /// Read a `meta.ini` inside archives that have no ModID in their name or `.meta`
+    pub inspect_archives: bool,
+    /// Orphans smaller than this many MB are left alone; 0 turns it off
+    pub orphan_min_size_mb: u64,
+    /// Levels of subfolders scanned inside each game folder; 0 turns it off
+    pub subfolder_depth: usize,
+    /// Folders on other drives that receive moved old versions; the one with
+    /// the most free space is used
+    pub backup_roots: Vec<PathBuf>,
+    /// Where cleanup reports are saved; by default next to the moved files,
+    /// or in the downloads folder when files were deleted
+    pub cleanup_report_dir: Option<PathBuf>,
+}
+
+impl Default for Profile {
+    fn default() -> Self {
+        Self {
+            wabbajack_dir: None,
+            downloads_dir: None,
+            selected_modlists: Vec::new(),
+            move_to_recycle_bin: true,
+            safe_mode: true,
+            use_system_trash: false,
+            include_uncompressed_size: false,
+            estimate_orphans: true,
+            read_only_unmapped_folders: false,
+            split_version_schemes: false,
+            group_strategy: GroupStrategy::default(),
+            keep_versions: 1,
+            keep_order: KeepOrder::default(),
+            newest_by: NewestBy::default(),
+            protect_required_versions: true,
+            recycle_bin_template: DEFAULT_RECYCLE_BIN_TEMPLATE.to_string(),
+            protect_accessed_days: 0,
+            in_use_minutes: 10,
+            hash_unmatched: false,
+            inspect_archives: false,
+            orphan_min_size_mb: 0,
+            subfolder_depth: 0,
+            backup_roots: Vec::new(),
+            cleanup_report_dir: None,
+        }
+    }
+}
+
+/// Persistent settings with one or more named profiles
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct Config {
+    pub active_profile: String,
+    pub profiles: BTreeMap<String, Profile>,
+    /// Game folder names and their canonical games, shared by all profiles
+    pub games: Vec<GameEntry>,
+    /// File extensions scanned as archives, such as ".7z"; compound ones like
+    /// ".tar.zst" only need their last part
+    pub archive_extensions: Vec<String>,
+    /// Least severe log messages written: "error", "warn", "info" or "debug"
+    pub log_level: String,
+    /// A `-log` file this many MB or larger is rotated at startup
+    pub log_max_size_mb: u64,
+    /// Rotated copies of the `-log` file kept, as `<name>.1` and up
+    pub log_keep: usize,
+    /// Mods never to delete, read from `wlc-exclude.txt` rather than the config file
+    #[serde(skip)]
+    pub exclusions: Exclusions,
+    /// FileIDs to keep instead of the newest, read from `wlc-pins.txt`
+    #[serde(skip)]
+    pub pins: Pins,
+}
+
+impl Default for Config {
+    fn default() -> Self {
+        let mut profiles = BTreeMap::new();
+        profiles.insert(DEFAULT_PROFILE.to_string(), Profile::default());
+        Self {
+            active_profile: DEFAULT_PROFILE.to_string(),
+            profiles,
+            games: default_games(),
+            archive_extensions: ARCHIVE_EXTENSIONS.iter().map(|e| e.to_string()).collect(),
+            log_level: DEFAULT_LOG_LEVEL.to_string(),
+            log_max_size_mb: 5,
+            log_keep: 10,
+            exclusions: Exclusions::default(),
+            pins: Pins::default(),
+        }
+    }
+}
+
+/// Read a log level name such as "warn"; "warning" is accepted too
+pub fn parse_log_level(text: &str) -> Option<log::LevelFilter> {
+    match text.trim().to_ascii_lowercase().as_str() {
+        "error" => Some(log::LevelFilter::Error),
+        "warn" | "warning" => Some(log::LevelFilter::Warn),
+        "info" => Some(log::LevelFilter::Info),
+        "debug" => Some(log::LevelFilter::Debug),
+        _ => None,
+    }
+}
+
+impl Config {
+    /// The configured log level, or info when the config names an unknown one
+    pub fn log_filter(&self) -> log::LevelFilter {
+        parse_log_level(&self.log_level).unwrap_or(log::LevelFilter::Info)
+    }
+
+    /// Location of the config file in the user's config directory
+    pub fn default_path() -> Option<PathBuf> {
+        let base = if cfg!(windows) {
+            std::env::var_os("APPDATA").map(PathBuf::from)
+        } else {
+            std::env::var_os("XDG_CONFIG_HOME")
+                .map(PathBuf::from)
+                .or_else(|| std::env::var_os("HOME").map(|h| PathBuf::from(h).join(".config")))
+        };
+
+        base.map(|dir| dir.join(CONFIG_DIR_NAME).join(CONFIG_FILE_NAME))
+    }
+
+    /// Load the config, exclusion list and pins from the default location,
+    /// falling back to defaults
+    pub fn load() -> Self {
+        Self {
+            exclusions: Exclusions::load(),
+            pins: Pins::load(),
+            ..Self::load_settings()
+        }
+    }
+
+    fn load_settings() -> Self {
+        let Some(path) = Self::default_path() else {
+            log::warn!("No config directory available, using default settings");
+            return Self::default();
+        };
+
+        if !path.exists() {
+            return Self::default();
+        }
+
+        match Self::load_from(&path) {
+            Ok(config) => config,
+            Err(e) => {
+                log::warn!("Failed to load config, using default settings: {:#}", e);
+                Self::default()
+            }
+        }
+    }
+
+    /// Load the config from a specific file
+    pub fn load_from(path: &Path) -> Result<Self> {
+        let content = fs::read_to_string(path)
+            .with_context(|| format!("Failed to read config file: {:?}", path))?;
+        let mut config: Config = serde_json::from_str(&content)
+            .with_context(|| format!("Failed to parse config file: {:?}", path))?;
+        config.ensure_active_profile();
+        Ok(config)
+    }
+
+    /// Save the config to the default location
+    pub fn save(&self) -> Result<()> {
+        let path = Self::default_path().context("No config directory available")?;
+        self.save_to(&path)
+    }
+
+    /// Save the config to a specific file
+    pub fn save_to(&self, path: &Path) -> Result<()> {
+        if let Some(parent) = path.parent() {
+            fs::create_dir_all(parent)
+                .with_context(|| format!("Failed to create config folder: {:?}", parent))?;
+        }
+
+        let content = serde_json::to_string_pretty(self).context("Failed to serialize config")?;
+        fs::write(path, content)
+            .with_context(|| format!("Failed to write config file: {:?}", path))?;
+
+        log::info!("Saved config to {:?}", path);
+        Ok(())
+    }
+
+    /// Make sure the active profile name points at an existing profile
+    fn ensure_active_profile(&mut self) {
+        if self.profiles.contains_key(&self.active_profile) {
+            return;
+        }
+
+        match self.profiles.keys().next() {
+            Some(first) => self.active_profile = first.clone(),
+            None => *self = Self::default(),
+        }
+    }
+
+    pub fn profile_names(&self) -> Vec<String> {
+        self.profiles.keys().cloned().collect()
+    }
+
+    pub fn active(&self) -> &Profile {
+        self.profiles
+            .get(&self.active_profile)
+            .expect("active profile always exists")
+    }
+
+    pub fn active_mut(&mut self) -> &mut Profile {
+        self.profiles
+            .get_mut(&self.active_profile)
+            .expect("active profile always exists")
+    }
+
+    /// Switch to an existing profile. Returns false if it doesn't exist.
+    pub fn switch_profile(&mut self, name: &str) -> bool {
+        if !self.profiles.contains_key(name) {
+            return false;
+        }
+        self.active_profile = name.to_string();
+        true
+    }
+
+    /// Create a new profile with default settings and make it active
+    ///
+    /// Returns false if the name is empty or already taken.
+    pub fn create_profile(&mut self, name: &str) -> bool {
+        let name = name.trim();
+        if name.is_empty() || self.profiles.contains_key(name) {
+            return false;
+        }
+        self.profiles.insert(name.to_string(), Profile::default());
+        self.active_profile = name.to_string();
+        true
+    }
+
+    /// Remove a profile. The last remaining profile can't be removed.
+    pub fn remove_profile(&mut self, name: &str) -> bool {
+        if self.profiles.len() <= 1 || self.profiles.remove(name).is_none() {
+            return false;
+        }
+        self.ensure_active_profile();
+        true
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::tempdir;
+
+    #[test]
+    fn test_default_config() {
+        let config = Config::default();
+        assert_eq!(config.active_profile, DEFAULT_PROFILE);
+        assert!(config.active().move_to_recycle_bin);
+        assert!(config.active().safe_mode);
+        assert!(config.active().wabbajack_dir.is_none());
+    }
+
+    #[test]
+    fn test_save_and_load_roundtrip() {
+        let dir = tempdir().unwrap();
+        let path = dir.path().join("nested").join("config.json");
+
+        let mut config = Config::default();
+        config.active_mut().downloads_dir = Some(PathBuf::from("F:/Wabbajack/downloads"));
+        assert!(config.create_profile("Fallout"));
+        config.active_mut().selected_modlists = vec!["Magnum Opus".to_string()];
+        config.active_mut().move_to_recycle_bin = false;
+
+        config.save_to(&path).unwrap();
+        let loaded = Config::load_from(&path).unwrap();
+
+        assert_eq!(loaded, config);
+        assert_eq!(loaded.active_profile, "Fallout");
+    }
+
+    #[test]
+    fn test_log_level() {
+        assert_eq!(Config::default().log_filter(), log::LevelFilter::Info);
+        assert_eq!(parse_log_level("Warning"), Some(log::LevelFilter::Warn));
+        assert_eq!(parse_log_level(" debug "), Some(log::LevelFilter::Debug));
+        assert_eq!(parse_log_level("verbose"), None);
+
+        let config = Config {
+            log_level: "loud".to_string(),
+            ..Config::default()
+        };
+        assert_eq!(config.log_filter(), log::LevelFilter::Info);
+    }
+
+    #[test]
+    fn test_profile_management() {
+        let mut config = Config::default();
+
+        assert!(config.create_profile("Skyrim"));
+        assert!(!config.create_profile("Skyrim"));
+        assert!(!config.create_profile("  "));
+        assert_eq!(config.profile_names(), vec!["Default", "Skyrim"]);
+
+        assert!(config.switch_profile(DEFAULT_PROFILE));
+        assert!(!config.switch_profile("Missing"));
+        assert_eq!(config.active_profile, DEFAULT_PROFILE);
+
+        // Removing the active profile falls back to another one
+        assert!(config.remove_profile(DEFAULT_PROFILE));
+        assert_eq!(config.active_profile, "Skyrim");
+        assert!(!config.remove_profile("Skyrim"));
+    }
+
+    #[test]
+    fn test_load_repairs_missing_active_profile() {
+        let dir = tempdir().unwrap();
+        let path = dir.path().join("config.json");
+        fs::write(
+            &path,
+            r#"{"active_profile": "Gone", "profiles": {"Skyrim": {"downloads_dir": "D:/dl"}}}"#,
+        )
+        .unwrap();
+
+        let config = Config::load_from(&path).unwrap();
+        assert_eq!(config.active_profile, "Skyrim");
+        // Missing fields take their defaults
+        assert!(config.active().move_to_recycle_bin);
+        // Profiles saved before safe mode existed keep deleting as they did
+        assert!(!config.active().safe_mode);
+        assert_eq!(config.games, default_games());
+    }
+}
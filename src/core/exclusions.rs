@@ -0,0 +1,158 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+//! Mods the user never wants cleaned, listed in `wlc-exclude.txt`
+//!
+//! Each line is a ModID or a file name pattern where `*` matches any run of
+//! characters. Blank lines and lines starting with `#` are ignored.
+//!
+//! ```text
+//! # Keep every SkyUI download
+//! 12604
+//! Unofficial Skyrim*Patch*.7z
+//! ```
+
+use std::collections::HashSet;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+
+use crate::core::config::Config;
+use crate::core::parser::is_numeric;
+use crate::core::types::ModFile;
+
+pub const EXCLUSIONS_FILE_NAME: &str = "wlc-exclude.txt";
+
+/// ModIDs and file name patterns that are never deleted
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct Exclusions {
+    mod_ids: HashSet<String>,
+    /// Lowercased file name patterns
+    patterns: Vec<String>,
+}
+
+impl Exclusions {
+    /// Location of the exclusion list next to the config file
+    pub fn default_path() -> Option<PathBuf> {
+        Config::default_path().and_then(|p| p.parent().map(|dir| dir.join(EXCLUSIONS_FILE_NAME)))
+    }
+
+    /// Read the exclusion list from the default location; missing means empty
+    pub fn load() -> Self {
+        let Some(path) = Self::default_path().filter(|p| p.exists()) else {
+            return Self::default();
+        };
+        match Self::load_from(&path) {
+            Ok(exclusions) => {
+                log::info!("Loaded {} exclusion(s) from {:?}", exclusions.len(), path);
+                exclusions
+            }
+            Err(e) => {
+                log::warn!("Failed to load exclusion list: {:#}", e);
+                Self::default()
+            }
+        }
+    }
+
+    pub fn load_from(path: &Path) -> Result<Self> {
+        let content = fs::read_to_string(path)
+            .with_context(|| format!("Failed to read exclusion list: {:?}", path))?;
+        Ok(Self::parse(&content))
+    }
+
+    pub fn parse(content: &str) -> Self {
+        let mut exclusions = Self::default();
+        for line in content.lines() {
+            let line = line.trim();
+            if line.is_empty() || line.starts_with('#') {
+                continue;
+            }
+            if is_numeric(line) {
+                exclusions.mod_ids.insert(line.to_string());
+            } else {
+                exclusions.patterns.push(line.to_lowercase());
+            }
+        }
+        exclusions
+    }
+
+    pub fn len(&self) -> usize {
+        self.mod_ids.len() + self.patterns.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+
+    /// Check if a file's ModID or name is on the list
+    ///
+    /// Patterns match the whole file name, ignoring case.
+    pub fn matches(&self, file: &ModFile) -> bool {
+        if file.mod_id != "0" && self.mod_ids.contains(&file.mod_id) {
+            return true;
+        }
+        let name = file.file_name.to_lowercase();
+        self.patterns.iter().any(|p| wildcard_match(p, &name))
+    }
+}
+
+/// Match `text` against a pattern where `*` stands for any run of characters
+fn wildcard_match(pattern: &str, text: &str) -> bool {
+    let mut parts = pattern.split('*');
+    let first = parts.next().unwrap_or_default();
+    let Some(mut rest) = text.strip_prefix(first) else {
+        return false;
+    };
+    let parts: Vec<&str> = parts.collect();
+    let Some((last, middle)) = parts.split_last() else {
+        // No `*` at all: the pattern is the whole name
+        return rest.is_empty();
+    };
+
+    for part in middle {
+        match rest.find(part) {
+            Some(i) => rest = &rest[i + part.len()..],
+            None => return false,
+        }
+    }
+    rest.len() >= last.len() && rest.ends_with(last)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::core::parser::parse_mod_filename;
+
+    #[test]
+    fn test_wildcard_match() {
+        assert!(wildcard_match("skyui*.7z", "skyui-12604-5-2-1700000000.7z"));
+        assert!(wildcard_match("*patch*", "ussep patch-266-4-2-1.7z"));
+        assert!(wildcard_match("exact.7z", "exact.7z"));
+        assert!(!wildcard_match("exact.7z", "exact.7z.bak"));
+        assert!(!wildcard_match("a*bc", "abc_c"));
+        assert!(wildcard_match("a*b*b", "ab_b"));
+        assert!(!wildcard_match("ab*ba", "aba"));
+    }
+
+    #[test]
+    fn test_exclusions() {
+        let exclusions = Exclusions::parse(
+            "# Never touch these\r\n12604\r\n\r\n  Unofficial Skyrim*Patch*  \r\n",
+        );
+        assert_eq!(exclusions.len(), 2);
+
+        let skyui = parse_mod_filename("SkyUI-12604-5-2-1700000000.7z").unwrap();
+        let ussep =
+            parse_mod_filename("Unofficial Skyrim Special Edition Patch-266-4-2-1700000000.7z")
+                .unwrap();
+        let other = parse_mod_filename("Immersive Armors-3479-8-1-1700000000.7z").unwrap();
+        assert!(exclusions.matches(&skyui));
+        assert!(exclusions.matches(&ussep));
+        assert!(!exclusions.matches(&other));
+    }
+}
@@ -0,0 +1,332 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+//! File system access by scans and cleanups, behind a trait
+//!
+//! Every change a cleanup makes (creating the recycle bin, moving, trashing
+//! or deleting a file) goes through [`FileOps`], and so do the reads its
+//! safety checks and the scanner's folder listings rely on. The reads go to
+//! the disk unless an implementation overrides them. [`SimulatedFileOps`]
+//! records the changes instead of making them, for `-simulate` runs and for
+//! tests of the deletion logic.
+
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+use crate::core::trash::move_to_trash;
+use crate::core::types::modified_secs;
+
+/// Size, modification time and kind of a file or folder
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct FileInfo {
+    pub size: u64,
+    /// Seconds since the Unix epoch
+    pub modified: Option<u64>,
+    pub is_dir: bool,
+}
+
+impl FileInfo {
+    fn from_metadata(metadata: &fs::Metadata) -> Self {
+        Self {
+            size: metadata.len(),
+            modified: modified_secs(metadata),
+            is_dir: metadata.is_dir(),
+        }
+    }
+}
+
+/// A file opened for reading, such as an archive whose header is checked
+pub trait ReadSeek: io::Read + io::Seek {}
+
+impl<T: io::Read + io::Seek> ReadSeek for T {}
+
+/// The file system reads and changes a scan or cleanup can make
+pub trait FileOps: Sync {
+    fn create_dir_all(&self, dir: &Path) -> io::Result<()>;
+    fn rename(&self, from: &Path, to: &Path) -> io::Result<()>;
+    fn copy(&self, from: &Path, to: &Path) -> io::Result<()>;
+    fn remove_file(&self, path: &Path) -> io::Result<()>;
+    /// Move a file to the desktop trash and return where it went
+    fn trash(&self, path: &Path) -> io::Result<PathBuf>;
+
+    /// Whether changes are only recorded, so nothing else should be written either
+    fn is_simulated(&self) -> bool {
+        false
+    }
+
+    fn exists(&self, path: &Path) -> bool {
+        path.exists()
+    }
+
+    /// Info on the file or folder at `path`, following links
+    fn metadata(&self, path: &Path) -> io::Result<FileInfo> {
+        fs::metadata(path).map(|m| FileInfo::from_metadata(&m))
+    }
+
+    /// Everything directly inside `dir`, with its info
+    ///
+    /// An entry whose info can't be read, such as a file removed since the
+    /// folder was listed, is still returned with the error.
+    fn read_dir(&self, dir: &Path) -> io::Result<Vec<(PathBuf, io::Result<FileInfo>)>> {
+        fs::read_dir(dir)?
+            .map(|entry| {
+                let entry = entry?;
+                let path = entry.path();
+                // A link's own metadata would hide the folder it points to
+                let info = match entry.file_type() {
+                    Ok(t) if t.is_symlink() => fs::metadata(&path),
+                    _ => entry.metadata(),
+                };
+                Ok((path, info.map(|m| FileInfo::from_metadata(&m))))
+            })
+            .collect()
+    }
+
+    fn open(&self, path: &Path) -> io::Result<Box<dyn ReadSeek>> {
+        Ok(Box::new(fs::File::open(path)?))
+    }
+
+    /// Whether another program holds the file open, so it can't be moved
+    ///
+    /// Probed by opening the file for writing, which changes nothing in it.
+    fn is_locked(&self, path: &Path) -> bool {
+        fs::OpenOptions::new()
+            .read(true)
+            .write(true)
+            .open(path)
+            .is_err()
+    }
+}
+
+/// Changes made to the real file system
+#[derive(Debug, Clone, Copy, Default)]
+pub struct RealFileOps;
+
+impl FileOps for RealFileOps {
+    fn create_dir_all(&self, dir: &Path) -> io::Result<()> {
+        fs::create_dir_all(dir)
+    }
+
+    fn rename(&self, from: &Path, to: &Path) -> io::Result<()> {
+        fs::rename(from, to)
+    }
+
+    fn copy(&self, from: &Path, to: &Path) -> io::Result<()> {
+        fs::copy(from, to).map(|_| ())
+    }
+
+    fn remove_file(&self, path: &Path) -> io::Result<()> {
+        fs::remove_file(path)
+    }
+
+    fn trash(&self, path: &Path) -> io::Result<PathBuf> {
+        move_to_trash(path)
+    }
+}
+
+/// One change a simulated cleanup would have made
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum FileOp {
+    CreateDir(PathBuf),
+    Move { from: PathBuf, to: PathBuf },
+    Copy { from: PathBuf, to: PathBuf },
+    Remove(PathBuf),
+    Trash(PathBuf),
+}
+
+/// Records changes instead of making them; every change succeeds
+#[derive(Debug, Default)]
+pub struct SimulatedFileOps {
+    ops: Mutex<Vec<FileOp>>,
+}
+
+impl SimulatedFileOps {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// The changes recorded so far, in order
+    pub fn operations(&self) -> Vec<FileOp> {
+        self.ops.lock().unwrap_or_else(|e| e.into_inner()).clone()
+    }
+
+    fn record(&self, op: FileOp) {
+        self.ops.lock().unwrap_or_else(|e| e.into_inner()).push(op);
+    }
+}
+
+impl FileOps for SimulatedFileOps {
+    fn create_dir_all(&self, dir: &Path) -> io::Result<()> {
+        self.record(FileOp::CreateDir(dir.to_path_buf()));
+        Ok(())
+    }
+
+    fn rename(&self, from: &Path, to: &Path) -> io::Result<()> {
+        self.record(FileOp::Move {
+            from: from.to_path_buf(),
+            to: to.to_path_buf(),
+        });
+        Ok(())
+    }
+
+    fn copy(&self, from: &Path, to: &Path) -> io::Result<()> {
+        self.record(FileOp::Copy {
+            from: from.to_path_buf(),
+            to: to.to_path_buf(),
+        });
+        Ok(())
+    }
+
+    fn remove_file(&self, path: &Path) -> io::Result<()> {
+        self.record(FileOp::Remove(path.to_path_buf()));
+        Ok(())
+    }
+
+    fn trash(&self, path: &Path) -> io::Result<PathBuf> {
+        self.record(FileOp::Trash(path.to_path_buf()));
+        Ok(path.to_path_buf())
+    }
+
+    fn is_simulated(&self) -> bool {
+        true
+    }
+
+    // Nothing is moved, so no lock gets in the way and no file is opened for writing
+    fn is_locked(&self, _path: &Path) -> bool {
+        false
+    }
+}
+
+/// Contents and modification time of each file in a [`MemoryFileOps`]
+#[cfg(test)]
+type MemoryFiles = std::collections::HashMap<PathBuf, (Vec<u8>, Option<u64>)>;
+
+/// A file system held in memory, for tests that must not touch the disk
+///
+/// Folders exist implicitly wherever a file is stored below them.
+#[cfg(test)]
+#[derive(Debug, Default)]
+pub struct MemoryFileOps {
+    files: Mutex<MemoryFiles>,
+}
+
+#[cfg(test)]
+impl MemoryFileOps {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Store a file, replacing any file at the same path
+    pub fn add(&self, path: &Path, contents: &[u8], modified: Option<u64>) {
+        self.files()
+            .insert(path.to_path_buf(), (contents.to_vec(), modified));
+    }
+
+    fn files(&self) -> std::sync::MutexGuard<'_, MemoryFiles> {
+        self.files.lock().unwrap_or_else(|e| e.into_inner())
+    }
+
+    fn not_found(path: &Path) -> io::Error {
+        io::Error::new(io::ErrorKind::NotFound, format!("{:?} not found", path))
+    }
+}
+
+#[cfg(test)]
+impl FileOps for MemoryFileOps {
+    fn create_dir_all(&self, _dir: &Path) -> io::Result<()> {
+        Ok(())
+    }
+
+    fn rename(&self, from: &Path, to: &Path) -> io::Result<()> {
+        let mut files = self.files();
+        let file = files.remove(from).ok_or_else(|| Self::not_found(from))?;
+        files.insert(to.to_path_buf(), file);
+        Ok(())
+    }
+
+    fn copy(&self, from: &Path, to: &Path) -> io::Result<()> {
+        let mut files = self.files();
+        let file = files
+            .get(from)
+            .cloned()
+            .ok_or_else(|| Self::not_found(from))?;
+        files.insert(to.to_path_buf(), file);
+        Ok(())
+    }
+
+    fn remove_file(&self, path: &Path) -> io::Result<()> {
+        self.files()
+            .remove(path)
+            .map(|_| ())
+            .ok_or_else(|| Self::not_found(path))
+    }
+
+    fn trash(&self, path: &Path) -> io::Result<PathBuf> {
+        self.remove_file(path)?;
+        Ok(path.to_path_buf())
+    }
+
+    fn is_locked(&self, _path: &Path) -> bool {
+        false
+    }
+
+    fn exists(&self, path: &Path) -> bool {
+        self.files().keys().any(|file| file.starts_with(path))
+    }
+
+    fn metadata(&self, path: &Path) -> io::Result<FileInfo> {
+        let files = self.files();
+        if let Some((contents, modified)) = files.get(path) {
+            return Ok(FileInfo {
+                size: contents.len() as u64,
+                modified: *modified,
+                is_dir: false,
+            });
+        }
+        if files.keys().any(|file| file.starts_with(path)) {
+            return Ok(FileInfo {
+                size: 0,
+                modified: None,
+                is_dir: true,
+            });
+        }
+        Err(Self::not_found(path))
+    }
+
+    fn read_dir(&self, dir: &Path) -> io::Result<Vec<(PathBuf, io::Result<FileInfo>)>> {
+        let mut entries: Vec<PathBuf> = self
+            .files()
+            .keys()
+            .filter_map(|file| file.strip_prefix(dir).ok())
+            .filter_map(|rest| rest.components().next())
+            .map(|first| dir.join(first))
+            .collect();
+        if entries.is_empty() {
+            return Err(Self::not_found(dir));
+        }
+        entries.sort();
+        entries.dedup();
+        Ok(entries
+            .into_iter()
+            .map(|path| {
+                let info = self.metadata(&path);
+                (path, info)
+            })
+            .collect())
+    }
+
+    fn open(&self, path: &Path) -> io::Result<Box<dyn ReadSeek>> {
+        let contents = self
+            .files()
+            .get(path)
+            .map(|(contents, _)| contents.clone())
+            .ok_or_else(|| Self::not_found(path))?;
+        Ok(Box::new(io::Cursor::new(contents)))
+    }
+}
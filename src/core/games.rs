@@ -0,0 +1,198 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+use serde::{Deserialize, Serialize};
+
+/// A game and the folder names that refer to it
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct GameEntry {
+    /// Wabbajack game identifier, e.g. "SkyrimSpecialEdition"
+    pub game: String,
+    /// Game domain on Nexus Mods, e.g. "skyrimspecialedition"
+    pub nexus_slug: String,
+    /// Folder names or `*` patterns that belong to this game
+    ///
+    /// Matching ignores case, spaces and punctuation, so "Skyrim SE" also
+    /// matches a folder named "SkyrimSE".
+    #[serde(default)]
+    pub folders: Vec<String>,
+}
+
+impl GameEntry {
+    fn new(game: &str, nexus_slug: &str, folders: &[&str]) -> Self {
+        Self {
+            game: game.to_string(),
+            nexus_slug: nexus_slug.to_string(),
+            folders: folders.iter().map(|f| f.to_string()).collect(),
+        }
+    }
+
+    /// Check if a folder name or game identifier refers to this game
+    fn matches(&self, name: &str) -> bool {
+        let compact = normalize_game_name(name);
+        normalize_game_name(&self.game) == compact
+            || self
+                .folders
+                .iter()
+                .any(|pattern| wildcard_match(&compact_pattern(pattern), &compact))
+    }
+}
+
+/// Default mapping for the common Bethesda games and other Wabbajack targets
+pub fn default_games() -> Vec<GameEntry> {
+    vec![
+        GameEntry::new(
+            "SkyrimSpecialEdition",
+            "skyrimspecialedition",
+            &[
+                "Skyrim Special Edition",
+                "Skyrim SE",
+                "SSE",
+                "Skyrim AE",
+                "Skyrim Anniversary Edition",
+            ],
+        ),
+        // Legendary Edition; its Nexus domain is separate from SE's
+        GameEntry::new(
+            "Skyrim",
+            "skyrim",
+            &[
+                "Skyrim LE",
+                "Skyrim Legendary Edition",
+                "Skyrim Classic",
+                "Oldrim",
+                "TES5",
+            ],
+        ),
+        GameEntry::new("SkyrimVR", "skyrimspecialedition", &["Skyrim VR"]),
+        GameEntry::new("Fallout4", "fallout4", &["Fallout 4", "FO4"]),
+        GameEntry::new("Fallout4VR", "fallout4", &["Fallout 4 VR", "FO4VR"]),
+        GameEntry::new("Fallout3", "fallout3", &["Fallout 3", "FO3"]),
+        GameEntry::new(
+            "FalloutNewVegas",
+            "newvegas",
+            &["Fallout New Vegas", "New Vegas", "FNV", "FONV"],
+        ),
+        GameEntry::new("Oblivion", "oblivion", &["TES4"]),
+        GameEntry::new("Morrowind", "morrowind", &["TES3"]),
+        GameEntry::new(
+            "EnderalSpecialEdition",
+            "enderalspecialedition",
+            &["Enderal SE"],
+        ),
+        GameEntry::new("Enderal", "enderal", &[]),
+        GameEntry::new("Starfield", "starfield", &[]),
+    ]
+}
+
+/// Find the configured game a folder name or game identifier refers to
+///
+/// Folder names and identifiers are tried first; the Nexus slug is only
+/// used as a fallback because several games share one Nexus domain.
+pub fn resolve_game<'a>(games: &'a [GameEntry], name: &str) -> Option<&'a GameEntry> {
+    games.iter().find(|g| g.matches(name)).or_else(|| {
+        let compact = normalize_game_name(name);
+        games
+            .iter()
+            .find(|g| normalize_game_name(&g.nexus_slug) == compact)
+    })
+}
+
+/// Comparison key for a game folder name or game identifier
+///
+/// Names that resolve to a configured game share that game's key; anything
+/// else falls back to its normalized spelling.
+pub fn game_key(games: &[GameEntry], name: &str) -> String {
+    match resolve_game(games, name) {
+        Some(entry) => normalize_game_name(&entry.game),
+        None => normalize_game_name(name),
+    }
+}
+
+/// Reduce a game name to lowercase letters and digits
+pub fn normalize_game_name(name: &str) -> String {
+    name.chars()
+        .filter(|c| c.is_ascii_alphanumeric())
+        .map(|c| c.to_ascii_lowercase())
+        .collect()
+}
+
+/// Normalize a folder pattern the same way as names, keeping `*` wildcards
+fn compact_pattern(pattern: &str) -> String {
+    pattern
+        .chars()
+        .filter(|c| c.is_ascii_alphanumeric() || *c == '*')
+        .map(|c| c.to_ascii_lowercase())
+        .collect()
+}
+
+/// Match a name against a pattern where `*` matches any run of characters
+fn wildcard_match(pattern: &str, name: &str) -> bool {
+    let Some((first, rest)) = pattern.split_once('*') else {
+        return pattern == name;
+    };
+
+    let Some(mut remaining) = name.strip_prefix(first) else {
+        return false;
+    };
+
+    let mut parts: Vec<&str> = rest.split('*').collect();
+    let last = parts.pop().unwrap_or_default();
+    for part in parts {
+        match remaining.find(part) {
+            Some(pos) => remaining = &remaining[pos + part.len()..],
+            None => return false,
+        }
+    }
+
+    remaining.len() >= last.len() && remaining.ends_with(last)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_game_key_defaults() {
+        let games = default_games();
+        let sse = game_key(&games, "SkyrimSpecialEdition");
+
+        assert_eq!(sse, "skyrimspecialedition");
+        assert_eq!(game_key(&games, "Skyrim Special Edition"), sse);
+        assert_eq!(game_key(&games, "SkyrimSE"), sse);
+        assert_eq!(game_key(&games, "Skyrim SE"), sse);
+        assert_eq!(game_key(&games, "Fallout 4"), "fallout4");
+        assert_eq!(game_key(&games, "FO4"), "fallout4");
+        assert_eq!(game_key(&games, "newvegas"), "falloutnewvegas");
+        assert_ne!(game_key(&games, "Skyrim"), sse);
+        assert_eq!(game_key(&games, "SkyrimLE"), "skyrim");
+        assert_eq!(game_key(&games, "Oldrim"), "skyrim");
+        assert_eq!(game_key(&games, "skyrimspecialedition"), sse);
+        // Unknown names fall back to their normalized spelling
+        assert_eq!(game_key(&games, "Some Game"), "somegame");
+    }
+
+    #[test]
+    fn test_custom_folder_patterns() {
+        let mut games = default_games();
+        games[0].folders.push("My Skyrim*".to_string());
+
+        let entry = resolve_game(&games, "My Skyrim Downloads 2").unwrap();
+        assert_eq!(entry.game, "SkyrimSpecialEdition");
+        assert_eq!(entry.nexus_slug, "skyrimspecialedition");
+        assert!(resolve_game(&games, "Not My Skyrim").is_none());
+    }
+
+    #[test]
+    fn test_wildcard_match() {
+        assert!(wildcard_match("skyrim*", "skyrimse"));
+        assert!(wildcard_match("*se", "skyrimse"));
+        assert!(wildcard_match("s*r*e", "skyrimse"));
+        assert!(!wildcard_match("a*a", "a"));
+        assert!(!wildcard_match("fallout*", "skyrim"));
+    }
+}
@@ -0,0 +1,322 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+//! Archive hashes in the form Wabbajack records them
+//!
+//! Wabbajack identifies archives by the xxHash64 (seed 0) of their contents,
+//! written as the base64 of the hash's little-endian bytes, e.g. "k8XMlLt/BoQ=".
+
+use std::collections::HashMap;
+use std::fs::{self, File};
+use std::io::{self, Read};
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+
+use crate::core::config::Config;
+use crate::core::types::ModFile;
+
+const HASH_CACHE_FILE_NAME: &str = "hash_cache.json";
+
+const PRIME_1: u64 = 0x9E37_79B1_85EB_CA87;
+const PRIME_2: u64 = 0xC2B2_AE3D_27D4_EB4F;
+const PRIME_3: u64 = 0x1656_67B1_9E37_79F9;
+const PRIME_4: u64 = 0x85EB_CA77_C2B2_AE63;
+const PRIME_5: u64 = 0x27D4_EB2F_1656_67C5;
+
+fn round(acc: u64, input: u64) -> u64 {
+    acc.wrapping_add(input.wrapping_mul(PRIME_2))
+        .rotate_left(31)
+        .wrapping_mul(PRIME_1)
+}
+
+fn merge_round(acc: u64, val: u64) -> u64 {
+    (acc ^ round(0, val))
+        .wrapping_mul(PRIME_1)
+        .wrapping_add(PRIME_4)
+}
+
+fn read_u64(bytes: &[u8]) -> u64 {
+    u64::from_le_bytes(bytes[..8].try_into().unwrap_or_default())
+}
+
+/// Streaming xxHash64 with seed 0
+struct XxHash64 {
+    acc: [u64; 4],
+    total_len: u64,
+    buf: [u8; 32],
+    buf_len: usize,
+}
+
+impl XxHash64 {
+    fn new() -> Self {
+        Self {
+            acc: [
+                PRIME_1.wrapping_add(PRIME_2),
+                PRIME_2,
+                0,
+                0u64.wrapping_sub(PRIME_1),
+            ],
+            total_len: 0,
+            buf: [0; 32],
+            buf_len: 0,
+        }
+    }
+
+    fn stripe(acc: &mut [u64; 4], stripe: &[u8]) {
+        for (i, lane) in acc.iter_mut().enumerate() {
+            *lane = round(*lane, read_u64(&stripe[i * 8..]));
+        }
+    }
+
+    fn update(&mut self, mut data: &[u8]) {
+        self.total_len += data.len() as u64;
+
+        if self.buf_len > 0 {
+            let take = (32 - self.buf_len).min(data.len());
+            self.buf[self.buf_len..self.buf_len + take].copy_from_slice(&data[..take]);
+            self.buf_len += take;
+            data = &data[take..];
+            if self.buf_len < 32 {
+                return;
+            }
+            let buf = self.buf;
+            Self::stripe(&mut self.acc, &buf);
+            self.buf_len = 0;
+        }
+
+        let mut stripes = data.chunks_exact(32);
+        for stripe in &mut stripes {
+            Self::stripe(&mut self.acc, stripe);
+        }
+        let rest = stripes.remainder();
+        self.buf[..rest.len()].copy_from_slice(rest);
+        self.buf_len = rest.len();
+    }
+
+    fn finish(&self) -> u64 {
+        let [v1, v2, v3, v4] = self.acc;
+        let mut h = if self.total_len >= 32 {
+            let h = v1
+                .rotate_left(1)
+                .wrapping_add(v2.rotate_left(7))
+                .wrapping_add(v3.rotate_left(12))
+                .wrapping_add(v4.rotate_left(18));
+            [v1, v2, v3, v4].into_iter().fold(h, merge_round)
+        } else {
+            PRIME_5
+        };
+        h = h.wrapping_add(self.total_len);
+
+        let mut rest = &self.buf[..self.buf_len];
+        while rest.len() >= 8 {
+            h ^= round(0, read_u64(rest));
+            h = h
+                .rotate_left(27)
+                .wrapping_mul(PRIME_1)
+                .wrapping_add(PRIME_4);
+            rest = &rest[8..];
+        }
+        if rest.len() >= 4 {
+            let word = u32::from_le_bytes(rest[..4].try_into().unwrap_or_default());
+            h ^= (word as u64).wrapping_mul(PRIME_1);
+            h = h
+                .rotate_left(23)
+                .wrapping_mul(PRIME_2)
+                .wrapping_add(PRIME_3);
+            rest = &rest[4..];
+        }
+        for &byte in rest {
+            h ^= (byte as u64).wrapping_mul(PRIME_5);
+            h = h.rotate_left(11).wrapping_mul(PRIME_1);
+        }
+
+        h ^= h >> 33;
+        h = h.wrapping_mul(PRIME_2);
+        h ^= h >> 29;
+        h = h.wrapping_mul(PRIME_3);
+        h ^ (h >> 32)
+    }
+}
+
+/// Encode a hash the way Wabbajack writes it in modlists and `.meta` files
+pub fn encode_hash(hash: u64) -> String {
+    const ALPHABET: &[u8; 64] = b"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
+    let bytes = hash.to_le_bytes();
+    let mut encoded = String::with_capacity(12);
+    for chunk in bytes.chunks(3) {
+        let n = chunk
+            .iter()
+            .enumerate()
+            .fold(0u32, |n, (i, b)| n | (*b as u32) << (16 - 8 * i));
+        for i in 0..4 {
+            if i <= chunk.len() {
+                encoded.push(ALPHABET[(n >> (18 - 6 * i) & 0x3F) as usize] as char);
+            } else {
+                encoded.push('=');
+            }
+        }
+    }
+    encoded
+}
+
+/// Hash a file's contents in the form Wabbajack records archive hashes
+pub fn compute_file_hash(path: &Path) -> io::Result<String> {
+    let mut file = File::open(path)?;
+    let mut hasher = XxHash64::new();
+    let mut buf = vec![0u8; 1 << 20];
+    loop {
+        let read = file.read(&mut buf)?;
+        if read == 0 {
+            break;
+        }
+        hasher.update(&buf[..read]);
+    }
+    Ok(encode_hash(hasher.finish()))
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+struct CachedHash {
+    size: u64,
+    modified: Option<u64>,
+    hash: String,
+}
+
+/// Hashes computed by earlier runs, keyed by path, size and modification time
+///
+/// A file whose size or modification time changed is hashed again.
+#[derive(Debug, Default)]
+pub struct HashCache {
+    entries: Mutex<HashMap<PathBuf, CachedHash>>,
+    path: Option<PathBuf>,
+}
+
+impl HashCache {
+    /// Location of the cache file next to the config file
+    pub fn default_path() -> Option<PathBuf> {
+        Config::default_path().and_then(|p| p.parent().map(|dir| dir.join(HASH_CACHE_FILE_NAME)))
+    }
+
+    /// Load the cache from `path`, starting empty if it's missing or unreadable
+    pub fn open(path: &Path) -> Self {
+        let entries = fs::read_to_string(path)
+            .ok()
+            .and_then(|content| match serde_json::from_str(&content) {
+                Ok(entries) => Some(entries),
+                Err(e) => {
+                    log::warn!("Ignoring unreadable hash cache {:?}: {}", path, e);
+                    None
+                }
+            })
+            .unwrap_or_default();
+        Self {
+            entries: Mutex::new(entries),
+            path: Some(path.to_path_buf()),
+        }
+    }
+
+    /// Hash of a file, from the cache when the file hasn't changed
+    pub fn hash(&self, file: &ModFile) -> io::Result<String> {
+        let cached = self
+            .entries
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .get(&file.full_path)
+            .filter(|c| c.size == file.size && c.modified == file.modified)
+            .map(|c| c.hash.clone());
+        if let Some(hash) = cached {
+            return Ok(hash);
+        }
+
+        let hash = compute_file_hash(&file.full_path)?;
+        self.entries
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .insert(
+                file.full_path.clone(),
+                CachedHash {
+                    size: file.size,
+                    modified: file.modified,
+                    hash: hash.clone(),
+                },
+            );
+        Ok(hash)
+    }
+
+    /// Write the cache file, dropping files that no longer exist
+    pub fn save(&self) -> Result<()> {
+        let Some(path) = &self.path else {
+            return Ok(());
+        };
+        let mut entries = self.entries.lock().unwrap_or_else(|e| e.into_inner());
+        entries.retain(|file, _| file.exists());
+
+        if let Some(parent) = path.parent() {
+            fs::create_dir_all(parent)
+                .with_context(|| format!("Failed to create folder: {:?}", parent))?;
+        }
+        let content = serde_json::to_string(&*entries).context("Failed to serialize hash cache")?;
+        fs::write(path, content).with_context(|| format!("Failed to write hash cache: {:?}", path))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::tempdir;
+
+    fn xxh64(data: &[u8]) -> u64 {
+        let mut hasher = XxHash64::new();
+        hasher.update(data);
+        hasher.finish()
+    }
+
+    #[test]
+    fn test_xxhash64() {
+        assert_eq!(xxh64(b""), 0xEF46_DB37_51D8_E999);
+        assert_eq!(xxh64(b"abc"), 0x44BC_2CF5_AD77_0999);
+        let long = b"Nobody inspects the spammish repetition";
+        assert_eq!(xxh64(long), 0xFBCE_A83C_8A37_8BF1);
+
+        // Feeding the data in pieces gives the same hash
+        let mut hasher = XxHash64::new();
+        for piece in long.chunks(5) {
+            hasher.update(piece);
+        }
+        assert_eq!(hasher.finish(), 0xFBCE_A83C_8A37_8BF1);
+
+        assert_eq!(encode_hash(0xEF46_DB37_51D8_E999), "menYUTfbRu8=");
+    }
+
+    #[test]
+    fn test_hash_cache() {
+        let dir = tempdir().unwrap();
+        let path = dir.path().join("SkyUI-12604-5-2-1700000000.7z");
+        fs::write(&path, b"abc").unwrap();
+        let file = ModFile {
+            full_path: path.clone(),
+            size: 3,
+            modified: Some(1),
+            ..crate::core::parser::parse_mod_filename("SkyUI-12604-5-2-1700000000.7z").unwrap()
+        };
+
+        let cache_path = dir.path().join(HASH_CACHE_FILE_NAME);
+        let cache = HashCache::open(&cache_path);
+        let hash = cache.hash(&file).unwrap();
+        assert_eq!(hash, encode_hash(0x44BC_2CF5_AD77_0999));
+        cache.save().unwrap();
+
+        // An unchanged file is served from the saved cache without reading it
+        fs::write(&path, b"changed").unwrap();
+        let cache = HashCache::open(&cache_path);
+        assert_eq!(cache.hash(&file).unwrap(), hash);
+        let changed = ModFile { size: 7, ..file };
+        assert_ne!(cache.hash(&changed).unwrap(), hash);
+    }
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+//! Rolling log file for `-log`
+//!
+//! Runs append to one file. Once it grows past a size limit it is renamed to
+//! `<name>.1` at startup, older copies move up one number, and copies past
+//! the number kept are deleted, so logs never pile up.
+
+use std::fs::{self, File, OpenOptions};
+use std::io;
+use std::path::{Path, PathBuf};
+
+/// Name of the log file when `-log` is given a folder
+pub const LOG_FILE_NAME: &str = "wabbajack-library-cleaner.log";
+
+/// The file to log to for a `-log` argument
+///
+/// A folder, whether it exists or is written with a trailing separator like
+/// `logs/`, gets `LOG_FILE_NAME` inside it.
+pub fn log_file_path(arg: &str) -> PathBuf {
+    let path = PathBuf::from(arg);
+    if arg.ends_with('/') || arg.ends_with('\\') || path.is_dir() {
+        path.join(LOG_FILE_NAME)
+    } else {
+        path
+    }
+}
+
+/// Rotate the log at `path` if it has reached `max_bytes`, then open it for appending
+///
+/// `keep` rotated copies are kept; 0 keeps none, so a full log starts over.
+/// The log's folder is created if needed.
+pub fn open_log_file(path: &Path, max_bytes: u64, keep: usize) -> io::Result<File> {
+    if let Some(parent) = path.parent().filter(|p| !p.as_os_str().is_empty()) {
+        fs::create_dir_all(parent)?;
+    }
+    let full = fs::metadata(path).is_ok_and(|m| m.len() >= max_bytes);
+    if full {
+        rotate_logs(path, keep)?;
+    }
+    OpenOptions::new().create(true).append(true).open(path)
+}
+
+/// `<path>.<n>`, the n-th most recent rotated copy
+fn rotated_path(path: &Path, n: usize) -> PathBuf {
+    let mut name = path.as_os_str().to_owned();
+    name.push(format!(".{}", n));
+    PathBuf::from(name)
+}
+
+/// Numbers of the rotated copies of `path` that exist
+fn rotated_numbers(path: &Path) -> io::Result<Vec<usize>> {
+    let Some(name) = path.file_name().map(|n| n.to_string_lossy().to_string()) else {
+        return Ok(Vec::new());
+    };
+    let dir = match path.parent().filter(|p| !p.as_os_str().is_empty()) {
+        Some(dir) => dir.to_path_buf(),
+        None => PathBuf::from("."),
+    };
+    Ok(fs::read_dir(dir)?
+        .flatten()
+        .filter_map(|entry| {
+            let file_name = entry.file_name().to_string_lossy().to_string();
+            file_name
+                .strip_prefix(&name)?
+                .strip_prefix('.')?
+                .parse()
+                .ok()
+        })
+        .collect())
+}
+
+fn rotate_logs(path: &Path, keep: usize) -> io::Result<()> {
+    // The oldest kept copy is about to be replaced, and copies past `keep`,
+    // such as ones left from a larger setting, are no longer wanted
+    for n in rotated_numbers(path)?.into_iter().filter(|&n| n >= keep) {
+        fs::remove_file(rotated_path(path, n))?;
+    }
+    if keep == 0 {
+        return fs::remove_file(path);
+    }
+    for n in (1..keep).rev() {
+        let from = rotated_path(path, n);
+        if from.exists() {
+            fs::rename(&from, rotated_path(path, n + 1))?;
+        }
+    }
+    fs::rename(path, rotated_path(path, 1))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::io::Write;
+    use tempfile::tempdir;
+
+    #[test]
+    fn test_log_rotation() {
+        let dir = tempdir().unwrap();
+        let path = dir.path().join("logs").join("wlc.log");
+
+        for run in 0..4 {
+            let mut file = open_log_file(&path, 4, 2).unwrap();
+            write!(file, "run{}", run).unwrap();
+        }
+        // Leftover from a run that kept more copies
+        fs::write(rotated_path(&path, 5), "old").unwrap();
+        open_log_file(&path, 4, 2).unwrap();
+
+        assert_eq!(fs::read_to_string(&path).unwrap(), "");
+        assert_eq!(fs::read_to_string(rotated_path(&path, 1)).unwrap(), "run3");
+        assert_eq!(fs::read_to_string(rotated_path(&path, 2)).unwrap(), "run2");
+        assert!(!rotated_path(&path, 3).exists());
+        assert!(!rotated_path(&path, 5).exists());
+
+        let mut file = open_log_file(&path, 1024, 2).unwrap();
+        write!(file, "a").unwrap();
+        write!(open_log_file(&path, 1024, 2).unwrap(), "b").unwrap();
+        assert_eq!(fs::read_to_string(&path).unwrap(), "ab");
+    }
+
+    #[test]
+    fn test_log_file_path() {
+        let dir = tempdir().unwrap();
+        let arg = dir.path().to_string_lossy().to_string();
+        assert_eq!(log_file_path(&arg), dir.path().join(LOG_FILE_NAME));
+        assert_eq!(
+            log_file_path("logs/"),
+            PathBuf::from("logs/").join(LOG_FILE_NAME)
+        );
+        assert_eq!(log_file_path("run.log"), PathBuf::from("run.log"));
+    }
+}
@@ -0,0 +1,400 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+use std::fs;
+use std::fs::File;
+use std::io::Read;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+use std::sync::OnceLock;
+
+use zip::ZipArchive;
+
+use crate::core::fsops::{FileOps, RealFileOps};
+use crate::core::parser::{
+    is_numeric, is_patch_or_hotfix, strip_archive_extension, strip_version_word,
+};
+use crate::core::types::ModFile;
+
+/// Fields read from a Wabbajack/MO2 `.meta` file next to a downloaded archive
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct MetaInfo {
+    pub game_name: Option<String>,
+    pub mod_id: Option<String>,
+    pub file_id: Option<String>,
+    pub version: Option<String>,
+    /// Content hash written by Wabbajack after downloading
+    pub hash: Option<String>,
+    /// The file was removed or archived on Nexus
+    pub removed: bool,
+    /// The download was paused
+    pub paused: bool,
+}
+
+impl MetaInfo {
+    /// Why the archive must not be deleted, if its flags make it irreplaceable
+    pub fn protection_reason(&self) -> Option<&'static str> {
+        if self.removed {
+            Some("cannot be re-downloaded from Nexus")
+        } else if self.paused {
+            Some("download is marked as paused")
+        } else {
+            None
+        }
+    }
+}
+
+/// Path of the `.meta` file that belongs to an archive
+pub fn meta_path_for(archive_path: &Path) -> PathBuf {
+    let mut path = archive_path.as_os_str().to_owned();
+    path.push(".meta");
+    PathBuf::from(path)
+}
+
+/// Parse the contents of a `.meta` INI file
+///
+/// Section headers and comments are ignored, keys are matched
+/// case-insensitively and surrounding quotes are stripped from values.
+pub fn parse_meta_content(content: &str) -> MetaInfo {
+    let mut info = MetaInfo::default();
+
+    for line in content.lines() {
+        let line = line.trim();
+        if line.is_empty()
+            || line.starts_with('[')
+            || line.starts_with(';')
+            || line.starts_with('#')
+        {
+            continue;
+        }
+
+        let Some((key, value)) = line.split_once('=') else {
+            continue;
+        };
+        let value = value.trim().trim_matches('"').trim();
+        if value.is_empty() {
+            continue;
+        }
+
+        match key.trim().to_lowercase().as_str() {
+            "gamename" => info.game_name = Some(value.to_string()),
+            "modid" => info.mod_id = Some(value.to_string()),
+            "fileid" => info.file_id = Some(value.to_string()),
+            "version" => info.version = Some(value.to_string()),
+            "hash" => info.hash = Some(value.to_string()),
+            "removed" => info.removed = is_truthy(value),
+            "paused" => info.paused = is_truthy(value),
+            _ => {}
+        }
+    }
+
+    info
+}
+
+fn is_truthy(value: &str) -> bool {
+    matches!(value.to_lowercase().as_str(), "true" | "1" | "yes")
+}
+
+/// Read the `.meta` file of an archive, if one exists
+pub fn read_meta_for(archive_path: &Path) -> Option<MetaInfo> {
+    let meta_path = meta_path_for(archive_path);
+    let content = fs::read_to_string(&meta_path).ok()?;
+    Some(parse_meta_content(&content))
+}
+
+/// Read the `.meta` file of an archive through `ops`, if one exists
+pub fn read_meta_for_with(archive_path: &Path, ops: &dyn FileOps) -> Option<MetaInfo> {
+    let mut content = String::new();
+    ops.open(&meta_path_for(archive_path))
+        .ok()?
+        .read_to_string(&mut content)
+        .ok()?;
+    Some(parse_meta_content(&content))
+}
+
+/// Build a mod file from the `.meta` of an archive whose name has no ModID
+///
+/// Returns `None` unless the `.meta` has a numeric ModID. The name carries
+/// no upload timestamp, so `timestamp` is left at "0" for the caller to fill in.
+pub fn mod_file_from_meta(filename: &str, meta: &MetaInfo) -> Option<ModFile> {
+    let mod_id = meta
+        .mod_id
+        .as_deref()
+        .filter(|id| is_numeric(id) && *id != "0")?;
+    let file_id = meta
+        .file_id
+        .as_deref()
+        .filter(|id| is_numeric(id) && *id != "0");
+    let mod_name = strip_archive_extension(filename);
+
+    Some(ModFile {
+        file_name: filename.to_string(),
+        full_path: PathBuf::new(),
+        mod_name: mod_name.to_string(),
+        mod_id: mod_id.to_string(),
+        file_id: file_id.map(str::to_string),
+        version: meta
+            .version
+            .as_deref()
+            .map_or_else(|| "0.0".to_string(), |v| strip_version_word(v).to_string()),
+        timestamp: "0".to_string(),
+        size: 0,
+        is_patch: is_patch_or_hotfix(filename),
+        modified: None,
+    })
+}
+
+/// Name of the settings file some mod authors ship inside their archives
+const EMBEDDED_META_NAME: &str = "meta.ini";
+
+/// Largest embedded `meta.ini` read; anything bigger isn't an MO2 settings file
+const MAX_EMBEDDED_META_BYTES: u64 = 64 * 1024;
+
+/// Read the `meta.ini` packed inside an archive, if it has one
+///
+/// Zip archives are read directly. `.7z` and `.rar` archives need a `7z`
+/// program on the PATH or in its usual install folder; without one they are
+/// skipped. The `meta.ini` closest to the archive's root wins.
+pub fn read_embedded_meta(archive_path: &Path) -> Option<MetaInfo> {
+    let ext = archive_path.extension()?.to_string_lossy().to_lowercase();
+    let content = match ext.as_str() {
+        "zip" => read_zip_meta(archive_path),
+        "7z" | "rar" => read_7z_meta(archive_path),
+        _ => None,
+    }?;
+    Some(parse_meta_content(&content))
+}
+
+fn read_zip_meta(archive_path: &Path) -> Option<String> {
+    let mut archive = ZipArchive::new(File::open(archive_path).ok()?).ok()?;
+    let name = archive
+        .file_names()
+        .filter(|name| is_embedded_meta(name))
+        .min_by_key(|name| name.matches(['/', '\\']).count())?
+        .to_string();
+    let entry = archive.by_name(&name).ok()?;
+    if entry.size() > MAX_EMBEDDED_META_BYTES {
+        return None;
+    }
+    let mut content = String::new();
+    entry
+        .take(MAX_EMBEDDED_META_BYTES)
+        .read_to_string(&mut content)
+        .ok()?;
+    Some(content)
+}
+
+fn read_7z_meta(archive_path: &Path) -> Option<String> {
+    let program = seven_zip()?;
+    // `e -so` writes the matching files to stdout; `-r` searches every folder
+    let output = Command::new(program)
+        .args(["e", "-so", "-r", "-y", "-bd"])
+        .arg(archive_path)
+        .arg(EMBEDDED_META_NAME)
+        .output()
+        .ok()?;
+    if !output.status.success() || output.stdout.is_empty() {
+        return None;
+    }
+    let stdout = &output.stdout[..output.stdout.len().min(MAX_EMBEDDED_META_BYTES as usize)];
+    Some(String::from_utf8_lossy(stdout).into_owned())
+}
+
+fn is_embedded_meta(entry_name: &str) -> bool {
+    entry_name
+        .rsplit(['/', '\\'])
+        .next()
+        .is_some_and(|name| name.eq_ignore_ascii_case(EMBEDDED_META_NAME))
+}
+
+/// The 7-Zip program to extract with, looked up once
+fn seven_zip() -> Option<&'static Path> {
+    static PROGRAM: OnceLock<Option<PathBuf>> = OnceLock::new();
+    PROGRAM
+        .get_or_init(|| {
+            let installed = [
+                r"C:\Program Files\7-Zip\7z.exe",
+                r"C:\Program Files (x86)\7-Zip\7z.exe",
+            ]
+            .into_iter()
+            .map(PathBuf::from)
+            .filter(|p| p.is_file());
+            let program = ["7z", "7zz", "7za"]
+                .into_iter()
+                .map(PathBuf::from)
+                .chain(installed)
+                .find(|p| Command::new(p).arg("i").output().is_ok());
+            match &program {
+                Some(p) => log::info!("Reading archives with {:?}", p),
+                None => log::warn!("No 7z program found; .7z and .rar archives won't be opened"),
+            }
+            program
+        })
+        .as_deref()
+}
+
+/// Why an archive must not be deleted, based on its `.meta` flags
+pub fn protection_reason_for(archive_path: &Path) -> Option<&'static str> {
+    protection_reason_for_with(archive_path, &RealFileOps)
+}
+
+/// Why an archive must not be deleted, reading its `.meta` through `ops`
+pub fn protection_reason_for_with(archive_path: &Path, ops: &dyn FileOps) -> Option<&'static str> {
+    read_meta_for_with(archive_path, ops)?.protection_reason()
+}
+
+/// Find the `.meta` files directly inside each folder whose archive is gone
+///
+/// They are left behind when archives are deleted by hand. Sorted by path.
+pub fn find_orphaned_meta_files(folders: &[PathBuf]) -> Vec<PathBuf> {
+    let mut orphaned = Vec::new();
+    for folder in folders {
+        let entries = match fs::read_dir(folder) {
+            Ok(entries) => entries,
+            Err(e) => {
+                log::warn!("Failed to read folder {:?}: {}", folder, e);
+                continue;
+            }
+        };
+        for path in entries.filter_map(|e| e.ok()).map(|e| e.path()) {
+            let name = path
+                .file_name()
+                .map(|n| n.to_string_lossy().to_string())
+                .unwrap_or_default();
+            if name.len() <= ".meta".len() || !name.to_lowercase().ends_with(".meta") {
+                continue;
+            }
+            let archive = path.with_file_name(&name[..name.len() - ".meta".len()]);
+            if path.is_file() && !archive.exists() {
+                orphaned.push(path);
+            }
+        }
+    }
+    orphaned.sort();
+    orphaned
+}
+
+/// Describe every cleanup candidate whose `.meta` flags protect it
+pub fn find_protected_archives<'a>(files: impl IntoIterator<Item = &'a ModFile>) -> Vec<String> {
+    files
+        .into_iter()
+        .filter_map(|f| {
+            protection_reason_for(&f.full_path)
+                .map(|reason| format!("{} ({})", f.file_name, reason))
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_find_orphaned_meta_files() {
+        let dir = tempfile::tempdir().unwrap();
+        for name in [
+            "SkyUI-12604-5-2-1700000000.7z",
+            "SkyUI-12604-5-2-1700000000.7z.meta",
+            "SkyUI-12604-5-1-1600000000.7z.meta",
+            "BigMod-123-1-0-1700000000.7z.001",
+            "BigMod-123-1-0-1700000000.7z.001.meta",
+            ".meta",
+        ] {
+            fs::write(dir.path().join(name), "[General]\n").unwrap();
+        }
+        fs::create_dir(dir.path().join("Folder.meta")).unwrap();
+
+        let folders = vec![dir.path().to_path_buf(), dir.path().join("missing")];
+        assert_eq!(
+            find_orphaned_meta_files(&folders),
+            vec![dir.path().join("SkyUI-12604-5-1-1600000000.7z.meta")]
+        );
+    }
+
+    #[test]
+    fn test_meta_path_for() {
+        let path = meta_path_for(Path::new("downloads/SkyUI-12604-5-2-SE-1615410779.7z"));
+        assert_eq!(
+            path,
+            PathBuf::from("downloads/SkyUI-12604-5-2-SE-1615410779.7z.meta")
+        );
+    }
+
+    #[test]
+    fn test_parse_meta_content() {
+        let content = "[General]\r\ngameName=SkyrimSpecialEdition\r\nmodID=12604\r\nfileID=\"35407\"\r\nversion=5.2SE\r\ninstalled=true\r\n";
+        let info = parse_meta_content(content);
+        assert_eq!(info.game_name.as_deref(), Some("SkyrimSpecialEdition"));
+        assert_eq!(info.mod_id.as_deref(), Some("12604"));
+        assert_eq!(info.file_id.as_deref(), Some("35407"));
+        assert_eq!(info.version.as_deref(), Some("5.2SE"));
+        assert_eq!(info.protection_reason(), None);
+    }
+
+    #[test]
+    fn test_mod_file_from_meta() {
+        let meta =
+            parse_meta_content("[General]\r\nmodID=\"12604\"\r\nfileID=35407\r\nversion=v5.2\r\n");
+        let mod_file = mod_file_from_meta("SkyUI SE.7z", &meta).unwrap();
+        assert_eq!(mod_file.mod_name, "SkyUI SE");
+        assert_eq!(mod_file.mod_id, "12604");
+        assert_eq!(mod_file.file_id.as_deref(), Some("35407"));
+        assert_eq!(mod_file.version, "5.2");
+
+        let meta = parse_meta_content("[General]\nmodID=0\nfileID=35407\n");
+        assert!(mod_file_from_meta("SkyUI SE.7z", &meta).is_none());
+    }
+
+    #[test]
+    fn test_parse_meta_flags() {
+        let info = parse_meta_content("[General]\nremoved=true\npaused=false\n");
+        assert!(info.removed);
+        assert!(!info.paused);
+        assert_eq!(
+            info.protection_reason(),
+            Some("cannot be re-downloaded from Nexus")
+        );
+
+        let info = parse_meta_content("[General]\npaused=1\n");
+        assert!(info.paused);
+        assert!(info.protection_reason().is_some());
+    }
+
+    #[test]
+    fn test_parse_meta_content_ignores_noise() {
+        let info = parse_meta_content("; comment\n[General]\nmodID=\nbroken line\n");
+        assert_eq!(info, MetaInfo::default());
+    }
+
+    #[test]
+    fn test_read_embedded_meta() {
+        use std::io::Write;
+        use zip::write::SimpleFileOptions;
+        use zip::ZipWriter;
+
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("Some Retexture.zip");
+        let mut zip = ZipWriter::new(File::create(&path).unwrap());
+        let options = SimpleFileOptions::default();
+        zip.start_file("Data/optional/meta.ini", options).unwrap();
+        zip.write_all(b"[General]\nmodid=1\n").unwrap();
+        zip.start_file("Meta.ini", options).unwrap();
+        zip.write_all(b"[General]\nmodid=12345\nfileid=678\n")
+            .unwrap();
+        zip.finish().unwrap();
+
+        let meta = read_embedded_meta(&path).unwrap();
+        assert_eq!(meta.mod_id.as_deref(), Some("12345"));
+        assert_eq!(meta.file_id.as_deref(), Some("678"));
+
+        let plain = dir.path().join("Plain.zip");
+        let mut zip = ZipWriter::new(File::create(&plain).unwrap());
+        zip.start_file("readme.txt", options).unwrap();
+        zip.finish().unwrap();
+        assert_eq!(read_embedded_meta(&plain), None);
+    }
+}
@@ -0,0 +1,311 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+use std::collections::HashSet;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use anyhow::{bail, Context, Result};
+
+use crate::core::parser::is_numeric;
+use crate::core::types::ModlistInfo;
+
+/// Settings file at the root of every Mod Organizer 2 instance
+pub const MO2_INI_NAME: &str = "ModOrganizer.ini";
+
+/// Whether a folder is a Mod Organizer 2 instance rather than a Wabbajack folder
+pub fn is_mo2_instance(path: &Path) -> bool {
+    path.join(MO2_INI_NAME).is_file()
+        || (path.join("mods").is_dir() && path.join("profiles").is_dir())
+}
+
+/// What an installed mod's `meta.ini` says about the archive it came from
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct InstalledMod {
+    pub game_name: Option<String>,
+    pub mod_id: Option<String>,
+    /// File name of the archive it was installed from
+    pub installation_file: Option<String>,
+    /// `"<ModID>-<FileID>"` keys from the `[installedFiles]` section
+    pub file_ids: Vec<String>,
+}
+
+/// Parse the `meta.ini` of a mod in an MO2 `mods` folder
+///
+/// `installationFile` may be a full path in older instances; only its file
+/// name is kept. `[installedFiles]` entries pair up as `N\modid` and `N\fileid`.
+pub fn parse_installed_mod(content: &str) -> InstalledMod {
+    let mut info = InstalledMod::default();
+    let mut section = String::new();
+    let mut installed: Vec<(String, Option<String>, Option<String>)> = Vec::new();
+
+    for line in content.lines() {
+        let line = line.trim();
+        if line.is_empty() || line.starts_with(';') || line.starts_with('#') {
+            continue;
+        }
+        if let Some(name) = line.strip_prefix('[').and_then(|l| l.strip_suffix(']')) {
+            section = name.to_lowercase();
+            continue;
+        }
+
+        let Some((key, value)) = line.split_once('=') else {
+            continue;
+        };
+        let key = key.trim().to_lowercase();
+        let value = value.trim().trim_matches('"').trim();
+        if value.is_empty() {
+            continue;
+        }
+
+        if section == "installedfiles" {
+            let Some((index, field)) = key.split_once('\\') else {
+                continue;
+            };
+            let entry = match installed.iter_mut().position(|(i, _, _)| i == index) {
+                Some(pos) => &mut installed[pos],
+                None => {
+                    installed.push((index.to_string(), None, None));
+                    installed.last_mut().unwrap()
+                }
+            };
+            match field {
+                "modid" => entry.1 = Some(value.to_string()),
+                "fileid" => entry.2 = Some(value.to_string()),
+                _ => {}
+            }
+            continue;
+        }
+
+        match key.as_str() {
+            "gamename" => info.game_name = Some(value.to_string()),
+            "modid" => info.mod_id = Some(value.to_string()),
+            "installationfile" => {
+                let name = value.rsplit(['/', '\\']).next().unwrap_or(value);
+                if !name.is_empty() {
+                    info.installation_file = Some(name.to_string());
+                }
+            }
+            _ => {}
+        }
+    }
+
+    info.mod_id = info.mod_id.filter(|id| is_nexus_id(id));
+    info.file_ids = installed
+        .into_iter()
+        .filter_map(|(_, mod_id, file_id)| {
+            let mod_id = mod_id.filter(|id| is_nexus_id(id))?;
+            let file_id = file_id.filter(|id| is_nexus_id(id))?;
+            Some(format!("{}-{}", mod_id, file_id))
+        })
+        .collect();
+    info
+}
+
+fn is_nexus_id(id: &str) -> bool {
+    is_numeric(id) && !id.trim_start_matches('0').is_empty()
+}
+
+/// Mod names listed in a profile's `modlist.txt`, enabled or not
+///
+/// Separators and mods MO2 doesn't manage (`*` lines, such as DLCs) are left out.
+pub fn parse_profile_modlist(content: &str) -> Vec<String> {
+    content
+        .lines()
+        .filter_map(|line| {
+            let line = line.trim();
+            let name = line.strip_prefix('+').or_else(|| line.strip_prefix('-'))?;
+            (!name.is_empty() && !name.ends_with("_separator")).then(|| name.to_string())
+        })
+        .collect()
+}
+
+/// Read a setting from `ModOrganizer.ini`, ignoring the section it is in
+fn read_ini_value(content: &str, key: &str) -> Option<String> {
+    content.lines().find_map(|line| {
+        let (k, v) = line.trim().split_once('=')?;
+        let v = v.trim().trim_matches('"').trim();
+        (k.trim().eq_ignore_ascii_case(key) && !v.is_empty()).then(|| v.to_string())
+    })
+}
+
+/// A folder setting from `ModOrganizer.ini`, or `default` inside the instance
+fn instance_dir(instance: &Path, ini: &str, key: &str, default: &str) -> PathBuf {
+    read_ini_value(ini, key)
+        .map(|dir| {
+            let base = instance.to_string_lossy();
+            PathBuf::from(dir.replace("%BASE_DIR%", &base))
+        })
+        .filter(|dir| dir.is_dir())
+        .unwrap_or_else(|| instance.join(default))
+}
+
+/// Build the archives an installed MO2 instance uses, for when its `.wabbajack`
+/// file is gone
+///
+/// Every mod named in a profile's `modlist.txt` counts as used, whether it is
+/// enabled or not; without profiles every folder in `mods` does. The returned
+/// modlist references each mod's installation file, its ModID and the
+/// ModID/FileID pairs MO2 recorded, so `detect_orphaned_mods` can use it like
+/// a parsed `.wabbajack` file.
+pub fn load_mo2_instance(instance: &Path) -> Result<ModlistInfo> {
+    log::info!("Reading MO2 instance: {:?}", instance);
+
+    let ini = fs::read_to_string(instance.join(MO2_INI_NAME)).unwrap_or_default();
+    let mods_dir = instance_dir(instance, &ini, "mod_directory", "mods");
+    let profiles_dir = instance_dir(instance, &ini, "profiles_directory", "profiles");
+    if !mods_dir.is_dir() {
+        bail!("No mods folder in MO2 instance {:?}", instance);
+    }
+
+    let mut listed: Option<HashSet<String>> = None;
+    if let Ok(entries) = fs::read_dir(&profiles_dir) {
+        for entry in entries.flatten() {
+            let Ok(content) = fs::read_to_string(entry.path().join("modlist.txt")) else {
+                continue;
+            };
+            listed
+                .get_or_insert_with(HashSet::new)
+                .extend(parse_profile_modlist(&content));
+        }
+    }
+
+    let mut info = ModlistInfo {
+        file_path: instance.to_path_buf(),
+        name: instance
+            .file_name()
+            .map(|n| n.to_string_lossy().to_string())
+            .unwrap_or_else(|| "MO2".to_string()),
+        game: read_ini_value(&ini, "gameName"),
+        ..Default::default()
+    };
+
+    let entries = fs::read_dir(&mods_dir)
+        .with_context(|| format!("Failed to read directory: {:?}", mods_dir))?;
+    for entry in entries.flatten() {
+        let name = entry.file_name().to_string_lossy().to_string();
+        if listed.as_ref().is_some_and(|l| !l.contains(&name)) {
+            continue;
+        }
+        let Ok(content) = fs::read_to_string(entry.path().join("meta.ini")) else {
+            continue;
+        };
+        let installed = parse_installed_mod(&content);
+        info.mod_count += 1;
+
+        if let Some(file) = installed.installation_file {
+            if let Some(game) = installed.game_name {
+                info.archive_games.insert(file.clone(), game);
+            }
+            info.used_file_names.insert(file);
+        }
+        info.used_mod_file_ids.extend(installed.file_ids);
+        if let Some(mod_id) = installed.mod_id {
+            info.used_mod_keys.insert(mod_id);
+        }
+    }
+
+    log::info!(
+        "Read MO2 instance '{}': {} installed mods, {} unique ModIDs, {} file names",
+        info.name,
+        info.mod_count,
+        info.used_mod_keys.len(),
+        info.used_file_names.len()
+    );
+    Ok(info)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::core::parser::parse_mod_filename;
+    use crate::core::scanner::detect_orphaned_mods;
+
+    #[test]
+    fn test_parse_installed_mod() {
+        let info = parse_installed_mod(
+            "[General]\ngameName=SkyrimSE\nmodid=12604\nversion=5.2.0.0\n\
+             installationFile=C:/Modlists/downloads/SkyUI-12604-5-2SE-1600000000.7z\n\
+             [installedFiles]\n1\\modid=12604\n1\\fileid=35407\nsize=1\n",
+        );
+        assert_eq!(info.game_name.as_deref(), Some("SkyrimSE"));
+        assert_eq!(info.mod_id.as_deref(), Some("12604"));
+        assert_eq!(
+            info.installation_file.as_deref(),
+            Some("SkyUI-12604-5-2SE-1600000000.7z")
+        );
+        assert_eq!(info.file_ids, vec!["12604-35407".to_string()]);
+
+        let manual = parse_installed_mod("[General]\nmodid=0\ninstallationFile=\n");
+        assert_eq!(manual, InstalledMod::default());
+    }
+
+    #[test]
+    fn test_parse_profile_modlist() {
+        let names = parse_profile_modlist(
+            "# This file was automatically generated by Mod Organizer.\n\
+             +SkyUI\n-Disabled Mod\n*DLC: Dawnguard\n+Visuals_separator\n",
+        );
+        assert_eq!(names, vec!["SkyUI".to_string(), "Disabled Mod".to_string()]);
+    }
+
+    #[test]
+    fn test_load_mo2_instance() {
+        let dir = tempfile::tempdir().unwrap();
+        let instance = dir.path().join("My List");
+        fs::create_dir_all(instance.join("profiles/Default")).unwrap();
+        fs::write(
+            instance.join(MO2_INI_NAME),
+            "[General]\ngameName=Skyrim Special Edition\n",
+        )
+        .unwrap();
+        fs::write(
+            instance.join("profiles/Default/modlist.txt"),
+            "+SkyUI\n-USSEP\n",
+        )
+        .unwrap();
+        for (name, meta) in [
+            (
+                "SkyUI",
+                "[General]\nmodid=12604\ninstallationFile=SkyUI-12604-5-2SE-1600000000.7z\n\
+                 [installedFiles]\n1\\modid=12604\n1\\fileid=35407\n",
+            ),
+            ("USSEP", "[General]\nmodid=266\n"),
+            ("Leftover", "[General]\nmodid=999\n"),
+        ] {
+            fs::create_dir_all(instance.join("mods").join(name)).unwrap();
+            fs::write(instance.join("mods").join(name).join("meta.ini"), meta).unwrap();
+        }
+
+        assert!(is_mo2_instance(&instance));
+        assert!(!is_mo2_instance(dir.path()));
+
+        let info = load_mo2_instance(&instance).unwrap();
+        assert_eq!(info.name, "My List");
+        assert_eq!(info.game.as_deref(), Some("Skyrim Special Edition"));
+        assert_eq!(info.mod_count, 2);
+        assert!(info
+            .used_file_names
+            .contains("SkyUI-12604-5-2SE-1600000000.7z"));
+        assert!(info.used_mod_file_ids.contains("12604-35407"));
+        assert!(info.used_mod_keys.contains("266"));
+        assert!(!info.used_mod_keys.contains("999"));
+
+        let files: Vec<_> = [
+            "SkyUI-12604-5-2SE-1600000000.7z",
+            "USSEP-266-4-2-5-1600000000.7z",
+            "Leftover-999-1-0-1600000000.7z",
+        ]
+        .iter()
+        .map(|name| parse_mod_filename(name).unwrap())
+        .collect();
+        let result = detect_orphaned_mods(&files, &[info]);
+        assert_eq!(result.used_mods.len(), 2);
+        assert_eq!(result.orphaned_mods.len(), 1);
+        assert_eq!(result.orphaned_mods[0].file.mod_id, "999");
+    }
+}
@@ -6,11 +6,43 @@
 // (at your option) any later version.
 
 pub mod cleaner;
+pub mod config;
+pub mod exclusions;
+pub mod fsops;
+pub mod games;
+pub mod hash;
+pub mod logfile;
+pub mod meta;
+pub mod mo2;
 pub mod parser;
+pub mod pins;
+pub mod repair;
+pub mod report;
+pub mod restore;
+pub mod resume;
 pub mod scanner;
+pub mod stat_cache;
+pub mod trace;
+pub mod trash;
 pub mod types;
 
 pub use cleaner::*;
+pub use config::*;
+pub use exclusions::*;
+pub use fsops::*;
+pub use games::*;
+pub use hash::*;
+pub use logfile::*;
+pub use meta::*;
+pub use mo2::*;
 pub use parser::*;
+pub use pins::*;
+pub use repair::*;
+pub use report::*;
+pub use restore::*;
+pub use resume::*;
 pub use scanner::*;
+pub use stat_cache::*;
+pub use trace::*;
+pub use trash::*;
 pub use types::*;
@@ -5,16 +5,19 @@
 // the Free Software Foundation, either version 3 of the License, or
 // (at your option) any later version.
 
-use std::collections::HashSet;
+use std::cmp::Ordering;
+use std::collections::{HashMap, HashSet};
 use std::fs::File;
-use std::io::Read;
-use std::path::Path;
+use std::io::{BufReader, Read, Seek};
+use std::path::{Path, PathBuf};
 
 use anyhow::{Context, Result};
 use serde::Deserialize;
 use zip::ZipArchive;
 
-use crate::core::types::{ModFile, ModlistInfo, ARCHIVE_EXTENSIONS};
+use crate::core::cleaner::format_size;
+use crate::core::fsops::{FileOps, RealFileOps};
+use crate::core::types::{ExpectedArchive, ModFile, ModlistInfo, SkipReason, ARCHIVE_EXTENSIONS};
 
 /// JSON structures for parsing .wabbajack files
 #[derive(Debug, Deserialize)]
@@ -27,20 +30,33 @@ struct Modlist {
     #[serde(rename = "Author")]
     #[allow(dead_code)]
     author: Option<String>,
+    #[serde(rename = "GameType")]
+    game_type: Option<String>,
+    #[serde(rename = "Description")]
+    description: Option<String>,
+    #[serde(rename = "Readme")]
+    readme: Option<String>,
+    #[serde(rename = "Image")]
+    image: Option<String>,
     #[serde(rename = "Archives")]
     archives: Vec<ModlistArchive>,
 }
 
+/// A modlist wrapped in an outer object, as some newer .wabbajack files store it
+#[derive(Debug, Deserialize)]
+struct NestedModlist {
+    #[serde(rename = "ModList", alias = "Modlist", alias = "modlist")]
+    modlist: Modlist,
+}
+
 #[derive(Debug, Deserialize)]
 struct ModlistArchive {
     #[serde(rename = "Hash")]
-    #[allow(dead_code)]
     hash: Option<String>,
     #[serde(rename = "Name")]
     #[allow(dead_code)]
     name: Option<String>,
     #[serde(rename = "Size")]
-    #[allow(dead_code)]
     size: Option<i64>,
     #[serde(rename = "State")]
     state: ModlistModState,
@@ -49,23 +65,39 @@ struct ModlistArchive {
 #[derive(Debug, Deserialize)]
 struct ModlistModState {
     #[serde(rename = "$type")]
-    #[allow(dead_code)]
     type_name: Option<String>,
     #[serde(rename = "ModID")]
     mod_id: Option<i64>,
     #[serde(rename = "FileID")]
     file_id: Option<i64>,
     #[serde(rename = "GameName")]
-    #[allow(dead_code)]
     game_name: Option<String>,
     #[serde(rename = "Name")]
     #[allow(dead_code)]
     name: Option<String>,
     #[serde(rename = "Version")]
-    #[allow(dead_code)]
     version: Option<String>,
 }
 
+/// Downloader named by a `State.$type`, e.g. "Nexus" for
+/// "NexusDownloader, Wabbajack.Lib" or "NexusDownloader+State, Wabbajack.Lib"
+pub fn downloader_name(type_name: &str) -> &str {
+    let name = type_name
+        .split([',', '+'])
+        .next()
+        .unwrap_or_default()
+        .trim();
+    name.strip_suffix("Downloader").unwrap_or(name)
+}
+
+/// File name with case and underscores ignored
+///
+/// Browsers and manual downloads often change these, so an archive a modlist
+/// lists can end up on disk as "sky_ui_5.2.7z" instead of "Sky UI 5.2.7z".
+pub fn loose_file_name(file_name: &str) -> String {
+    file_name.to_lowercase().replace('_', " ")
+}
+
 /// Check if a string contains only digits (optionally with leading minus)
 pub fn is_numeric(s: &str) -> bool {
     if s.is_empty() {
@@ -75,32 +107,102 @@ pub fn is_numeric(s: &str) -> bool {
     !s.is_empty() && s.chars().all(|c| c.is_ascii_digit())
 }
 
-/// Check if a string looks like a version pattern (e.g., "1.2.3", "v1.0")
+/// Words that may introduce a version number, longest first
+const VERSION_WORDS: &[&str] = &["version", "ver", "rev", "v"];
+
+/// Strip a leading "version"/"ver"/"rev"/"v" word that is followed by a number
+///
+/// "Version 2", "ver3" and "rev 1.2" become "2", "3" and "1.2". Anything
+/// else, like "Reverb", is returned unchanged.
+pub fn strip_version_word(s: &str) -> &str {
+    let lower = s.to_lowercase();
+    for word in VERSION_WORDS {
+        if lower.starts_with(word) && s.is_char_boundary(word.len()) {
+            let rest = s[word.len()..].trim_start_matches([' ', '.', '_']);
+            if rest.starts_with(|c: char| c.is_ascii_digit()) {
+                return rest;
+            }
+        }
+    }
+    s
+}
+
+/// Check if a string looks like a version pattern (e.g., "1.2.3", "v1.0", "Version 2")
 pub fn is_version_pattern(s: &str) -> bool {
-    let s = s.to_lowercase();
-    let s = s.strip_prefix('v').unwrap_or(&s);
+    let s = strip_version_word(s);
 
     let mut has_digit = false;
     for c in s.chars() {
         if c.is_ascii_digit() {
             has_digit = true;
-        } else if c != '.' && c != '-' && c != '_' {
+        } else if c != '.' && c != '-' && c != '_' && c != ' ' {
             return false;
         }
     }
     has_digit
 }
 
+/// Suffixes that mark a version as a pre-release of its numbers
+const PRERELEASE_WORDS: &[&str] = &["alpha", "beta", "rc", "pre", "preview", "dev", "test"];
+
+/// Sort key of a version: numbers without trailing zeros, then whether it's a
+/// full release, then the pre-release suffix
+fn version_key(version: &str) -> Option<(Vec<u64>, bool, String)> {
+    let version = strip_version_word(version.trim());
+    let mut numbers = Vec::new();
+    let mut suffix = String::new();
+
+    for part in version.split(['.', '-', '_', ' ']) {
+        if !suffix.is_empty() {
+            suffix.push_str(part);
+            continue;
+        }
+        let digits = part.len() - part.trim_start_matches(|c: char| c.is_ascii_digit()).len();
+        if digits > 0 {
+            numbers.push(part[..digits].parse::<u64>().ok()?);
+        }
+        suffix.push_str(&part[digits..].to_lowercase());
+    }
+    if numbers.is_empty() {
+        return None;
+    }
+    while numbers.last() == Some(&0) {
+        numbers.pop();
+    }
+
+    let prerelease = PRERELEASE_WORDS.iter().any(|w| suffix.starts_with(w));
+    if !prerelease {
+        // Other text, like "SE" in "5.2SE", doesn't order versions
+        suffix.clear();
+    }
+    Some((numbers, !prerelease, suffix))
+}
+
+/// Compare two version strings by their numbers
+///
+/// Dots, dashes and underscores all separate numbers, a leading "v" is
+/// ignored and missing numbers count as zero, so "v1.2" equals "1.2.0". A
+/// pre-release suffix like "1.2-beta" sorts before "1.2". Returns `None`
+/// when either version has no leading number.
+pub fn compare_versions(a: &str, b: &str) -> Option<Ordering> {
+    Some(version_key(a)?.cmp(&version_key(b)?))
+}
+
 /// Normalize mod name by removing trailing version patterns
 pub fn normalize_mod_name(mod_name: &str) -> String {
     let parts: Vec<&str> = mod_name.split(' ').collect();
     let mut clean_parts = Vec::new();
 
-    for part in parts {
-        if is_version_pattern(part) {
+    for (i, part) in parts.iter().enumerate() {
+        // A version word on its own, followed by the number: "Mod Version 2"
+        let is_version_word = VERSION_WORDS.contains(&part.to_lowercase().as_str())
+            && parts
+                .get(i + 1)
+                .is_some_and(|next| is_version_pattern(next));
+        if is_version_pattern(part) || is_version_word {
             break;
         }
-        clean_parts.push(part);
+        clean_parts.push(*part);
     }
 
     if clean_parts.is_empty() {
@@ -178,40 +280,263 @@ pub fn extract_part_indicator(filename: &str) -> Option<String> {
     None
 }
 
+/// Part indicator in a parsed file's ModName
+///
+/// Only the name is searched: the ModID, FileID and version after it are all
+/// dash-separated numbers, so a version like `-2-0-` would otherwise read as
+/// part 2. A part number right before the ModID, as in `Textures -1-12345-...`,
+/// still counts.
+pub fn name_part_indicator(mod_file: &ModFile) -> Option<String> {
+    extract_part_indicator(&format!("{}-", mod_file.mod_name))
+}
+
+/// Words that introduce a FOMOD-style option, e.g. "Option A"
+const OPTION_WORDS: &[&str] = &["option", "opt", "variant", "choice"];
+
+/// Words naming one of a pair of alternative downloads, e.g. "Dark" and "Light"
+const OPTION_ALTERNATIVES: &[&str] = &[
+    "dark", "light", "day", "night", "male", "female", "black", "white", "summer", "winter",
+];
+
+/// How a scan reads archive file names
+///
+/// Scans take these from the config and pass them down to each file they
+/// read. The free functions of this module use the defaults.
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct ParseOptions {
+    /// Lowercased, each with a leading dot; empty means [`ARCHIVE_EXTENSIONS`]
+    extensions: Vec<String>,
+    /// Open archives to read a `meta.ini` packed inside them
+    ///
+    /// Off by default, as opening every unrecognized archive is slow on large
+    /// libraries. Only used for archives whose name has no ModID and that
+    /// have no `.meta` file next to them.
+    pub inspect_archives: bool,
+}
+
+impl ParseOptions {
+    /// Recognize these extensions as archives instead of the defaults
+    ///
+    /// Entries are matched ignoring case, and a missing leading dot is added.
+    /// An empty list keeps [`ARCHIVE_EXTENSIONS`].
+    pub fn with_extensions(extensions: &[String]) -> Self {
+        let extensions = extensions
+            .iter()
+            .map(|ext| ext.trim().trim_start_matches('.').to_lowercase())
+            .filter(|ext| !ext.is_empty())
+            .map(|ext| format!(".{}", ext))
+            .collect();
+        Self {
+            extensions,
+            ..Self::default()
+        }
+    }
+
+    /// See [`archive_extension`]
+    pub fn archive_extension(&self, filename: &str) -> Option<String> {
+        if self.extensions.is_empty() {
+            find_archive_extension(filename, ARCHIVE_EXTENSIONS)
+        } else {
+            find_archive_extension(filename, &self.extensions)
+        }
+    }
+
+    /// See [`split_archive_part`]
+    pub fn split_archive_part<'a>(&self, filename: &'a str) -> Option<(&'a str, u32)> {
+        let (base, suffix) = filename.rsplit_once('.')?;
+        if suffix.len() != 3 || !is_numeric(suffix) {
+            return None;
+        }
+        self.archive_extension(base)?;
+        let part = suffix.parse().ok()?;
+        (part > 0).then_some((base, part))
+    }
+
+    /// See [`is_later_archive_part`]
+    pub fn is_later_archive_part(&self, filename: &str) -> bool {
+        self.split_archive_part(filename)
+            .is_some_and(|(_, part)| part > 1)
+    }
+
+    /// See [`has_valid_archive_extension`]
+    pub fn has_valid_archive_extension(&self, filename: &str) -> bool {
+        let name = self
+            .split_archive_part(filename)
+            .map_or(filename, |(base, _)| base);
+        self.archive_extension(name).is_some()
+    }
+
+    /// See [`is_wabbajack_file`]
+    pub fn is_wabbajack_file(&self, filename: &str) -> bool {
+        self.has_valid_archive_extension(filename) && !is_temp_file(filename)
+    }
+
+    /// File name without its archive extension, looking past the part
+    /// number of a multi-part archive
+    fn archive_stem<'a>(&self, filename: &'a str) -> Option<&'a str> {
+        let archive_name = self
+            .split_archive_part(filename)
+            .map_or(filename, |(base, _)| base);
+        let ext = self.archive_extension(archive_name)?;
+        archive_name.get(..archive_name.len() - ext.len())
+    }
+
+    /// See [`skip_reason`]
+    pub fn skip_reason(&self, filename: &str) -> SkipReason {
+        if is_temp_file(filename) {
+            return SkipReason::TempFile;
+        }
+        let Some(name_without_ext) = self.archive_stem(filename) else {
+            return SkipReason::BadExtension;
+        };
+        let parts: Vec<&str> = name_without_ext.split('-').collect();
+        if parts.len() < 3 {
+            return SkipReason::NoDash;
+        }
+        let timestamp = parts[parts.len() - 1];
+        if !is_numeric(timestamp) || timestamp.len() < 10 {
+            return SkipReason::NoTimestamp;
+        }
+        SkipReason::NoModId
+    }
+
+    /// See [`parse_mod_filename`]
+    pub fn parse_mod_filename(&self, filename: &str) -> Option<ModFile> {
+        parse_name_parts(filename, self.archive_stem(filename)?)
+    }
+}
+
+/// The archive extension a file name ends with, lowercased
+///
+/// The longest match wins, and a `.tar` in front of a compression
+/// extension is included, so "Mod.tar.zst" has the extension ".tar.zst".
+pub fn archive_extension(filename: &str) -> Option<String> {
+    ParseOptions::default().archive_extension(filename)
+}
+
+fn find_archive_extension(filename: &str, extensions: &[impl AsRef<str>]) -> Option<String> {
+    let lower = filename.to_lowercase();
+    let ext = extensions
+        .iter()
+        .map(AsRef::as_ref)
+        .filter(|ext| lower.ends_with(ext) && lower.len() > ext.len())
+        .max_by_key(|ext| ext.len())?;
+    let stem = &lower[..lower.len() - ext.len()];
+    if !ext.starts_with(".tar") && stem.ends_with(".tar") && stem.len() > 4 {
+        return Some(format!(".tar{}", ext));
+    }
+    Some(ext.to_string())
+}
+
+/// File name without its archive extension, or the whole name if it has none
+pub fn strip_archive_extension(filename: &str) -> &str {
+    archive_extension(filename)
+        .and_then(|ext| filename.get(..filename.len() - ext.len()))
+        .unwrap_or(filename)
+}
+
+/// Extract a FOMOD-style option from a file name (e.g., "Option A", "Dark")
+///
+/// Different options of one mod are separate downloads that may share the
+/// ModID and version, so the option becomes part of the group key.
+pub fn extract_option_indicator(filename: &str) -> Option<String> {
+    let lower = filename.to_lowercase();
+    let stem = strip_archive_extension(&lower);
+    let words: Vec<&str> = stem
+        .split(|c: char| !c.is_alphanumeric())
+        .filter(|w| !w.is_empty())
+        .collect();
+
+    for (i, word) in words.iter().enumerate() {
+        if OPTION_WORDS.contains(word) {
+            if let Some(choice) = words.get(i + 1) {
+                return Some(format!(":option-{}", choice));
+            }
+        }
+    }
+
+    words
+        .iter()
+        .find(|w| OPTION_ALTERNATIVES.contains(w))
+        .map(|w| format!(":option-{}", w))
+}
+
 /// Check if a file has a valid archive extension
+///
+/// Parts of a multi-part archive, like "Mod.7z.001", count as archives.
 pub fn has_valid_archive_extension(filename: &str) -> bool {
-    let lower = filename.to_lowercase();
-    ARCHIVE_EXTENSIONS.iter().any(|ext| lower.ends_with(ext))
+    ParseOptions::default().has_valid_archive_extension(filename)
+}
+
+/// Split a multi-part archive name like "Mod.7z.002" into "Mod.7z" and 2
+pub fn split_archive_part(filename: &str) -> Option<(&str, u32)> {
+    ParseOptions::default().split_archive_part(filename)
+}
+
+/// Check if a file is the second or a later part of a multi-part archive
+///
+/// The first part stands for the whole set.
+pub fn is_later_archive_part(filename: &str) -> bool {
+    ParseOptions::default().is_later_archive_part(filename)
+}
+
+/// Every part of an archive, starting with the given first part
+///
+/// Parts of a multi-part archive are numbered without gaps, so the set ends
+/// at the first missing number. Any other archive is its only part.
+pub fn archive_parts(first_part: &Path) -> Vec<PathBuf> {
+    archive_parts_with(first_part, &RealFileOps)
+}
+
+/// Every part of an archive, looking the later parts up through `ops`
+pub fn archive_parts_with(first_part: &Path, ops: &dyn FileOps) -> Vec<PathBuf> {
+    let mut parts = vec![first_part.to_path_buf()];
+    let name = first_part
+        .file_name()
+        .map(|n| n.to_string_lossy().to_string());
+    let Some((base, 1)) = name.as_deref().and_then(split_archive_part) else {
+        return parts;
+    };
+    for number in 2..=999 {
+        let part = first_part.with_file_name(format!("{}.{:03}", base, number));
+        if !ops.exists(&part) {
+            break;
+        }
+        parts.push(part);
+    }
+    parts
 }
 
 /// Check if a file is a valid Wabbajack mod file
 pub fn is_wabbajack_file(filename: &str) -> bool {
-    if !has_valid_archive_extension(filename) {
-        return false;
-    }
+    ParseOptions::default().is_wabbajack_file(filename)
+}
 
+/// A download in progress or an editor's temporary file
+fn is_temp_file(filename: &str) -> bool {
     let lower = filename.to_lowercase();
-    if lower.contains(".part")
+    lower.contains(".part")
         || lower.contains(".tmp")
         || lower.contains(".download")
+        || lower.ends_with(".crdownload")
         || lower.starts_with('~')
-    {
-        return false;
-    }
+}
 
-    true
+/// Why [`parse_mod_filename`] can't read a file name
+///
+/// Names it can read are reported as having no ModID, which is what the
+/// scan skips them for when their `.meta` has none either.
+pub fn skip_reason(filename: &str) -> SkipReason {
+    ParseOptions::default().skip_reason(filename)
 }
 
 /// Parse a mod filename into its components
 pub fn parse_mod_filename(filename: &str) -> Option<ModFile> {
-    // Check extension
-    let ext = ARCHIVE_EXTENSIONS
-        .iter()
-        .find(|ext| filename.to_lowercase().ends_with(*ext))?;
-
-    // Remove extension
-    let name_without_ext = &filename[..filename.len() - ext.len()];
+    ParseOptions::default().parse_mod_filename(filename)
+}
 
+/// Read ModID, FileID, version and timestamp from a file name without its extension
+fn parse_name_parts(filename: &str, name_without_ext: &str) -> Option<ModFile> {
     // Split by dash
     let parts: Vec<&str> = name_without_ext.split('-').collect();
     if parts.len() < 3 {
@@ -257,6 +582,7 @@ pub fn parse_mod_filename(filename: &str) -> Option<ModFile> {
     // Version = parts after ModID (and FileID if present) until timestamp
     let version_start = file_id_index.map(|i| i + 1).unwrap_or(mod_id_index + 1);
     let version = parts[version_start..parts.len() - 1].join("-");
+    let version = strip_version_word(&version).replace(' ', "-");
 
     Some(ModFile {
         file_name: filename.to_string(),
@@ -268,51 +594,238 @@ pub fn parse_mod_filename(filename: &str) -> Option<ModFile> {
         timestamp: timestamp.to_string(),
         size: 0,
         is_patch: is_patch_or_hotfix(filename),
+        modified: None,
     })
 }
 
-/// Parse a .wabbajack file and extract modlist information
-pub fn parse_wabbajack_file(file_path: &Path) -> Result<ModlistInfo> {
-    log::info!("Parsing wabbajack file: {:?}", file_path);
+/// A file whose name has no ModID, e.g. a download from GitHub or a direct URL
+///
+/// It has no version history, but is still tracked so it can be found orphaned.
+pub fn generic_mod_file(filename: &str) -> ModFile {
+    ModFile {
+        file_name: filename.to_string(),
+        full_path: std::path::PathBuf::new(),
+        mod_name: filename.to_string(), // Use full filename as name
+        mod_id: "0".to_string(),        // Default ID for unknown
+        file_id: None,
+        version: "0.0".to_string(),
+        timestamp: "0".to_string(),
+        size: 0,
+        is_patch: false,
+        modified: None,
+    }
+}
 
+/// Sum the uncompressed sizes of all entries in a zip archive
+pub fn zip_uncompressed_size(file_path: &Path) -> Result<u64> {
+    let file = File::open(file_path)
+        .with_context(|| format!("Failed to open archive: {:?}", file_path))?;
+
+    let mut archive = ZipArchive::new(file)
+        .with_context(|| format!("Failed to read archive as ZIP: {:?}", file_path))?;
+
+    let mut total = 0u64;
+    for i in 0..archive.len() {
+        let entry = archive
+            .by_index(i)
+            .with_context(|| format!("Failed to read entry {} in {:?}", i, file_path))?;
+        total += entry.size();
+    }
+
+    Ok(total)
+}
+
+/// Characters of a bundled readme kept for display
+const README_PREVIEW_CHARS: usize = 500;
+
+/// Largest modlist image read from a .wabbajack file
+const MAX_IMAGE_BYTES: u64 = 4 * 1024 * 1024;
+
+/// Cut text to at most `max_chars` characters, marking the cut with "..."
+fn truncate_chars(text: &str, max_chars: usize) -> String {
+    let text = text.trim();
+    match text.char_indices().nth(max_chars) {
+        Some((idx, _)) => format!("{}...", text[..idx].trim_end()),
+        None => text.to_string(),
+    }
+}
+
+/// Read the start of a readme bundled in the .wabbajack file, if there is one
+fn read_bundled_readme<R: Read + std::io::Seek>(archive: &mut ZipArchive<R>) -> Option<String> {
+    let name = archive
+        .file_names()
+        .find(|n| {
+            let lower = n.to_lowercase();
+            lower.starts_with("readme") && (lower.ends_with(".md") || lower.ends_with(".txt"))
+        })?
+        .to_string();
+
+    let mut content = String::new();
+    archive
+        .by_name(&name)
+        .ok()?
+        .read_to_string(&mut content)
+        .ok()?;
+    let content = truncate_chars(&content, README_PREVIEW_CHARS);
+    (!content.is_empty()).then_some(content)
+}
+
+/// Read the modlist image stored in the .wabbajack file
+fn read_modlist_image<R: Read + std::io::Seek>(
+    archive: &mut ZipArchive<R>,
+    name: Option<&str>,
+) -> Option<Vec<u8>> {
+    let name = name
+        .filter(|n| !n.is_empty() && !n.contains("://"))
+        .unwrap_or("modlist-image.png");
+    let mut entry = archive.by_name(name).ok()?;
+    if entry.size() > MAX_IMAGE_BYTES {
+        log::info!("Skipping modlist image {}: too large", name);
+        return None;
+    }
+
+    let mut bytes = Vec::new();
+    entry.read_to_end(&mut bytes).ok()?;
+    Some(bytes)
+}
+
+/// Largest archive size a plain ZIP directory can describe; beyond it ZIP64 is required
+const ZIP64_THRESHOLD: u64 = u32::MAX as u64;
+
+/// Open a .wabbajack file as a ZIP archive
+///
+/// Modlists over 4 GB are ZIP64 archives. Those fail to open when the
+/// download was cut short, so the error says so instead of only reporting
+/// a broken ZIP.
+fn open_wabbajack_archive(file_path: &Path) -> Result<ZipArchive<BufReader<File>>> {
     let file = File::open(file_path)
         .with_context(|| format!("Failed to open wabbajack file: {:?}", file_path))?;
+    let len = file.metadata().map(|m| m.len()).unwrap_or(0);
 
-    let mut archive =
-        ZipArchive::new(file).with_context(|| "Failed to read wabbajack file as ZIP")?;
+    ZipArchive::new(BufReader::new(file)).with_context(|| {
+        if len > ZIP64_THRESHOLD {
+            format!(
+                "Failed to read wabbajack file as ZIP64 ({}): the file may be incomplete, try downloading it again",
+                format_size(len)
+            )
+        } else {
+            "Failed to read wabbajack file as ZIP".to_string()
+        }
+    })
+}
 
-    // Find and read the "modlist" file
-    let mut modlist_content = String::new();
-    {
-        let mut modlist_file = archive
-            .by_name("modlist")
-            .with_context(|| "modlist file not found in archive")?;
-        modlist_file
-            .read_to_string(&mut modlist_content)
-            .with_context(|| "Failed to read modlist file")?;
+/// Name of the archive entry holding the modlist JSON
+///
+/// Usually `modlist` at the root; some newer files keep it in a folder, so
+/// the shallowest entry whose last path part is `modlist` is used instead.
+fn find_modlist_entry<R: Read + Seek>(archive: &ZipArchive<R>) -> Option<String> {
+    if archive.index_for_name("modlist").is_some() {
+        return Some("modlist".to_string());
     }
+    archive
+        .file_names()
+        .filter(|name| {
+            name.rsplit(['/', '\\'])
+                .next()
+                .is_some_and(|last| last.eq_ignore_ascii_case("modlist"))
+        })
+        .min_by_key(|name| name.matches(['/', '\\']).count())
+        .map(str::to_string)
+}
+
+/// Stream a modlist entry into the parser; it can be hundreds of MB
+fn read_modlist_entry<T: serde::de::DeserializeOwned>(
+    archive: &mut ZipArchive<BufReader<File>>,
+    entry: &str,
+) -> Result<T> {
+    let file = archive
+        .by_name(entry)
+        .with_context(|| format!("Failed to read {} from archive", entry))?;
+    serde_json::from_reader(BufReader::new(file)).with_context(|| "Failed to parse modlist JSON")
+}
+
+/// Parse a .wabbajack file and extract modlist information
+pub fn parse_wabbajack_file(file_path: &Path) -> Result<ModlistInfo> {
+    log::info!("Parsing wabbajack file: {:?}", file_path);
 
-    let modlist: Modlist =
-        serde_json::from_str(&modlist_content).with_context(|| "Failed to parse modlist JSON")?;
+    let mut archive = open_wabbajack_archive(file_path)?;
+
+    let entry = find_modlist_entry(&archive).context("modlist file not found in archive")?;
+    let modlist = match read_modlist_entry::<Modlist>(&mut archive, &entry) {
+        Ok(modlist) => modlist,
+        // Only read it a second time when the plain layout didn't fit
+        Err(e) => read_modlist_entry::<NestedModlist>(&mut archive, &entry)
+            .map(|nested| nested.modlist)
+            .map_err(|_| e)?,
+    };
+
+    let readme = read_bundled_readme(&mut archive)
+        .or_else(|| modlist.readme.clone().filter(|r| !r.trim().is_empty()));
+    let image = read_modlist_image(&mut archive, modlist.image.as_deref());
 
     // Build sets for used mods
     let mut used_mod_keys = HashSet::new();
     let mut used_mod_file_ids = HashSet::new();
     let mut used_file_names = HashSet::new();
+    let mut archive_games = HashMap::new();
+    let mut archive_hashes = HashMap::new();
+    let mut archive_sizes = HashMap::new();
+    let mut archives = Vec::new();
+    let mut other_sources = 0;
 
     for arch in &modlist.archives {
+        // Only Nexus states carry ModIDs; other sources are known by name and hash.
+        // Lists too old to record a $type only used Nexus IDs.
+        let source = arch.state.type_name.as_deref().map(downloader_name);
+        if source.is_some_and(|s| s != "Nexus") {
+            other_sources += 1;
+        }
+
         // Collect exact file names for precise matching
         if let Some(ref name) = arch.name {
             if !name.is_empty() {
                 used_file_names.insert(name.clone());
+
+                if let Some(ref hash) = arch.hash {
+                    if !hash.is_empty() {
+                        archive_hashes.insert(name.clone(), hash.clone());
+                    }
+                }
+
+                if let Some(size) = arch.size.filter(|s| *s > 0) {
+                    archive_sizes.insert(name.clone(), size as u64);
+                }
+
+                if let Some(ref game) = arch.state.game_name {
+                    if !game.is_empty() {
+                        archive_games.insert(name.clone(), game.clone());
+                    }
+                }
             }
         }
 
-        if let Some(mod_id) = arch.state.mod_id {
+        if let Some(mod_id) = arch
+            .state
+            .mod_id
+            .filter(|_| source.is_none_or(|s| s == "Nexus"))
+        {
             if mod_id > 0 {
                 // ModID-only key (backward compatibility)
                 used_mod_keys.insert(mod_id.to_string());
 
+                if let Some(ref name) = arch.name {
+                    archives.push(ExpectedArchive {
+                        file_name: name.clone(),
+                        mod_id: mod_id.to_string(),
+                        file_id: arch
+                            .state
+                            .file_id
+                            .filter(|id| *id > 0)
+                            .map(|id| id.to_string()),
+                        version: arch.state.version.clone().filter(|v| !v.is_empty()),
+                    });
+                }
+
                 // ModID+FileID combination key for precise matching
                 if let Some(file_id) = arch.state.file_id {
                     if file_id > 0 {
@@ -324,9 +837,10 @@ pub fn parse_wabbajack_file(file_path: &Path) -> Result<ModlistInfo> {
     }
 
     log::info!(
-        "Parsed modlist '{}': {} archives, {} unique ModIDs, {} file names",
+        "Parsed modlist '{}': {} archives ({} not from Nexus), {} unique ModIDs, {} file names",
         modlist.name,
         modlist.archives.len(),
+        other_sources,
         used_mod_keys.len(),
         used_file_names.len()
     );
@@ -334,10 +848,22 @@ pub fn parse_wabbajack_file(file_path: &Path) -> Result<ModlistInfo> {
     Ok(ModlistInfo {
         file_path: file_path.to_path_buf(),
         name: modlist.name,
+        game: modlist.game_type.filter(|g| !g.is_empty()),
         mod_count: modlist.archives.len(),
         used_mod_keys,
         used_mod_file_ids,
         used_file_names,
+        archive_games,
+        archive_hashes,
+        archive_sizes,
+        archives,
+        description: modlist
+            .description
+            .as_deref()
+            .map(|d| truncate_chars(d, README_PREVIEW_CHARS))
+            .filter(|d| !d.is_empty()),
+        readme,
+        image,
     })
 }
 
@@ -345,6 +871,132 @@ pub fn parse_wabbajack_file(file_path: &Path) -> Result<ModlistInfo> {
 mod tests {
     use super::*;
 
+    #[test]
+    fn test_parse_modlist_readme_and_image() {
+        use std::io::Write;
+        use zip::write::SimpleFileOptions;
+        use zip::ZipWriter;
+
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("wj-abc123.wabbajack");
+        let mut zip = ZipWriter::new(File::create(&path).unwrap());
+        let options = SimpleFileOptions::default();
+        zip.start_file("modlist", options).unwrap();
+        zip.write_all(
+            br#"{"Name": "Test", "Description": "A test list", "Image": "modlist-image.png", "Archives": []}"#,
+        )
+        .unwrap();
+        zip.start_file("README.md", options).unwrap();
+        zip.write_all("x".repeat(600).as_bytes()).unwrap();
+        zip.start_file("modlist-image.png", options).unwrap();
+        zip.write_all(b"png").unwrap();
+        zip.finish().unwrap();
+
+        let info = parse_wabbajack_file(&path).unwrap();
+        assert_eq!(info.description.as_deref(), Some("A test list"));
+        assert_eq!(
+            info.readme.unwrap().chars().count(),
+            README_PREVIEW_CHARS + 3
+        );
+        assert_eq!(info.image.as_deref(), Some(&b"png"[..]));
+    }
+
+    #[test]
+    fn test_parse_zip64_modlist() {
+        use std::io::Write;
+        use zip::write::SimpleFileOptions;
+        use zip::ZipWriter;
+
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("large.wabbajack");
+        let mut zip = ZipWriter::new(File::create(&path).unwrap());
+        // Forces ZIP64 headers like a distributable over 4 GB
+        let options = SimpleFileOptions::default().large_file(true);
+        zip.start_file("modlist", options).unwrap();
+        zip.write_all(
+            br#"{"Name": "Big", "Archives": [{"Name": "SkyUI-12604-5-2SE-1600000000.7z", "State": {"ModID": 12604}}]}"#,
+        )
+        .unwrap();
+        zip.finish().unwrap();
+
+        let info = parse_wabbajack_file(&path).unwrap();
+        assert_eq!(info.name, "Big");
+        assert!(info.used_mod_keys.contains("12604"));
+    }
+
+    #[test]
+    fn test_parse_nested_modlist_entry() {
+        use std::io::Write;
+        use zip::write::SimpleFileOptions;
+        use zip::ZipWriter;
+
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("nested.wabbajack");
+        let mut zip = ZipWriter::new(File::create(&path).unwrap());
+        let options = SimpleFileOptions::default();
+        zip.start_file("data/deep/modlist", options).unwrap();
+        zip.write_all(b"{}").unwrap();
+        zip.start_file("data/modlist", options).unwrap();
+        zip.write_all(
+            br#"{"ModList": {"Name": "Nested", "GameType": "SkyrimSpecialEdition", "Archives": [{"Name": "SkyUI-12604-5-2SE-1600000000.7z", "State": {"ModID": 12604}}]}}"#,
+        )
+        .unwrap();
+        zip.finish().unwrap();
+
+        let info = parse_wabbajack_file(&path).unwrap();
+        assert_eq!(info.name, "Nested");
+        assert_eq!(info.game.as_deref(), Some("SkyrimSpecialEdition"));
+        assert!(info.used_mod_keys.contains("12604"));
+    }
+
+    #[test]
+    fn test_non_nexus_sources() {
+        assert_eq!(downloader_name("NexusDownloader, Wabbajack.Lib"), "Nexus");
+        assert_eq!(
+            downloader_name("NexusDownloader+State, Wabbajack.Lib"),
+            "Nexus"
+        );
+        assert_eq!(
+            downloader_name("GameFileSourceDownloader, Wabbajack.Lib"),
+            "GameFileSource"
+        );
+        assert_eq!(downloader_name("GoogleDrive"), "GoogleDrive");
+        assert_eq!(loose_file_name("Sky_UI 5.2.7Z"), "sky ui 5.2.7z");
+
+        use std::io::Write;
+        use zip::write::SimpleFileOptions;
+        use zip::ZipWriter;
+
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("sources.wabbajack");
+        let mut zip = ZipWriter::new(File::create(&path).unwrap());
+        zip.start_file("modlist", SimpleFileOptions::default())
+            .unwrap();
+        zip.write_all(
+            br#"{"Name": "Sources", "Archives": [
+                {"Name": "SkyUI-12604-5-2SE-1600000000.7z", "Hash": "a=", "State": {"$type": "NexusDownloader, Wabbajack.Lib", "ModID": 12604}},
+                {"Name": "Skyrim.esm", "Hash": "b=", "State": {"$type": "GameFileSourceDownloader, Wabbajack.Lib", "ModID": 99}},
+                {"Name": "Mega Pack.7z", "Hash": "c=", "State": {"$type": "MegaDownloader, Wabbajack.Lib"}}
+            ]}"#,
+        )
+        .unwrap();
+        zip.finish().unwrap();
+
+        let info = parse_wabbajack_file(&path).unwrap();
+        assert_eq!(info.used_mod_keys, ["12604".to_string()].into());
+        assert!(info.used_file_names.contains("Mega Pack.7z"));
+        assert_eq!(
+            info.archive_hashes.get("Skyrim.esm").map(String::as_str),
+            Some("b=")
+        );
+    }
+
+    #[test]
+    fn test_truncate_chars() {
+        assert_eq!(truncate_chars("  short  ", 10), "short");
+        assert_eq!(truncate_chars("Ünïcödé text", 7), "Ünïcödé...");
+    }
+
     #[test]
     fn test_is_numeric() {
         assert!(is_numeric("123"));
@@ -355,6 +1007,31 @@ mod tests {
         assert!(!is_numeric(""));
     }
 
+    #[test]
+    fn test_extract_option_indicator() {
+        assert_eq!(
+            extract_option_indicator("Mod - Option A-1234-1-0-1600000000.7z").as_deref(),
+            Some(":option-a")
+        );
+        assert_eq!(
+            extract_option_indicator("Mod-1234-1-0-Dark-1600000000.7z").as_deref(),
+            Some(":option-dark")
+        );
+        assert_eq!(
+            extract_option_indicator("Mod Variant 2-1234-1-0-1600000000.7z").as_deref(),
+            Some(":option-2")
+        );
+        assert_eq!(
+            extract_option_indicator("SkyUI-12604-5-2SE-1600000000.7z"),
+            None
+        );
+        // Words only count when they stand alone
+        assert_eq!(
+            extract_option_indicator("Daylight Waves-1234-1-0-1600000000.7z"),
+            None
+        );
+    }
+
     #[test]
     fn test_is_version_pattern() {
         assert!(is_version_pattern("v1.0"));
@@ -365,6 +1042,13 @@ mod tests {
         assert!(!is_version_pattern("Part1"));
         assert!(!is_version_pattern("Main"));
         assert!(!is_version_pattern("abc"));
+        assert!(is_version_pattern("Version 2"));
+        assert!(is_version_pattern("ver 3"));
+        assert!(is_version_pattern("rev 1.2"));
+        assert!(is_version_pattern("Ver3"));
+        assert!(!is_version_pattern("Version"));
+        assert!(!is_version_pattern("Reverb"));
+        assert!(!is_version_pattern("Vertex 2"));
     }
 
     #[test]
@@ -373,6 +1057,93 @@ mod tests {
         assert_eq!(normalize_mod_name("Simple Mod V2.0"), "Simple Mod");
         assert_eq!(normalize_mod_name("No Version Mod"), "No Version Mod");
         assert_eq!(normalize_mod_name("Mod 0.18"), "Mod");
+        assert_eq!(normalize_mod_name("Mod Version 2"), "Mod");
+        assert_eq!(normalize_mod_name("Mod ver 3"), "Mod");
+        assert_eq!(normalize_mod_name("Mod rev 1.2"), "Mod");
+        assert_eq!(normalize_mod_name("Reverb Mod"), "Reverb Mod");
+    }
+
+    #[test]
+    fn test_parse_version_word() {
+        let parsed = parse_mod_filename("Mod-12345-Version 2 0-1-0-1700000000.7z").unwrap();
+        assert_eq!(parsed.mod_name, "Mod");
+        assert_eq!(parsed.version, "2-0-1-0");
+
+        let parsed = parse_mod_filename("Mod-12345-rev 1.2-1700000000.7z").unwrap();
+        assert_eq!(parsed.version, "1.2");
+    }
+
+    #[test]
+    fn test_parse_multi_part_archive() {
+        assert!(is_wabbajack_file("BigMod-123-1-0-1700000000.7z.001"));
+        assert!(is_wabbajack_file("BigMod-123-1-0-1700000000.7z.002"));
+        assert!(!is_wabbajack_file("BigMod-123-1-0-1700000000.001"));
+        assert!(!is_wabbajack_file("BigMod-123-1-0-1700000000.7z.1"));
+        assert_eq!(
+            split_archive_part("BigMod-123-1-0-1700000000.7z.002"),
+            Some(("BigMod-123-1-0-1700000000.7z", 2))
+        );
+        assert!(!is_later_archive_part("BigMod-123-1-0-1700000000.7z.001"));
+        assert!(is_later_archive_part("BigMod-123-1-0-1700000000.7z.002"));
+
+        let first = parse_mod_filename("BigMod-123-1-0-1700000000.7z.001").unwrap();
+        assert_eq!(first.file_name, "BigMod-123-1-0-1700000000.7z.001");
+        assert_eq!(first.mod_name, "BigMod");
+        assert_eq!(first.mod_id, "123");
+        assert_eq!(first.version, "1-0");
+        assert_eq!(first.timestamp, "1700000000");
+        let second = parse_mod_filename("BigMod-123-1-0-1700000000.7z.002").unwrap();
+        assert_eq!(second.mod_id, "123");
+    }
+
+    #[test]
+    fn test_name_part_indicator() {
+        let cases = [
+            // Version numbers after the ModID are not parts
+            ("Cool Mod-12345-2-0-1700000000.7z", None),
+            ("Cool Mod-12345-1-0-1700000000.7z", None),
+            ("SkyUI-12604-5-2SE-1700000000.7z", None),
+            ("Cool Mod-12345-123456-2-0-1700000000.7z", None),
+            ("Noble Skyrim-21423-3-1-1-1700000000.7z", None),
+            // Parts within the name are
+            ("Textures -1-12345-1-0-1700000000.7z", Some("-1-")),
+            ("Textures -2-12345-1-0-1700000000.7z", Some("-2-")),
+            ("Textures Part 2-12345-1-0-1700000000.7z", Some(":part2")),
+            ("Landscape pt3-12345-2-0-1700000000.7z", Some(":part3")),
+            ("Textures 2K-12345-2-0-1700000000.7z", None),
+        ];
+        for (name, expected) in cases {
+            let mod_file = parse_mod_filename(name).unwrap();
+            assert_eq!(
+                name_part_indicator(&mod_file).as_deref(),
+                expected,
+                "{}",
+                name
+            );
+        }
+    }
+
+    #[test]
+    fn test_archive_parts() {
+        let dir = tempfile::tempdir().unwrap();
+        for name in [
+            "BigMod-123-1-0-1700000000.7z.001",
+            "BigMod-123-1-0-1700000000.7z.002",
+        ] {
+            std::fs::write(dir.path().join(name), b"part").unwrap();
+        }
+        std::fs::write(dir.path().join("BigMod-123-1-0-1700000000.7z.004"), b"part").unwrap();
+
+        let parts = archive_parts(&dir.path().join("BigMod-123-1-0-1700000000.7z.001"));
+        assert_eq!(
+            parts,
+            vec![
+                dir.path().join("BigMod-123-1-0-1700000000.7z.001"),
+                dir.path().join("BigMod-123-1-0-1700000000.7z.002"),
+            ]
+        );
+        let single = dir.path().join("SkyUI-12604-5-2-1700000000.7z");
+        assert_eq!(archive_parts(&single), vec![single]);
     }
 
     #[test]
@@ -385,6 +1156,28 @@ mod tests {
         assert!(!is_patch_or_hotfix("Normal Mod-123-1-0.7z"));
     }
 
+    #[test]
+    fn test_compare_versions() {
+        assert_eq!(compare_versions("v1.2", "1.2.0"), Some(Ordering::Equal));
+        assert_eq!(compare_versions("1-2", "1.2"), Some(Ordering::Equal));
+        assert_eq!(compare_versions("1.10", "1.9"), Some(Ordering::Greater));
+        assert_eq!(compare_versions("1.2", "1.5"), Some(Ordering::Less));
+        assert_eq!(compare_versions("1.2-beta", "1.2"), Some(Ordering::Less));
+        assert_eq!(compare_versions("1.2-beta", "1.1"), Some(Ordering::Greater));
+        assert_eq!(
+            compare_versions("1.2-beta2", "1.2-rc1"),
+            Some(Ordering::Less)
+        );
+        assert_eq!(compare_versions("5-2SE", "5-1SE"), Some(Ordering::Greater));
+        assert_eq!(compare_versions("5-2SE", "5.2"), Some(Ordering::Equal));
+        assert_eq!(
+            compare_versions("Version 2", "1.9"),
+            Some(Ordering::Greater)
+        );
+        assert_eq!(compare_versions("final", "1.0"), None);
+        assert_eq!(compare_versions("1.0", ""), None);
+    }
+
     #[test]
     fn test_parse_mod_filename() {
         // Valid filename with ModID and FileID
@@ -415,5 +1208,56 @@ mod tests {
         assert!(!is_wabbajack_file("readme.txt"));
         assert!(!is_wabbajack_file("mod.part.7z"));
         assert!(!is_wabbajack_file("~temp.zip"));
+        assert!(is_wabbajack_file("Mod-123-1-0-1234567890.tar.zst"));
+        assert!(is_wabbajack_file("Mod.7z.001"));
+        assert!(!is_wabbajack_file(".zst"));
+    }
+
+    #[test]
+    fn test_compound_archive_extensions() {
+        assert_eq!(
+            archive_extension("Mod.TAR.ZST").as_deref(),
+            Some(".tar.zst")
+        );
+        assert_eq!(archive_extension("Mod.tar.gz").as_deref(), Some(".tar.gz"));
+        assert_eq!(archive_extension("Mod.tar").as_deref(), Some(".tar"));
+        assert_eq!(archive_extension("Mod.bz2").as_deref(), Some(".bz2"));
+        assert_eq!(archive_extension("notes.txt"), None);
+        assert_eq!(strip_archive_extension("Mod.tar.xz"), "Mod");
+
+        let file = parse_mod_filename("SkyUI-12604-5-2SE-1600000000.tar.zst").unwrap();
+        let same = parse_mod_filename("SkyUI-12604-5-2SE-1600000000.7z").unwrap();
+        assert_eq!(file.mod_id, "12604");
+        assert_eq!(file.mod_name, same.mod_name);
+        assert_eq!(file.version, same.version);
+        assert_eq!(file.timestamp, "1600000000");
+
+        let custom = ParseOptions::with_extensions(&["PAK".to_string(), ".7z".to_string()]);
+        assert_eq!(custom.archive_extension("Mod.PAK").as_deref(), Some(".pak"));
+        assert_eq!(custom.archive_extension("Mod.zip"), None);
+        assert!(custom.is_wabbajack_file("Mod.pak.001") && !is_wabbajack_file("Mod.pak"));
+        let file = custom
+            .parse_mod_filename("SkyUI-12604-5-2SE-1600000000.pak")
+            .unwrap();
+        assert_eq!(file.mod_name, same.mod_name);
+        assert_eq!(ParseOptions::with_extensions(&[]), ParseOptions::default());
+    }
+
+    #[test]
+    fn test_skip_reason() {
+        let cases = [
+            ("SkyUI.7z", SkipReason::NoDash),
+            ("SkyUI-12604-5-2SE-0.7z", SkipReason::NoTimestamp),
+            ("SkyUI-abc-5-2SE-1700000000.7z", SkipReason::NoModId),
+            ("readme.txt", SkipReason::BadExtension),
+            ("SkyUI-12604-5-2SE-1700000000.7z.part", SkipReason::TempFile),
+            (
+                "SkyUI-12604-5-2SE-1700000000.7z.crdownload",
+                SkipReason::TempFile,
+            ),
+        ];
+        for (name, want) in cases {
+            assert_eq!(skip_reason(name), want, "{}", name);
+        }
     }
 }
@@ -0,0 +1,115 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+//! Versions to keep instead of the newest, listed in `wlc-pins.txt`
+//!
+//! Each line maps a ModID to the Nexus FileID of the one file old version
+//! cleanups keep for it, whatever its timestamp. Blank lines and lines
+//! starting with `#` are ignored.
+//!
+//! ```text
+//! # SkyUI 5.1, which my modlist was built with
+//! 12604 = 35407
+//! ```
+
+use std::collections::HashMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+
+use crate::core::config::Config;
+use crate::core::parser::is_numeric;
+
+pub const PINS_FILE_NAME: &str = "wlc-pins.txt";
+
+/// FileIDs to keep, by ModID
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct Pins {
+    file_ids: HashMap<String, String>,
+}
+
+impl Pins {
+    /// Location of the pins file next to the config file
+    pub fn default_path() -> Option<PathBuf> {
+        Config::default_path().and_then(|p| p.parent().map(|dir| dir.join(PINS_FILE_NAME)))
+    }
+
+    /// Read the pins from the default location; missing means none
+    pub fn load() -> Self {
+        let Some(path) = Self::default_path().filter(|p| p.exists()) else {
+            return Self::default();
+        };
+        match Self::load_from(&path) {
+            Ok(pins) => {
+                log::info!("Loaded {} pin(s) from {:?}", pins.len(), path);
+                pins
+            }
+            Err(e) => {
+                log::warn!("Failed to load pins: {:#}", e);
+                Self::default()
+            }
+        }
+    }
+
+    pub fn load_from(path: &Path) -> Result<Self> {
+        let content =
+            fs::read_to_string(path).with_context(|| format!("Failed to read pins: {:?}", path))?;
+        Ok(Self::parse(&content))
+    }
+
+    /// Parse `ModID = FileID` lines; the `=` may be left out
+    pub fn parse(content: &str) -> Self {
+        let mut pins = Self::default();
+        for line in content.lines() {
+            let line = line.trim();
+            if line.is_empty() || line.starts_with('#') {
+                continue;
+            }
+            let mut fields = line
+                .split(|c: char| c == '=' || c.is_whitespace())
+                .filter(|f| !f.is_empty());
+            match (fields.next(), fields.next(), fields.next()) {
+                (Some(mod_id), Some(file_id), None)
+                    if is_numeric(mod_id) && is_numeric(file_id) =>
+                {
+                    pins.file_ids
+                        .insert(mod_id.to_string(), file_id.to_string());
+                }
+                _ => log::warn!("Ignoring pin line, expected \"ModID = FileID\": {}", line),
+            }
+        }
+        pins
+    }
+
+    pub fn len(&self) -> usize {
+        self.file_ids.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.file_ids.is_empty()
+    }
+
+    /// FileID pinned for a ModID
+    pub fn file_id_for(&self, mod_id: &str) -> Option<&str> {
+        self.file_ids.get(mod_id).map(String::as_str)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_pins() {
+        let pins = Pins::parse("# Pinned\r\n12604 = 35407\r\n\r\n266\t1000\r\nSkyUI = 1\r\n");
+        assert_eq!(pins.len(), 2);
+        assert_eq!(pins.file_id_for("12604"), Some("35407"));
+        assert_eq!(pins.file_id_for("266"), Some("1000"));
+        assert_eq!(pins.file_id_for("3479"), None);
+    }
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+
+use crate::core::meta::{meta_path_for, read_meta_for, MetaInfo};
+use crate::core::parser::{archive_extension, is_numeric, is_wabbajack_file, parse_mod_filename};
+use crate::core::types::modified_secs;
+
+/// A proposed rename of an archive to the canonical Wabbajack pattern
+#[derive(Debug, Clone, PartialEq)]
+pub struct NameRepair {
+    pub from: PathBuf,
+    pub to: PathBuf,
+}
+
+/// Build the canonical `Name-ModID-FileID-Version-Timestamp.ext` name for an archive
+///
+/// Returns `None` when the `.meta` lacks a ModID or the result still
+/// wouldn't parse, so a repair never produces another unrecognized name.
+pub fn canonical_file_name(file_name: &str, meta: &MetaInfo, timestamp: u64) -> Option<String> {
+    let ext = archive_extension(file_name)?;
+    let stem = file_name.get(..file_name.len() - ext.len())?;
+
+    let mod_id = meta.mod_id.as_deref().filter(|id| is_numeric(id))?;
+
+    // Dashes separate the fields, so they can't appear inside the name
+    let name = stem
+        .split(|c: char| !c.is_alphanumeric() && c != ' ')
+        .filter(|s| !s.trim().is_empty())
+        .map(str::trim)
+        .collect::<Vec<_>>()
+        .join(" ");
+    if name.is_empty() {
+        return None;
+    }
+
+    let mut parts = vec![name, mod_id.to_string()];
+    if let Some(file_id) = meta.file_id.as_deref().filter(|id| is_numeric(id)) {
+        parts.push(file_id.to_string());
+    }
+    if let Some(version) = &meta.version {
+        parts.extend(
+            version
+                .split(|c: char| !c.is_alphanumeric())
+                .filter(|s| !s.is_empty())
+                .map(str::to_string),
+        );
+    }
+    parts.push(timestamp.to_string());
+
+    let canonical = format!("{}{}", parts.join("-"), ext);
+    let parsed = parse_mod_filename(&canonical)?;
+    (parsed.mod_id == mod_id).then_some(canonical)
+}
+
+/// Find archives that don't parse but have a `.meta` describing them
+///
+/// Nothing is renamed; the file's modification time stands in for the
+/// download timestamp.
+pub fn plan_name_repairs(folders: &[PathBuf]) -> Result<Vec<NameRepair>> {
+    let mut repairs = Vec::new();
+
+    for folder in folders {
+        let entries = fs::read_dir(folder)
+            .with_context(|| format!("Failed to read directory: {:?}", folder))?;
+
+        for entry in entries.filter_map(|e| e.ok()) {
+            let path = entry.path();
+            let file_name = entry.file_name().to_string_lossy().to_string();
+            if !path.is_file()
+                || !is_wabbajack_file(&file_name)
+                || parse_mod_filename(&file_name).is_some()
+            {
+                continue;
+            }
+
+            let Some(meta) = read_meta_for(&path) else {
+                continue;
+            };
+            let Some(timestamp) = fs::metadata(&path).ok().and_then(|m| modified_secs(&m)) else {
+                continue;
+            };
+            let Some(canonical) = canonical_file_name(&file_name, &meta, timestamp) else {
+                log::info!("Cannot build a canonical name for {}", file_name);
+                continue;
+            };
+
+            let to = folder.join(&canonical);
+            if to.exists() || repairs.iter().any(|r: &NameRepair| r.to == to) {
+                log::warn!("Skipping {}: {} already exists", file_name, canonical);
+                continue;
+            }
+            repairs.push(NameRepair { from: path, to });
+        }
+    }
+
+    repairs.sort_by(|a, b| a.from.cmp(&b.from));
+    Ok(repairs)
+}
+
+/// Rename archives and their `.meta` files as planned
+///
+/// Returns the number of renamed archives and an error per failed rename.
+pub fn apply_name_repairs(repairs: &[NameRepair]) -> (usize, Vec<String>) {
+    let mut renamed = 0;
+    let mut errors = Vec::new();
+
+    for repair in repairs {
+        if let Err(e) = rename_with_meta(&repair.from, &repair.to) {
+            errors.push(e);
+        } else {
+            renamed += 1;
+        }
+    }
+
+    (renamed, errors)
+}
+
+fn rename_with_meta(from: &Path, to: &Path) -> Result<(), String> {
+    if to.exists() {
+        return Err(format!("Target already exists: {:?}", to));
+    }
+    fs::rename(from, to).map_err(|e| format!("Failed to rename {:?}: {}", from, e))?;
+    log::info!("Renamed {:?} -> {:?}", from, to);
+
+    let meta_from = meta_path_for(from);
+    if meta_from.exists() {
+        if let Err(e) = fs::rename(&meta_from, meta_path_for(to)) {
+            log::warn!("Failed to rename {:?}: {}", meta_from, e);
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::core::meta::parse_meta_content;
+    use tempfile::tempdir;
+
+    #[test]
+    fn test_canonical_file_name() {
+        let meta = parse_meta_content("modID=12604\nfileID=35407\nversion=5.2SE\n");
+        assert_eq!(
+            canonical_file_name("SkyUI (renamed).7z", &meta, 1700000000).as_deref(),
+            Some("SkyUI renamed-12604-35407-5-2SE-1700000000.7z")
+        );
+
+        // Without a ModID there is nothing to rebuild the name from
+        let meta = parse_meta_content("version=1.0\n");
+        assert_eq!(canonical_file_name("SkyUI.7z", &meta, 1700000000), None);
+    }
+
+    #[test]
+    fn test_repair_renames_archive_and_meta() {
+        let dir = tempdir().unwrap();
+        let archive = dir.path().join("My Mod.zip");
+        fs::write(&archive, b"data").unwrap();
+        fs::write(meta_path_for(&archive), "modID=1234\nversion=2.0\n").unwrap();
+        // Already canonical names are left alone
+        fs::write(dir.path().join("Other-5678-1-0-1700000000.zip"), b"x").unwrap();
+
+        let folders = vec![dir.path().to_path_buf()];
+        let repairs = plan_name_repairs(&folders).unwrap();
+        assert_eq!(repairs.len(), 1);
+        assert!(archive.exists(), "planning must not rename anything");
+
+        let (renamed, errors) = apply_name_repairs(&repairs);
+        assert_eq!(renamed, 1);
+        assert!(errors.is_empty());
+        assert!(!archive.exists());
+        assert!(repairs[0].to.exists());
+        assert!(meta_path_for(&repairs[0].to).exists());
+        assert!(plan_name_repairs(&folders).unwrap().is_empty());
+    }
+}
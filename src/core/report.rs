@@ -0,0 +1,1138 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+//! Plain text, JSON and CSV reports of scan results
+//!
+//! Every report writes to any `io::Write`, so the same text can go to
+//! stdout, a file or an in-memory buffer.
+
+use std::borrow::Cow;
+use std::collections::BTreeMap;
+use std::fs;
+use std::io::{self, Write};
+use std::path::{Path, PathBuf};
+
+use serde::{Deserialize, Serialize};
+
+use crate::core::cleaner::{format_size, timestamp_to_date};
+use crate::core::types::{
+    CrossFolderDuplicate, DeletionResult, IdenticalFiles, LibraryAudit, LibraryStats, ModFile,
+    ModGroup, ModlistFootprint, ModlistUse, OldVersionScanResult, OrphanedMod, ScanResult,
+    SkipReason, SkippedFile, VersionMismatch,
+};
+
+/// Write the old versions found by a duplicate scan
+pub fn write_duplicates_report<W: Write + ?Sized>(
+    w: &mut W,
+    result: &OldVersionScanResult,
+) -> io::Result<()> {
+    writeln!(
+        w,
+        "Old versions: {} files ({})",
+        result.total_files,
+        format_size(result.total_space)
+    )?;
+    if !result.skipped_files.is_empty() {
+        writeln!(
+            w,
+            "Skipped {} files whose names couldn't be read ({})",
+            result.skipped_files.len(),
+            skip_counts(&result.skipped_files)
+        )?;
+    }
+    if !result.vanished_files.is_empty() {
+        writeln!(
+            w,
+            "Left out {} files removed while the scan ran",
+            result.vanished_files.len()
+        )?;
+    }
+    let (cleaned, kept): (Vec<&String>, Vec<&String>) = result
+        .heuristic_groups
+        .iter()
+        .partition(|key| result.duplicates.iter().any(|g| &g.mod_key == *key));
+    if !kept.is_empty() {
+        writeln!(
+            w,
+            "Kept only by the version heuristics, -aggressive cleans them: {}",
+            join_keys(&kept)
+        )?;
+    }
+    if !cleaned.is_empty() {
+        writeln!(
+            w,
+            "Cleaned by -aggressive despite the version heuristics: {}",
+            join_keys(&cleaned)
+        )?;
+    }
+    for group in &result.duplicates {
+        writeln!(w)?;
+        write_group_plan(w, group)?;
+    }
+    Ok(())
+}
+
+/// Skipped files counted by reason, e.g. "2 no-modid, 1 temp-file"
+pub fn skip_counts(skipped: &[SkippedFile]) -> String {
+    SkipReason::ALL
+        .iter()
+        .filter_map(|reason| {
+            let count = skipped.iter().filter(|s| s.reason == *reason).count();
+            (count > 0).then(|| format!("{} {}", count, reason.code()))
+        })
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+/// Write each skipped file with the reason it was skipped
+pub fn write_skipped_files<W: Write + ?Sized>(
+    w: &mut W,
+    skipped: &[SkippedFile],
+) -> io::Result<()> {
+    writeln!(w, "Skipped files: {}", skipped.len())?;
+    for file in skipped {
+        writeln!(w, "  {:<13} {}", file.reason.code(), file.path.display())?;
+    }
+    Ok(())
+}
+
+fn join_keys(keys: &[&String]) -> String {
+    keys.iter()
+        .map(|k| k.as_str())
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+/// Write the `limit` largest orphans and how many more there are
+///
+/// `orphans` are expected largest first, as the orphan scan returns them.
+pub fn write_largest_orphans<W: Write + ?Sized>(
+    w: &mut W,
+    orphans: &[OrphanedMod],
+    limit: usize,
+) -> io::Result<()> {
+    writeln!(w, "Largest:")?;
+    for m in orphans.iter().take(limit) {
+        writeln!(w, "  {} ({})", m.file.file_name, format_size(m.file.size))?;
+    }
+    let rest = orphans.get(limit..).unwrap_or_default();
+    if !rest.is_empty() {
+        let rest_size: u64 = rest.iter().map(|m| m.file.size).sum();
+        writeln!(
+            w,
+            "  ...and {} more ({})",
+            rest.len(),
+            format_size(rest_size)
+        )?;
+    }
+    Ok(())
+}
+
+/// Write how much dropping each modlist would free, largest first
+pub fn write_unique_footprints<W: Write + ?Sized>(
+    w: &mut W,
+    footprints: &[ModlistFootprint],
+) -> io::Result<()> {
+    writeln!(w, "Space only one modlist uses:")?;
+    for f in footprints {
+        writeln!(
+            w,
+            "  Dropping {} would free {} ({} archives)",
+            f.modlist,
+            format_size(f.size),
+            f.files
+        )?;
+    }
+    Ok(())
+}
+
+/// Write archives found in more than one folder, marking the copy kept
+pub fn write_cross_folder_duplicates<W: Write + ?Sized>(
+    w: &mut W,
+    duplicates: &[CrossFolderDuplicate],
+) -> io::Result<()> {
+    let reclaimable: u64 = duplicates.iter().map(|d| d.reclaimable).sum();
+    writeln!(
+        w,
+        "Duplicates across folders: {} archives ({} reclaimable)",
+        duplicates.len(),
+        format_size(reclaimable)
+    )?;
+    for d in duplicates {
+        for (i, f) in d.files.iter().enumerate() {
+            let action = if i == 0 { "KEEP" } else { "DUPLICATE" };
+            writeln!(
+                w,
+                "  {:<9} {} ({})",
+                action,
+                f.full_path.display(),
+                format_size(f.size)
+            )?;
+        }
+    }
+    Ok(())
+}
+
+/// Write byte-identical files found by the identical files scan
+pub fn write_identical_files<W: Write + ?Sized>(
+    w: &mut W,
+    identical: &[IdenticalFiles],
+) -> io::Result<()> {
+    let reclaimable: u64 = identical.iter().map(|d| d.reclaimable).sum();
+    writeln!(
+        w,
+        "Identical files: {} sets ({} reclaimable)",
+        identical.len(),
+        format_size(reclaimable)
+    )?;
+    for d in identical {
+        for (i, f) in d.files.iter().enumerate() {
+            let action = if i == 0 { "KEEP" } else { "IDENTICAL" };
+            writeln!(
+                w,
+                "  {:<9} {} ({})",
+                action,
+                f.full_path.display(),
+                format_size(f.size)
+            )?;
+        }
+    }
+    Ok(())
+}
+
+/// Write which files of one old version group are kept and which are deleted
+pub fn write_group_plan<W: Write + ?Sized>(w: &mut W, group: &ModGroup) -> io::Result<()> {
+    writeln!(w, "{}", group.mod_key)?;
+    for (i, file) in group.files.iter().enumerate() {
+        let action = if i < group.newest_idx {
+            "DELETE"
+        } else {
+            "KEEP"
+        };
+        writeln!(
+            w,
+            "  {:<6} {} ({})",
+            action,
+            file.file_name,
+            format_size(file.size)
+        )?;
+    }
+    Ok(())
+}
+
+#[derive(Serialize)]
+struct DuplicatesJson<'a> {
+    summary: DuplicatesSummaryJson<'a>,
+    groups: Vec<GroupJson<'a>>,
+    skipped: &'a [SkippedFile],
+    vanished: &'a [String],
+}
+
+#[derive(Serialize)]
+struct DuplicatesSummaryJson<'a> {
+    total_groups: usize,
+    files_to_delete: usize,
+    bytes_to_free: u64,
+    skipped_files: usize,
+    vanished_files: usize,
+    heuristic_groups: &'a [String],
+}
+
+#[derive(Serialize)]
+struct GroupJson<'a> {
+    key: &'a str,
+    space_to_free: u64,
+    kept: Vec<FileJson<'a>>,
+    deleted: Vec<FileJson<'a>>,
+}
+
+#[derive(Serialize)]
+struct FileJson<'a> {
+    name: &'a str,
+    path: &'a Path,
+    size: u64,
+    /// Seconds since the Unix epoch, `null` when the name has no timestamp
+    timestamp: Option<i64>,
+    date: String,
+}
+
+impl<'a> FileJson<'a> {
+    fn new(file: &'a ModFile) -> Self {
+        FileJson {
+            name: &file.file_name,
+            path: &file.full_path,
+            size: file.size,
+            timestamp: file.timestamp.parse().ok(),
+            date: timestamp_to_date(&file.timestamp),
+        }
+    }
+}
+
+/// Write the old versions found by a duplicate scan as JSON for scripts
+pub fn write_duplicates_json<W: Write + ?Sized>(
+    w: &mut W,
+    result: &OldVersionScanResult,
+) -> io::Result<()> {
+    let report = DuplicatesJson {
+        summary: DuplicatesSummaryJson {
+            total_groups: result.duplicates.len(),
+            files_to_delete: result.duplicates.iter().map(|g| g.newest_idx).sum(),
+            bytes_to_free: result.duplicates.iter().map(|g| g.space_to_free).sum(),
+            skipped_files: result.skipped_files.len(),
+            vanished_files: result.vanished_files.len(),
+            heuristic_groups: &result.heuristic_groups,
+        },
+        groups: result
+            .duplicates
+            .iter()
+            .map(|group| GroupJson {
+                key: &group.mod_key,
+                space_to_free: group.space_to_free,
+                kept: group.files[group.newest_idx..]
+                    .iter()
+                    .map(FileJson::new)
+                    .collect(),
+                deleted: group.files[..group.newest_idx]
+                    .iter()
+                    .map(FileJson::new)
+                    .collect(),
+            })
+            .collect(),
+        skipped: &result.skipped_files,
+        vanished: &result.vanished_files,
+    };
+    serde_json::to_writer_pretty(&mut *w, &report)?;
+    writeln!(w)
+}
+
+/// Write the orphaned archives found by an orphan scan
+pub fn write_orphaned_report<W: Write + ?Sized>(w: &mut W, result: &ScanResult) -> io::Result<()> {
+    writeln!(
+        w,
+        "Used: {} files ({})",
+        result.used_mods.len(),
+        format_size(result.used_size)
+    )?;
+    writeln!(
+        w,
+        "Orphaned: {} files ({})",
+        result.orphaned_mods.len(),
+        format_size(result.orphaned_size)
+    )?;
+    for m in &result.orphaned_mods {
+        writeln!(w, "  {} ({})", m.file.file_name, format_size(m.file.size))?;
+    }
+    if result.small_orphans > 0 {
+        writeln!(
+            w,
+            "Skipped (too small): {} files ({})",
+            result.small_orphans,
+            format_size(result.small_orphans_size)
+        )?;
+    }
+    if !result.orphaned_patches.is_empty() {
+        writeln!(
+            w,
+            "\nOrphaned patches (no main file): {}",
+            result.orphaned_patches.len()
+        )?;
+        for m in &result.orphaned_patches {
+            writeln!(w, "  {}", m.file.file_name)?;
+        }
+    }
+    if !result.identical_archives.is_empty() {
+        writeln!(
+            w,
+            "\nIdentical downloads: {}",
+            result.identical_archives.len()
+        )?;
+        for d in &result.identical_archives {
+            for (i, f) in d.files.iter().enumerate() {
+                let action = if i == 0 { "KEEP" } else { "REDUNDANT" };
+                writeln!(w, "  {:<9} {}", action, f.full_path.display())?;
+            }
+        }
+    }
+    if !result.foreign_game_mods.is_empty() {
+        writeln!(
+            w,
+            "\nOther game leftovers: {}",
+            result.foreign_game_mods.len()
+        )?;
+        for m in &result.foreign_game_mods {
+            writeln!(w, "  [{}] {}", m.game, m.file.file_name)?;
+        }
+    }
+    Ok(())
+}
+
+/// Quote a CSV field when it holds a separator, quote or line break
+fn csv_field(value: &str) -> Cow<'_, str> {
+    if value.contains([',', '"', '\n', '\r']) {
+        Cow::Owned(format!("\"{}\"", value.replace('"', "\"\"")))
+    } else {
+        Cow::Borrowed(value)
+    }
+}
+
+fn write_csv_row<W: Write + ?Sized>(
+    w: &mut W,
+    file: &ModFile,
+    status: &str,
+    modlists: &str,
+) -> io::Result<()> {
+    // Generic archives have no ModID
+    let mod_id = if file.mod_id == "0" { "" } else { &file.mod_id };
+    let fields = [
+        &file.file_name,
+        mod_id,
+        file.file_id.as_deref().unwrap_or_default(),
+        &file.version,
+        &file.size.to_string(),
+        &format_size(file.size),
+        status,
+        modlists,
+    ];
+    let row: Vec<Cow<str>> = fields.iter().map(|f| csv_field(f)).collect();
+    write!(w, "{}\r\n", row.join(","))
+}
+
+/// Write every used and orphaned archive of an orphan scan as CSV
+///
+/// Used archives name the modlists that reference them in `MatchedModlist`.
+pub fn write_orphaned_csv<W: Write + ?Sized>(w: &mut W, result: &ScanResult) -> io::Result<()> {
+    write!(
+        w,
+        "FileName,ModID,FileID,Version,SizeBytes,SizeHuman,Status,MatchedModlist\r\n"
+    )?;
+    for file in &result.used_mods {
+        let modlists: Vec<&str> = result
+            .keep_reasons
+            .get(&file.full_path)
+            .into_iter()
+            .flatten()
+            .map(|r| r.modlist.as_str())
+            .collect();
+        write_csv_row(w, file, "used", &modlists.join("; "))?;
+    }
+    for m in &result.orphaned_mods {
+        write_csv_row(w, &m.file, "orphaned", "")?;
+    }
+    Ok(())
+}
+
+/// Write every used archive with the modlists that keep it
+pub fn write_keep_reasons_report<W: Write + ?Sized>(
+    w: &mut W,
+    result: &ScanResult,
+) -> io::Result<()> {
+    writeln!(w, "Used archives and why they were kept:")?;
+    for file in &result.used_mods {
+        writeln!(w, "  {}", file.full_path.display())?;
+        for reason in result
+            .keep_reasons
+            .get(&file.full_path)
+            .into_iter()
+            .flatten()
+        {
+            writeln!(w, "      {} ({})", reason.modlist, reason.kind.label())?;
+        }
+    }
+    Ok(())
+}
+
+/// Describe one modlist's use of an archive, e.g. "Tuxborn (ModID), expects version 5.2"
+pub fn describe_modlist_use(modlist_use: &ModlistUse) -> String {
+    let mut text = format!("{} ({})", modlist_use.modlist, modlist_use.kind.label());
+    if let Some(version) = &modlist_use.expected_version {
+        text.push_str(&format!(", expects version {}", version));
+    }
+    if modlist_use.other_file_id {
+        if let Some(file_id) = &modlist_use.expected_file_id {
+            text.push_str(&format!(
+                " - downloads FileID {}, not the file on disk",
+                file_id
+            ));
+        }
+    }
+    text
+}
+
+/// Describe a mod whose downloads aren't the file its modlist expects, e.g.
+/// "Tuxborn: SkyUI needs FileID 35407 (SkyUI-12604-35407-...), have FileID 36000"
+pub fn describe_version_mismatch(mismatch: &VersionMismatch) -> String {
+    let have = mismatch
+        .on_disk
+        .iter()
+        .map(|f| match &f.file_id {
+            Some(file_id) => format!("FileID {}", file_id),
+            None => f.file_name.clone(),
+        })
+        .collect::<Vec<_>>()
+        .join(", ");
+    format!(
+        "{}: {} needs FileID {} ({}), have {}",
+        mismatch.modlist,
+        mismatch.mod_name,
+        mismatch.expected.file_id.as_deref().unwrap_or("?"),
+        mismatch.expected.file_name,
+        have
+    )
+}
+
+/// Write the mods the modlists would have to download again
+pub fn write_version_mismatches<W: Write + ?Sized>(
+    w: &mut W,
+    mismatches: &[VersionMismatch],
+) -> io::Result<()> {
+    if mismatches.is_empty() {
+        return writeln!(w, "Every mod on disk is the file its modlists expect");
+    }
+    writeln!(
+        w,
+        "{} mod(s) on disk aren't the file their modlist expects; download these again:",
+        mismatches.len()
+    )?;
+    for mismatch in mismatches {
+        writeln!(w, "  {}", describe_version_mismatch(mismatch))?;
+    }
+    Ok(())
+}
+
+/// Write which modlists reference an archive
+pub fn write_modlist_uses<W: Write + ?Sized>(
+    w: &mut W,
+    file_name: &str,
+    uses: &[ModlistUse],
+) -> io::Result<()> {
+    if uses.is_empty() {
+        return writeln!(w, "{} is not used by any modlist", file_name);
+    }
+    writeln!(w, "{} is used by {} modlist(s):", file_name, uses.len())?;
+    for modlist_use in uses {
+        writeln!(w, "  {}", describe_modlist_use(modlist_use))?;
+    }
+    Ok(())
+}
+
+/// Describe how much a fresh install could reuse from the downloads folder
+pub fn download_summary(audit: &LibraryAudit) -> String {
+    if audit.needed == 0 {
+        "The selected modlists record no archive hashes".to_string()
+    } else if audit.missing.is_empty() {
+        format!(
+            "You have all {} required archives - nothing needs downloading on a fresh install",
+            audit.needed
+        )
+    } else {
+        format!(
+            "You have {} of {} required archives - only {} ({}) would need downloading on a fresh install",
+            audit.found(),
+            audit.needed,
+            audit.missing.len(),
+            format_size(audit.missing_size)
+        )
+    }
+}
+
+/// Write a library audit: kept, orphaned, unhashed and missing archives
+pub fn write_audit_report<W: Write + ?Sized>(w: &mut W, audit: &LibraryAudit) -> io::Result<()> {
+    writeln!(w, "{}", download_summary(audit))?;
+    writeln!(
+        w,
+        "Library audit: {} needed ({}), {} orphaned ({}), {} missing",
+        audit.kept.len(),
+        format_size(audit.kept_size),
+        audit.orphaned.len(),
+        format_size(audit.orphaned_size),
+        audit.missing.len()
+    )?;
+    if !audit.orphaned.is_empty() {
+        writeln!(w, "\nOrphaned (hash not needed by any modlist):")?;
+        for f in &audit.orphaned {
+            writeln!(w, "  {} ({})", f.full_path.display(), format_size(f.size))?;
+        }
+    }
+    if !audit.missing.is_empty() {
+        writeln!(w, "\nMissing (needed but not on disk):")?;
+        for m in &audit.missing {
+            writeln!(
+                w,
+                "  {} [{}] {} ({})",
+                m.file_name,
+                m.hash,
+                format_size(m.size),
+                m.modlists.join(", ")
+            )?;
+        }
+    }
+    if !audit.unhashed.is_empty() {
+        writeln!(
+            w,
+            "\nUnverified (no hash in .meta): {}",
+            audit.unhashed.len()
+        )?;
+        for f in &audit.unhashed {
+            writeln!(w, "  {}", f.full_path.display())?;
+        }
+    }
+    Ok(())
+}
+
+/// Archives found by a run, saved so a later run can report what changed
+///
+/// Files are keyed by name with their size. A section is `None` when the
+/// run didn't scan for it, so its last known state carries over.
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct ScanSnapshot {
+    pub used: Option<BTreeMap<String, u64>>,
+    pub orphaned: Option<BTreeMap<String, u64>>,
+    /// Old versions the scan would delete
+    pub old_versions: Option<BTreeMap<String, u64>>,
+}
+
+impl ScanSnapshot {
+    pub fn load(path: &Path) -> io::Result<Self> {
+        let content = fs::read_to_string(path)?;
+        serde_json::from_str(&content).map_err(io::Error::other)
+    }
+
+    pub fn save(&self, path: &Path) -> io::Result<()> {
+        let content = serde_json::to_string_pretty(self).map_err(io::Error::other)?;
+        fs::write(path, content)
+    }
+
+    pub fn record_orphan_scan(&mut self, result: &ScanResult) {
+        self.used = Some(
+            result
+                .used_mods
+                .iter()
+                .map(|f| (f.file_name.clone(), f.size))
+                .collect(),
+        );
+        self.orphaned = Some(
+            result
+                .orphaned_mods
+                .iter()
+                .map(|m| (m.file.file_name.clone(), m.file.size))
+                .collect(),
+        );
+    }
+
+    pub fn record_old_versions(&mut self, result: &OldVersionScanResult) {
+        self.old_versions = Some(
+            result
+                .duplicates
+                .iter()
+                .flat_map(|g| g.files[..g.newest_idx].iter())
+                .map(|f| (f.file_name.clone(), f.size))
+                .collect(),
+        );
+    }
+}
+
+/// What changed between two snapshots, each list largest first
+#[derive(Debug, Default, PartialEq)]
+pub struct ReportDiff {
+    pub newly_orphaned: Vec<(String, u64)>,
+    /// Orphaned last time, used by a modlist now
+    pub used_again: Vec<(String, u64)>,
+    pub new_old_versions: Vec<(String, u64)>,
+}
+
+impl ReportDiff {
+    pub fn is_empty(&self) -> bool {
+        self.newly_orphaned.is_empty()
+            && self.used_again.is_empty()
+            && self.new_old_versions.is_empty()
+    }
+}
+
+/// Compare a snapshot with an earlier one; sections missing from either are skipped
+pub fn compare_reports(old: &ScanSnapshot, new: &ScanSnapshot) -> ReportDiff {
+    fn added(
+        old: Option<&BTreeMap<String, u64>>,
+        new: Option<&BTreeMap<String, u64>>,
+    ) -> Vec<(String, u64)> {
+        let (Some(old), Some(new)) = (old, new) else {
+            return Vec::new();
+        };
+        let mut added: Vec<(String, u64)> = new
+            .iter()
+            .filter(|(name, _)| !old.contains_key(*name))
+            .map(|(name, size)| (name.clone(), *size))
+            .collect();
+        added.sort_by(|a, b| b.1.cmp(&a.1).then_with(|| a.0.cmp(&b.0)));
+        added
+    }
+
+    let used_again = match (&old.orphaned, &new.used) {
+        (Some(orphaned), Some(used)) => {
+            let mut files: Vec<(String, u64)> = used
+                .iter()
+                .filter(|(name, _)| orphaned.contains_key(*name))
+                .map(|(name, size)| (name.clone(), *size))
+                .collect();
+            files.sort_by(|a, b| b.1.cmp(&a.1).then_with(|| a.0.cmp(&b.0)));
+            files
+        }
+        _ => Vec::new(),
+    };
+
+    ReportDiff {
+        newly_orphaned: added(old.orphaned.as_ref(), new.orphaned.as_ref()),
+        used_again,
+        new_old_versions: added(old.old_versions.as_ref(), new.old_versions.as_ref()),
+    }
+}
+
+/// Write a short summary of what changed since the previous snapshot
+pub fn write_report_diff<W: Write + ?Sized>(w: &mut W, diff: &ReportDiff) -> io::Result<()> {
+    if diff.is_empty() {
+        return writeln!(w, "No changes since the previous scan");
+    }
+    let sections = [
+        ("Newly orphaned", &diff.newly_orphaned),
+        ("Used again", &diff.used_again),
+        ("New old versions", &diff.new_old_versions),
+    ];
+    for (title, files) in sections {
+        if files.is_empty() {
+            continue;
+        }
+        let total: u64 = files.iter().map(|(_, size)| size).sum();
+        writeln!(
+            w,
+            "{}: {} files ({})",
+            title,
+            files.len(),
+            format_size(total)
+        )?;
+        for (name, size) in files {
+            writeln!(w, "  {} ({})", name, format_size(*size))?;
+        }
+    }
+    Ok(())
+}
+
+/// Write a record of a finished cleanup: every removed file, kept files and failures
+pub fn write_cleanup_report<W: Write + ?Sized>(
+    w: &mut W,
+    result: &DeletionResult,
+    finished: chrono::DateTime<chrono::Local>,
+) -> io::Result<()> {
+    writeln!(
+        w,
+        "Cleanup report - {}",
+        finished.format("%Y-%m-%d %H:%M:%S")
+    )?;
+    match &result.recycle_bin_path {
+        Some(path) => writeln!(w, "Files were moved to {}", path.display())?,
+        None => writeln!(w, "Files were permanently deleted")?,
+    }
+    writeln!(
+        w,
+        "Removed: {} files ({})",
+        result.deleted_count,
+        format_size(result.space_freed)
+    )?;
+    writeln!(w, "Skipped: {} files", result.skipped.len())?;
+
+    writeln!(w, "\nRemoved files:")?;
+    for (path, size) in &result.removed {
+        writeln!(w, "  {} ({})", path.display(), format_size(*size))?;
+    }
+
+    if !result.kept.is_empty() {
+        writeln!(w, "\nKept versions:")?;
+        for (mod_key, files) in &result.kept {
+            writeln!(w, "  {}", mod_key)?;
+            for path in files {
+                writeln!(w, "      {}", path.display())?;
+            }
+        }
+    }
+
+    if result.has_failures() {
+        writeln!(w, "\nFailures:")?;
+        for error in &result.errors {
+            writeln!(w, "  {}", error)?;
+        }
+        for (path, error) in &result.failed {
+            writeln!(w, "  {}: {}", path.display(), error)?;
+        }
+    }
+    Ok(())
+}
+
+/// Save a cleanup report as `cleanup_report_<timestamp>.txt` in `dir`
+pub fn save_cleanup_report(dir: &Path, result: &DeletionResult) -> io::Result<PathBuf> {
+    let now = chrono::Local::now();
+    fs::create_dir_all(dir)?;
+    let path = dir.join(format!(
+        "cleanup_report_{}.txt",
+        now.format("%Y-%m-%d_%H-%M-%S")
+    ));
+    let mut w = io::BufWriter::new(fs::File::create(&path)?);
+    write_cleanup_report(&mut w, result, now)?;
+    w.flush()?;
+    Ok(path)
+}
+
+/// One line summing up how much of the library a cleanup could free
+pub fn reclaimable_headline(stats: &LibraryStats) -> String {
+    let from = if stats.reclaimable.is_some() {
+        "old versions and orphans"
+    } else {
+        "old versions"
+    };
+    format!(
+        "You can safely reclaim {} ({:.1}% of your library) from {}",
+        format_size(stats.reclaimable_bytes()),
+        stats.reclaimable_percent(),
+        from
+    )
+}
+
+/// Write library statistics broken down by game folder
+pub fn write_statistics<W: Write + ?Sized>(w: &mut W, stats: &LibraryStats) -> io::Result<()> {
+    writeln!(
+        w,
+        "Library: {} files ({})",
+        stats.total_files,
+        format_size(stats.total_size)
+    )?;
+    if stats.total_size > 0 {
+        writeln!(w, "{}", reclaimable_headline(stats))?;
+    }
+    if let Some(uncompressed) = stats.uncompressed_size {
+        writeln!(w, "Uncompressed: {}", format_size(uncompressed))?;
+    }
+    if let Some((old_bytes, orphan_bytes)) = stats.reclaimable {
+        writeln!(
+            w,
+            "Reclaimable: ~{} (old versions {}, orphaned {})",
+            format_size(old_bytes + orphan_bytes),
+            format_size(old_bytes),
+            format_size(orphan_bytes)
+        )?;
+    }
+    if let Some(free) = stats.free_space {
+        writeln!(w, "Free space: {}", format_size(free))?;
+    }
+    for game in &stats.by_game {
+        writeln!(
+            w,
+            "  {:<30} {:>6} files  {:>10}  old versions {:>10}",
+            game.game,
+            game.files,
+            format_size(game.size),
+            format_size(game.old_version_bytes)
+        )?;
+        if let Some((name, size)) = &game.largest {
+            writeln!(w, "    largest: {} ({})", name, format_size(*size))?;
+        }
+    }
+    if !stats.by_game.is_empty() {
+        writeln!(
+            w,
+            "  {:<30} {:>6} files  {:>10}  old versions {:>10}",
+            "Total",
+            stats.total_files,
+            format_size(stats.total_size),
+            format_size(stats.old_version_bytes())
+        )?;
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::core::parser::parse_mod_filename;
+    use crate::core::types::{GameStats, ModGroup};
+
+    #[test]
+    fn test_write_duplicates_report() {
+        let mut old = parse_mod_filename("SkyUI-12604-5-1SE-1600000000.7z").unwrap();
+        old.size = 1024;
+        let new = parse_mod_filename("SkyUI-12604-5-2SE-1700000000.7z").unwrap();
+        let result = OldVersionScanResult {
+            duplicates: vec![ModGroup {
+                mod_key: "12604:SkyUI".to_string(),
+                files: vec![old, new],
+                newest_idx: 1,
+                space_to_free: 1024,
+            }],
+            total_files: 1,
+            total_space: 1024,
+            vanished_files: vec!["Gone-1-1-0-1.7z".to_string()],
+            split_groups: Vec::new(),
+            skipped_files: vec![
+                SkippedFile {
+                    path: PathBuf::from("SkyUI-ab-5-2SE-1700000000.7z"),
+                    reason: SkipReason::NoModId,
+                },
+                SkippedFile {
+                    path: PathBuf::from("SkyUI-12604-5-2SE-1700000000.7z.part"),
+                    reason: SkipReason::TempFile,
+                },
+            ],
+            heuristic_groups: vec!["12604:SkyUI".to_string(), "3863:SKSE".to_string()],
+        };
+
+        let mut out = Vec::new();
+        write_duplicates_report(&mut out, &result).unwrap();
+        let text = String::from_utf8(out).unwrap();
+
+        assert!(text.starts_with("Old versions: 1 files (1.00 KB)"));
+        assert!(
+            text.contains("Skipped 2 files whose names couldn't be read (1 no-modid, 1 temp-file)")
+        );
+        assert!(text.contains("Left out 1 files removed while the scan ran"));
+        assert!(text
+            .contains("Kept only by the version heuristics, -aggressive cleans them: 3863:SKSE"));
+        assert!(text.contains("Cleaned by -aggressive despite the version heuristics: 12604:SkyUI"));
+        assert!(text.contains("DELETE SkyUI-12604-5-1SE-1600000000.7z"));
+        assert!(text.contains("KEEP   SkyUI-12604-5-2SE-1700000000.7z"));
+    }
+
+    #[test]
+    fn test_write_duplicates_json() {
+        let mut old = parse_mod_filename("SkyUI-12604-5-1SE-1600000000.7z").unwrap();
+        old.size = 1024;
+        let new = parse_mod_filename("SkyUI-12604-5-2SE-1700000000.7z").unwrap();
+        let result = OldVersionScanResult {
+            duplicates: vec![ModGroup {
+                mod_key: "12604:SkyUI".to_string(),
+                files: vec![old, new],
+                newest_idx: 1,
+                space_to_free: 1024,
+            }],
+            total_files: 1,
+            total_space: 1024,
+            vanished_files: vec!["Gone-1-1-0-1.7z".to_string()],
+            split_groups: Vec::new(),
+            skipped_files: vec![
+                SkippedFile {
+                    path: PathBuf::from("readme.txt"),
+                    reason: SkipReason::BadExtension,
+                },
+                SkippedFile {
+                    path: PathBuf::from("SkyUI.7z"),
+                    reason: SkipReason::NoDash,
+                },
+            ],
+            heuristic_groups: Vec::new(),
+        };
+
+        let mut out = Vec::new();
+        write_duplicates_json(&mut out, &result).unwrap();
+        let json: serde_json::Value = serde_json::from_slice(&out).unwrap();
+
+        assert_eq!(json["summary"]["total_groups"], 1);
+        assert_eq!(json["summary"]["files_to_delete"], 1);
+        assert_eq!(json["summary"]["bytes_to_free"], 1024);
+        assert_eq!(json["summary"]["skipped_files"], 2);
+        assert_eq!(json["summary"]["vanished_files"], 1);
+        assert_eq!(json["vanished"][0], "Gone-1-1-0-1.7z");
+        assert_eq!(json["skipped"][0]["reason"], "bad-extension");
+        assert_eq!(json["skipped"][1]["path"], "SkyUI.7z");
+        let group = &json["groups"][0];
+        assert_eq!(group["key"], "12604:SkyUI");
+        assert_eq!(group["space_to_free"], 1024);
+        assert_eq!(group["kept"][0]["name"], "SkyUI-12604-5-2SE-1700000000.7z");
+        let deleted = &group["deleted"][0];
+        assert_eq!(deleted["size"], 1024);
+        assert_eq!(deleted["timestamp"], 1600000000);
+        assert_eq!(deleted["date"], timestamp_to_date("1600000000"));
+    }
+
+    #[test]
+    fn test_write_orphaned_report_skips_small_orphans() {
+        let orphan = |name: &str, size: u64| {
+            let mut file = parse_mod_filename(name).unwrap();
+            file.size = size;
+            crate::core::types::OrphanedMod { file }
+        };
+        let mut result = ScanResult {
+            orphaned_mods: vec![
+                orphan("Big Mod-100-1-0-1600000000.7z", 200 * 1024 * 1024),
+                orphan("Small Mod-200-1-0-1600000000.7z", 1024),
+            ],
+            ..Default::default()
+        };
+        result.skip_small_orphans(100 * 1024 * 1024);
+        assert_eq!(result.orphaned_mods.len(), 1);
+        assert_eq!(result.orphaned_size, 200 * 1024 * 1024);
+
+        let mut out = Vec::new();
+        write_orphaned_report(&mut out, &result).unwrap();
+        let text = String::from_utf8(out).unwrap();
+
+        assert!(text.contains("Orphaned: 1 files (200.00 MB)"));
+        assert!(!text.contains("Small Mod"));
+        assert!(text.contains("Skipped (too small): 1 files (1.00 KB)"));
+    }
+
+    #[test]
+    fn test_write_largest_orphans() {
+        let orphans: Vec<OrphanedMod> = (1..=12u64)
+            .rev()
+            .map(|i| {
+                let mut file = parse_mod_filename("Old Mod-266-1-0-1600000000.7z").unwrap();
+                file.file_name = format!("Mod{}.7z", i);
+                file.size = i * 1024;
+                OrphanedMod { file }
+            })
+            .collect();
+
+        let mut out = Vec::new();
+        write_largest_orphans(&mut out, &orphans, 10).unwrap();
+        let text = String::from_utf8(out).unwrap();
+
+        assert!(text.starts_with("Largest:\n  Mod12.7z (12.00 KB)"));
+        assert!(text.contains("  Mod3.7z (3.00 KB)"));
+        assert!(!text.contains("Mod2.7z"));
+        assert!(text.ends_with("  ...and 2 more (3.00 KB)\n"));
+    }
+
+    #[test]
+    fn test_write_orphaned_csv() {
+        let used = parse_mod_filename("SkyUI, Reworked-12604-35407-5-2-1700000000.7z").unwrap();
+        let orphaned = parse_mod_filename("Old \"Classic\" Mod-266-1-0-1600000000.7z").unwrap();
+        let result = ScanResult {
+            keep_reasons: [(
+                used.full_path.clone(),
+                vec![crate::core::types::KeepReason {
+                    modlist: "Tuxborn".to_string(),
+                    kind: crate::core::types::MatchKind::FileName,
+                }],
+            )]
+            .into(),
+            used_mods: vec![used],
+            orphaned_mods: vec![crate::core::types::OrphanedMod { file: orphaned }],
+            ..Default::default()
+        };
+
+        let mut out = Vec::new();
+        write_orphaned_csv(&mut out, &result).unwrap();
+        let text = String::from_utf8(out).unwrap();
+        let lines: Vec<&str> = text.split("\r\n").collect();
+
+        assert_eq!(
+            lines[0],
+            "FileName,ModID,FileID,Version,SizeBytes,SizeHuman,Status,MatchedModlist"
+        );
+        assert_eq!(
+            lines[1],
+            "\"SkyUI, Reworked-12604-35407-5-2-1700000000.7z\",12604,35407,5-2,0,0 B,used,Tuxborn"
+        );
+        assert_eq!(
+            lines[2],
+            "\"Old \"\"Classic\"\" Mod-266-1-0-1600000000.7z\",266,,1-0,0,0 B,orphaned,"
+        );
+    }
+
+    #[test]
+    fn test_compare_reports() {
+        let files = |list: &[(&str, u64)]| {
+            Some(
+                list.iter()
+                    .map(|(name, size)| (name.to_string(), *size))
+                    .collect::<BTreeMap<_, _>>(),
+            )
+        };
+        let old = ScanSnapshot {
+            used: files(&[("A.7z", 10), ("Big.7z", 5000)]),
+            orphaned: files(&[("Back.7z", 20)]),
+            old_versions: None,
+        };
+        let new = ScanSnapshot {
+            used: files(&[("A.7z", 10), ("Back.7z", 20)]),
+            orphaned: files(&[("Big.7z", 5000), ("Small.7z", 1)]),
+            old_versions: files(&[("Old.7z", 30)]),
+        };
+
+        let diff = compare_reports(&old, &new);
+        assert_eq!(
+            diff.newly_orphaned,
+            vec![("Big.7z".to_string(), 5000), ("Small.7z".to_string(), 1)]
+        );
+        assert_eq!(diff.used_again, vec![("Back.7z".to_string(), 20)]);
+        // The previous run didn't look for old versions
+        assert!(diff.new_old_versions.is_empty());
+
+        let mut out = Vec::new();
+        write_report_diff(&mut out, &diff).unwrap();
+        let text = String::from_utf8(out).unwrap();
+        assert!(text.starts_with("Newly orphaned: 2 files"));
+        assert!(text.contains("\nUsed again: 1 files (20 B)\n  Back.7z (20 B)\n"));
+        assert!(compare_reports(&new, &new).is_empty());
+    }
+
+    #[test]
+    fn test_save_cleanup_report() {
+        let dir = tempfile::tempdir().unwrap();
+        let result = DeletionResult {
+            deleted_count: 1,
+            space_freed: 2048,
+            skipped: vec!["Locked-1-1-0-1600000000.7z".to_string()],
+            errors: vec!["Failed to write restore manifest".to_string()],
+            failed: vec![(
+                PathBuf::from("Locked-1-1-0-1600000000.7z"),
+                "File is locked".to_string(),
+            )],
+            recycle_bin_path: Some(dir.path().to_path_buf()),
+            removed: vec![(PathBuf::from("SkyUI-12604-5-1SE-1600000000.7z"), 2048)],
+            kept: vec![(
+                "12604:SkyUI".to_string(),
+                vec![PathBuf::from("SkyUI-12604-5-2SE-1700000000.7z")],
+            )],
+            ..Default::default()
+        };
+
+        let path = save_cleanup_report(dir.path(), &result).unwrap();
+        let name = path.file_name().unwrap().to_string_lossy().to_string();
+        assert!(name.starts_with("cleanup_report_") && name.ends_with(".txt"));
+
+        let text = fs::read_to_string(&path).unwrap();
+        assert!(text.contains("Removed: 1 files (2.00 KB)"));
+        assert!(text.contains("SkyUI-12604-5-1SE-1600000000.7z (2.00 KB)"));
+        assert!(text.contains("12604:SkyUI\n      SkyUI-12604-5-2SE-1700000000.7z"));
+        assert!(text.contains(
+            "Failures:\n  Failed to write restore manifest\n  Locked-1-1-0-1600000000.7z: File is locked"
+        ));
+    }
+
+    #[test]
+    fn test_reclaimable_headline() {
+        let mut stats = LibraryStats {
+            total_files: 3,
+            total_size: 4096,
+            by_game: vec![GameStats {
+                game: "Skyrim".to_string(),
+                files: 3,
+                size: 4096,
+                old_version_bytes: 1024,
+                largest: None,
+            }],
+            ..Default::default()
+        };
+        assert_eq!(
+            reclaimable_headline(&stats),
+            "You can safely reclaim 1.00 KB (25.0% of your library) from old versions"
+        );
+
+        stats.reclaimable = Some((1024, 1024));
+        assert_eq!(
+            reclaimable_headline(&stats),
+            "You can safely reclaim 2.00 KB (50.0% of your library) from old versions and orphans"
+        );
+    }
+}
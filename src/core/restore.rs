@@ -0,0 +1,290 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+use std::collections::BTreeMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::time::SystemTime;
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+
+use crate::core::cleaner::move_file;
+use crate::core::meta::meta_path_for;
+
+/// File in each recycle bin folder recording where its archives came from
+pub const BACKUP_MANIFEST_FILE_NAME: &str = "wlc_manifest.json";
+
+/// Original location of every archive moved into a recycle bin folder
+#[derive(Debug, Default, Serialize, Deserialize)]
+pub struct BackupManifest {
+    /// Original full path, by path inside the backup folder with `/` separators;
+    /// archives whose name was taken sit in a numbered subfolder
+    pub files: BTreeMap<String, PathBuf>,
+}
+
+impl BackupManifest {
+    /// Load the manifest of a backup folder
+    pub fn load(backup_dir: &Path) -> Result<Self> {
+        let path = backup_dir.join(BACKUP_MANIFEST_FILE_NAME);
+        let content = fs::read_to_string(&path)
+            .with_context(|| format!("No restore manifest in {:?}", backup_dir))?;
+        serde_json::from_str(&content).with_context(|| format!("Failed to parse {:?}", path))
+    }
+
+    fn save(&self, backup_dir: &Path) -> Result<()> {
+        let path = backup_dir.join(BACKUP_MANIFEST_FILE_NAME);
+        let content = serde_json::to_string_pretty(self)?;
+        fs::write(&path, content).with_context(|| format!("Failed to write {:?}", path))
+    }
+}
+
+/// Record where moved archives came from, adding to the folder's manifest
+///
+/// `moved` pairs each original path with where it went inside `backup_dir`.
+/// A folder can be reused by later cleanups when its name template has no
+/// `{date}`, so existing entries are kept.
+pub fn save_backup_manifest(backup_dir: &Path, moved: &[(PathBuf, PathBuf)]) -> Result<()> {
+    let mut manifest = if backup_dir.join(BACKUP_MANIFEST_FILE_NAME).exists() {
+        BackupManifest::load(backup_dir)?
+    } else {
+        BackupManifest::default()
+    };
+    for (original, dest) in moved {
+        let Ok(relative) = dest.strip_prefix(backup_dir) else {
+            continue;
+        };
+        let key = relative
+            .components()
+            .map(|c| c.as_os_str().to_string_lossy())
+            .collect::<Vec<_>>()
+            .join("/");
+        manifest.files.insert(key, original.clone());
+    }
+    manifest.save(backup_dir)
+}
+
+/// A recycle bin folder that can be restored
+#[derive(Debug, Clone)]
+pub struct BackupFolder {
+    pub path: PathBuf,
+    pub file_count: usize,
+    pub modified: Option<SystemTime>,
+}
+
+/// Find restorable backups inside recycle bin roots, newest first
+///
+/// Folders are searched recursively since name templates can nest them.
+/// Only folders with a manifest are listed; older backups have to be moved
+/// back by hand.
+pub fn list_backups(roots: &[PathBuf]) -> Vec<BackupFolder> {
+    let mut backups = Vec::new();
+    let mut pending: Vec<PathBuf> = roots.iter().filter(|r| r.is_dir()).cloned().collect();
+
+    while let Some(dir) = pending.pop() {
+        let Ok(entries) = fs::read_dir(&dir) else {
+            continue;
+        };
+        pending.extend(
+            entries
+                .filter_map(|e| e.ok())
+                .map(|e| e.path())
+                .filter(|p| p.is_dir()),
+        );
+
+        let manifest_path = dir.join(BACKUP_MANIFEST_FILE_NAME);
+        if let Ok(manifest) = BackupManifest::load(&dir) {
+            backups.push(BackupFolder {
+                file_count: manifest.files.len(),
+                modified: fs::metadata(&manifest_path).and_then(|m| m.modified()).ok(),
+                path: dir,
+            });
+        }
+    }
+
+    backups.sort_by(|a, b| b.modified.cmp(&a.modified).then(a.path.cmp(&b.path)));
+    backups
+}
+
+/// Outcome of restoring a backup folder
+#[derive(Debug, Default)]
+pub struct RestoreResult {
+    pub restored: usize,
+    /// Original paths where another file already exists
+    pub conflicts: Vec<PathBuf>,
+    pub errors: Vec<String>,
+}
+
+/// Move every archive in a backup folder, and its `.meta`, back where it came from
+///
+/// Files whose original path is taken are left in the backup and reported
+/// as conflicts. Restored files are dropped from the manifest, and the
+/// folder is removed once it's empty.
+pub fn restore_backup(backup_dir: &Path) -> Result<RestoreResult> {
+    restore_matching(backup_dir, |_| true)
+}
+
+/// Move only the given archives in a backup folder back, by original path
+///
+/// Used to undo one cleanup when its folder also holds files from earlier
+/// ones. Paths the manifest doesn't list are ignored.
+pub fn restore_files(backup_dir: &Path, originals: &[PathBuf]) -> Result<RestoreResult> {
+    restore_matching(backup_dir, |original| originals.contains(original))
+}
+
+fn restore_matching(backup_dir: &Path, wanted: impl Fn(&PathBuf) -> bool) -> Result<RestoreResult> {
+    let mut manifest = BackupManifest::load(backup_dir)?;
+    let mut result = RestoreResult::default();
+
+    manifest.files.retain(|name, original| {
+        if !wanted(original) {
+            return true;
+        }
+        let backup_path = backup_dir.join(name);
+        if !backup_path.exists() {
+            result
+                .errors
+                .push(format!("{} is no longer in the backup folder", name));
+            return true;
+        }
+        if original.exists() {
+            result.conflicts.push(original.clone());
+            return true;
+        }
+
+        let moved = original
+            .parent()
+            .map_or(Ok(()), fs::create_dir_all)
+            .and_then(|_| move_file(&backup_path, original));
+        if let Err(e) = moved {
+            result
+                .errors
+                .push(format!("Failed to restore {}: {}", name, e));
+            return true;
+        }
+
+        let backup_meta = meta_path_for(&backup_path);
+        let original_meta = meta_path_for(original);
+        if backup_meta.exists() && !original_meta.exists() {
+            if let Err(e) = move_file(&backup_meta, &original_meta) {
+                log::warn!("Failed to restore {:?}: {}", backup_meta, e);
+            }
+        }
+
+        // Only succeeds once a numbered subfolder for name clashes is empty
+        if let Some(subfolder) = backup_path.parent().filter(|dir| *dir != backup_dir) {
+            let _ = fs::remove_dir(subfolder);
+        }
+
+        log::info!("Restored {:?}", original);
+        result.restored += 1;
+        false
+    });
+
+    if manifest.files.is_empty() {
+        fs::remove_file(backup_dir.join(BACKUP_MANIFEST_FILE_NAME))
+            .with_context(|| format!("Failed to remove manifest in {:?}", backup_dir))?;
+        // Only succeeds when nothing else was left behind
+        let _ = fs::remove_dir(backup_dir);
+    } else {
+        manifest.save(backup_dir)?;
+    }
+
+    Ok(result)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::tempdir;
+
+    #[test]
+    fn test_restore_backup() {
+        let dir = tempdir().unwrap();
+        let game = dir.path().join("Skyrim");
+        let backup = dir
+            .path()
+            .join("WLC_RecycleBin")
+            .join("2025-01-01_10-00-00");
+        fs::create_dir_all(&game).unwrap();
+        fs::create_dir_all(&backup).unwrap();
+
+        let restored = game.join("SkyUI-12604-5-2-1.7z");
+        let conflicting = game.join("USSEP-266-4-2-1.7z");
+        fs::write(backup.join("SkyUI-12604-5-2-1.7z"), b"old").unwrap();
+        fs::write(backup.join("SkyUI-12604-5-2-1.7z.meta"), "modID=12604\n").unwrap();
+        fs::write(backup.join("USSEP-266-4-2-1.7z"), b"old").unwrap();
+        fs::write(&conflicting, b"redownloaded").unwrap();
+        save_backup_manifest(
+            &backup,
+            &[
+                (restored.clone(), backup.join("SkyUI-12604-5-2-1.7z")),
+                (conflicting.clone(), backup.join("USSEP-266-4-2-1.7z")),
+            ],
+        )
+        .unwrap();
+
+        let backups = list_backups(&[dir.path().join("WLC_RecycleBin")]);
+        assert_eq!(backups.len(), 1);
+        assert_eq!(backups[0].path, backup);
+        assert_eq!(backups[0].file_count, 2);
+
+        let result = restore_backup(&backup).unwrap();
+        assert_eq!(result.restored, 1);
+        assert_eq!(result.conflicts, vec![conflicting.clone()]);
+        assert!(result.errors.is_empty());
+        assert_eq!(fs::read(&restored).unwrap(), b"old");
+        assert!(meta_path_for(&restored).exists());
+        assert_eq!(fs::read(&conflicting).unwrap(), b"redownloaded");
+
+        // The conflict stays in the backup and its manifest
+        let manifest = BackupManifest::load(&backup).unwrap();
+        assert_eq!(manifest.files.len(), 1);
+        assert!(manifest.files.contains_key("USSEP-266-4-2-1.7z"));
+
+        fs::remove_file(&conflicting).unwrap();
+        let result = restore_backup(&backup).unwrap();
+        assert_eq!(result.restored, 1);
+        assert!(!backup.exists());
+        assert!(list_backups(&[dir.path().join("WLC_RecycleBin")]).is_empty());
+    }
+
+    #[test]
+    fn test_restore_files() {
+        let dir = tempdir().unwrap();
+        let game = dir.path().join("Skyrim");
+        let backup = dir.path().join("WLC_RecycleBin").join("old-versions");
+        fs::create_dir_all(&game).unwrap();
+        fs::create_dir_all(&backup).unwrap();
+
+        // An earlier cleanup reused the same folder
+        let earlier = game.join("SkyUI-12604-5-1-1.7z");
+        let last = game.join("USSEP-266-4-2-1.7z");
+        fs::write(backup.join("SkyUI-12604-5-1-1.7z"), b"earlier").unwrap();
+        fs::write(backup.join("USSEP-266-4-2-1.7z"), b"last").unwrap();
+        save_backup_manifest(
+            &backup,
+            &[(earlier.clone(), backup.join("SkyUI-12604-5-1-1.7z"))],
+        )
+        .unwrap();
+        save_backup_manifest(
+            &backup,
+            &[(last.clone(), backup.join("USSEP-266-4-2-1.7z"))],
+        )
+        .unwrap();
+
+        let result = restore_files(&backup, std::slice::from_ref(&last)).unwrap();
+        assert_eq!(result.restored, 1);
+        assert!(result.conflicts.is_empty() && result.errors.is_empty());
+        assert_eq!(fs::read(&last).unwrap(), b"last");
+        assert!(!earlier.exists());
+
+        let manifest = BackupManifest::load(&backup).unwrap();
+        assert_eq!(manifest.files.len(), 1);
+        assert!(manifest.files.contains_key("SkyUI-12604-5-1-1.7z"));
+    }
+}
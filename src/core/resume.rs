@@ -0,0 +1,195 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+use std::collections::BTreeMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::time::UNIX_EPOCH;
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+
+use crate::core::config::Config;
+use crate::core::types::ModFile;
+
+const SCAN_PROGRESS_FILE_NAME: &str = "scan_progress.json";
+
+/// Cheap summary of a folder's contents used to detect changes between runs
+///
+/// Adding, removing or renaming a file updates the folder's modification time.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct FolderFingerprint {
+    pub entries: usize,
+    pub modified: u64,
+}
+
+/// Compute the fingerprint of a folder
+pub fn folder_fingerprint(folder: &Path) -> Result<FolderFingerprint> {
+    let modified = fs::metadata(folder)
+        .and_then(|m| m.modified())
+        .with_context(|| format!("Failed to read folder metadata: {:?}", folder))?
+        .duration_since(UNIX_EPOCH)
+        .map(|d| d.as_nanos() as u64)
+        .unwrap_or(0);
+    let entries = fs::read_dir(folder)
+        .with_context(|| format!("Failed to read directory: {:?}", folder))?
+        .count();
+
+    Ok(FolderFingerprint { entries, modified })
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+struct FolderProgress {
+    fingerprint: FolderFingerprint,
+    files: Vec<ModFile>,
+}
+
+/// Folders finished by a multi-folder scan, saved after each folder
+///
+/// If a scan is interrupted, a resumed run reuses the cached files of every
+/// folder whose fingerprint hasn't changed and only scans the rest.
+#[derive(Debug, Default, Serialize, Deserialize)]
+pub struct ScanProgress {
+    folders: BTreeMap<PathBuf, FolderProgress>,
+    #[serde(skip)]
+    path: Option<PathBuf>,
+}
+
+impl ScanProgress {
+    /// Location of the progress file next to the config file
+    pub fn default_path() -> Option<PathBuf> {
+        Config::default_path().and_then(|p| p.parent().map(|dir| dir.join(SCAN_PROGRESS_FILE_NAME)))
+    }
+
+    /// Start tracking progress in `path`
+    ///
+    /// With `resume`, folders finished by an earlier interrupted run are
+    /// loaded; otherwise the scan starts from scratch.
+    pub fn open(path: &Path, resume: bool) -> Self {
+        let mut progress = if resume && path.exists() {
+            match Self::load(path) {
+                Ok(p) => {
+                    log::info!("Resuming scan with {} finished folders", p.folders.len());
+                    p
+                }
+                Err(e) => {
+                    log::warn!("Ignoring unreadable scan progress: {:#}", e);
+                    Self::default()
+                }
+            }
+        } else {
+            Self::default()
+        };
+        progress.path = Some(path.to_path_buf());
+        progress
+    }
+
+    fn load(path: &Path) -> Result<Self> {
+        let content = fs::read_to_string(path)
+            .with_context(|| format!("Failed to read scan progress: {:?}", path))?;
+        serde_json::from_str(&content)
+            .with_context(|| format!("Failed to parse scan progress: {:?}", path))
+    }
+
+    /// Cached files of a finished folder, if its contents haven't changed
+    pub fn cached(&self, folder: &Path, fingerprint: &FolderFingerprint) -> Option<&[ModFile]> {
+        let entry = self.folders.get(folder)?;
+        if entry.fingerprint != *fingerprint {
+            log::info!(
+                "Folder changed since the last run, rescanning: {:?}",
+                folder
+            );
+            return None;
+        }
+        Some(&entry.files)
+    }
+
+    /// Record a finished folder and save the progress file
+    pub fn record(
+        &mut self,
+        folder: &Path,
+        fingerprint: FolderFingerprint,
+        files: Vec<ModFile>,
+    ) -> Result<()> {
+        self.folders
+            .insert(folder.to_path_buf(), FolderProgress { fingerprint, files });
+
+        let Some(path) = &self.path else {
+            return Ok(());
+        };
+        if let Some(parent) = path.parent() {
+            fs::create_dir_all(parent)
+                .with_context(|| format!("Failed to create folder: {:?}", parent))?;
+        }
+        let content = serde_json::to_string(self).context("Failed to serialize scan progress")?;
+        fs::write(path, content)
+            .with_context(|| format!("Failed to write scan progress: {:?}", path))
+    }
+
+    /// Remove the progress file once the scan has completed
+    pub fn finish(self) {
+        if let Some(path) = self.path {
+            if path.exists() {
+                if let Err(e) = fs::remove_file(&path) {
+                    log::warn!("Failed to remove scan progress {:?}: {}", path, e);
+                }
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::tempdir;
+
+    fn mod_file(name: &str) -> ModFile {
+        ModFile {
+            file_name: name.to_string(),
+            full_path: PathBuf::from(name),
+            mod_name: "test".to_string(),
+            mod_id: "1".to_string(),
+            file_id: None,
+            version: "1".to_string(),
+            timestamp: "1".to_string(),
+            size: 1,
+            is_patch: false,
+            modified: None,
+        }
+    }
+
+    #[test]
+    fn test_resume_skips_unchanged_folders() {
+        let dir = tempdir().unwrap();
+        let folder = dir.path().join("Skyrim");
+        fs::create_dir(&folder).unwrap();
+        fs::write(folder.join("a.7z"), b"a").unwrap();
+        let state = dir.path().join("state").join("progress.json");
+
+        let mut progress = ScanProgress::open(&state, false);
+        let fp = folder_fingerprint(&folder).unwrap();
+        progress
+            .record(&folder, fp.clone(), vec![mod_file("a.7z")])
+            .unwrap();
+        assert!(state.exists());
+
+        // A resumed run reuses the folder; a fresh run ignores it
+        let resumed = ScanProgress::open(&state, true);
+        assert_eq!(resumed.cached(&folder, &fp).unwrap().len(), 1);
+        assert!(ScanProgress::open(&state, false)
+            .cached(&folder, &fp)
+            .is_none());
+
+        // Changed folder contents invalidate the cached result
+        fs::write(folder.join("b.7z"), b"b").unwrap();
+        let changed = folder_fingerprint(&folder).unwrap();
+        assert!(resumed.cached(&folder, &changed).is_none());
+
+        resumed.finish();
+        assert!(!state.exists());
+    }
+}
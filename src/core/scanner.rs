@@ -5,23 +5,44 @@
 // the Free Software Foundation, either version 3 of the License, or
 // (at your option) any later version.
 
-use std::collections::HashMap;
+use std::collections::{HashMap, HashSet};
 use std::fs;
 use std::path::Path;
+use std::sync::atomic::{AtomicBool, AtomicUsize, Ordering};
+use std::sync::Mutex;
 
-use anyhow::{Context, Result};
+use anyhow::{anyhow, Context, Result};
 use rayon::prelude::*;
 
+use crate::core::cleaner::{resolve_links, RECYCLE_BIN_DIR_NAME};
+use crate::core::games::{default_games, game_key, resolve_game, GameEntry};
+use crate::core::hash::HashCache;
+use crate::core::meta::{mod_file_from_meta, read_embedded_meta, read_meta_for};
 use crate::core::parser::{
-    extract_part_indicator, is_full_or_main_file, is_wabbajack_file, normalize_mod_name,
-    parse_mod_filename,
+    archive_parts, compare_versions, extract_option_indicator, generic_mod_file,
+    is_full_or_main_file, is_numeric, is_wabbajack_file, loose_file_name, name_part_indicator,
+    normalize_mod_name, parse_mod_filename, split_archive_part, zip_uncompressed_size,
+    ParseOptions,
 };
+use crate::core::pins::Pins;
+use crate::core::resume::{folder_fingerprint, ScanProgress};
+use crate::core::stat_cache::{FileStat, StatCache};
+use crate::core::trace::{trace, trace_enabled};
 use crate::core::types::{
-    LibraryStats, ModFile, ModGroup, ModlistInfo, OldVersionScanResult, OrphanedMod, ScanResult,
+    CleanupPlan, CrossFolderDuplicate, ExpectedArchive, ForeignGameMod, FragmentedMod, GameStats,
+    GroupStrategy, IdenticalArchives, IdenticalFiles, KeepOrder, KeepReason, LibraryAudit,
+    LibraryStats, MatchKind, MissingArchive, ModFile, ModGroup, ModlistFootprint, ModlistInfo,
+    ModlistUse, NewestBy, OldVersionScanResult, OrphanedMod, ScanResult, SkipReason, SkippedFile,
+    VersionDrift, VersionDriftKind, VersionMismatch,
 };
 
-/// Get game folders from a base directory
-pub fn get_game_folders(base_dir: &Path) -> Result<Vec<std::path::PathBuf>> {
+/// Get game folders from a base directory.
+/// Folders starting with `.` or `__` are skipped unless `include_hidden` is set.
+///
+/// A flat library keeps its archives directly in the base directory, which
+/// is then scanned as a game folder of its own. The recycle bin is never
+/// returned, since it holds backups rather than downloads.
+pub fn get_game_folders(base_dir: &Path, include_hidden: bool) -> Result<Vec<std::path::PathBuf>> {
     let mut folders = Vec::new();
 
     let entries = fs::read_dir(base_dir)
@@ -47,14 +68,43 @@ pub fn get_game_folders(base_dir: &Path) -> Result<Vec<std::path::PathBuf>> {
     }
 
     // Also scan for subdirectories (game folders)
+    let mut links = Vec::new();
     for entry in entries {
         let entry = entry?;
         let name = entry.file_name();
         let name_str = name.to_string_lossy();
+        // Symlinks and junctions aren't reported as folders themselves
+        let file_type = entry.file_type()?;
+        let is_link = file_type.is_symlink() && entry.path().is_dir();
 
-        if entry.file_type()?.is_dir() && !name_str.starts_with('.') && !name_str.starts_with("__")
+        if (file_type.is_dir() || is_link)
+            && (include_hidden || !is_hidden_folder(&name_str))
+            && name_str != RECYCLE_BIN_DIR_NAME
         {
-            folders.push(entry.path());
+            if is_link {
+                links.push(entry.path());
+            } else {
+                folders.push(entry.path());
+            }
+        }
+    }
+
+    // A link to a folder that is already listed would count its archives twice
+    let mut targets: HashSet<std::path::PathBuf> = folders
+        .iter()
+        .filter_map(|f| fs::canonicalize(f).ok())
+        .collect();
+    for link in links {
+        match fs::canonicalize(&link) {
+            Ok(target) if !targets.insert(target.clone()) => {
+                log::warn!(
+                    "Skipping {:?}, a link to {:?} which is already scanned",
+                    link,
+                    target
+                );
+            }
+            Ok(_) => folders.push(link),
+            Err(e) => log::warn!("Skipping link {:?}: {}", link, e),
         }
     }
 
@@ -62,6 +112,54 @@ pub fn get_game_folders(base_dir: &Path) -> Result<Vec<std::path::PathBuf>> {
     Ok(folders)
 }
 
+/// Check if a folder is hidden from scans by its name: `.` and `__` folders are
+pub(crate) fn is_hidden_folder(name: &str) -> bool {
+    name.starts_with('.') || name.starts_with("__")
+}
+
+/// The game folder a file was found in: the nearest of `game_folders` above it
+///
+/// Files in subfolders belong to the game folder whose scan reached them.
+pub fn game_folder_of<'a>(
+    path: &Path,
+    game_folders: &'a [std::path::PathBuf],
+) -> Option<&'a std::path::PathBuf> {
+    path.ancestors()
+        .skip(1)
+        .find_map(|dir| game_folders.iter().find(|f| f.as_path() == dir))
+}
+
+/// Comparison key of the game whose folder holds `path`, if the folder names a known game
+fn folder_game(
+    path: &Path,
+    game_folders: &[std::path::PathBuf],
+    games: &[GameEntry],
+) -> Option<String> {
+    let name = game_folder_of(path, game_folders)?
+        .file_name()?
+        .to_string_lossy();
+    resolve_game(games, &name).map(|_| game_key(games, &name))
+}
+
+/// Game folders that are symlinks or junctions, with the folder each points to
+///
+/// Their archives and free space are on the target's drive, which may not be
+/// the one holding the downloads folder.
+pub fn folder_links(
+    folders: &[std::path::PathBuf],
+) -> Vec<(std::path::PathBuf, std::path::PathBuf)> {
+    folders
+        .iter()
+        .filter(|f| fs::symlink_metadata(f).is_ok_and(|m| m.file_type().is_symlink()))
+        .map(|f| (f.clone(), resolve_links(f)))
+        .collect()
+}
+
+/// Check if game folders found by [`get_game_folders`] are just the flat base directory
+pub fn is_flat_library(base_dir: &Path, folders: &[std::path::PathBuf]) -> bool {
+    matches!(folders, [only] if only == base_dir)
+}
+
 /// Find all .wabbajack files in a directory
 pub fn find_wabbajack_files(base_dir: &Path) -> Result<Vec<std::path::PathBuf>> {
     let mut wabbajack_files = Vec::new();
@@ -88,97 +186,583 @@ pub fn find_wabbajack_files(base_dir: &Path) -> Result<Vec<std::path::PathBuf>>
     Ok(wabbajack_files)
 }
 
+/// Whether a folder is a Wabbajack installation rather than a downloads folder
+///
+/// Wabbajack keeps `Wabbajack.exe` and a `downloaded_mod_lists` folder in its
+/// installation folder, and its version folders would be scanned as games.
+pub fn looks_like_wabbajack_install(path: &Path) -> bool {
+    path.join("Wabbajack.exe").is_file() || path.join("downloaded_mod_lists").is_dir()
+}
+
+/// Find the modlist files of a Wabbajack installation, one per file name
+///
+/// `.wabbajack` files directly in `path` are used first, then those in its
+/// `downloaded_mod_lists` folder. Otherwise every version folder's
+/// `downloaded_mod_lists` is searched and the newest version of each wins.
+pub fn find_modlist_files(path: &Path) -> Result<Vec<std::path::PathBuf>> {
+    let mut modlist_map: HashMap<String, (std::path::PathBuf, String)> = HashMap::new();
+
+    // 1. The selected directory itself contains `.wabbajack` files
+    if let Ok(files) = find_wabbajack_files(path) {
+        add_modlist_files(&mut modlist_map, files, "");
+    }
+
+    // 2. A `downloaded_mod_lists` folder directly inside the selected path
+    if modlist_map.is_empty() {
+        let direct_modlists_path = path.join("downloaded_mod_lists");
+        if direct_modlists_path.exists() {
+            if let Ok(files) = find_wabbajack_files(&direct_modlists_path) {
+                add_modlist_files(&mut modlist_map, files, "");
+            }
+        }
+    }
+
+    // 3. Version subdirectories (original Wabbajack structure)
+    if modlist_map.is_empty() {
+        let entries =
+            fs::read_dir(path).with_context(|| format!("Failed to read directory: {:?}", path))?;
+        for entry in entries.flatten() {
+            if !entry.file_type().map(|t| t.is_dir()).unwrap_or(false) {
+                continue;
+            }
+            let version_name = entry.file_name().to_string_lossy().to_string();
+            let modlists_path = entry.path().join("downloaded_mod_lists");
+            if modlists_path.exists() {
+                if let Ok(files) = find_wabbajack_files(&modlists_path) {
+                    add_modlist_files(&mut modlist_map, files, &version_name);
+                }
+            }
+        }
+    }
+
+    Ok(modlist_map.into_values().map(|(p, _)| p).collect())
+}
+
+/// Find the `.wabbajack` files in a folder of saved modlists
+///
+/// Looks in the folder and in each folder directly inside it, but no deeper,
+/// so pointing it at a large archive directory stays quick. Hidden folders
+/// and the recycle bin are skipped. Each file name is used once.
+pub fn find_modlists_in_folder(dir: &Path) -> Result<Vec<std::path::PathBuf>> {
+    let mut modlist_map: HashMap<String, (std::path::PathBuf, String)> = HashMap::new();
+    add_modlist_files(&mut modlist_map, find_wabbajack_files(dir)?, "");
+
+    let entries =
+        fs::read_dir(dir).with_context(|| format!("Failed to read directory: {:?}", dir))?;
+    for entry in entries.flatten() {
+        if !entry.file_type().map(|t| t.is_dir()).unwrap_or(false) {
+            continue;
+        }
+        let name = entry.file_name().to_string_lossy().to_string();
+        if name.starts_with('.') || name == RECYCLE_BIN_DIR_NAME {
+            continue;
+        }
+        match find_wabbajack_files(&entry.path()) {
+            Ok(files) => add_modlist_files(&mut modlist_map, files, ""),
+            Err(e) => log::warn!("Skipping {:?}: {:#}", entry.path(), e),
+        }
+    }
+
+    Ok(modlist_map.into_values().map(|(p, _)| p).collect())
+}
+
+/// Add modlist files by name, keeping the one from the newest version folder
+fn add_modlist_files(
+    modlist_map: &mut HashMap<String, (std::path::PathBuf, String)>,
+    files: Vec<std::path::PathBuf>,
+    version_name: &str,
+) {
+    for wbfile in files {
+        let basename = wbfile
+            .file_name()
+            .map(|n| n.to_string_lossy().to_string())
+            .unwrap_or_default();
+        if modlist_map
+            .get(&basename)
+            .map(|(_, v)| version_name > v.as_str())
+            .unwrap_or(true)
+        {
+            modlist_map.insert(basename, (wbfile, version_name.to_string()));
+        }
+    }
+}
+
+/// Error message of a file scan stopped through its cancel flag
+pub const SCAN_CANCELLED: &str = "Scan cancelled";
+
 /// Collect all mod files from game folders
 pub fn get_all_mod_files(game_folders: &[std::path::PathBuf]) -> Result<Vec<ModFile>> {
+    get_all_mod_files_cached(game_folders, &ParseOptions::default(), &StatCache::new())
+}
+
+/// Collect all mod files from game folders, reading names as `parse` says
+/// and file stats through `cache`
+pub fn get_all_mod_files_cached(
+    game_folders: &[std::path::PathBuf],
+    parse: &ParseOptions,
+    cache: &StatCache,
+) -> Result<Vec<ModFile>> {
     // Process game folders in parallel
     let all_files: Vec<ModFile> = game_folders
         .par_iter()
-        .flat_map(|folder| {
-            let entries = match fs::read_dir(folder) {
-                Ok(e) => e,
-                Err(e) => {
-                    log::warn!("Failed to read folder {:?}: {}", folder, e);
-                    return Vec::new();
-                }
-            };
+        .flat_map(|folder| collect_folder_mod_files(folder, parse, cache, None))
+        .collect();
 
-            // Collect valid entries first to avoid holding I/O locks
-            let valid_entries: Vec<_> = entries
-                .filter_map(|e| e.ok())
-                .filter(|e| !e.file_type().map(|t| t.is_dir()).unwrap_or(true))
-                .collect();
+    Ok(all_files)
+}
 
-            // Process entries in parallel within each folder
-            valid_entries
-                .par_iter()
-                .filter_map(|entry| {
-                    let filename = entry.file_name().to_string_lossy().to_string();
+/// Collect all mod files from game folders, stopping early once `cancel` is set
+///
+/// The flag is checked before each file, so a scan of a slow network drive
+/// can be stopped from another thread. A stopped scan returns [`SCAN_CANCELLED`].
+pub fn get_all_mod_files_cancellable(
+    game_folders: &[std::path::PathBuf],
+    parse: &ParseOptions,
+    cache: &StatCache,
+    cancel: &AtomicBool,
+) -> Result<Vec<ModFile>> {
+    let all_files: Vec<ModFile> = game_folders
+        .par_iter()
+        .flat_map(|folder| collect_folder_mod_files(folder, parse, cache, Some(cancel)))
+        .collect();
 
-                    // Check if it is an archive file
-                    if !is_wabbajack_file(&filename) {
-                        return None;
-                    }
+    if cancel.load(Ordering::Relaxed) {
+        return Err(anyhow!("{}", SCAN_CANCELLED));
+    }
+    Ok(all_files)
+}
 
-                    // Try to parse as Nexus mod, otherwise treat as generic archive
-                    let mut mod_file = parse_mod_filename(&filename).unwrap_or_else(|| {
-                        // Generic archive file (e.g. from GitHub/Direct URL)
-                        // We track it so we can detect if it is Orphaned (unused)
-                        ModFile {
-                            file_name: filename.clone(),
-                            full_path: std::path::PathBuf::new(),
-                            mod_name: filename.clone(), // Use full filename as name
-                            mod_id: "0".to_string(),    // Default ID for unknown
-                            file_id: None,
-                            version: "0.0".to_string(),
-                            timestamp: "0".to_string(),
-                            size: 0,
-                            is_patch: false,
-                        }
-                    });
+/// Collect all mod files from game folders, reporting each file scanned
+///
+/// Every folder is listed first so `progress` can be given the files scanned
+/// so far and the total. It is called from the scanning threads. Subfolders
+/// are scanned up to `subfolder_depth` levels down.
+pub fn get_all_mod_files_with_progress(
+    game_folders: &[std::path::PathBuf],
+    parse: &ParseOptions,
+    subfolder_depth: usize,
+    progress: &(dyn Fn(usize, usize) + Sync),
+) -> Result<Vec<ModFile>> {
+    let cache = StatCache::with_subfolders(subfolder_depth, game_folders);
+    let listed = list_folders(game_folders, &cache);
+    let progress = FileProgress::new(&listed, progress);
 
-                    let full_path = entry.path();
-                    if let Ok(metadata) = fs::metadata(&full_path) {
-                        mod_file.full_path = full_path;
-                        mod_file.size = metadata.len();
-                        return Some(mod_file);
-                    }
-                    None
-                })
-                .collect::<Vec<ModFile>>()
+    let all_files: Vec<ModFile> = listed
+        .into_par_iter()
+        .flat_map(|(folder, paths)| match paths {
+            Ok(paths) => collect_mod_files(paths, parse, &cache, Some(&progress), None),
+            Err(e) => {
+                log::warn!("Failed to read folder {:?}: {:#}", folder, e);
+                Vec::new()
+            }
         })
         .collect();
 
     Ok(all_files)
 }
 
-/// Detect orphaned mods by comparing mod files with active modlists
-pub fn detect_orphaned_mods(mod_files: &[ModFile], active_modlists: &[ModlistInfo]) -> ScanResult {
-    // Build combined sets for matching
-    let mut used_file_names = std::collections::HashSet::new();
-    let mut used_mod_ids = std::collections::HashSet::new();
+/// Files in each folder, listed up front so a scan knows its total
+type ListedFolders = Vec<(std::path::PathBuf, Result<Vec<std::path::PathBuf>>)>;
 
-    for modlist in active_modlists {
-        for file_name in &modlist.used_file_names {
-            used_file_names.insert(file_name.clone());
+fn list_folders(folders: &[std::path::PathBuf], cache: &StatCache) -> ListedFolders {
+    folders
+        .par_iter()
+        .map(|folder| (folder.clone(), cache.list_folder(folder)))
+        .collect()
+}
+
+/// Counts the files scanned by parallel threads and reports each one
+struct FileProgress<'a> {
+    done: AtomicUsize,
+    total: usize,
+    report: &'a (dyn Fn(usize, usize) + Sync),
+}
+
+impl<'a> FileProgress<'a> {
+    fn new(listed: &ListedFolders, report: &'a (dyn Fn(usize, usize) + Sync)) -> Self {
+        let total = listed
+            .iter()
+            .filter_map(|(_, paths)| paths.as_ref().ok())
+            .map(Vec::len)
+            .sum();
+        Self {
+            done: AtomicUsize::new(0),
+            total,
+            report,
+        }
+    }
+
+    fn advance(&self) {
+        let done = self.done.fetch_add(1, Ordering::Relaxed) + 1;
+        (self.report)(done, self.total);
+    }
+}
+
+/// Collect mod files from game folders, saving progress after each folder
+///
+/// Folders already finished by an interrupted run are taken from `progress`
+/// when their contents haven't changed. The progress file is removed once
+/// every folder has been scanned. Folders are scanned in parallel; the
+/// files come back in folder order. Setting `cancel` stops the scan with
+/// [`SCAN_CANCELLED`], keeping the folders finished so far for the next run.
+pub fn get_all_mod_files_resumable(
+    game_folders: &[std::path::PathBuf],
+    parse: &ParseOptions,
+    progress: ScanProgress,
+    cancel: &AtomicBool,
+) -> Result<Vec<ModFile>> {
+    let progress = Mutex::new(progress);
+    let cache = StatCache::new();
+
+    let per_folder = game_folders
+        .par_iter()
+        .map(|folder| {
+            let fingerprint = folder_fingerprint(folder)?;
+            let cached = progress
+                .lock()
+                .unwrap_or_else(|e| e.into_inner())
+                .cached(folder, &fingerprint)
+                .map(<[ModFile]>::to_vec);
+            if let Some(files) = cached {
+                log::info!("Skipping already scanned folder: {:?}", folder);
+                return Ok(files);
+            }
+
+            let files = collect_folder_mod_files(folder, parse, &cache, Some(cancel));
+            if cancel.load(Ordering::Relaxed) {
+                return Err(anyhow!("{}", SCAN_CANCELLED));
+            }
+            let mut progress = progress.lock().unwrap_or_else(|e| e.into_inner());
+            if let Err(e) = progress.record(folder, fingerprint, files.clone()) {
+                log::warn!("Failed to save scan progress: {:#}", e);
+            }
+            Ok(files)
+        })
+        .collect::<Result<Vec<Vec<ModFile>>>>()?;
+
+    progress
+        .into_inner()
+        .unwrap_or_else(|e| e.into_inner())
+        .finish();
+    Ok(per_folder.into_iter().flatten().collect())
+}
+
+/// Collect the archives directly inside one game folder
+fn collect_folder_mod_files(
+    folder: &Path,
+    parse: &ParseOptions,
+    cache: &StatCache,
+    cancel: Option<&AtomicBool>,
+) -> Vec<ModFile> {
+    if cancel.is_some_and(|c| c.load(Ordering::Relaxed)) {
+        return Vec::new();
+    }
+    let paths = match cache.list_folder(folder) {
+        Ok(paths) => paths,
+        Err(e) => {
+            log::warn!("Failed to read folder {:?}: {:#}", folder, e);
+            return Vec::new();
+        }
+    };
+    collect_mod_files(paths, parse, cache, None, cancel)
+}
+
+/// Collect the archives among a folder's files
+fn collect_mod_files(
+    paths: Vec<std::path::PathBuf>,
+    parse: &ParseOptions,
+    cache: &StatCache,
+    progress: Option<&FileProgress>,
+    cancel: Option<&AtomicBool>,
+) -> Vec<ModFile> {
+    // Process entries in parallel within each folder
+    paths
+        .into_par_iter()
+        .filter_map(|full_path| {
+            if cancel.is_some_and(|c| c.load(Ordering::Relaxed)) {
+                return None;
+            }
+            if let Some(progress) = progress {
+                progress.advance();
+            }
+            let filename = full_path.file_name()?.to_string_lossy().to_string();
+
+            // Check if it is an archive file; later parts go with the first
+            if !parse.is_wabbajack_file(&filename) || parse.is_later_archive_part(&filename) {
+                return None;
+            }
+
+            // Try to parse as Nexus mod, then its .meta, otherwise treat as generic archive
+            let parsed = parse.parse_mod_filename(&filename);
+            if trace_enabled() {
+                if let Some(mf) = &parsed {
+                    trace(&filename, "parse", "nexus", &parse_detail(mf));
+                }
+            }
+            let parsed = parsed.or_else(|| parse_from_meta(&filename, &full_path, parse, cache));
+            if parsed.is_none() {
+                trace(&filename, "parse", "generic", "no ModID in name or .meta");
+            }
+            let mut mod_file = parsed.unwrap_or_else(|| generic_mod_file(&filename));
+
+            let stat = stat_archive(&full_path, cache).ok()?;
+            mod_file.full_path = full_path;
+            mod_file.size = stat.size;
+            mod_file.modified = stat.modified;
+            Some(mod_file)
+        })
+        .collect()
+}
+
+/// Stat an archive, summing the sizes of all parts of a multi-part archive
+fn stat_archive(first_part: &Path, cache: &StatCache) -> std::io::Result<FileStat> {
+    let mut stat = cache.stat(first_part)?;
+    for part in archive_parts(first_part).iter().skip(1) {
+        stat.size += cache.stat(part)?.size;
+    }
+    Ok(stat)
+}
+
+/// Recover ModID and FileID from the `.meta` of an archive whose name has none
+///
+/// Without a `.meta`, a `meta.ini` inside the archive is tried when `parse`
+/// turns archive inspection on. The file's modification time stands in for the upload
+/// timestamp, so versions recovered this way can still be ordered.
+fn parse_from_meta(
+    filename: &str,
+    full_path: &Path,
+    parse: &ParseOptions,
+    cache: &StatCache,
+) -> Option<ModFile> {
+    let (meta, source) = match read_meta_for(full_path) {
+        Some(meta) => (meta, "meta"),
+        None if parse.inspect_archives => (read_embedded_meta(full_path)?, "archive meta.ini"),
+        None => return None,
+    };
+    let mut mod_file = mod_file_from_meta(filename, &meta)?;
+    if let Some(modified) = cache.stat(full_path).ok().and_then(|s| s.modified) {
+        mod_file.timestamp = modified.to_string();
+    }
+    if trace_enabled() {
+        trace(filename, "parse", source, &parse_detail(&mod_file));
+    }
+    Some(mod_file)
+}
+
+/// Summarize the fields parsed from a file name for the trace
+fn parse_detail(mod_file: &ModFile) -> String {
+    format!(
+        "mod {:?}, ModID {}, FileID {}, version {}, timestamp {}{}",
+        mod_file.mod_name,
+        mod_file.mod_id,
+        mod_file.file_id.as_deref().unwrap_or("-"),
+        mod_file.version,
+        mod_file.timestamp,
+        if mod_file.is_patch { ", patch" } else { "" }
+    )
+}
+
+/// Record the same decision for every file of a group
+fn trace_group(group: &ModGroup, stage: &str, verdict: &str, detail: &str) {
+    if trace_enabled() {
+        for file in &group.files {
+            trace(&file.file_name, stage, verdict, detail);
+        }
+    }
+}
+
+/// References of the active modlists merged into borrowed sets
+struct ModlistRefs<'a> {
+    file_names: HashSet<&'a str>,
+    /// `"<ModID>-<FileID>"` keys
+    file_ids: HashSet<&'a str>,
+    /// ModIDs some modlist references without listing any of their FileIDs
+    bare_mod_ids: HashSet<&'a str>,
+    /// Content hashes of every listed archive, whatever its source
+    hashes: HashSet<&'a str>,
+    /// Listed file names as compared by `loose_file_name`
+    loose_names: HashSet<String>,
+    /// ModID -> keys of the games modlists download it for; Nexus ModIDs
+    /// are only unique within one game
+    id_games: HashMap<&'a str, HashSet<String>>,
+}
+
+impl<'a> ModlistRefs<'a> {
+    /// References of `active_modlists`; with `games`, ModIDs also remember their games
+    fn new(active_modlists: &'a [ModlistInfo], games: &[GameEntry]) -> Self {
+        let total_names = active_modlists
+            .iter()
+            .map(|m| m.used_file_names.len())
+            .sum();
+        let total_ids = active_modlists
+            .iter()
+            .map(|m| m.used_mod_file_ids.len())
+            .sum();
+        let mut refs = ModlistRefs {
+            file_names: HashSet::with_capacity(total_names),
+            file_ids: HashSet::with_capacity(total_ids),
+            bare_mod_ids: HashSet::new(),
+            hashes: HashSet::new(),
+            loose_names: HashSet::with_capacity(total_names),
+            id_games: HashMap::new(),
+        };
+
+        for modlist in active_modlists {
+            refs.file_names
+                .extend(modlist.used_file_names.iter().map(String::as_str));
+            refs.loose_names
+                .extend(modlist.used_file_names.iter().map(|n| loose_file_name(n)));
+            refs.hashes
+                .extend(modlist.archive_hashes.values().map(String::as_str));
+            refs.file_ids
+                .extend(modlist.used_mod_file_ids.iter().map(String::as_str));
+            let with_file_ids: HashSet<&str> = modlist
+                .used_mod_file_ids
+                .iter()
+                .filter_map(|key| key.split_once('-').map(|(mod_id, _)| mod_id))
+                .collect();
+            refs.bare_mod_ids.extend(
+                modlist
+                    .used_mod_keys
+                    .iter()
+                    .map(String::as_str)
+                    .filter(|mod_id| !with_file_ids.contains(mod_id)),
+            );
+            if games.is_empty() {
+                continue;
+            }
+            // Lists pull archives from a sibling game's Nexus, like LE archives in
+            // an SE list, and those are downloaded into the list's own game folder
+            for archive in &modlist.archives {
+                let archive_games = modlist
+                    .archive_games
+                    .get(&archive.file_name)
+                    .into_iter()
+                    .chain(modlist.game.as_ref());
+                for game in archive_games {
+                    refs.id_games
+                        .entry(archive.mod_id.as_str())
+                        .or_default()
+                        .insert(game_key(games, game));
+                }
+            }
+        }
+        refs
+    }
+
+    /// Whether a modlist wants `mod_id` for the game `game`
+    ///
+    /// True when the file's game or the ModID's games aren't known, so only
+    /// a clear mismatch, like a Skyrim archive whose ModID a Fallout list
+    /// uses, rules out an ID match.
+    fn wants_for_game(&self, mod_id: &str, game: Option<&str>) -> bool {
+        match (game, self.id_games.get(mod_id)) {
+            (Some(game), Some(games)) => games.contains(game),
+            _ => true,
+        }
+    }
+
+    /// How a file in the game `game` matches the modlists, if it is used at all
+    fn match_kind(&self, mod_file: &ModFile, game: Option<&str>) -> Option<MatchKind> {
+        self.precise_kind(mod_file, game)
+            .or_else(|| self.fallback_kind(&mod_file.file_name, &mod_file.full_path))
+    }
+
+    /// Match by file name or Nexus IDs
+    ///
+    /// The exact file name is preferred, then the ModID and FileID. A ModID
+    /// alone only counts when no modlist lists a FileID for it; otherwise a
+    /// different FileID is a different file the modlist doesn't need. ID
+    /// matches also need a modlist to want the ModID for the file's game.
+    fn precise_kind(&self, mod_file: &ModFile, game: Option<&str>) -> Option<MatchKind> {
+        if self.file_names.contains(mod_file.file_name.as_str()) {
+            return Some(MatchKind::FileName);
+        }
+        if !self.wants_for_game(&mod_file.mod_id, game) {
+            return None;
         }
-        for mod_key in &modlist.used_mod_keys {
-            used_mod_ids.insert(mod_key.clone());
+        if let Some(file_id) = &mod_file.file_id {
+            let key = format!("{}-{}", mod_file.mod_id, file_id);
+            if self.file_ids.contains(key.as_str()) {
+                return Some(MatchKind::FileId);
+            }
+        }
+        self.bare_mod_ids
+            .contains(mod_file.mod_id.as_str())
+            .then_some(MatchKind::ModId)
+    }
+
+    /// Match archives from any source by their `.meta` hash, then by a loose file name
+    ///
+    /// Manually downloaded and non-Nexus archives often carry no IDs in their
+    /// name, or were saved under a slightly different one.
+    fn fallback_kind(&self, file_name: &str, path: &Path) -> Option<MatchKind> {
+        if !self.hashes.is_empty() {
+            let hash = read_meta_for(path).and_then(|meta| meta.hash);
+            if hash.is_some_and(|h| self.hashes.contains(h.as_str())) {
+                return Some(MatchKind::Hash);
+            }
         }
+        self.loose_names
+            .contains(&loose_file_name(file_name))
+            .then_some(MatchKind::SimilarName)
     }
+}
+
+/// Detect orphaned mods by comparing mod files with active modlists
+///
+/// The modlists are merged into sets borrowing their references, so the
+/// merge is O(total archives) and classification is a few lookups per file
+/// no matter how many modlists are selected. With 100k files on disk the
+/// `ModFile`s themselves dominate memory (about 400 bytes each, ~40 MB);
+/// the merged sets add about 16 bytes per referenced archive.
+pub fn detect_orphaned_mods(mod_files: &[ModFile], active_modlists: &[ModlistInfo]) -> ScanResult {
+    detect_orphaned_mods_by_game(mod_files, active_modlists, &[], &[])
+}
+
+/// Find orphaned mods, matching Nexus IDs only within each file's game
+///
+/// A file's game is its game folder's, resolved through `games`. Nexus
+/// ModIDs are numbered per game, so a Skyrim archive isn't kept because a
+/// Fallout modlist uses the same ModID. Files in folders that don't resolve
+/// to a game are matched as before.
+pub fn detect_orphaned_mods_by_game(
+    mod_files: &[ModFile],
+    active_modlists: &[ModlistInfo],
+    game_folders: &[std::path::PathBuf],
+    games: &[GameEntry],
+) -> ScanResult {
+    let refs = ModlistRefs::new(active_modlists, games);
 
     log::info!(
         "Total unique file names in active modlists: {}",
-        used_file_names.len()
+        refs.file_names.len()
     );
     log::info!(
-        "Total unique ModIDs in active modlists: {}",
-        used_mod_ids.len()
+        "Total unique ModID+FileID pairs in active modlists: {}",
+        refs.file_ids.len()
     );
 
-    let (used_mods, orphaned_mods): (Vec<ModFile>, Vec<OrphanedMod>) =
+    let (used_mods, mut orphaned_mods): (Vec<ModFile>, Vec<OrphanedMod>) =
         mod_files.par_iter().partition_map(|mod_file| {
-            // Primary matching: exact file name match (most reliable)
-            let is_used = used_file_names.contains(&mod_file.file_name);
+            let game = folder_game(&mod_file.full_path, game_folders, games);
+            let kind = refs.match_kind(mod_file, game.as_deref());
+            let is_used = kind.is_some();
+            trace(
+                &mod_file.file_name,
+                "orphan",
+                if is_used { "used" } else { "orphaned" },
+                match kind {
+                    Some(MatchKind::FileName) => "a modlist references this file name",
+                    Some(MatchKind::FileId) => "a modlist references this ModID and FileID",
+                    Some(MatchKind::ModId) => "a modlist references this ModID without FileIDs",
+                    Some(MatchKind::Hash) => "a modlist references this archive's hash",
+                    Some(MatchKind::SimilarName) => {
+                        "a modlist references this file name with different case or underscores"
+                    }
+                    None => "no active modlist references this file",
+                },
+            );
 
             if is_used {
                 rayon::iter::Either::Left(mod_file.clone())
@@ -191,6 +775,13 @@ pub fn detect_orphaned_mods(mod_files: &[ModFile], active_modlists: &[ModlistInf
 
     let used_size: u64 = used_mods.par_iter().map(|m| m.size).sum();
     let orphaned_size: u64 = orphaned_mods.par_iter().map(|m| m.file.size).sum();
+    // Largest first, since those decide what a cleanup frees
+    orphaned_mods.sort_by(|a, b| {
+        b.file
+            .size
+            .cmp(&a.file.size)
+            .then_with(|| a.file.file_name.cmp(&b.file.file_name))
+    });
 
     log::info!(
         "Classification complete: {} used, {} orphaned",
@@ -198,90 +789,622 @@ pub fn detect_orphaned_mods(mod_files: &[ModFile], active_modlists: &[ModlistInf
         orphaned_mods.len()
     );
 
+    let orphaned_patches = find_orphaned_patches(mod_files, &orphaned_mods);
+    let keep_reasons = used_mods
+        .par_iter()
+        .map(|m| (m.full_path.clone(), keep_reasons(m, active_modlists)))
+        .collect();
+
     ScanResult {
         used_mods,
         orphaned_mods,
         used_size,
         orphaned_size,
+        foreign_game_mods: Vec::new(),
+        orphaned_patches,
+        fragmented_mods: Vec::new(),
+        identical_archives: Vec::new(),
+        keep_reasons,
+        small_orphans: 0,
+        small_orphans_size: 0,
     }
 }
 
-/// Check if files have conflicting descriptors (different content variants)
-fn has_conflicting_descriptors(filename1: &str, filename2: &str) -> bool {
-    let lower1 = filename1.to_lowercase();
-    let lower2 = filename2.to_lowercase();
-
-    let all_descriptors = [
-        // Texture quality
-        " 1k",
-        " 2k",
-        " 4k",
-        " 8k",
-        "-1k",
-        "-2k",
-        "-4k",
-        "-8k",
-        // Body types
-        "cbbe",
-        "uunp",
-        "bhunp",
-        "vanilla body",
-        "bodyslide",
-        // Mod components
-        " armor",
-        " weapon",
-        " clothes",
-        " clothing",
-        " hair",
-        " gloves",
-        " boots",
-        " helmet",
-        " meshes",
-        " textures",
-        "-armor",
-        "-weapon",
-        "-clothes",
-        "-hair",
-        "-gloves",
-        // File types
-        " esp ",
-        " esm ",
-        " esl ",
-        "esp-fe",
-        "esp only",
-        "esm only",
-        "loose files",
-        " bsa",
-        // Compatibility
-        " compat",
-        "compatibility",
-        " aslal",
-        "no worldspace",
-        "worldspace edit",
-        " performance",
-        // Edition types
-        " lite",
-        " light",
-        " full",
-        " extended",
-        " complete",
-        " basic",
-        " standard",
-        " deluxe",
-        // Clean variants
-        " clean",
-        " dirty",
-        " gross",
-        // Optional content
-        " optional",
-        " addon",
-        " add-on",
-        " expansion",
-    ];
+/// Hash orphaned archives and keep those a modlist lists by hash
+///
+/// Hashing reads every orphan in full, so it's opt-in and only applied to
+/// files nothing else matched. Rescued files are removed from `orphans` and
+/// returned with the modlists that list their hash.
+pub fn rescue_orphans_by_hash(
+    orphans: &mut Vec<OrphanedMod>,
+    active_modlists: &[ModlistInfo],
+    cache: &HashCache,
+) -> Vec<(ModFile, Vec<KeepReason>)> {
+    let mut modlists_by_hash: HashMap<&str, Vec<&str>> = HashMap::new();
+    for modlist in active_modlists {
+        for hash in modlist.archive_hashes.values() {
+            let names = modlists_by_hash.entry(hash.as_str()).or_default();
+            if !names.contains(&modlist.name.as_str()) {
+                names.push(modlist.name.as_str());
+            }
+        }
+    }
+    if modlists_by_hash.is_empty() {
+        return Vec::new();
+    }
 
-    let descriptors1: Vec<_> = all_descriptors
-        .iter()
-        .filter(|d| lower1.contains(*d))
+    let reasons: Vec<Option<Vec<KeepReason>>> = orphans
+        .par_iter()
+        .map(|orphan| {
+            let hash = match cache.hash(&orphan.file) {
+                Ok(hash) => hash,
+                Err(e) => {
+                    log::warn!("Failed to hash {:?}: {}", orphan.file.full_path, e);
+                    return None;
+                }
+            };
+            let modlists = modlists_by_hash.get(hash.as_str())?;
+            trace(
+                &orphan.file.file_name,
+                "orphan",
+                "used",
+                "a modlist references this archive's hash",
+            );
+            let mut reasons: Vec<KeepReason> = modlists
+                .iter()
+                .map(|name| KeepReason {
+                    modlist: name.to_string(),
+                    kind: MatchKind::Hash,
+                })
+                .collect();
+            reasons.sort_by(|a, b| a.modlist.cmp(&b.modlist));
+            Some(reasons)
+        })
+        .collect();
+
+    let mut rescued = Vec::new();
+    let mut reasons = reasons.into_iter();
+    orphans.retain(|orphan| match reasons.next().flatten() {
+        Some(reasons) => {
+            rescued.push((orphan.file.clone(), reasons));
+            false
+        }
+        None => true,
+    });
+    rescued
+}
+
+/// Move orphans a modlist lists by hash to the used mods of a scan result
+///
+/// Returns how many archives were rescued.
+pub fn match_orphans_by_hash(
+    result: &mut ScanResult,
+    active_modlists: &[ModlistInfo],
+    cache: &HashCache,
+) -> usize {
+    let rescued = rescue_orphans_by_hash(&mut result.orphaned_mods, active_modlists, cache);
+    let count = rescued.len();
+    for (file, reasons) in rescued {
+        result.orphaned_size -= file.size;
+        result.used_size += file.size;
+        result
+            .orphaned_patches
+            .retain(|p| p.file.full_path != file.full_path);
+        result.keep_reasons.insert(file.full_path.clone(), reasons);
+        result.used_mods.push(file);
+    }
+    count
+}
+
+/// List the modlists that reference an archive with the strongest match for each
+///
+/// Weaker matches from other modlists are recorded too, to show which lists
+/// share the mod.
+pub fn keep_reasons(mod_file: &ModFile, active_modlists: &[ModlistInfo]) -> Vec<KeepReason> {
+    let file_key = mod_file
+        .file_id
+        .as_ref()
+        .map(|file_id| format!("{}-{}", mod_file.mod_id, file_id));
+
+    let mut reasons: Vec<KeepReason> = active_modlists
+        .iter()
+        .filter_map(|modlist| {
+            let kind = if modlist.used_file_names.contains(&mod_file.file_name) {
+                MatchKind::FileName
+            } else if file_key
+                .as_ref()
+                .is_some_and(|key| modlist.used_mod_file_ids.contains(key))
+            {
+                MatchKind::FileId
+            } else if modlist.used_mod_keys.contains(&mod_file.mod_id) {
+                MatchKind::ModId
+            } else {
+                return None;
+            };
+            Some(KeepReason {
+                modlist: modlist.name.clone(),
+                kind,
+            })
+        })
+        .collect();
+
+    // Fallback matches scan whole modlists, so only look when nothing else matched
+    if reasons.is_empty() {
+        let hash = read_meta_for(&mod_file.full_path).and_then(|meta| meta.hash);
+        let loose = loose_file_name(&mod_file.file_name);
+        reasons = active_modlists
+            .iter()
+            .filter_map(|modlist| {
+                let kind = if hash
+                    .as_ref()
+                    .is_some_and(|h| modlist.archive_hashes.values().any(|v| v == h))
+                {
+                    MatchKind::Hash
+                } else if modlist
+                    .used_file_names
+                    .iter()
+                    .any(|n| loose_file_name(n) == loose)
+                {
+                    MatchKind::SimilarName
+                } else {
+                    return None;
+                };
+                Some(KeepReason {
+                    modlist: modlist.name.clone(),
+                    kind,
+                })
+            })
+            .collect();
+    }
+
+    reasons.sort_by(|a, b| a.kind.cmp(&b.kind).then_with(|| a.modlist.cmp(&b.modlist)));
+    reasons
+}
+
+/// Space each active modlist alone keeps in use, largest first
+///
+/// A used archive counts toward a modlist when no other active modlist
+/// references it, so dropping that modlist would orphan it. Every modlist
+/// is listed, including those whose archives are all shared.
+pub fn unique_footprint(modlists: &[ModlistInfo], result: &ScanResult) -> Vec<ModlistFootprint> {
+    let mut footprints: Vec<ModlistFootprint> = modlists
+        .iter()
+        .map(|m| ModlistFootprint {
+            modlist: m.name.clone(),
+            ..Default::default()
+        })
+        .collect();
+    for file in &result.used_mods {
+        let Some([reason]) = result.keep_reasons.get(&file.full_path).map(Vec::as_slice) else {
+            continue;
+        };
+        if let Some(footprint) = footprints.iter_mut().find(|f| f.modlist == reason.modlist) {
+            footprint.files += 1;
+            footprint.size += file.size;
+        }
+    }
+    footprints.sort_by(|a, b| b.size.cmp(&a.size).then_with(|| a.modlist.cmp(&b.modlist)));
+    footprints
+}
+
+/// List the modlists that reference an archive, with the version each downloads
+///
+/// Modlists that download a different Nexus FileID of the mod are flagged:
+/// the file on disk is not the one they install.
+pub fn which_modlists_use(mod_file: &ModFile, modlists: &[ModlistInfo]) -> Vec<ModlistUse> {
+    keep_reasons(mod_file, modlists)
+        .into_iter()
+        .map(|reason| {
+            let expected = modlists
+                .iter()
+                .find(|m| m.name == reason.modlist)
+                .and_then(|m| expected_archive_for(mod_file, m));
+            let expected_file_id = expected.and_then(|e| e.file_id.clone());
+            let other_file_id = mod_file
+                .file_id
+                .as_ref()
+                .zip(expected_file_id.as_ref())
+                .is_some_and(|(on_disk, wanted)| on_disk != wanted);
+            ModlistUse {
+                modlist: reason.modlist,
+                kind: reason.kind,
+                expected_version: expected.and_then(|e| e.version.clone()),
+                expected_file_id,
+                other_file_id,
+            }
+        })
+        .collect()
+}
+
+/// The archive of a modlist that best matches a file on disk
+///
+/// Prefers the same file name, then the same FileID, then the same mod name
+/// under the ModID, then any archive of the ModID.
+fn expected_archive_for<'a>(
+    mod_file: &ModFile,
+    modlist: &'a ModlistInfo,
+) -> Option<&'a ExpectedArchive> {
+    let same_mod = || {
+        modlist
+            .archives
+            .iter()
+            .filter(|a| a.mod_id == mod_file.mod_id)
+    };
+    let name_key = normalize_mod_name(&mod_file.mod_name).to_lowercase();
+    modlist
+        .archives
+        .iter()
+        .find(|a| a.file_name == mod_file.file_name)
+        .or_else(|| same_mod().find(|a| a.file_id.is_some() && a.file_id == mod_file.file_id))
+        .or_else(|| {
+            same_mod().find(|a| {
+                parse_mod_filename(&a.file_name)
+                    .is_some_and(|p| normalize_mod_name(&p.mod_name).to_lowercase() == name_key)
+            })
+        })
+        .or_else(|| same_mod().next())
+}
+
+/// Find orphaned patch/hotfix files with no main file for the same mod
+///
+/// A patch is useless without the file it patches. The old version scan never
+/// deletes groups mixing patches and main files, so these are reported as a
+/// separate, high-confidence category. Main files are looked up by ModID in
+/// the patch's own folder.
+fn find_orphaned_patches(mod_files: &[ModFile], orphaned_mods: &[OrphanedMod]) -> Vec<OrphanedMod> {
+    let mains: HashSet<(Option<&Path>, &str)> = mod_files
+        .iter()
+        .filter(|f| !f.is_patch && f.mod_id != "0")
+        .map(|f| (f.full_path.parent(), f.mod_id.as_str()))
+        .collect();
+
+    let patches: Vec<OrphanedMod> = orphaned_mods
+        .iter()
+        .filter(|o| o.file.is_patch && o.file.mod_id != "0")
+        .filter(|o| !mains.contains(&(o.file.full_path.parent(), o.file.mod_id.as_str())))
+        .cloned()
+        .collect();
+
+    if !patches.is_empty() {
+        log::info!(
+            "Found {} orphaned patches without a main file",
+            patches.len()
+        );
+    }
+
+    patches
+}
+
+/// Find archives that belong to a game with no game folder and no active modlist
+///
+/// An archive's game comes from its `.meta` file, or from the modlist that
+/// references it by name. Archives whose game can't be determined are not
+/// reported. Folder names and game identifiers are matched through `games`.
+/// Leftovers from an uninstalled game are high-confidence cleanup candidates
+/// that neither the orphan nor the old version scan singles out.
+pub fn detect_foreign_game_mods(
+    mod_files: &[ModFile],
+    game_folders: &[std::path::PathBuf],
+    active_modlists: &[ModlistInfo],
+    games: &[GameEntry],
+) -> Vec<ForeignGameMod> {
+    let mut known_games: HashSet<String> = game_folders
+        .iter()
+        .filter_map(|f| f.file_name())
+        .map(|n| game_key(games, &n.to_string_lossy()))
+        .collect();
+
+    let mut archive_games: HashMap<&str, &str> = HashMap::new();
+    for modlist in active_modlists {
+        for (file_name, game) in &modlist.archive_games {
+            known_games.insert(game_key(games, game));
+            archive_games.insert(file_name.as_str(), game.as_str());
+        }
+    }
+
+    let foreign: Vec<ForeignGameMod> = mod_files
+        .par_iter()
+        .filter_map(|mod_file| {
+            let game = read_meta_for(&mod_file.full_path)
+                .and_then(|meta| meta.game_name)
+                .or_else(|| {
+                    archive_games
+                        .get(mod_file.file_name.as_str())
+                        .map(|g| g.to_string())
+                })?;
+
+            if known_games.contains(&game_key(games, &game)) {
+                return None;
+            }
+
+            Some(ForeignGameMod {
+                file: mod_file.clone(),
+                game,
+            })
+        })
+        .collect();
+
+    if !foreign.is_empty() {
+        log::info!(
+            "Found {} archives for games without a folder or active modlist",
+            foreign.len()
+        );
+    }
+
+    foreign
+}
+
+/// Game folders that don't map to the game of any selected modlist
+///
+/// A modlist's games are the game it's built for plus the games of the
+/// archives it downloads. A folder whose name doesn't resolve to one of those
+/// may hold archives whose ModIDs collide with another game's, so it is
+/// treated as read-only when game-aware protection is enabled.
+pub fn read_only_folders(
+    game_folders: &[std::path::PathBuf],
+    active_modlists: &[ModlistInfo],
+    games: &[GameEntry],
+) -> Vec<std::path::PathBuf> {
+    let modlist_games: HashSet<String> = active_modlists
+        .iter()
+        .flat_map(|ml| ml.game.iter().chain(ml.archive_games.values()))
+        .map(|g| game_key(games, g))
+        .collect();
+
+    game_folders
+        .iter()
+        .filter(|folder| {
+            let name = folder
+                .file_name()
+                .map(|n| n.to_string_lossy().to_string())
+                .unwrap_or_default();
+            let mapped = modlist_games.contains(&game_key(games, &name));
+            if !mapped {
+                log::warn!(
+                    "Folder {} not mapped to a modlist game — treating as read-only.",
+                    name
+                );
+            }
+            !mapped
+        })
+        .cloned()
+        .collect()
+}
+
+/// Find mods whose files are spread over more than one game folder
+///
+/// The old version scan works one folder at a time, so versions split across
+/// folders are never compared. This usually means a download path was changed
+/// or misconfigured. Files are matched by ModID and normalized mod name, since
+/// ModIDs alone repeat across games.
+pub fn detect_fragmented_mods(mod_files: &[ModFile]) -> Vec<FragmentedMod> {
+    let mut by_mod: HashMap<(String, String), Vec<&ModFile>> = HashMap::new();
+    for mod_file in mod_files.iter().filter(|f| f.mod_id != "0") {
+        by_mod
+            .entry((
+                mod_file.mod_id.clone(),
+                normalize_mod_name(&mod_file.mod_name),
+            ))
+            .or_default()
+            .push(mod_file);
+    }
+
+    let mut fragmented: Vec<FragmentedMod> = by_mod
+        .into_values()
+        .filter_map(|files| {
+            let mut folders: Vec<std::path::PathBuf> = files
+                .iter()
+                .filter_map(|f| f.full_path.parent().map(|p| p.to_path_buf()))
+                .collect();
+            folders.sort();
+            folders.dedup();
+            if folders.len() <= 1 {
+                return None;
+            }
+
+            Some(FragmentedMod {
+                mod_id: files[0].mod_id.clone(),
+                mod_name: files[0].mod_name.clone(),
+                folders,
+                files: files.into_iter().cloned().collect(),
+            })
+        })
+        .collect();
+
+    fragmented.sort_by(|a, b| a.mod_name.cmp(&b.mod_name));
+
+    if !fragmented.is_empty() {
+        log::warn!(
+            "{} mods have files in more than one game folder",
+            fragmented.len()
+        );
+    }
+
+    fragmented
+}
+
+/// Find archives downloaded into more than one folder
+///
+/// Each folder's old version scan only sees its own files, so the same
+/// archive saved under two game folders is never reported. Copies share a
+/// ModID, a FileID (or the file name, without one) and the exact size. Copies
+/// whose `.meta` files name different games are left alone, since ModIDs
+/// repeat across Nexus game domains. The copy kept is one in the folder of
+/// the game its `.meta` names, or else the first by path.
+pub fn detect_cross_folder_duplicates(
+    mod_files: &[ModFile],
+    game_folders: &[std::path::PathBuf],
+    games: &[GameEntry],
+) -> Vec<CrossFolderDuplicate> {
+    // Group by ModID and size first, so only likely copies have their `.meta` read
+    let mut by_size: HashMap<(&str, u64), Vec<&ModFile>> = HashMap::new();
+    for mod_file in mod_files.iter().filter(|f| f.mod_id != "0" && f.size > 0) {
+        by_size
+            .entry((mod_file.mod_id.as_str(), mod_file.size))
+            .or_default()
+            .push(mod_file);
+    }
+
+    let mut by_file: HashMap<(&str, u64, Option<String>, String), Vec<&ModFile>> = HashMap::new();
+    for ((mod_id, size), files) in by_size.into_iter().filter(|(_, f)| f.len() > 1) {
+        let file_ids: Vec<Option<String>> = files.iter().map(|f| file_id_of(f)).collect();
+        for (i, mod_file) in files.iter().enumerate() {
+            // A copy without a FileID takes the one of a same-named copy
+            let file_id = file_ids[i].clone().or_else(|| {
+                files
+                    .iter()
+                    .zip(&file_ids)
+                    .find(|(f, id)| id.is_some() && f.file_name == mod_file.file_name)
+                    .and_then(|(_, id)| id.clone())
+            });
+            let name = match file_id {
+                Some(_) => String::new(),
+                None => mod_file.file_name.clone(),
+            };
+            by_file
+                .entry((mod_id, size, file_id, name))
+                .or_default()
+                .push(mod_file);
+        }
+    }
+
+    let folder_game = |path: &Path| {
+        game_folder_of(path, game_folders)
+            .and_then(|folder| folder.file_name())
+            .map(|name| game_key(games, &name.to_string_lossy()))
+    };
+
+    let mut duplicates: Vec<CrossFolderDuplicate> = by_file
+        .into_iter()
+        .filter(|(_, files)| files.len() > 1)
+        .filter_map(|((mod_id, size, file_id, _), files)| {
+            let meta_games: HashSet<String> = files
+                .iter()
+                .filter_map(|f| read_meta_for(&f.full_path).and_then(|meta| meta.game_name))
+                .map(|game| game_key(games, &game))
+                .collect();
+            if meta_games.len() > 1 {
+                log::info!(
+                    "Not treating copies of {} as duplicates: their .meta files name different games",
+                    files[0].file_name
+                );
+                return None;
+            }
+
+            let mut files: Vec<ModFile> = files.into_iter().cloned().collect();
+            files.sort_by(|a, b| a.full_path.cmp(&b.full_path));
+            if let Some(game) = meta_games.iter().next() {
+                let home = files
+                    .iter()
+                    .position(|f| folder_game(&f.full_path).as_ref() == Some(game));
+                if let Some(i) = home {
+                    let kept = files.remove(i);
+                    files.insert(0, kept);
+                }
+            }
+
+            Some(CrossFolderDuplicate {
+                mod_id: mod_id.to_string(),
+                file_id,
+                size,
+                reclaimable: size * (files.len() as u64 - 1),
+                files,
+            })
+        })
+        .collect();
+
+    duplicates.sort_by(|a, b| {
+        b.reclaimable
+            .cmp(&a.reclaimable)
+            .then_with(|| a.files[0].full_path.cmp(&b.files[0].full_path))
+    });
+
+    if !duplicates.is_empty() {
+        log::warn!(
+            "{} archives were downloaded into more than one folder",
+            duplicates.len()
+        );
+    }
+
+    duplicates
+}
+
+/// Check if files have conflicting descriptors (different content variants)
+fn has_conflicting_descriptors(filename1: &str, filename2: &str) -> bool {
+    let lower1 = filename1.to_lowercase();
+    let lower2 = filename2.to_lowercase();
+
+    let all_descriptors = [
+        // Texture quality
+        " 1k",
+        " 2k",
+        " 4k",
+        " 8k",
+        "-1k",
+        "-2k",
+        "-4k",
+        "-8k",
+        // Body types
+        "cbbe",
+        "uunp",
+        "bhunp",
+        "vanilla body",
+        "bodyslide",
+        // Mod components
+        " armor",
+        " weapon",
+        " clothes",
+        " clothing",
+        " hair",
+        " gloves",
+        " boots",
+        " helmet",
+        " meshes",
+        " textures",
+        "-armor",
+        "-weapon",
+        "-clothes",
+        "-hair",
+        "-gloves",
+        // File types
+        " esp ",
+        " esm ",
+        " esl ",
+        "esp-fe",
+        "esp only",
+        "esm only",
+        "loose files",
+        " bsa",
+        // Compatibility
+        " compat",
+        "compatibility",
+        " aslal",
+        "no worldspace",
+        "worldspace edit",
+        " performance",
+        // Edition types
+        " lite",
+        " light",
+        " full",
+        " extended",
+        " complete",
+        " basic",
+        " standard",
+        " deluxe",
+        // Clean variants
+        " clean",
+        " dirty",
+        " gross",
+        // Optional content
+        " optional",
+        " addon",
+        " add-on",
+        " expansion",
+    ];
+
+    let descriptors1: Vec<_> = all_descriptors
+        .iter()
+        .filter(|d| lower1.contains(*d))
         .collect();
     let descriptors2: Vec<_> = all_descriptors
         .iter()
@@ -361,107 +1484,278 @@ fn has_suspicious_version_pattern(group: &ModGroup) -> bool {
     false
 }
 
-/// Scan folder for old versions (duplicates)
-pub fn scan_folder_for_duplicates(folder_path: &Path) -> Result<OldVersionScanResult> {
-    log::info!("Scanning folder: {:?}", folder_path);
+/// Mod groups built from a folder listing, before duplicate filtering
+struct FolderGroups {
+    groups: HashMap<String, ModGroup>,
+    skipped: Vec<SkippedFile>,
+    /// Files that were listed but gone by the time their metadata was read
+    vanished: Vec<String>,
+}
 
-    let mut mod_groups: HashMap<String, ModGroup> = HashMap::new();
-    let mut skipped = 0;
+/// Key of the group a file belongs to under `strategy`
+///
+/// The default key is ModID + normalized ModName + part and option indicators.
+pub fn group_key(mod_file: &ModFile, strategy: GroupStrategy) -> String {
+    let name_key = || {
+        let normalized_name = normalize_mod_name(&mod_file.mod_name);
+        let part_indicator = name_part_indicator(mod_file).unwrap_or_default();
+        let option_indicator = extract_option_indicator(&mod_file.file_name).unwrap_or_default();
+        format!("{}{}{}", normalized_name, part_indicator, option_indicator)
+    };
 
-    let entries = fs::read_dir(folder_path)
-        .with_context(|| format!("Failed to read directory: {:?}", folder_path))?;
+    match strategy {
+        GroupStrategy::NameAware => format!("{}:{}", mod_file.mod_id, name_key()),
+        GroupStrategy::ModId => mod_file.mod_id.clone(),
+        GroupStrategy::ModIdFileId => match &mod_file.file_id {
+            Some(file_id) => format!("{}#{}", mod_file.mod_id, file_id),
+            None => format!("{}:{}", mod_file.mod_id, name_key()),
+        },
+        GroupStrategy::NameOnly => name_key(),
+    }
+}
 
-    for entry in entries {
-        let entry = entry?;
+/// Add a file to the group for its mod key under `strategy`
+fn add_to_group(
+    groups: &mut HashMap<String, ModGroup>,
+    mod_file: ModFile,
+    strategy: GroupStrategy,
+) {
+    let mod_key = group_key(&mod_file, strategy);
+    trace(&mod_file.file_name, "group", "grouped", &mod_key);
 
-        if entry.file_type()?.is_dir() {
-            continue;
-        }
+    groups
+        .entry(mod_key.clone())
+        .or_insert_with(|| ModGroup {
+            mod_key,
+            files: Vec::new(),
+            newest_idx: 0,
+            space_to_free: 0,
+        })
+        .files
+        .push(mod_file);
+}
+
+/// Parse listed files and group them by mod key
+///
+/// Wabbajack or the user may remove files while a scan is running. A file that
+/// no longer exists when its metadata is read is recorded as vanished and left
+/// out of every group, so no group ever holds a file without a known size.
+fn group_mod_files(
+    paths: &[std::path::PathBuf],
+    strategy: GroupStrategy,
+    parse: &ParseOptions,
+    cache: &StatCache,
+    progress: Option<&FileProgress>,
+) -> Result<FolderGroups> {
+    let mut mod_groups: HashMap<String, ModGroup> = HashMap::new();
+    let mut skipped = Vec::new();
+    let mut vanished = Vec::new();
 
-        let filename = entry.file_name().to_string_lossy().to_string();
+    for full_path in paths {
+        if let Some(progress) = progress {
+            progress.advance();
+        }
+        let filename = match full_path.file_name() {
+            Some(name) => name.to_string_lossy().to_string(),
+            None => continue,
+        };
 
-        if !is_wabbajack_file(&filename) {
-            skipped += 1;
+        // A .meta belongs to the archive next to it
+        if filename.to_lowercase().ends_with(".meta") {
+            continue;
+        }
+        if !parse.is_wabbajack_file(&filename) {
+            skipped.push(SkippedFile {
+                path: full_path.clone(),
+                reason: parse.skip_reason(&filename),
+            });
+            continue;
+        }
+        if parse.is_later_archive_part(&filename) {
             continue;
         }
 
-        let mut mod_file = match parse_mod_filename(&filename) {
-            Some(mf) => mf,
-            None => {
-                skipped += 1;
-                continue;
+        let mut mod_file = match parse.parse_mod_filename(&filename) {
+            Some(mf) => {
+                if trace_enabled() {
+                    trace(&filename, "parse", "nexus", &parse_detail(&mf));
+                }
+                mf
             }
+            None => match parse_from_meta(&filename, full_path, parse, cache) {
+                Some(mf) => mf,
+                None => {
+                    trace(&filename, "parse", "skipped", "no ModID in name or .meta");
+                    skipped.push(SkippedFile {
+                        path: full_path.clone(),
+                        reason: parse.skip_reason(&filename),
+                    });
+                    continue;
+                }
+            },
         };
 
         // Skip generic files that don't have a valid ModID/Timestamp parsed
         // We can't determine version history for these.
         if mod_file.mod_id == "0" || mod_file.timestamp == "0" {
-            skipped += 1;
+            trace(&filename, "parse", "skipped", "no ModID or timestamp");
+            let reason = if mod_file.mod_id == "0" {
+                SkipReason::NoModId
+            } else {
+                SkipReason::NoTimestamp
+            };
+            skipped.push(SkippedFile {
+                path: full_path.clone(),
+                reason,
+            });
             continue;
         }
 
-        let full_path = entry.path();
-        let metadata = fs::metadata(&full_path)?;
-        mod_file.full_path = full_path;
-        mod_file.size = metadata.len();
-
-        // Create mod key: ModID + normalized ModName + part indicator
-        let normalized_name = normalize_mod_name(&mod_file.mod_name);
-        let part_indicator = extract_part_indicator(&mod_file.file_name)
-            .or_else(|| extract_part_indicator(&mod_file.mod_name))
-            .unwrap_or_default();
-        let mod_key = format!("{}:{}{}", mod_file.mod_id, normalized_name, part_indicator);
+        let stat = match stat_archive(full_path, cache) {
+            Ok(stat) => stat,
+            Err(e) if e.kind() == std::io::ErrorKind::NotFound => {
+                log::warn!("File vanished during scan: {:?}", full_path);
+                trace(&filename, "parse", "vanished", "removed while scanning");
+                vanished.push(filename);
+                continue;
+            }
+            Err(e) => {
+                return Err(e).with_context(|| format!("Failed to read metadata: {:?}", full_path))
+            }
+        };
+        mod_file.full_path = full_path.clone();
+        mod_file.size = stat.size;
+        mod_file.modified = stat.modified;
 
-        mod_groups
-            .entry(mod_key.clone())
-            .or_insert_with(|| ModGroup {
-                mod_key,
-                files: Vec::new(),
-                newest_idx: 0,
-                space_to_free: 0,
-            })
-            .files
-            .push(mod_file);
+        add_to_group(&mut mod_groups, mod_file, strategy);
     }
 
-    if skipped > 0 {
-        log::info!("Skipped {} files in {:?}", skipped, folder_path);
-    }
+    Ok(FolderGroups {
+        groups: mod_groups,
+        skipped,
+        vanished,
+    })
+}
 
-    // Find duplicates and calculate space
-    let mut duplicates = Vec::new();
+/// Which old version safety checks a scan runs
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum SafetyChecks {
+    All,
+    /// All but the suspicious version heuristics, which compare descriptors,
+    /// sizes and upload times of same-version files
+    Aggressive,
+    /// Only the check that files can be ordered by timestamp
+    Off,
+}
 
-    for (_, mut group) in mod_groups {
+/// Keep the groups that have old versions safe to delete
+///
+/// Each returned group is sorted oldest first, keeps its `keep` newest files,
+/// and marks everything older for deletion; `policy` can then keep other
+/// files instead. Without `safety_checks`, only groups whose files can't be
+/// ordered by timestamp are skipped.
+fn select_old_versions(
+    groups: impl IntoIterator<Item = ModGroup>,
+    keep: usize,
+    policy: &KeepPolicy,
+    safety_checks: bool,
+) -> Vec<ModGroup> {
+    let checks = if safety_checks {
+        SafetyChecks::All
+    } else {
+        SafetyChecks::Off
+    };
+    select_old_versions_with(groups, keep, policy, checks).0
+}
+
+/// Keep the groups that have old versions safe to delete under `checks`
+///
+/// Also returns the keys of groups that only the suspicious version
+/// heuristics flag. With [`SafetyChecks::All`] they are left out; with
+/// [`SafetyChecks::Aggressive`] they are cleaned like any other group.
+fn select_old_versions_with(
+    groups: impl IntoIterator<Item = ModGroup>,
+    keep: usize,
+    policy: &KeepPolicy,
+    checks: SafetyChecks,
+) -> (Vec<ModGroup>, Vec<String>) {
+    let mut duplicates = Vec::new();
+    let mut heuristic_groups = Vec::new();
+
+    for mut group in groups.into_iter().flat_map(split_by_game) {
         if group.files.len() <= 1 {
             continue;
         }
 
-        // Check for unique timestamps
-        let unique_timestamps: std::collections::HashSet<_> =
-            group.files.iter().map(|f| &f.timestamp).collect();
+        // Files that can't be told apart by age can't be ordered safely
+        let distinct_times = match policy.newest_by {
+            NewestBy::Filename => group
+                .files
+                .iter()
+                .map(|f| &f.timestamp)
+                .collect::<HashSet<_>>()
+                .len(),
+            NewestBy::Mtime => group
+                .files
+                .iter()
+                .map(|f| f.modified)
+                .collect::<HashSet<_>>()
+                .len(),
+        };
+        if distinct_times <= 1 {
+            let reason = match policy.newest_by {
+                NewestBy::Filename => "all files have the same timestamp",
+                NewestBy::Mtime => "all files have the same modification time",
+            };
+            log::info!("Skipped group {}: {}", group.mod_key, reason);
+            trace_group(&group, "check", "skipped", reason);
+            continue;
+        }
+
+        // Sort by version, then age. Versions only lead when every file has
+        // one of the same scheme, so the order stays consistent.
+        let by_version = versions_comparable(&group.files);
+        group.files.sort_by(|a, b| {
+            let version_order = if by_version {
+                compare_versions(&a.version, &b.version).unwrap_or(std::cmp::Ordering::Equal)
+            } else {
+                std::cmp::Ordering::Equal
+            };
+            let age_order = match policy.newest_by {
+                NewestBy::Filename => a.timestamp.cmp(&b.timestamp),
+                NewestBy::Mtime => a.modified.cmp(&b.modified),
+            };
+            version_order
+                .then(age_order)
+                .then_with(|| a.version.cmp(&b.version))
+        });
 
-        if unique_timestamps.len() <= 1 {
-            log::info!(
-                "Skipped group {}: all files have same timestamp",
-                group.mod_key
-            );
+        // Set the index of the oldest kept file and calculate space to free
+        group.newest_idx = group.files.len().saturating_sub(keep.max(1));
+        if group.newest_idx == 0 {
             continue;
         }
+        group.space_to_free = group.files[..group.newest_idx].iter().map(|f| f.size).sum();
 
-        // Sort by timestamp, then version
-        group
-            .files
-            .sort_by(|a, b| match a.timestamp.cmp(&b.timestamp) {
-                std::cmp::Ordering::Equal => a.version.cmp(&b.version),
-                other => other,
-            });
+        if checks == SafetyChecks::Off {
+            trace_group(&group, "check", "bypassed", "safety checks are disabled");
+            apply_keep_policy(&mut group, policy);
+            trace_plan(&group);
+            duplicates.push(group);
+            continue;
+        }
 
-        // Check for suspicious patterns
-        if has_suspicious_version_pattern(&group) {
+        if has_ambiguous_file_ids(&group) {
             log::warn!(
-                "Skipped group {}: suspicious version pattern",
+                "Skipped group {}: ambiguous, files with different FileIDs don't have increasing versions",
                 group.mod_key
             );
+            trace_group(
+                &group,
+                "check",
+                "skipped",
+                "ambiguous: different FileIDs without a newer version",
+            );
             continue;
         }
 
@@ -477,15 +1771,25 @@ pub fn scan_folder_for_duplicates(folder_path: &Path) -> Result<OldVersionScanRe
                 "Skipped group {}: contains both PATCH and MAIN files",
                 group.mod_key
             );
+            trace_group(
+                &group,
+                "check",
+                "skipped",
+                "contains both patch and main files",
+            );
             continue;
         }
 
-        // Check if newest is a small patch
+        // Check if newest is a small patch for an older full release. Mods
+        // released only as patches have nothing to apply them to, so the
+        // newest patch supersedes the older ones as usual.
         let newest = group.files.last().unwrap();
         let mut skip_patch = false;
         if newest.is_patch && group.files.len() > 1 {
-            for i in 0..group.files.len() - 1 {
-                let old_file = &group.files[i];
+            for old_file in group.files[..group.files.len() - 1]
+                .iter()
+                .filter(|f| !f.is_patch)
+            {
                 let size_ratio = newest.size as f64 / old_file.size as f64;
                 if size_ratio < 0.1 {
                     log::warn!(
@@ -499,203 +1803,2986 @@ pub fn scan_folder_for_duplicates(folder_path: &Path) -> Result<OldVersionScanRe
         }
 
         if skip_patch {
+            trace_group(&group, "check", "skipped", "newest file is likely a patch");
             continue;
         }
 
-        // Set newest index and calculate space to free
-        group.newest_idx = group.files.len() - 1;
-        group.space_to_free = group.files[..group.newest_idx].iter().map(|f| f.size).sum();
-
+        // Checked last, so the groups it flags are exactly those only the
+        // heuristics keep
+        if has_suspicious_version_pattern(&group) {
+            heuristic_groups.push(group.mod_key.clone());
+            if checks == SafetyChecks::All {
+                log::warn!(
+                    "Skipped group {}: suspicious version pattern",
+                    group.mod_key
+                );
+                trace_group(&group, "check", "skipped", "suspicious version pattern");
+                continue;
+            }
+            trace_group(
+                &group,
+                "check",
+                "bypassed",
+                "suspicious version pattern, cleaned in aggressive mode",
+            );
+        } else {
+            trace_group(&group, "check", "passed", "all safety checks passed");
+        }
+        apply_keep_policy(&mut group, policy);
+        trace_plan(&group);
         duplicates.push(group);
     }
 
-    let total_files: usize = duplicates.iter().map(|g| g.files.len() - 1).sum();
-    let total_space: u64 = duplicates.iter().map(|g| g.space_to_free).sum();
+    // Groups freeing the most space first
+    duplicates.sort_by(|a, b| {
+        b.space_to_free
+            .cmp(&a.space_to_free)
+            .then_with(|| a.mod_key.cmp(&b.mod_key))
+    });
+    heuristic_groups.sort();
+    (duplicates, heuristic_groups)
+}
 
-    log::info!("Found {} mod groups with duplicates", duplicates.len());
+/// Split a group whose `.meta` files name different games
+///
+/// Skyrim LE and SE share mod names and sometimes ModIDs across their Nexus
+/// domains, and an archive of one can end up in the other's folder. Files of
+/// different games are never compared, even with the safety checks off.
+/// Once two games are seen, files without a known game form their own group.
+fn split_by_game(group: ModGroup) -> Vec<ModGroup> {
+    if group.files.len() <= 1 {
+        return vec![group];
+    }
 
-    Ok(OldVersionScanResult {
-        duplicates,
-        total_files,
-        total_space,
-    })
-}
+    let games = default_games();
+    let keys: Vec<Option<String>> = group
+        .files
+        .iter()
+        .map(|f| {
+            read_meta_for(&f.full_path)
+                .and_then(|meta| meta.game_name)
+                .map(|game| game_key(&games, &game))
+        })
+        .collect();
+    let known: HashSet<&String> = keys.iter().flatten().collect();
+    if known.len() <= 1 {
+        return vec![group];
+    }
 
-/// Calculate library statistics
-pub fn calculate_library_stats(game_folders: &[std::path::PathBuf]) -> LibraryStats {
-    let results: Vec<(String, usize, u64)> = game_folders
-        .par_iter()
-        .map(|folder| {
-            let entries = match fs::read_dir(folder) {
-                Ok(e) => e,
-                Err(_) => return ("Unknown".to_string(), 0, 0),
-            };
+    log::warn!(
+        "Split group {}: files belong to different games",
+        group.mod_key
+    );
+    trace_group(&group, "check", "split", "files belong to different games");
 
-            let mut game_files = 0;
-            let mut game_size = 0u64;
+    let mut clusters: std::collections::BTreeMap<String, Vec<ModFile>> =
+        std::collections::BTreeMap::new();
+    for (file, key) in group.files.into_iter().zip(keys) {
+        clusters
+            .entry(key.unwrap_or_else(|| "unknown".to_string()))
+            .or_default()
+            .push(file);
+    }
+    clusters
+        .into_iter()
+        .map(|(game, files)| ModGroup {
+            mod_key: format!("{}@{}", group.mod_key, game),
+            files,
+            newest_idx: 0,
+            space_to_free: 0,
+        })
+        .collect()
+}
 
-            for entry in entries {
-                let entry = match entry {
-                    Ok(e) => e,
-                    Err(_) => continue,
-                };
+/// Which files of each old version group are kept
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct KeepPolicy {
+    pub order: KeepOrder,
+    /// How files are ordered from oldest to newest, after their versions
+    pub newest_by: NewestBy,
+    /// FileIDs kept instead, whatever `order` says
+    pub pins: Pins,
+}
 
-                if entry.file_type().map(|t| t.is_dir()).unwrap_or(true) {
-                    continue;
-                }
+/// FileID of a file, from its name or its `.meta`
+fn file_id_of(file: &ModFile) -> Option<String> {
+    file.file_id
+        .clone()
+        .or_else(|| read_meta_for(&file.full_path).and_then(|meta| meta.file_id))
+}
 
-                let filename = entry.file_name().to_string_lossy().to_string();
-                if !is_wabbajack_file(&filename) {
-                    continue;
-                }
+/// Move the files `policy` keeps to the end of a group sorted oldest first
+///
+/// A pinned file is the only one kept. Otherwise keeping the oldest versions
+/// keeps as many files as keeping the newest would. The files left to
+/// delete stay in order, oldest first.
+fn apply_keep_policy(group: &mut ModGroup, policy: &KeepPolicy) {
+    let kept = group.files.len() - group.newest_idx;
+    let pin = group.files.iter().find_map(|f| {
+        let file_id = policy.pins.file_id_for(&f.mod_id)?;
+        Some((f.mod_id.clone(), file_id.to_string()))
+    });
 
-                if let Ok(metadata) = entry.metadata() {
-                    game_files += 1;
-                    game_size += metadata.len();
+    if let Some((mod_id, file_id)) = pin {
+        let pinned = group
+            .files
+            .iter()
+            .position(|f| f.mod_id == mod_id && file_id_of(f).as_deref() == Some(&file_id));
+        match pinned {
+            Some(idx) => {
+                let file = group.files.remove(idx);
+                if idx != group.files.len() || kept > 1 {
+                    log::info!(
+                        "Group {}: keeping pinned {} instead of the newest version",
+                        group.mod_key,
+                        file.file_name
+                    );
                 }
+                group.files.push(file);
+                group.newest_idx = group.files.len() - 1;
+                group.space_to_free = group.files[..group.newest_idx].iter().map(|f| f.size).sum();
+                return;
             }
+            None => log::warn!(
+                "Group {}: pinned FileID {} of ModID {} isn't on disk, keeping the {} version(s)",
+                group.mod_key,
+                file_id,
+                mod_id,
+                policy.order.label().to_lowercase()
+            ),
+        }
+    }
 
-            let game_name = folder
-                .file_name()
-                .map(|n| n.to_string_lossy().to_string())
-                .unwrap_or_else(|| "Unknown".to_string());
+    if policy.order == KeepOrder::Oldest {
+        group.files.rotate_left(kept);
+        group.space_to_free = group.files[..group.newest_idx].iter().map(|f| f.size).sum();
+    }
+}
+
+/// Record which files of an accepted group are kept and which are deleted
+fn trace_plan(group: &ModGroup) {
+    if !trace_enabled() {
+        return;
+    }
+    for (i, file) in group.files.iter().enumerate() {
+        if i < group.newest_idx {
+            trace(
+                &file.file_name,
+                "plan",
+                "delete",
+                "not among the kept versions",
+            );
+        } else {
+            trace(&file.file_name, "plan", "keep", "among the kept versions");
+        }
+    }
+}
+
+/// Options for the old version scan
+#[derive(Debug, Clone, Default)]
+pub struct DuplicateScanOptions {
+    /// Treat files of one mod with incompatible version schemes as separate mods
+    pub split_version_schemes: bool,
+    /// Expert mode: skip the patch, variant and suspicious version checks and
+    /// delete everything but the newest kept files of each group by timestamp
+    pub unsafe_delete_all_old: bool,
+    /// Skip only the suspicious version heuristics, such as conflicting
+    /// descriptors; the other safety checks still run
+    pub aggressive: bool,
+    /// How files are grouped into versions of one mod
+    pub group_strategy: GroupStrategy,
+    /// Newest files kept in each group; 0 keeps one like 1 does
+    pub keep_versions: usize,
+    /// Keep the oldest files or pinned FileIDs instead of the newest
+    pub keep_policy: KeepPolicy,
+    /// Levels of subfolders scanned with each folder; their files are grouped
+    /// with the folder's own
+    pub subfolder_depth: usize,
+    /// Which files are archives, from the config
+    pub parse: ParseOptions,
+}
+
+/// Version numbering family of a file, used to avoid comparing unrelated files
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, PartialOrd, Ord)]
+enum VersionScheme {
+    /// Date based, e.g. "2024-05" or "20240512"
+    Calendar,
+    /// Regular version numbers, e.g. "1-2-3"
+    Sequential,
+}
+
+impl VersionScheme {
+    fn of(version: &str) -> Self {
+        let first = version.split(['-', '.']).next().unwrap_or_default();
+        let is_year =
+            |s: &str| s.len() == 4 && s.parse::<u32>().is_ok_and(|y| (1990..=2100).contains(&y));
 
-            (game_name, game_files, game_size)
+        if is_year(first) || (first.len() == 8 && is_numeric(first) && is_year(&first[..4])) {
+            VersionScheme::Calendar
+        } else {
+            VersionScheme::Sequential
+        }
+    }
+
+    fn label(self) -> &'static str {
+        match self {
+            VersionScheme::Calendar => "calendar",
+            VersionScheme::Sequential => "sequential",
+        }
+    }
+}
+
+/// Check if a sorted group holds distinct Nexus files rather than versions of one
+///
+/// Every upload gets a new FileID, so different FileIDs alone don't mean
+/// different files. But when the later file's version isn't newer, both may
+/// be separate downloads a modlist needs, like a main file and its addon.
+fn has_ambiguous_file_ids(group: &ModGroup) -> bool {
+    group.files.iter().enumerate().any(|(i, older)| {
+        group.files[i + 1..].iter().any(|newer| {
+            let distinct = matches!(
+                (&older.file_id, &newer.file_id),
+                (Some(a), Some(b)) if a != b
+            );
+            distinct
+                && compare_versions(&older.version, &newer.version)
+                    != Some(std::cmp::Ordering::Less)
         })
-        .collect();
+    })
+}
 
-    let mut stats = LibraryStats::default();
-    for (name, files, size) in results {
-        if files > 0 {
-            stats.by_game.push((name, files, size));
-            stats.total_files += files;
-            stats.total_size += size;
+/// Check that every file has a version comparable with the others
+fn versions_comparable(files: &[ModFile]) -> bool {
+    let Some(first) = files.first() else {
+        return false;
+    };
+    let scheme = VersionScheme::of(&first.version);
+    files.iter().all(|f| {
+        VersionScheme::of(&f.version) == scheme
+            && compare_versions(&f.version, &first.version).is_some()
+    })
+}
+
+/// Split groups that mix version schemes into one group per scheme
+///
+/// Some Nexus pages host unrelated tools under one ModID, e.g. a "1.2.3"
+/// plugin next to a "2024.05" data pack. Comparing those would delete the
+/// wrong file. Returns the resulting groups and the keys of split groups.
+fn split_by_version_scheme(
+    groups: impl IntoIterator<Item = ModGroup>,
+) -> (Vec<ModGroup>, Vec<String>) {
+    let mut result = Vec::new();
+    let mut split_keys = Vec::new();
+
+    for group in groups {
+        let mut clusters: std::collections::BTreeMap<VersionScheme, Vec<ModFile>> =
+            std::collections::BTreeMap::new();
+        for file in &group.files {
+            clusters
+                .entry(VersionScheme::of(&file.version))
+                .or_default()
+                .push(file.clone());
+        }
+
+        if clusters.len() <= 1 {
+            result.push(group);
+            continue;
+        }
+
+        log::warn!(
+            "Split group {}: files use incompatible version schemes",
+            group.mod_key
+        );
+        for (scheme, files) in clusters {
+            result.push(ModGroup {
+                mod_key: format!("{}#{}", group.mod_key, scheme.label()),
+                files,
+                newest_idx: 0,
+                space_to_free: 0,
+            });
         }
+        split_keys.push(group.mod_key);
     }
 
-    // Sort by game name for consistent display
-    stats.by_game.sort_by(|a, b| a.0.cmp(&b.0));
+    (result, split_keys)
+}
 
-    stats
+/// Scan folder for old versions (duplicates)
+pub fn scan_folder_for_duplicates(folder_path: &Path) -> Result<OldVersionScanResult> {
+    scan_folder_for_duplicates_with(folder_path, &DuplicateScanOptions::default())
 }
 
-#[cfg(test)]
-mod tests {
-    use super::*;
-    use std::fs::File;
-    use std::io::Write;
-    use tempfile::tempdir;
+/// Scan folder for old versions with non-default options
+pub fn scan_folder_for_duplicates_with(
+    folder_path: &Path,
+    options: &DuplicateScanOptions,
+) -> Result<OldVersionScanResult> {
+    let cache = StatCache::with_subfolders(options.subfolder_depth, &[]);
+    scan_folder_for_duplicates_cached(folder_path, options, &cache)
+}
 
-    #[test]
-    fn test_detect_orphaned_mods() {
-        let mod_files = vec![
-            ModFile {
-                file_name: "mod1.7z".to_string(),
-                full_path: std::path::PathBuf::new(),
-                mod_name: "Mod1".to_string(),
-                mod_id: "123".to_string(),
-                file_id: Some("456".to_string()),
-                version: "1.0".to_string(),
-                timestamp: "1234567890".to_string(),
-                size: 1000,
-                is_patch: false,
-            },
-            ModFile {
-                file_name: "mod2.7z".to_string(),
-                full_path: std::path::PathBuf::new(),
-                mod_name: "Mod2".to_string(),
-                mod_id: "123".to_string(),
-                file_id: Some("789".to_string()),
-                version: "2.0".to_string(),
-                timestamp: "1234567891".to_string(),
-                size: 2000,
-                is_patch: false,
-            },
-            ModFile {
-                file_name: "mod3.7z".to_string(),
-                full_path: std::path::PathBuf::new(),
-                mod_name: "Mod3".to_string(),
-                mod_id: "999".to_string(),
-                file_id: None,
-                version: "1.0".to_string(),
-                timestamp: "1234567892".to_string(),
-                size: 3000,
-                is_patch: false,
-            },
-            ModFile {
-                file_name: "mod4.7z".to_string(),
-                full_path: std::path::PathBuf::new(),
-                mod_name: "Mod4".to_string(),
-                mod_id: "888".to_string(),
-                file_id: Some("111".to_string()),
-                version: "1.0".to_string(),
-                timestamp: "1234567893".to_string(),
-                size: 4000,
-                is_patch: false,
-            },
-        ];
+/// Scan folder for old versions, reading file stats through `cache`
+pub fn scan_folder_for_duplicates_cached(
+    folder_path: &Path,
+    options: &DuplicateScanOptions,
+    cache: &StatCache,
+) -> Result<OldVersionScanResult> {
+    log::info!("Scanning folder: {:?}", folder_path);
 
-        let mut used_mod_keys = std::collections::HashSet::new();
-        used_mod_keys.insert("123".to_string());
-        used_mod_keys.insert("999".to_string());
+    let paths = cache.list_folder(folder_path)?;
+    scan_listed_folder(folder_path, &paths, options, cache, None)
+}
 
-        let mut used_mod_file_ids = std::collections::HashSet::new();
-        used_mod_file_ids.insert("123-456".to_string());
+/// Find old versions among a folder's files
+fn scan_listed_folder(
+    folder_path: &Path,
+    paths: &[std::path::PathBuf],
+    options: &DuplicateScanOptions,
+    cache: &StatCache,
+    progress: Option<&FileProgress>,
+) -> Result<OldVersionScanResult> {
+    let FolderGroups {
+        groups: mod_groups,
+        skipped,
+        vanished,
+    } = group_mod_files(
+        paths,
+        options.group_strategy,
+        &options.parse,
+        cache,
+        progress,
+    )?;
 
-        // File names that are "used"
-        let mut used_file_names = std::collections::HashSet::new();
-        used_file_names.insert("mod1.7z".to_string());
-        used_file_names.insert("mod2.7z".to_string());
-        used_file_names.insert("mod3.7z".to_string());
+    if !skipped.is_empty() {
+        log::info!("Skipped {} files in {:?}", skipped.len(), folder_path);
+    }
+    if !vanished.is_empty() {
+        log::warn!(
+            "{} files vanished during scan of {:?}",
+            vanished.len(),
+            folder_path
+        );
+    }
 
-        let modlist = ModlistInfo {
-            file_path: std::path::PathBuf::new(),
-            name: "Test Modlist".to_string(),
-            mod_count: 3,
-            used_mod_keys,
-            used_mod_file_ids,
-            used_file_names,
-        };
+    let (groups, split_groups) = if options.split_version_schemes {
+        split_by_version_scheme(mod_groups.into_values())
+    } else {
+        (mod_groups.into_values().collect(), Vec::new())
+    };
+    let checks = if options.unsafe_delete_all_old {
+        SafetyChecks::Off
+    } else if options.aggressive {
+        SafetyChecks::Aggressive
+    } else {
+        SafetyChecks::All
+    };
+    let (duplicates, heuristic_groups) =
+        select_old_versions_with(groups, options.keep_versions, &options.keep_policy, checks);
 
-        let result = detect_orphaned_mods(&mod_files, &[modlist]);
+    log::info!("Found {} mod groups with duplicates", duplicates.len());
 
-        // mod1, mod2 (both have ModID 123), and mod3 (ModID 999) should be used
-        // mod4 (ModID 888) should be orphaned
-        assert_eq!(result.orphaned_mods.len(), 1);
-        assert_eq!(result.used_mods.len(), 3);
-        assert_eq!(result.orphaned_mods[0].file.file_name, "mod4.7z");
+    let mut result = OldVersionScanResult {
+        duplicates,
+        vanished_files: vanished,
+        split_groups,
+        skipped_files: skipped,
+        heuristic_groups,
+        ..Default::default()
+    };
+    result.update_totals();
+    Ok(result)
+}
+
+/// Scan several game folders for old versions in parallel
+///
+/// Each folder is scanned on rayon's thread pool, which is bounded by the
+/// number of CPUs. Results are sorted by folder so output doesn't depend on
+/// which scan finishes first.
+pub fn scan_folders_for_duplicates(
+    folders: &[std::path::PathBuf],
+    options: &DuplicateScanOptions,
+) -> Vec<(std::path::PathBuf, Result<OldVersionScanResult>)> {
+    scan_folders_for_duplicates_with_progress(folders, options, &|_, _| {})
+}
+
+/// Scan several game folders for old versions, reporting each file scanned
+///
+/// `progress` receives the files scanned so far and the total of all folders.
+pub fn scan_folders_for_duplicates_with_progress(
+    folders: &[std::path::PathBuf],
+    options: &DuplicateScanOptions,
+    progress: &(dyn Fn(usize, usize) + Sync),
+) -> Vec<(std::path::PathBuf, Result<OldVersionScanResult>)> {
+    let cache = StatCache::with_subfolders(options.subfolder_depth, folders);
+    let listed = list_folders(folders, &cache);
+    let progress = FileProgress::new(&listed, progress);
+
+    let mut results: Vec<_> = listed
+        .into_par_iter()
+        .map(|(folder, paths)| {
+            log::info!("Scanning folder: {:?}", folder);
+            let result = paths.and_then(|paths| {
+                scan_listed_folder(&folder, &paths, options, &cache, Some(&progress))
+            });
+            (folder, result)
+        })
+        .collect();
+    results.sort_by(|a, b| a.0.cmp(&b.0));
+    results
+}
+
+/// Build a single deletion plan covering orphaned mods and old versions
+///
+/// Every game folder is read once. Archives no selected modlist uses are
+/// dropped entirely; the remaining archives are grouped per folder and
+/// trimmed to their newest `keep_versions` files.
+pub fn build_cleanup_plan(
+    game_folders: &[std::path::PathBuf],
+    active_modlists: &[ModlistInfo],
+    keep_versions: usize,
+) -> Result<CleanupPlan> {
+    let mod_files = get_all_mod_files(game_folders)?;
+    Ok(plan_cleanup(
+        &mod_files,
+        game_folders,
+        active_modlists,
+        &default_games(),
+        GroupStrategy::default(),
+        keep_versions,
+        &KeepPolicy::default(),
+    ))
+}
+
+/// Build a cleanup plan from files already collected from `game_folders`
+///
+/// Old versions are grouped by `strategy`, as the old version scan groups them.
+pub fn plan_cleanup(
+    mod_files: &[ModFile],
+    game_folders: &[std::path::PathBuf],
+    active_modlists: &[ModlistInfo],
+    games: &[GameEntry],
+    strategy: GroupStrategy,
+    keep_versions: usize,
+    policy: &KeepPolicy,
+) -> CleanupPlan {
+    let scan = detect_orphaned_mods_by_game(mod_files, active_modlists, game_folders, games);
+
+    let mut old_versions = Vec::new();
+    for folder in game_folders {
+        let mut groups = HashMap::new();
+        for mod_file in &scan.used_mods {
+            if game_folder_of(&mod_file.full_path, game_folders) != Some(folder) {
+                continue;
+            }
+            // Generic archives have no version history
+            if mod_file.mod_id == "0" || mod_file.timestamp == "0" {
+                continue;
+            }
+            add_to_group(&mut groups, mod_file.clone(), strategy);
+        }
+        old_versions.extend(select_old_versions(
+            groups.into_values(),
+            keep_versions,
+            policy,
+            true,
+        ));
     }
 
-    #[test]
-    fn test_find_wabbajack_files() {
-        let dir = tempdir().unwrap();
+    let old_version_files = old_versions.iter().map(|g| g.newest_idx).sum();
+    let old_version_size = old_versions.iter().map(|g| g.space_to_free).sum();
 
-        // Create test files
-        File::create(dir.path().join("modlist1.wabbajack")).unwrap();
-        File::create(dir.path().join("modlist2.wabbajack")).unwrap();
-        File::create(dir.path().join("readme.txt")).unwrap();
+    log::info!(
+        "Cleanup plan: {} orphaned, {} old versions (keeping {} per mod)",
+        scan.orphaned_mods.len(),
+        old_version_files,
+        keep_versions
+    );
 
-        let files = find_wabbajack_files(dir.path()).unwrap();
-        assert_eq!(files.len(), 2);
+    CleanupPlan {
+        orphaned_mods: scan.orphaned_mods,
+        old_versions,
+        keep_versions,
+        orphaned_size: scan.orphaned_size,
+        old_version_files,
+        old_version_size,
+        target: None,
     }
+}
 
-    #[test]
-    fn test_get_all_mod_files() {
-        let dir = tempdir().unwrap();
-        let game_dir = dir.path().join("Skyrim");
-        fs::create_dir(&game_dir).unwrap();
+/// Trim a cleanup plan to the files needed to free `target` bytes
+///
+/// Orphaned archives are taken first, largest first, then old versions
+/// oldest first. Returns `false` when the whole plan frees less than the
+/// target; the plan is then kept whole so the maximum is reclaimed.
+pub fn trim_plan_to_target(plan: &mut CleanupPlan, target: u64) -> bool {
+    plan.target = Some(target);
+    if plan.total_size() < target {
+        return false;
+    }
 
-        // Create valid mod files
-        let mut file1 = File::create(game_dir.join("SkyUI-12345-5-0-1234567890.7z")).unwrap();
-        file1.write_all(b"test content").unwrap();
+    let mut freed = 0;
+    plan.orphaned_mods
+        .sort_by(|a, b| b.file.size.cmp(&a.file.size));
+    let mut orphans = 0;
+    for m in &plan.orphaned_mods {
+        if freed >= target {
+            break;
+        }
+        freed += m.file.size;
+        orphans += 1;
+    }
+    plan.orphaned_mods.truncate(orphans);
 
-        let mut file2 = File::create(game_dir.join("SKSE-54321-1-0-9876543210.zip")).unwrap();
-        file2.write_all(b"test content 2").unwrap();
+    // Files within a group are sorted oldest first, so taking the oldest
+    // files across all groups only ever deletes a prefix of each group
+    let mut candidates: Vec<(u64, usize, usize)> = plan
+        .old_versions
+        .iter()
+        .enumerate()
+        .flat_map(|(g, group)| {
+            group.files[..group.newest_idx]
+                .iter()
+                .enumerate()
+                .map(move |(i, f)| (f.timestamp.parse().unwrap_or(0), g, i))
+        })
+        .collect();
+    candidates.sort();
 
-        // Create invalid file
-        File::create(game_dir.join("readme.txt")).unwrap();
+    let mut taken = vec![0; plan.old_versions.len()];
+    for (_, g, i) in candidates {
+        if freed >= target {
+            break;
+        }
+        if i < taken[g] {
+            continue;
+        }
+        let files = &plan.old_versions[g].files;
+        freed += files[taken[g]..=i].iter().map(|f| f.size).sum::<u64>();
+        taken[g] = i + 1;
+    }
 
-        let files = get_all_mod_files(&[game_dir]).unwrap();
-        assert_eq!(files.len(), 2);
+    for (group, count) in plan.old_versions.iter_mut().zip(taken) {
+        group.newest_idx = count;
+        group.space_to_free = group.files[..count].iter().map(|f| f.size).sum();
+    }
+    plan.old_versions.retain(|g| g.newest_idx > 0);
+
+    plan.orphaned_size = plan.orphaned_mods.iter().map(|m| m.file.size).sum();
+    plan.old_version_files = plan.old_versions.iter().map(|g| g.newest_idx).sum();
+    plan.old_version_size = plan.old_versions.iter().map(|g| g.space_to_free).sum();
+    true
+}
+
+/// Find byte-identical files saved under different names
+///
+/// Version grouping misses a re-download saved with a new timestamp, or a
+/// file renamed by hand. Files are grouped by size first and only sizes
+/// shared by several files are hashed, through `cache`. Multi-part archives
+/// are left out, since a first part says nothing about the others. The copy
+/// kept is the one with the newest timestamp in its name.
+pub fn detect_identical_files(mod_files: &[ModFile], cache: &HashCache) -> Vec<IdenticalFiles> {
+    let mut by_size: HashMap<u64, Vec<&ModFile>> = HashMap::new();
+    for mod_file in mod_files
+        .iter()
+        .filter(|f| f.size > 0 && split_archive_part(&f.file_name).is_none())
+    {
+        by_size.entry(mod_file.size).or_default().push(mod_file);
+    }
+    let candidates: Vec<&ModFile> = by_size
+        .into_values()
+        .filter(|files| files.len() > 1)
+        .flatten()
+        .collect();
+
+    let hashed: Vec<(String, &ModFile)> = candidates
+        .par_iter()
+        .filter_map(|mod_file| match cache.hash(mod_file) {
+            Ok(hash) => Some((hash, *mod_file)),
+            Err(e) => {
+                log::warn!("Failed to hash {:?}: {}", mod_file.full_path, e);
+                None
+            }
+        })
+        .collect();
+
+    let mut by_hash: HashMap<(u64, String), Vec<&ModFile>> = HashMap::new();
+    for (hash, mod_file) in hashed {
+        by_hash
+            .entry((mod_file.size, hash))
+            .or_default()
+            .push(mod_file);
+    }
+
+    let mut identical: Vec<IdenticalFiles> = by_hash
+        .into_iter()
+        .filter(|(_, files)| files.len() > 1)
+        .map(|((size, hash), files)| {
+            let mut files: Vec<ModFile> = files.into_iter().cloned().collect();
+            files.sort_by(|a, b| {
+                let timestamp = |f: &ModFile| f.timestamp.parse::<u64>().unwrap_or(0);
+                timestamp(b)
+                    .cmp(&timestamp(a))
+                    .then_with(|| b.modified.cmp(&a.modified))
+                    .then_with(|| a.full_path.cmp(&b.full_path))
+            });
+            IdenticalFiles {
+                hash,
+                size,
+                reclaimable: size * (files.len() as u64 - 1),
+                files,
+            }
+        })
+        .collect();
+
+    identical.sort_by(|a, b| {
+        b.reclaimable
+            .cmp(&a.reclaimable)
+            .then_with(|| a.files[0].full_path.cmp(&b.files[0].full_path))
+    });
+    identical
+}
+
+/// Find used archives that were downloaded more than once
+///
+/// Wabbajack records a content hash for every archive in a modlist. When two
+/// modlists reference the same content under different file names, both
+/// copies count as used and neither is ever orphaned. Files are matched by
+/// those hashes, so nothing needs to be read from disk. Only a report is
+/// built; which copy to remove is left to the user.
+pub fn detect_identical_archives(
+    used_mods: &[ModFile],
+    active_modlists: &[ModlistInfo],
+) -> Vec<IdenticalArchives> {
+    let mut hashes: HashMap<&str, &str> = HashMap::new();
+    for modlist in active_modlists {
+        for (file_name, hash) in &modlist.archive_hashes {
+            hashes.insert(file_name.as_str(), hash.as_str());
+        }
+    }
+
+    let mut by_hash: HashMap<&str, Vec<&ModFile>> = HashMap::new();
+    for mod_file in used_mods {
+        if let Some(hash) = hashes.get(mod_file.file_name.as_str()) {
+            by_hash.entry(hash).or_default().push(mod_file);
+        }
+    }
+
+    let mut identical: Vec<IdenticalArchives> = by_hash
+        .into_iter()
+        .filter_map(|(hash, files)| {
+            let mut files: Vec<ModFile> = files.into_iter().cloned().collect();
+            files.sort_by(|a, b| a.full_path.cmp(&b.full_path));
+            files.dedup_by(|a, b| a.full_path == b.full_path);
+            if files.len() <= 1 {
+                return None;
+            }
+
+            let reclaimable = files[1..].iter().map(|f| f.size).sum();
+            Some(IdenticalArchives {
+                hash: hash.to_string(),
+                files,
+                reclaimable,
+            })
+        })
+        .collect();
+
+    identical.sort_by(|a, b| b.reclaimable.cmp(&a.reclaimable));
+    identical
+}
+
+/// Audit the whole library against the content hashes of the modlists
+///
+/// Each archive is identified by the hash Wabbajack wrote to its `.meta`
+/// rather than by its file name. Archives without a hash fall back to the
+/// hash the modlists record for their file name; the rest can't be judged
+/// and are listed separately. Needed hashes no archive provides are
+/// reported as missing.
+pub fn audit_library(mod_files: &[ModFile], active_modlists: &[ModlistInfo]) -> LibraryAudit {
+    // hash -> (file name, size, modlists needing it)
+    let mut needed: HashMap<&str, (&str, u64, Vec<String>)> = HashMap::new();
+    let mut hash_by_name: HashMap<&str, &str> = HashMap::new();
+    for modlist in active_modlists {
+        for (file_name, hash) in &modlist.archive_hashes {
+            let size = modlist.archive_sizes.get(file_name).copied().unwrap_or(0);
+            let entry = needed
+                .entry(hash.as_str())
+                .or_insert_with(|| (file_name.as_str(), size, Vec::new()));
+            if !entry.2.contains(&modlist.name) {
+                entry.2.push(modlist.name.clone());
+            }
+            hash_by_name.insert(file_name.as_str(), hash.as_str());
+        }
+    }
+
+    let hashes: Vec<Option<String>> = mod_files
+        .par_iter()
+        .map(|f| {
+            read_meta_for(&f.full_path)
+                .and_then(|meta| meta.hash)
+                .or_else(|| {
+                    hash_by_name
+                        .get(f.file_name.as_str())
+                        .map(|h| h.to_string())
+                })
+        })
+        .collect();
+
+    let mut audit = LibraryAudit {
+        needed: needed.len(),
+        ..Default::default()
+    };
+    let mut found: HashSet<&str> = HashSet::new();
+    for (file, hash) in mod_files.iter().zip(&hashes) {
+        match hash {
+            Some(hash) if needed.contains_key(hash.as_str()) => {
+                found.insert(hash.as_str());
+                audit.kept_size += file.size;
+                audit.kept.push(file.clone());
+            }
+            Some(_) => {
+                audit.orphaned_size += file.size;
+                audit.orphaned.push(file.clone());
+            }
+            None => audit.unhashed.push(file.clone()),
+        }
+    }
+
+    audit.missing = needed
+        .into_iter()
+        .filter(|(hash, _)| !found.contains(hash))
+        .map(|(hash, (file_name, size, mut modlists))| {
+            modlists.sort();
+            MissingArchive {
+                hash: hash.to_string(),
+                file_name: file_name.to_string(),
+                size,
+                modlists,
+            }
+        })
+        .collect();
+    audit.missing.sort_by(|a, b| a.file_name.cmp(&b.file_name));
+    audit.missing_size = audit.missing.iter().map(|m| m.size).sum();
+    audit
+}
+
+/// Compare the Nexus archives a modlist expects with the versions on disk
+///
+/// Files on disk belong to an expected archive when they share its ModID and
+/// mod name. An expected archive with no such file is reported with an empty
+/// `on_disk` list.
+pub fn report_version_drift(modlist: &ModlistInfo, on_disk: &[ModFile]) -> Vec<VersionDrift> {
+    let mut report: Vec<VersionDrift> = modlist
+        .archives
+        .iter()
+        .map(|expected| {
+            let parsed = parse_mod_filename(&expected.file_name);
+            let name_key = parsed
+                .as_ref()
+                .map(|p| normalize_mod_name(&p.mod_name).to_lowercase());
+
+            let files = on_disk
+                .iter()
+                .filter(|f| f.mod_id == expected.mod_id)
+                .filter(|f| match &name_key {
+                    Some(key) => normalize_mod_name(&f.mod_name).to_lowercase() == *key,
+                    None => true,
+                })
+                .map(|f| (f.clone(), compare_to_expected(f, expected, parsed.as_ref())))
+                .collect();
+
+            VersionDrift {
+                expected: expected.clone(),
+                mod_name: parsed
+                    .map(|p| p.mod_name)
+                    .unwrap_or_else(|| expected.file_name.clone()),
+                on_disk: files,
+            }
+        })
+        .collect();
+
+    report.sort_by(|a, b| a.mod_name.to_lowercase().cmp(&b.mod_name.to_lowercase()));
+    report
+}
+
+/// Mods of a modlist that are on disk only in files other than the one it expects
+///
+/// The orphan scan counts these as used by ModID, yet installing the
+/// modlist would fail until the expected FileID is downloaded again. Mods
+/// with nothing on disk are left to the library audit.
+pub fn audit_modlist_versions(modlist: &ModlistInfo, files: &[ModFile]) -> Vec<VersionMismatch> {
+    report_version_drift(modlist, files)
+        .into_iter()
+        .filter(|drift| {
+            !drift.on_disk.is_empty()
+                && drift
+                    .on_disk
+                    .iter()
+                    .all(|(_, kind)| *kind != VersionDriftKind::Matching)
+        })
+        .map(|drift| VersionMismatch {
+            modlist: modlist.name.clone(),
+            mod_name: drift.mod_name,
+            expected: drift.expected,
+            on_disk: drift.on_disk.into_iter().map(|(file, _)| file).collect(),
+        })
+        .collect()
+}
+
+/// Compare a file on disk with an expected archive
+///
+/// FileIDs increase with every upload on Nexus, so they are compared first;
+/// versions and then download timestamps are the fallbacks.
+fn compare_to_expected(
+    file: &ModFile,
+    expected: &ExpectedArchive,
+    expected_parsed: Option<&ModFile>,
+) -> VersionDriftKind {
+    use std::cmp::Ordering;
+
+    if file.file_name == expected.file_name {
+        return VersionDriftKind::Matching;
+    }
+
+    let numeric = |s: &str| s.parse::<u64>().ok();
+    let file_ids = file
+        .file_id
+        .as_deref()
+        .and_then(numeric)
+        .zip(expected.file_id.as_deref().and_then(numeric));
+    let ordering = if let Some((on_disk, wanted)) = file_ids {
+        Some(on_disk.cmp(&wanted))
+    } else if expected
+        .version
+        .as_deref()
+        .is_some_and(|v| v.replace('.', "-") == file.version)
+    {
+        Some(Ordering::Equal)
+    } else {
+        expected_parsed
+            .and_then(|p| numeric(&p.timestamp))
+            .zip(numeric(&file.timestamp))
+            .map(|(wanted, on_disk)| on_disk.cmp(&wanted))
+    };
+
+    match ordering {
+        Some(Ordering::Equal) => VersionDriftKind::Matching,
+        Some(Ordering::Less) => VersionDriftKind::Older,
+        Some(Ordering::Greater) => VersionDriftKind::Newer,
+        None => VersionDriftKind::Unknown,
+    }
+}
+
+/// Estimate the space a combined clean keeping one version per mod would free
+///
+/// Returns `(old_version_bytes, orphan_bytes)`. Orphaned archives only add to
+/// a running total, and old versions reuse the grouping and safety rules of
+/// the old version scan without building a report.
+pub fn estimate_reclaimable(
+    game_folders: &[std::path::PathBuf],
+    active_modlists: &[ModlistInfo],
+) -> Result<(u64, u64)> {
+    estimate_reclaimable_cached(
+        game_folders,
+        active_modlists,
+        &default_games(),
+        GroupStrategy::default(),
+        1,
+        &KeepPolicy::default(),
+        &ParseOptions::default(),
+        &StatCache::new(),
+    )
+}
+
+/// Estimate reclaimable space, grouping by `strategy`, keeping `keep`
+/// versions per mod as `policy` picks them, reading names as `parse` says
+/// and file stats through `cache`
+#[allow(clippy::too_many_arguments)]
+pub fn estimate_reclaimable_cached(
+    game_folders: &[std::path::PathBuf],
+    active_modlists: &[ModlistInfo],
+    games: &[GameEntry],
+    strategy: GroupStrategy,
+    keep: usize,
+    policy: &KeepPolicy,
+    parse: &ParseOptions,
+    cache: &StatCache,
+) -> Result<(u64, u64)> {
+    let refs = ModlistRefs::new(active_modlists, games);
+
+    let mut old_version_bytes = 0;
+    let mut orphan_bytes = 0;
+
+    for folder in game_folders {
+        let mut groups = HashMap::new();
+        let game = folder
+            .file_name()
+            .map(|name| name.to_string_lossy())
+            .filter(|name| resolve_game(games, name).is_some())
+            .map(|name| game_key(games, &name));
+
+        for path in cache.list_folder(folder)? {
+            let filename = match path.file_name() {
+                Some(name) => name.to_string_lossy().to_string(),
+                None => continue,
+            };
+            if !parse.is_wabbajack_file(&filename) || parse.is_later_archive_part(&filename) {
+                continue;
+            }
+            let Ok(stat) = stat_archive(&path, cache) else {
+                continue;
+            };
+
+            let parsed = parse.parse_mod_filename(&filename);
+            let is_used = refs.file_names.contains(filename.as_str())
+                || parsed
+                    .as_ref()
+                    .is_some_and(|m| refs.precise_kind(m, game.as_deref()).is_some())
+                || refs.fallback_kind(&filename, &path).is_some();
+            if !is_used {
+                orphan_bytes += stat.size;
+                continue;
+            }
+
+            let Some(mut mod_file) = parsed else {
+                continue;
+            };
+            if mod_file.mod_id == "0" || mod_file.timestamp == "0" {
+                continue;
+            }
+            mod_file.full_path = path;
+            mod_file.size = stat.size;
+            mod_file.modified = stat.modified;
+            add_to_group(&mut groups, mod_file, strategy);
+        }
+
+        old_version_bytes += select_old_versions(groups.into_values(), keep, policy, true)
+            .iter()
+            .map(|g| g.space_to_free)
+            .sum::<u64>();
+    }
+
+    Ok((old_version_bytes, orphan_bytes))
+}
+
+/// Calculate library statistics
+///
+/// Each game folder also gets a quick estimate of the space its old versions
+/// take, from file names alone, and its largest archive.
+///
+/// When `include_uncompressed` is set, zip archives are opened to sum their
+/// uncompressed entry sizes. This reads every zip's central directory, so it
+/// is noticeably slower on large libraries.
+pub fn calculate_library_stats(
+    game_folders: &[std::path::PathBuf],
+    include_uncompressed: bool,
+) -> LibraryStats {
+    calculate_library_stats_cached(
+        game_folders,
+        include_uncompressed,
+        GroupStrategy::default(),
+        1,
+        &KeepPolicy::default(),
+        &ParseOptions::default(),
+        &StatCache::new(),
+    )
+}
+
+/// Calculate library statistics, grouping old versions by `strategy`,
+/// keeping `keep` versions per mod as `policy` picks them, reading names as
+/// `parse` says and file stats through `cache`
+pub fn calculate_library_stats_cached(
+    game_folders: &[std::path::PathBuf],
+    include_uncompressed: bool,
+    strategy: GroupStrategy,
+    keep: usize,
+    policy: &KeepPolicy,
+    parse: &ParseOptions,
+    cache: &StatCache,
+) -> LibraryStats {
+    let results: Vec<(GameStats, u64)> = game_folders
+        .par_iter()
+        .map(|folder| {
+            let mut game = GameStats {
+                game: folder
+                    .file_name()
+                    .map(|n| n.to_string_lossy().to_string())
+                    .unwrap_or_else(|| "Unknown".to_string()),
+                ..Default::default()
+            };
+            let Ok(paths) = cache.list_folder(folder) else {
+                return (game, 0);
+            };
+
+            let mut game_uncompressed = 0u64;
+            let mut groups = HashMap::new();
+
+            for path in paths {
+                let Some(filename) = path.file_name().map(|n| n.to_string_lossy().to_string())
+                else {
+                    continue;
+                };
+                if !parse.is_wabbajack_file(&filename) {
+                    continue;
+                }
+
+                if let Ok(stat) = cache.stat(&path) {
+                    game.files += 1;
+                    game.size += stat.size;
+
+                    if include_uncompressed {
+                        game_uncompressed +=
+                            uncompressed_size_of(&path, &filename).unwrap_or(stat.size);
+                    }
+                }
+
+                if parse.is_later_archive_part(&filename) {
+                    continue;
+                }
+                let Ok(stat) = stat_archive(&path, cache) else {
+                    continue;
+                };
+                if game
+                    .largest
+                    .as_ref()
+                    .is_none_or(|(_, size)| stat.size > *size)
+                {
+                    game.largest = Some((filename.clone(), stat.size));
+                }
+                let Some(mut mod_file) = parse.parse_mod_filename(&filename) else {
+                    continue;
+                };
+                if mod_file.mod_id == "0" || mod_file.timestamp == "0" {
+                    continue;
+                }
+                mod_file.full_path = path;
+                mod_file.size = stat.size;
+                mod_file.modified = stat.modified;
+                add_to_group(&mut groups, mod_file, strategy);
+            }
+
+            game.old_version_bytes = select_old_versions(groups.into_values(), keep, policy, true)
+                .iter()
+                .map(|g| g.space_to_free)
+                .sum();
+
+            (game, game_uncompressed)
+        })
+        .collect();
+
+    let mut stats = LibraryStats::default();
+    let mut uncompressed_total = 0u64;
+    for (game, uncompressed) in results {
+        if game.files > 0 {
+            stats.total_files += game.files;
+            stats.total_size += game.size;
+            uncompressed_total += uncompressed;
+            stats.by_game.push(game);
+        }
+    }
+
+    if include_uncompressed {
+        stats.uncompressed_size = Some(uncompressed_total);
+    }
+
+    // Largest folders first, so it's clear where the space goes
+    stats
+        .by_game
+        .sort_by(|a, b| b.size.cmp(&a.size).then_with(|| a.game.cmp(&b.game)));
+
+    stats
+}
+
+/// Uncompressed size of a zip archive, or None for other formats and unreadable zips
+fn uncompressed_size_of(path: &Path, filename: &str) -> Option<u64> {
+    if !filename.to_lowercase().ends_with(".zip") {
+        return None;
+    }
+
+    match zip_uncompressed_size(path) {
+        Ok(size) => Some(size),
+        Err(e) => {
+            log::warn!("Could not read uncompressed size of {:?}: {}", path, e);
+            None
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs::File;
+    use std::io::Write;
+    use tempfile::tempdir;
+
+    #[test]
+    fn test_detect_orphaned_mods() {
+        let mod_files = vec![
+            ModFile {
+                file_name: "mod1.7z".to_string(),
+                full_path: std::path::PathBuf::new(),
+                mod_name: "Mod1".to_string(),
+                mod_id: "123".to_string(),
+                file_id: Some("456".to_string()),
+                version: "1.0".to_string(),
+                timestamp: "1234567890".to_string(),
+                size: 1000,
+                is_patch: false,
+                modified: None,
+            },
+            ModFile {
+                file_name: "mod2.7z".to_string(),
+                full_path: std::path::PathBuf::new(),
+                mod_name: "Mod2".to_string(),
+                mod_id: "123".to_string(),
+                file_id: Some("789".to_string()),
+                version: "2.0".to_string(),
+                timestamp: "1234567891".to_string(),
+                size: 2000,
+                is_patch: false,
+                modified: None,
+            },
+            ModFile {
+                file_name: "mod3.7z".to_string(),
+                full_path: std::path::PathBuf::new(),
+                mod_name: "Mod3".to_string(),
+                mod_id: "999".to_string(),
+                file_id: None,
+                version: "1.0".to_string(),
+                timestamp: "1234567892".to_string(),
+                size: 3000,
+                is_patch: false,
+                modified: None,
+            },
+            ModFile {
+                file_name: "mod4.7z".to_string(),
+                full_path: std::path::PathBuf::new(),
+                mod_name: "Mod4".to_string(),
+                mod_id: "888".to_string(),
+                file_id: Some("111".to_string()),
+                version: "1.0".to_string(),
+                timestamp: "1234567893".to_string(),
+                size: 4000,
+                is_patch: false,
+                modified: None,
+            },
+        ];
+
+        let mut used_mod_keys = std::collections::HashSet::new();
+        used_mod_keys.insert("123".to_string());
+        used_mod_keys.insert("999".to_string());
+
+        let mut used_mod_file_ids = std::collections::HashSet::new();
+        used_mod_file_ids.insert("123-456".to_string());
+
+        // File names that are "used"
+        let mut used_file_names = std::collections::HashSet::new();
+        used_file_names.insert("mod1.7z".to_string());
+        used_file_names.insert("mod2.7z".to_string());
+        used_file_names.insert("mod3.7z".to_string());
+
+        let modlist = ModlistInfo {
+            file_path: std::path::PathBuf::new(),
+            name: "Test Modlist".to_string(),
+            game: None,
+            mod_count: 3,
+            used_mod_keys,
+            used_mod_file_ids,
+            used_file_names,
+            archive_games: HashMap::new(),
+            ..Default::default()
+        };
+
+        let result = detect_orphaned_mods(&mod_files, &[modlist]);
+
+        // mod1, mod2 (both have ModID 123), and mod3 (ModID 999) should be used
+        // mod4 (ModID 888) should be orphaned
+        assert_eq!(result.orphaned_mods.len(), 1);
+        assert_eq!(result.used_mods.len(), 3);
+        assert_eq!(result.orphaned_mods[0].file.file_name, "mod4.7z");
+    }
+
+    #[test]
+    fn test_detect_orphaned_mods_by_file_id() {
+        let file = |name: &str, mod_id: &str, file_id: Option<&str>| ModFile {
+            file_id: file_id.map(str::to_string),
+            mod_id: mod_id.to_string(),
+            file_name: name.to_string(),
+            full_path: std::path::PathBuf::from(name),
+            ..strategy_file("Test-123-1-0-1234567890.7z")
+        };
+        let mod_files = vec![
+            // Renamed copy of the listed FileID
+            file("renamed.7z", "123", Some("456")),
+            // Another file of a mod whose FileIDs are listed
+            file("other.7z", "123", Some("789")),
+            // A mod listed without FileIDs falls back to its ModID
+            file("bare.7z", "555", Some("1")),
+            file("unknown.7z", "888", None),
+        ];
+        let modlist = ModlistInfo {
+            name: "Test Modlist".to_string(),
+            used_mod_keys: ["123".to_string(), "555".to_string()].into(),
+            used_mod_file_ids: ["123-456".to_string()].into(),
+            ..Default::default()
+        };
+
+        let result = detect_orphaned_mods(&mod_files, std::slice::from_ref(&modlist));
+        let used: Vec<&str> = result
+            .used_mods
+            .iter()
+            .map(|m| m.file_name.as_str())
+            .collect();
+        assert_eq!(used, vec!["renamed.7z", "bare.7z"]);
+        let orphaned: Vec<&str> = result
+            .orphaned_mods
+            .iter()
+            .map(|m| m.file.file_name.as_str())
+            .collect();
+        assert_eq!(orphaned, vec!["other.7z", "unknown.7z"]);
+        assert_eq!(
+            result.keep_reasons[&std::path::PathBuf::from("renamed.7z")][0].kind,
+            MatchKind::FileId
+        );
+    }
+
+    #[test]
+    fn test_detect_orphaned_mods_from_other_sources() {
+        let dir = tempdir().unwrap();
+        let file = |name: &str| {
+            let path = dir.path().join(name);
+            File::create(&path).unwrap();
+            ModFile {
+                file_name: name.to_string(),
+                full_path: path,
+                mod_name: name.to_string(),
+                mod_id: "0".to_string(),
+                file_id: None,
+                version: "0.0".to_string(),
+                timestamp: "0".to_string(),
+                size: 0,
+                is_patch: false,
+                modified: None,
+            }
+        };
+        // Saved by a browser under another name, but Wabbajack hashed it
+        let hashed = file("download (1).7z");
+        fs::write(
+            crate::core::meta::meta_path_for(&hashed.full_path),
+            "hash=bXlIYXNo
+",
+        )
+        .unwrap();
+        let mod_files = vec![hashed, file("mega_texture_pack.7z"), file("unrelated.7z")];
+        let modlist = ModlistInfo {
+            name: "Test Modlist".to_string(),
+            used_file_names: [
+                "ENB Presets.7z".to_string(),
+                "Mega Texture Pack.7z".to_string(),
+            ]
+            .into(),
+            archive_hashes: [("ENB Presets.7z".to_string(), "bXlIYXNo".to_string())].into(),
+            ..Default::default()
+        };
+
+        let result = detect_orphaned_mods(&mod_files, std::slice::from_ref(&modlist));
+        let orphaned: Vec<&str> = result
+            .orphaned_mods
+            .iter()
+            .map(|m| m.file.file_name.as_str())
+            .collect();
+        assert_eq!(orphaned, vec!["unrelated.7z"]);
+        assert_eq!(
+            result.keep_reasons[&mod_files[0].full_path][0].kind,
+            MatchKind::Hash
+        );
+        assert_eq!(
+            result.keep_reasons[&mod_files[1].full_path][0].kind,
+            MatchKind::SimilarName
+        );
+    }
+
+    #[test]
+    fn test_match_orphans_by_hash() {
+        let dir = tempdir().unwrap();
+        let path = dir.path().join("renamed.7z");
+        fs::write(&path, b"abc").unwrap();
+        let renamed = ModFile {
+            file_name: "renamed.7z".to_string(),
+            full_path: path,
+            mod_name: "renamed".to_string(),
+            mod_id: "0".to_string(),
+            file_id: None,
+            version: "0.0".to_string(),
+            timestamp: "0".to_string(),
+            size: 3,
+            is_patch: false,
+            modified: None,
+        };
+        let modlist = ModlistInfo {
+            name: "Test Modlist".to_string(),
+            archive_hashes: [(
+                "Original Name.7z".to_string(),
+                crate::core::hash::encode_hash(0x44BC_2CF5_AD77_0999),
+            )]
+            .into(),
+            ..Default::default()
+        };
+        let modlists = std::slice::from_ref(&modlist);
+
+        let mut result = detect_orphaned_mods(std::slice::from_ref(&renamed), modlists);
+        assert_eq!(result.orphaned_mods.len(), 1);
+
+        let cache = HashCache::default();
+        assert_eq!(match_orphans_by_hash(&mut result, modlists, &cache), 1);
+        assert!(result.orphaned_mods.is_empty());
+        assert_eq!(result.orphaned_size, 0);
+        assert_eq!(result.used_mods.len(), 1);
+        assert_eq!(
+            result.keep_reasons[&renamed.full_path][0].kind,
+            MatchKind::Hash
+        );
+    }
+
+    fn strategy_file(file_name: &str) -> ModFile {
+        parse_mod_filename(file_name).unwrap()
+    }
+
+    #[test]
+    fn test_group_key_name_aware() {
+        let strategy = GroupStrategy::NameAware;
+        let main = strategy_file("SkyUI-12604-5-1SE-1600000000.7z");
+        let update = strategy_file("SkyUI-12604-5-2SE-1700000000.7z");
+        let other = strategy_file("SkyUI Patch-12604-1-0-1700000000.7z");
+        assert_eq!(group_key(&main, strategy), group_key(&update, strategy));
+        assert_ne!(group_key(&main, strategy), group_key(&other, strategy));
+        assert_eq!(
+            group_key(&main, strategy),
+            format!("12604:{}", normalize_mod_name("SkyUI"))
+        );
+
+        // A version's "-2-" is not a part number
+        let v1 = strategy_file("Cool Mod-12345-1-0-1600000000.7z");
+        let v2 = strategy_file("Cool Mod-12345-2-0-1700000000.7z");
+        assert_eq!(group_key(&v1, strategy), group_key(&v2, strategy));
+    }
+
+    #[test]
+    fn test_group_key_mod_id() {
+        let strategy = GroupStrategy::ModId;
+        let main = strategy_file("SkyUI-12604-5-1SE-1600000000.7z");
+        let other = strategy_file("SkyUI Patch-12604-1-0-1700000000.7z");
+        let unrelated = strategy_file("SkyUI-99999-5-1SE-1600000000.7z");
+        assert_eq!(group_key(&main, strategy), "12604");
+        assert_eq!(group_key(&main, strategy), group_key(&other, strategy));
+        assert_ne!(group_key(&main, strategy), group_key(&unrelated, strategy));
+    }
+
+    #[test]
+    fn test_group_key_mod_id_file_id() {
+        let strategy = GroupStrategy::ModIdFileId;
+        let mut first = strategy_file("SkyUI-12604-5-1SE-1600000000.7z");
+        let mut again = strategy_file("SkyUI Renamed-12604-5-1SE-1700000000.7z");
+        let mut other = strategy_file("SkyUI-12604-5-2SE-1700000000.7z");
+        first.file_id = Some("35407".to_string());
+        again.file_id = Some("35407".to_string());
+        other.file_id = Some("41000".to_string());
+        assert_eq!(group_key(&first, strategy), "12604#35407");
+        assert_eq!(group_key(&first, strategy), group_key(&again, strategy));
+        assert_ne!(group_key(&first, strategy), group_key(&other, strategy));
+
+        // Without a FileID the name-aware key is used
+        let plain = strategy_file("SkyUI-12604-5-1SE-1600000000.7z");
+        assert_eq!(
+            group_key(&plain, strategy),
+            group_key(&plain, GroupStrategy::NameAware)
+        );
+    }
+
+    #[test]
+    fn test_group_key_name_only() {
+        let strategy = GroupStrategy::NameOnly;
+        let nexus = strategy_file("SkyUI-12604-5-1SE-1600000000.7z");
+        let mirror = strategy_file("SkyUI-99999-5-2SE-1700000000.7z");
+        let part = strategy_file("SkyUI Part 2-12604-5-1SE-1600000000.7z");
+        assert_eq!(group_key(&nexus, strategy), group_key(&mirror, strategy));
+        assert_ne!(group_key(&nexus, strategy), group_key(&part, strategy));
+    }
+
+    #[test]
+    fn test_group_strategy_in_scan() {
+        let dir = tempdir().unwrap();
+        for name in [
+            "SkyUI-12604-5-1SE-1600000000.7z",
+            "SkyUI Patch-12604-1-0-1700000000.7z",
+        ] {
+            fs::write(dir.path().join(name), vec![0u8; 1000]).unwrap();
+        }
+
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert!(result.duplicates.is_empty());
+
+        let options = DuplicateScanOptions {
+            group_strategy: GroupStrategy::ModId,
+            ..Default::default()
+        };
+        let result = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        assert_eq!(result.duplicates.len(), 1);
+        assert_eq!(result.duplicates[0].mod_key, "12604");
+    }
+
+    #[test]
+    fn test_newest_by_modified_time() {
+        let dir = tempdir().unwrap();
+        let names = ["Mod-1234-1-0-1600000000.7z", "Mod-1234-1-0-1700000000.7z"];
+        let archive = |name: &str, modified: u64| {
+            let file = File::create(dir.path().join(name)).unwrap();
+            file.set_len(1000).unwrap();
+            file.set_modified(std::time::UNIX_EPOCH + std::time::Duration::from_secs(modified))
+                .unwrap();
+        };
+        // The name with the older timestamp was modified last
+        archive(names[0], 1_750_000_000);
+        archive(names[1], 1_650_000_000);
+
+        let by_name = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert_eq!(by_name.duplicates[0].files[0].file_name, names[0]);
+
+        let options = DuplicateScanOptions {
+            keep_policy: KeepPolicy {
+                newest_by: NewestBy::Mtime,
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        let by_mtime = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        assert_eq!(by_mtime.duplicates[0].files[0].file_name, names[1]);
+        assert_eq!(by_mtime.duplicates[0].files[1].file_name, names[0]);
+
+        // Files modified at the same moment can't be ordered
+        archive(names[1], 1_750_000_000);
+        let same = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        assert!(same.duplicates.is_empty());
+    }
+
+    #[test]
+    fn test_scan_recovers_ids_from_meta() {
+        let dir = tempdir().unwrap();
+        let archive = |name: &str, version: &str, modified: u64| {
+            let path = dir.path().join(name);
+            let file = File::create(&path).unwrap();
+            file.set_len(1000).unwrap();
+            file.set_modified(std::time::UNIX_EPOCH + std::time::Duration::from_secs(modified))
+                .unwrap();
+            fs::write(
+                crate::core::meta::meta_path_for(&path),
+                format!("[General]\r\nmodID=\"12604\"\r\nversion={}\r\n", version),
+            )
+            .unwrap();
+        };
+        archive("SkyUI SE 5.1.7z", "5.1", 1_600_000_000);
+        archive("SkyUI SE 5.2.7z", "5.2", 1_700_000_000);
+
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert_eq!(result.duplicates.len(), 1);
+        let group = &result.duplicates[0];
+        assert_eq!(group.files[0].file_name, "SkyUI SE 5.1.7z");
+        assert_eq!(group.files[1].file_name, "SkyUI SE 5.2.7z");
+        assert_eq!(group.files[1].timestamp, "1700000000");
+
+        let files = get_all_mod_files(&[dir.path().to_path_buf()]).unwrap();
+        assert!(files.iter().all(|f| f.mod_id == "12604"));
+    }
+
+    #[test]
+    fn test_scan_reports_progress() {
+        let dir = tempdir().unwrap();
+        for name in [
+            "SkyUI-12604-5-0-1500000000.7z",
+            "SkyUI-12604-5-2-1700000000.7z",
+            "readme.txt",
+        ] {
+            File::create(dir.path().join(name)).unwrap();
+        }
+        let folders = vec![dir.path().to_path_buf(), dir.path().join("missing")];
+
+        let reports = Mutex::new(Vec::new());
+        let record = |done: usize, total: usize| {
+            reports.lock().unwrap().push((done, total));
+        };
+        let files = get_all_mod_files_with_progress(&folders, &ParseOptions::default(), 0, &record)
+            .unwrap();
+        assert_eq!(files.len(), 2);
+        let mut seen = std::mem::take(&mut *reports.lock().unwrap());
+        seen.sort();
+        assert_eq!(seen, vec![(1, 3), (2, 3), (3, 3)]);
+
+        let results = scan_folders_for_duplicates_with_progress(
+            &folders,
+            &DuplicateScanOptions::default(),
+            &record,
+        );
+        assert_eq!(results[0].1.as_ref().unwrap().duplicates.len(), 1);
+        assert!(results[1].1.is_err());
+        assert_eq!(reports.lock().unwrap().last(), Some(&(3, 3)));
+    }
+
+    #[test]
+    fn test_multi_part_archive_is_one_file() {
+        let dir = tempdir().unwrap();
+        for (name, len) in [
+            ("BigMod-123-1-0-1600000000.7z.001", 1000),
+            ("BigMod-123-1-0-1600000000.7z.002", 500),
+            ("BigMod-123-1-1-1700000000.7z", 1200),
+        ] {
+            File::create(dir.path().join(name))
+                .unwrap()
+                .set_len(len)
+                .unwrap();
+        }
+
+        let files = get_all_mod_files(&[dir.path().to_path_buf()]).unwrap();
+        assert_eq!(files.len(), 2);
+        let split = files
+            .iter()
+            .find(|f| f.file_name.ends_with(".001"))
+            .unwrap();
+        assert_eq!(split.size, 1500);
+
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert_eq!(result.duplicates.len(), 1);
+        let group = &result.duplicates[0];
+        assert_eq!(group.files[0].file_name, "BigMod-123-1-0-1600000000.7z.001");
+        assert_eq!(group.space_to_free, 1500);
+    }
+
+    #[test]
+    fn test_newest_version_wins_over_newer_upload() {
+        let dir = tempdir().unwrap();
+        // 1.2 was republished after 1.5 was pulled
+        for name in ["Mod-1234-1-5-1600000000.7z", "Mod-1234-1-2-1700000000.7z"] {
+            fs::write(dir.path().join(name), vec![0u8; 1000]).unwrap();
+        }
+
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert_eq!(result.duplicates.len(), 1);
+        let group = &result.duplicates[0];
+        assert_eq!(group.files[0].file_name, "Mod-1234-1-2-1700000000.7z");
+        assert_eq!(group.files[1].file_name, "Mod-1234-1-5-1600000000.7z");
+
+        // Without a comparable version on every file, timestamps decide
+        fs::write(
+            dir.path().join("Mod-1234-final-1800000000.7z"),
+            vec![0u8; 1000],
+        )
+        .unwrap();
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        let names: Vec<&str> = result.duplicates[0]
+            .files
+            .iter()
+            .map(|f| f.file_name.as_str())
+            .collect();
+        assert_eq!(
+            names,
+            vec![
+                "Mod-1234-1-5-1600000000.7z",
+                "Mod-1234-1-2-1700000000.7z",
+                "Mod-1234-final-1800000000.7z"
+            ]
+        );
+    }
+
+    #[test]
+    fn test_keep_newest_versions() {
+        let dir = tempdir().unwrap();
+        for name in [
+            "SkyUI-12604-5-0-1500000000.7z",
+            "SkyUI-12604-5-1-1600000000.7z",
+            "SkyUI-12604-5-2-1700000000.7z",
+        ] {
+            fs::write(dir.path().join(name), vec![0u8; 1000]).unwrap();
+        }
+
+        let options = DuplicateScanOptions {
+            keep_versions: 2,
+            ..Default::default()
+        };
+        let result = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        let group = &result.duplicates[0];
+        assert_eq!(group.newest_idx, 1);
+        assert_eq!(group.space_to_free, 1000);
+        assert_eq!(group.files[0].file_name, "SkyUI-12604-5-0-1500000000.7z");
+        assert_eq!(result.total_files, 1);
+
+        // Nothing to delete when every file is kept
+        let options = DuplicateScanOptions {
+            keep_versions: 3,
+            ..Default::default()
+        };
+        let result = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        assert!(result.duplicates.is_empty());
+    }
+
+    #[test]
+    fn test_keep_oldest_and_pinned_versions() {
+        let dir = tempdir().unwrap();
+        let names = [
+            "SkyUI-12604-5-0-1500000000.7z",
+            "SkyUI-12604-5-1-1600000000.7z",
+            "SkyUI-12604-5-2-1700000000.7z",
+        ];
+        for (name, size) in names.iter().zip([1000, 2000, 3000]) {
+            fs::write(dir.path().join(name), vec![0u8; size]).unwrap();
+        }
+        fs::write(
+            dir.path().join(format!("{}.meta", names[1])),
+            "[General]\nfileID=35407\n",
+        )
+        .unwrap();
+
+        let options = DuplicateScanOptions {
+            keep_policy: KeepPolicy {
+                order: KeepOrder::Oldest,
+                pins: Pins::default(),
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        let result = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        let group = &result.duplicates[0];
+        let order: Vec<&str> = group.files.iter().map(|f| f.file_name.as_str()).collect();
+        assert_eq!(order, vec![names[1], names[2], names[0]]);
+        assert_eq!(group.newest_idx, 2);
+        assert_eq!(group.space_to_free, 5000);
+
+        // A pin keeps its file whichever order is chosen
+        let options = DuplicateScanOptions {
+            keep_versions: 2,
+            keep_policy: KeepPolicy {
+                order: KeepOrder::Oldest,
+                pins: Pins::parse("12604 = 35407"),
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        let result = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        let group = &result.duplicates[0];
+        let order: Vec<&str> = group.files.iter().map(|f| f.file_name.as_str()).collect();
+        assert_eq!(order, vec![names[0], names[2], names[1]]);
+        assert_eq!(group.newest_idx, 2);
+        assert_eq!(group.space_to_free, 4000);
+
+        // A pinned FileID that isn't on disk falls back to the order
+        let options = DuplicateScanOptions {
+            keep_policy: KeepPolicy {
+                order: KeepOrder::Newest,
+                pins: Pins::parse("12604 = 99999"),
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        let result = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        assert_eq!(result.duplicates[0].files[2].file_name, names[2]);
+        assert_eq!(result.total_files, 2);
+    }
+
+    #[test]
+    fn test_looks_like_wabbajack_install() {
+        let dir = tempdir().unwrap();
+        fs::create_dir(dir.path().join("Skyrim Special Edition")).unwrap();
+        assert!(!looks_like_wabbajack_install(dir.path()));
+
+        fs::write(dir.path().join("Wabbajack.exe"), "").unwrap();
+        assert!(looks_like_wabbajack_install(dir.path()));
+
+        let install = dir.path().join("Skyrim Special Edition");
+        fs::create_dir(install.join("downloaded_mod_lists")).unwrap();
+        assert!(looks_like_wabbajack_install(&install));
+    }
+
+    #[test]
+    fn test_detect_identical_files() {
+        let dir = tempdir().unwrap();
+        let folder = dir.path().join("Skyrim Special Edition");
+        fs::create_dir_all(&folder).unwrap();
+        // A re-download under a new timestamp, and a copy renamed by hand
+        let names = [
+            "SkyUI-12604-5-2SE-1600000000.7z",
+            "SkyUI-12604-5-2SE-1700000000.7z",
+            "skyui backup.7z",
+        ];
+        for name in names {
+            fs::write(folder.join(name), b"same bytes").unwrap();
+        }
+        // Same size, different contents
+        fs::write(folder.join("Other-999-1-0-1600000000.7z"), b"other byte").unwrap();
+
+        let files = get_all_mod_files(std::slice::from_ref(&folder)).unwrap();
+        let identical = detect_identical_files(&files, &HashCache::default());
+        assert_eq!(identical.len(), 1);
+        let set = &identical[0];
+        assert_eq!(set.files.len(), 3);
+        assert_eq!(set.files[0].file_name, names[1]);
+        assert_eq!(set.reclaimable, 20);
+
+        let group = set.to_group();
+        assert_eq!(group.newest_idx, 2);
+        assert_eq!(group.files[2].file_name, names[1]);
+    }
+
+    #[test]
+    fn test_detect_cross_folder_duplicates() {
+        let dir = tempdir().unwrap();
+        let folders: Vec<std::path::PathBuf> = ["Fallout 4", "Skyrim Special Edition"]
+            .iter()
+            .map(|name| dir.path().join(name))
+            .collect();
+        for folder in &folders {
+            fs::create_dir_all(folder).unwrap();
+        }
+        let skyui = "SkyUI-12604-5-2SE-1600000000.7z";
+        for folder in &folders {
+            fs::write(folder.join(skyui), vec![0u8; 1000]).unwrap();
+        }
+        fs::write(
+            folders[1].join(format!("{}.meta", skyui)),
+            "[General]\ngameName=SkyrimSE\nfileID=35407\n",
+        )
+        .unwrap();
+        // Same size, different mod
+        fs::write(
+            folders[1].join("Other-999-1-0-1600000000.7z"),
+            vec![0u8; 1000],
+        )
+        .unwrap();
+        // Copies whose .meta files name different games are not duplicates
+        let shared = "Shared-555-1-0-1600000000.7z";
+        for (folder, game) in folders.iter().zip(["Fallout4", "SkyrimSE"]) {
+            fs::write(folder.join(shared), vec![0u8; 500]).unwrap();
+            fs::write(
+                folder.join(format!("{}.meta", shared)),
+                format!("[General]\ngameName={}\n", game),
+            )
+            .unwrap();
+        }
+
+        let files = get_all_mod_files(&folders).unwrap();
+        let duplicates = detect_cross_folder_duplicates(&files, &folders, &default_games());
+        assert_eq!(duplicates.len(), 1);
+        let dup = &duplicates[0];
+        assert_eq!(dup.mod_id, "12604");
+        assert_eq!(dup.files.len(), 2);
+        assert_eq!(dup.reclaimable, 1000);
+        // The copy in the folder its .meta names is kept
+        assert_eq!(dup.files[0].full_path, folders[1].join(skyui));
+
+        let group = dup.to_group();
+        assert_eq!(
+            group.files[group.newest_idx].full_path,
+            folders[1].join(skyui)
+        );
+        assert_eq!(group.space_to_free, 1000);
+    }
+
+    #[test]
+    fn test_distinct_file_ids_are_not_collapsed() {
+        let dir = tempdir().unwrap();
+        // Two files on one mod page, both at version 1.0
+        for name in [
+            "Mod-1234-5678-1-0-1600000000.7z",
+            "Mod-1234-9012-1-0-1700000000.7z",
+        ] {
+            fs::write(dir.path().join(name), vec![0u8; 1000]).unwrap();
+        }
+
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert!(result.duplicates.is_empty());
+
+        // A newer version under a new FileID is a regular update
+        fs::remove_file(dir.path().join("Mod-1234-9012-1-0-1700000000.7z")).unwrap();
+        fs::write(
+            dir.path().join("Mod-1234-9012-1-1-1700000000.7z"),
+            vec![0u8; 1000],
+        )
+        .unwrap();
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert_eq!(result.duplicates.len(), 1);
+        assert_eq!(
+            result.duplicates[0].files[0].file_name,
+            "Mod-1234-5678-1-0-1600000000.7z"
+        );
+    }
+
+    #[test]
+    fn test_fomod_options_are_not_grouped() {
+        let dir = tempdir().unwrap();
+        let names = [
+            "Mod Option 1-1234-1-0-1600000000.7z",
+            "Mod Option 2-1234-1-0-1700000000.7z",
+            "Mod - Option A-1234-1-0-1600000000.7z",
+            "Mod - Option B-1234-1-0-1700000000.7z",
+            "Mod-5678-1-0-Dark-1600000000.7z",
+            "Mod-5678-1-0-Light-1700000000.7z",
+        ];
+        for name in names {
+            fs::write(dir.path().join(name), vec![0u8; 1000]).unwrap();
+        }
+
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert!(result.duplicates.is_empty());
+
+        // Versions of the same option are still grouped
+        fs::write(
+            dir.path().join("Mod-5678-1-1-Dark-1800000000.7z"),
+            vec![0u8; 1000],
+        )
+        .unwrap();
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert_eq!(result.duplicates.len(), 1);
+        assert_eq!(
+            result.duplicates[0].files[0].file_name,
+            "Mod-5678-1-0-Dark-1600000000.7z"
+        );
+    }
+
+    #[test]
+    fn test_skyrim_le_and_se_never_share_a_group() {
+        let dir = tempdir().unwrap();
+        let create = |folder: &Path, name: &str, game: &str| {
+            fs::create_dir_all(folder).unwrap();
+            let path = folder.join(name);
+            fs::write(&path, vec![0u8; 1000]).unwrap();
+            fs::write(
+                crate::core::meta::meta_path_for(&path),
+                format!("gameName={}\n", game),
+            )
+            .unwrap();
+        };
+
+        // An LE download that ended up in the SE folder next to the SE file
+        let se_folder = dir.path().join("SkyrimSE");
+        create(&se_folder, "SkyUI-3863-5-1-1400000000.7z", "Skyrim");
+        create(&se_folder, "SkyUI-3863-5-2-1600000000.7z", "SkyrimSE");
+        let result = scan_folder_for_duplicates(&se_folder).unwrap();
+        assert!(result.duplicates.is_empty());
+
+        let unsafe_options = DuplicateScanOptions {
+            unsafe_delete_all_old: true,
+            ..Default::default()
+        };
+        let result = scan_folder_for_duplicates_with(&se_folder, &unsafe_options).unwrap();
+        assert!(result.duplicates.is_empty());
+
+        // The same mod in both game folders is grouped per folder only
+        let le_folder = dir.path().join("Skyrim");
+        create(&le_folder, "SkyUI-3863-4-1-1300000000.7z", "Skyrim");
+        let folders = vec![le_folder, se_folder];
+        let files = get_all_mod_files(&folders).unwrap();
+        let modlist = ModlistInfo {
+            used_file_names: files.iter().map(|f| f.file_name.clone()).collect(),
+            ..Default::default()
+        };
+        let plan = plan_cleanup(
+            &files,
+            &folders,
+            &[modlist],
+            &[],
+            GroupStrategy::default(),
+            1,
+            &KeepPolicy::default(),
+        );
+        assert_eq!(plan.orphaned_mods.len(), 0);
+        assert!(plan.old_versions.is_empty());
+    }
+
+    #[test]
+    fn test_plan_cleanup_group_strategy() {
+        let dir = tempdir().unwrap();
+        let folder = dir.path().join("Skyrim");
+        fs::create_dir(&folder).unwrap();
+        for name in [
+            "SkyUI-12604-5-1-1600000000.7z",
+            "SkyUI Beta-12604-5-2-1700000000.7z",
+        ] {
+            fs::write(folder.join(name), name).unwrap();
+        }
+        let folders = vec![folder];
+        let files = get_all_mod_files(&folders).unwrap();
+        let modlist = ModlistInfo {
+            used_file_names: files.iter().map(|f| f.file_name.clone()).collect(),
+            ..Default::default()
+        };
+        let plan = |strategy| {
+            plan_cleanup(
+                &files,
+                &folders,
+                std::slice::from_ref(&modlist),
+                &[],
+                strategy,
+                1,
+                &KeepPolicy::default(),
+            )
+        };
+
+        // The names differ, so only grouping by ModID makes one an old version
+        assert!(plan(GroupStrategy::NameAware).old_versions.is_empty());
+        let by_mod_id = plan(GroupStrategy::ModId);
+        assert_eq!(by_mod_id.old_version_files, 1);
+        assert_eq!(
+            by_mod_id.old_versions[0].files[0].file_name,
+            "SkyUI-12604-5-1-1600000000.7z"
+        );
+    }
+
+    #[test]
+    fn test_keep_reasons() {
+        let file = parse_mod_filename("SkyUI-12604-35407-5-2SE-1600000000.7z").unwrap();
+        let modlist = |name: &str, file_name: &str, file_id: &str| ModlistInfo {
+            name: name.to_string(),
+            used_mod_keys: HashSet::from(["12604".to_string()]),
+            used_mod_file_ids: HashSet::from([format!("12604-{}", file_id)]),
+            used_file_names: HashSet::from([file_name.to_string()]),
+            ..Default::default()
+        };
+        let modlists = [
+            modlist("C", "SkyUI-12604-1-5-1SE-1500000000.7z", "1"),
+            modlist("B", "SkyUI Renamed.7z", "35407"),
+            modlist("A", "SkyUI-12604-35407-5-2SE-1600000000.7z", "35407"),
+            ModlistInfo {
+                name: "Unrelated".to_string(),
+                ..Default::default()
+            },
+        ];
+
+        let reasons = keep_reasons(&file, &modlists);
+        let summary: Vec<(&str, MatchKind)> = reasons
+            .iter()
+            .map(|r| (r.modlist.as_str(), r.kind))
+            .collect();
+        assert_eq!(
+            summary,
+            vec![
+                ("A", MatchKind::FileName),
+                ("B", MatchKind::FileId),
+                ("C", MatchKind::ModId),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_which_modlists_use() {
+        let file = parse_mod_filename("SkyUI-12604-35407-5-2SE-1600000000.7z").unwrap();
+        let archive = |file_id: &str, version: &str| ExpectedArchive {
+            file_name: format!("SkyUI-12604-{}-{}-1600000000.7z", file_id, version),
+            mod_id: "12604".to_string(),
+            file_id: Some(file_id.to_string()),
+            version: Some(version.replace('-', ".")),
+        };
+        let modlist = |name: &str, expected: ExpectedArchive| ModlistInfo {
+            name: name.to_string(),
+            used_mod_keys: HashSet::from(["12604".to_string()]),
+            used_mod_file_ids: HashSet::from([format!(
+                "12604-{}",
+                expected.file_id.clone().unwrap()
+            )]),
+            used_file_names: HashSet::from([expected.file_name.clone()]),
+            archives: vec![expected],
+            ..Default::default()
+        };
+        let modlists = [
+            modlist("Current", archive("35407", "5-2SE")),
+            modlist("Outdated", archive("1", "5-1SE")),
+        ];
+
+        let uses = which_modlists_use(&file, &modlists);
+        assert_eq!(uses.len(), 2);
+        assert_eq!(uses[0].modlist, "Current");
+        assert_eq!(uses[0].kind, MatchKind::FileName);
+        assert_eq!(uses[0].expected_version.as_deref(), Some("5.2SE"));
+        assert!(!uses[0].other_file_id);
+        assert_eq!(uses[1].modlist, "Outdated");
+        assert_eq!(uses[1].kind, MatchKind::ModId);
+        assert_eq!(uses[1].expected_file_id.as_deref(), Some("1"));
+        assert!(uses[1].other_file_id);
+
+        assert!(which_modlists_use(&file, &[]).is_empty());
+    }
+
+    #[test]
+    fn test_unique_footprint() {
+        let files: Vec<ModFile> = [
+            ("SkyUI-12604-5-2SE-1600000000.7z", 1000),
+            ("USSEP-266-4-2-5-1600000000.7z", 300),
+            ("SKSE-30379-2-2-1600000000.7z", 50),
+        ]
+        .iter()
+        .map(|(name, size)| {
+            let mut file = parse_mod_filename(name).unwrap();
+            file.full_path = std::path::PathBuf::from(name);
+            file.size = *size;
+            file
+        })
+        .collect();
+        let modlist = |name: &str, used: &[&ModFile]| ModlistInfo {
+            name: name.to_string(),
+            used_file_names: used.iter().map(|f| f.file_name.clone()).collect(),
+            ..Default::default()
+        };
+        let modlists = [
+            modlist("Tuxborn", &[&files[0], &files[2]]),
+            modlist("Nordic", &[&files[1], &files[2]]),
+            modlist("Empty", &[&files[2]]),
+        ];
+
+        let result = detect_orphaned_mods(&files, &modlists);
+        let footprints = unique_footprint(&modlists, &result);
+        let summary: Vec<(&str, usize, u64)> = footprints
+            .iter()
+            .map(|f| (f.modlist.as_str(), f.files, f.size))
+            .collect();
+        assert_eq!(
+            summary,
+            vec![("Tuxborn", 1, 1000), ("Nordic", 1, 300), ("Empty", 0, 0)]
+        );
+    }
+
+    #[test]
+    fn test_get_game_folders_hidden() {
+        let dir = tempdir().unwrap();
+        for name in ["Skyrim", ".git", "__MACOSX"] {
+            fs::create_dir(dir.path().join(name)).unwrap();
+        }
+
+        let folders = get_game_folders(dir.path(), false).unwrap();
+        assert_eq!(folders, vec![dir.path().join("Skyrim")]);
+
+        let folders = get_game_folders(dir.path(), true).unwrap();
+        assert_eq!(folders.len(), 3);
+        assert!(folders.contains(&dir.path().join(".git")));
+    }
+
+    #[test]
+    fn test_find_modlists_in_folder() {
+        let dir = tempdir().unwrap();
+        let nested = dir.path().join("Skyrim").join("old");
+        fs::create_dir_all(&nested).unwrap();
+        fs::create_dir(dir.path().join(".cache")).unwrap();
+        for path in [
+            dir.path().join("Tuxborn.wabbajack"),
+            dir.path().join("Skyrim").join("Nolvus.wabbajack"),
+            dir.path().join("Skyrim").join("notes.txt"),
+            dir.path().join(".cache").join("Hidden.wabbajack"),
+            nested.join("TooDeep.wabbajack"),
+        ] {
+            File::create(path).unwrap();
+        }
+
+        let mut names: Vec<String> = find_modlists_in_folder(dir.path())
+            .unwrap()
+            .iter()
+            .map(|p| p.file_name().unwrap().to_string_lossy().to_string())
+            .collect();
+        names.sort();
+        assert_eq!(names, vec!["Nolvus.wabbajack", "Tuxborn.wabbajack"]);
+        assert!(find_modlists_in_folder(&dir.path().join("missing")).is_err());
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_get_game_folders_links() {
+        let dir = tempdir().unwrap();
+        let other_drive = tempdir().unwrap();
+        let skyrim = dir.path().join("Skyrim");
+        fs::create_dir(&skyrim).unwrap();
+        fs::create_dir(other_drive.path().join("Fallout4")).unwrap();
+        std::os::unix::fs::symlink(
+            other_drive.path().join("Fallout4"),
+            dir.path().join("Fallout4"),
+        )
+        .unwrap();
+        std::os::unix::fs::symlink(&skyrim, dir.path().join("Skyrim Link")).unwrap();
+
+        let folders = get_game_folders(dir.path(), false).unwrap();
+        assert_eq!(folders, vec![dir.path().join("Fallout4"), skyrim]);
+
+        let links = folder_links(&folders);
+        assert_eq!(links.len(), 1);
+        assert_eq!(links[0].0, dir.path().join("Fallout4"));
+        assert_eq!(
+            links[0].1,
+            fs::canonicalize(other_drive.path().join("Fallout4")).unwrap()
+        );
+    }
+
+    #[test]
+    fn test_get_game_folders_flat() {
+        let dir = tempdir().unwrap();
+        File::create(dir.path().join("SkyUI-12604-5-2-1700000000.7z")).unwrap();
+        fs::create_dir(dir.path().join(RECYCLE_BIN_DIR_NAME)).unwrap();
+
+        let folders = get_game_folders(dir.path(), false).unwrap();
+        assert_eq!(folders, vec![dir.path().to_path_buf()]);
+        assert!(is_flat_library(dir.path(), &folders));
+
+        fs::create_dir(dir.path().join("Skyrim")).unwrap();
+        let folders = get_game_folders(dir.path(), false).unwrap();
+        assert!(!is_flat_library(dir.path(), &folders));
+    }
+
+    #[test]
+    fn test_find_wabbajack_files() {
+        let dir = tempdir().unwrap();
+
+        // Create test files
+        File::create(dir.path().join("modlist1.wabbajack")).unwrap();
+        File::create(dir.path().join("modlist2.wabbajack")).unwrap();
+        File::create(dir.path().join("readme.txt")).unwrap();
+
+        let files = find_wabbajack_files(dir.path()).unwrap();
+        assert_eq!(files.len(), 2);
+    }
+
+    #[test]
+    fn test_get_all_mod_files() {
+        let dir = tempdir().unwrap();
+        let game_dir = dir.path().join("Skyrim");
+        fs::create_dir(&game_dir).unwrap();
+
+        // Create valid mod files
+        let mut file1 = File::create(game_dir.join("SkyUI-12345-5-0-1234567890.7z")).unwrap();
+        file1.write_all(b"test content").unwrap();
+
+        let mut file2 = File::create(game_dir.join("SKSE-54321-1-0-9876543210.zip")).unwrap();
+        file2.write_all(b"test content 2").unwrap();
+
+        // Create invalid file
+        File::create(game_dir.join("readme.txt")).unwrap();
+
+        let files = get_all_mod_files(&[game_dir.clone()]).unwrap();
+        assert_eq!(files.len(), 2);
+
+        // Extensions from the config replace the defaults for the scan
+        File::create(game_dir.join("Pack-11111-1-0-1234567890.pak")).unwrap();
+        let parse = ParseOptions::with_extensions(&["pak".to_string()]);
+        let files = get_all_mod_files_cached(&[game_dir], &parse, &StatCache::new()).unwrap();
+        assert_eq!(files.len(), 1);
+        assert_eq!(files[0].mod_id, "11111");
+    }
+
+    #[test]
+    fn test_inspect_archives_option() {
+        use zip::write::SimpleFileOptions;
+        use zip::ZipWriter;
+
+        let dir = tempdir().unwrap();
+        let mut zip = ZipWriter::new(File::create(dir.path().join("Some Retexture.zip")).unwrap());
+        zip.start_file("meta.ini", SimpleFileOptions::default())
+            .unwrap();
+        zip.write_all(b"[General]\nmodid=12345\n").unwrap();
+        zip.finish().unwrap();
+        let folders = [dir.path().to_path_buf()];
+
+        // Only a scan whose options ask for it opens the archive
+        let files = get_all_mod_files(&folders).unwrap();
+        assert_eq!(files[0].mod_id, "0");
+        let mut parse = ParseOptions::default();
+        parse.inspect_archives = true;
+        let files = get_all_mod_files_cached(&folders, &parse, &StatCache::new()).unwrap();
+        assert_eq!(files[0].mod_id, "12345");
+    }
+
+    #[test]
+    fn test_scan_folders_in_parallel() {
+        let dir = tempdir().unwrap();
+        let names = ["Starfield", "Fallout4", "Skyrim"];
+        let folders: Vec<_> = names.iter().map(|n| dir.path().join(n)).collect();
+        for folder in &folders {
+            fs::create_dir(folder).unwrap();
+            File::create(folder.join("Mod-100-1-0-1600000000.7z")).unwrap();
+            File::create(folder.join("Mod-100-2-0-1700000000.7z")).unwrap();
+        }
+
+        let results = scan_folders_for_duplicates(&folders, &DuplicateScanOptions::default());
+        let scanned: Vec<_> = results.iter().map(|(f, _)| f.clone()).collect();
+        let mut sorted = folders.clone();
+        sorted.sort();
+        assert_eq!(scanned, sorted);
+        for (_, result) in &results {
+            assert_eq!(result.as_ref().unwrap().total_files, 1);
+        }
+
+        // Resumable collection keeps folder order and cleans up its progress file
+        let progress_path = dir.path().join("scan_progress.json");
+        let cancel = AtomicBool::new(true);
+        let err = get_all_mod_files_resumable(
+            &folders,
+            &ParseOptions::default(),
+            ScanProgress::open(&progress_path, false),
+            &cancel,
+        )
+        .unwrap_err();
+        assert_eq!(err.to_string(), SCAN_CANCELLED);
+        let err = get_all_mod_files_cancellable(
+            &folders,
+            &ParseOptions::default(),
+            &StatCache::new(),
+            &cancel,
+        )
+        .unwrap_err();
+        assert_eq!(err.to_string(), SCAN_CANCELLED);
+
+        cancel.store(false, Ordering::Relaxed);
+        let files = get_all_mod_files_resumable(
+            &folders,
+            &ParseOptions::default(),
+            ScanProgress::open(&progress_path, false),
+            &cancel,
+        )
+        .unwrap();
+        assert_eq!(files.len(), 6);
+        for (pair, folder) in files.chunks(2).zip(&folders) {
+            assert!(pair.iter().all(|f| f.full_path.parent() == Some(folder)));
+        }
+        assert!(!progress_path.exists());
+    }
+
+    #[test]
+    fn test_calculate_library_stats_uncompressed() {
+        use zip::write::SimpleFileOptions;
+        use zip::ZipWriter;
+
+        let dir = tempdir().unwrap();
+        let game_dir = dir.path().join("Skyrim");
+        fs::create_dir(&game_dir).unwrap();
+
+        let zip_path = game_dir.join("Textures-12345-1-0-1234567890.zip");
+        let mut zip = ZipWriter::new(File::create(&zip_path).unwrap());
+        let options =
+            SimpleFileOptions::default().compression_method(zip::CompressionMethod::Stored);
+        zip.start_file("textures/a.dds", options).unwrap();
+        zip.write_all(&[0u8; 300]).unwrap();
+        zip.start_file("textures/b.dds", options).unwrap();
+        zip.write_all(&[0u8; 200]).unwrap();
+        zip.finish().unwrap();
+
+        let mut other = File::create(game_dir.join("SKSE-54321-1-0-9876543210.7z")).unwrap();
+        other.write_all(b"test content").unwrap();
+
+        let stats = calculate_library_stats(&[game_dir.clone()], false);
+        assert_eq!(stats.total_files, 2);
+        assert!(stats.uncompressed_size.is_none());
+
+        let stats = calculate_library_stats(&[game_dir], true);
+        // Zip entries are summed, the .7z counts at its on-disk size
+        assert_eq!(stats.uncompressed_size, Some(500 + 12));
+    }
+
+    #[test]
+    fn test_scan_groups_across_subfolders() {
+        let dir = tempdir().unwrap();
+        let old = dir
+            .path()
+            .join("AuthorA")
+            .join("SkyUI-12604-5-1-1600000000.7z");
+        let new = dir
+            .path()
+            .join("AuthorB")
+            .join("SkyUI-12604-5-2-1700000000.7z");
+        for file in [&old, &new] {
+            fs::create_dir_all(file.parent().unwrap()).unwrap();
+            fs::write(file, b"archive").unwrap();
+        }
+
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert!(result.duplicates.is_empty());
+
+        let options = DuplicateScanOptions {
+            subfolder_depth: 1,
+            ..Default::default()
+        };
+        let result = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        assert_eq!(result.duplicates.len(), 1);
+        assert_eq!(result.duplicates[0].files[0].full_path, old);
+        assert_eq!(
+            game_folder_of(&old, &[dir.path().to_path_buf()]),
+            Some(&dir.path().to_path_buf())
+        );
+    }
+
+    #[test]
+    fn test_calculate_library_stats_by_game() {
+        let dir = tempdir().unwrap();
+        let skyrim = dir.path().join("Skyrim");
+        let fallout = dir.path().join("Fallout4");
+        fs::create_dir(&skyrim).unwrap();
+        fs::create_dir(&fallout).unwrap();
+
+        fs::write(skyrim.join("SkyUI-12604-5-1-1600000000.7z"), vec![0u8; 100]).unwrap();
+        fs::write(skyrim.join("SkyUI-12604-5-2-1700000000.7z"), vec![0u8; 150]).unwrap();
+        fs::write(fallout.join("F4SE-4000-1-0-1600000000.7z"), vec![0u8; 400]).unwrap();
+
+        let stats = calculate_library_stats(&[skyrim, fallout], false);
+
+        // Largest folder first
+        let games: Vec<_> = stats.by_game.iter().map(|g| g.game.as_str()).collect();
+        assert_eq!(games, ["Fallout4", "Skyrim"]);
+        assert_eq!(stats.by_game[0].old_version_bytes, 0);
+        assert_eq!(stats.by_game[1].old_version_bytes, 100);
+        assert_eq!(
+            stats.by_game[1].largest,
+            Some(("SkyUI-12604-5-2-1700000000.7z".to_string(), 150))
+        );
+        assert_eq!(stats.old_version_bytes(), 100);
+    }
+
+    #[test]
+    fn test_scan_handles_file_vanished_after_listing() {
+        let dir = tempdir().unwrap();
+        let names = [
+            "SkyUI-12345-5-0-1600000000.7z",
+            "SkyUI-12345-5-1-1700000000.7z",
+            "SkyUI-12345-5-2-1800000000.7z",
+        ];
+        for name in names {
+            let mut f = File::create(dir.path().join(name)).unwrap();
+            f.write_all(b"test content").unwrap();
+        }
+
+        // List first, then remove a file before a fresh cache reads its metadata
+        let paths = StatCache::new().list_folder(dir.path()).unwrap();
+        assert_eq!(paths.len(), 3);
+        fs::remove_file(dir.path().join(names[1])).unwrap();
+
+        let grouped = group_mod_files(
+            &paths,
+            GroupStrategy::default(),
+            &ParseOptions::default(),
+            &StatCache::new(),
+            None,
+        )
+        .unwrap();
+        assert_eq!(grouped.vanished, vec![names[1].to_string()]);
+        assert_eq!(grouped.groups.len(), 1);
+
+        let group = grouped.groups.values().next().unwrap();
+        assert_eq!(group.files.len(), 2);
+        assert!(group.files.iter().all(|f| f.full_path.exists()));
+        assert!(group.files.iter().all(|f| f.size == 12));
+    }
+
+    #[test]
+    fn test_detect_orphaned_mods_by_game() {
+        let dir = tempdir().unwrap();
+        let skyrim = dir.path().join("Skyrim Special Edition");
+        let fallout = dir.path().join("Fallout 4");
+        let other = dir.path().join("Misc");
+        for folder in [&skyrim, &fallout, &other] {
+            fs::create_dir(folder).unwrap();
+            File::create(folder.join("Some Mod-12345-1-0-1600000000.7z")).unwrap();
+        }
+        let folders = vec![skyrim.clone(), fallout.clone(), other.clone()];
+
+        // A Fallout 4 list that downloads ModID 12345 under another name
+        let modlist = ModlistInfo {
+            name: "Fallout List".to_string(),
+            game: Some("Fallout4".to_string()),
+            used_mod_keys: HashSet::from(["12345".to_string()]),
+            archives: vec![ExpectedArchive {
+                file_name: "Other Mod-12345-2-0-1700000000.7z".to_string(),
+                mod_id: "12345".to_string(),
+                file_id: None,
+                version: None,
+            }],
+            ..Default::default()
+        };
+
+        let files = get_all_mod_files(&folders).unwrap();
+        let result =
+            detect_orphaned_mods_by_game(&files, &[modlist.clone()], &folders, &default_games());
+        let orphaned: Vec<_> = result
+            .orphaned_mods
+            .iter()
+            .map(|m| m.file.full_path.parent().unwrap().to_path_buf())
+            .collect();
+        assert_eq!(orphaned, vec![skyrim]);
+
+        // Without game folders every copy matches by ModID, as before
+        assert!(detect_orphaned_mods(&files, &[modlist])
+            .orphaned_mods
+            .is_empty());
+    }
+
+    #[test]
+    fn test_detect_orphaned_mods_cross_game_archive() {
+        let dir = tempdir().unwrap();
+        let new_vegas = dir.path().join("Fallout New Vegas");
+        let fallout3 = dir.path().join("Fallout 3");
+        let fallout4 = dir.path().join("Fallout 4");
+        for folder in [&new_vegas, &fallout3, &fallout4] {
+            fs::create_dir(folder).unwrap();
+            File::create(folder.join("Some Mod-12345-1-0-1600000000.7z")).unwrap();
+        }
+        let folders = vec![new_vegas.clone(), fallout3.clone(), fallout4.clone()];
+
+        // A New Vegas list that downloads a Fallout 3 archive
+        let expected = "Other Mod-12345-2-0-1700000000.7z";
+        let modlist = ModlistInfo {
+            name: "New Vegas List".to_string(),
+            game: Some("FalloutNewVegas".to_string()),
+            used_mod_keys: HashSet::from(["12345".to_string()]),
+            archive_games: HashMap::from([(expected.to_string(), "Fallout3".to_string())]),
+            archives: vec![ExpectedArchive {
+                file_name: expected.to_string(),
+                mod_id: "12345".to_string(),
+                file_id: None,
+                version: None,
+            }],
+            ..Default::default()
+        };
+
+        let files = get_all_mod_files(&folders).unwrap();
+        let result = detect_orphaned_mods_by_game(&files, &[modlist], &folders, &default_games());
+        let orphaned: Vec<_> = result
+            .orphaned_mods
+            .iter()
+            .map(|m| m.file.full_path.parent().unwrap().to_path_buf())
+            .collect();
+        assert_eq!(orphaned, vec![fallout4]);
+    }
+
+    #[test]
+    fn test_detect_foreign_game_mods() {
+        use crate::core::games::default_games;
+
+        let dir = tempdir().unwrap();
+        let game_dir = dir.path().join("Skyrim Special Edition");
+        fs::create_dir(&game_dir).unwrap();
+
+        let names = [
+            "SkyUI-12604-5-2-SE-1615410779.7z",
+            "Oblivion Leftover-1234-1-0-1500000000.7z",
+            "No Meta-5555-1-0-1500000000.7z",
+        ];
+        for name in names {
+            File::create(game_dir.join(name)).unwrap();
+        }
+        fs::write(
+            game_dir.join(format!("{}.meta", names[0])),
+            "[General]\ngameName=SkyrimSE\nmodID=12604\n",
+        )
+        .unwrap();
+        fs::write(
+            game_dir.join(format!("{}.meta", names[1])),
+            "[General]\ngameName=Oblivion\nmodID=1234\n",
+        )
+        .unwrap();
+
+        let files = get_all_mod_files(&[game_dir.clone()]).unwrap();
+        let foreign = detect_foreign_game_mods(&files, &[game_dir.clone()], &[], &default_games());
+        assert_eq!(foreign.len(), 1);
+        assert_eq!(foreign[0].file.file_name, names[1]);
+        assert_eq!(foreign[0].game, "Oblivion");
+
+        // A modlist for the game makes its archives known
+        let mut archive_games = HashMap::new();
+        archive_games.insert("Other.7z".to_string(), "Oblivion".to_string());
+        let modlist = ModlistInfo {
+            file_path: std::path::PathBuf::new(),
+            name: "Oblivion List".to_string(),
+            game: None,
+            mod_count: 1,
+            used_mod_keys: HashSet::new(),
+            used_mod_file_ids: HashSet::new(),
+            used_file_names: HashSet::new(),
+            archive_games,
+            ..Default::default()
+        };
+        assert!(
+            detect_foreign_game_mods(&files, &[game_dir], &[modlist], &default_games()).is_empty()
+        );
+    }
+
+    #[test]
+    fn test_build_cleanup_plan() {
+        let dir = tempdir().unwrap();
+        let game_dir = dir.path().join("Skyrim");
+        fs::create_dir(&game_dir).unwrap();
+
+        let versions = [
+            "SkyUI-12604-5-0-1600000000.7z",
+            "SkyUI-12604-5-1-1610000000.7z",
+            "SkyUI-12604-5-2-1620000000.7z",
+        ];
+        let orphan = "Unused Mod-999-1-0-1500000000.7z";
+        for name in versions.iter().chain([&orphan]) {
+            let mut f = File::create(game_dir.join(name)).unwrap();
+            f.write_all(b"data").unwrap();
+        }
+
+        let modlist = ModlistInfo {
+            file_path: std::path::PathBuf::new(),
+            name: "List".to_string(),
+            game: None,
+            mod_count: 3,
+            used_mod_keys: HashSet::new(),
+            used_mod_file_ids: HashSet::new(),
+            used_file_names: versions.iter().map(|v| v.to_string()).collect(),
+            archive_games: HashMap::new(),
+            ..Default::default()
+        };
+
+        let plan = build_cleanup_plan(&[game_dir.clone()], &[modlist.clone()], 2).unwrap();
+        assert_eq!(plan.orphaned_mods.len(), 1);
+        assert_eq!(plan.orphaned_mods[0].file.file_name, orphan);
+        assert_eq!(plan.old_version_files, 1);
+        assert_eq!(plan.old_versions[0].files[0].file_name, versions[0]);
+        assert_eq!(plan.total_files(), 2);
+        assert_eq!(plan.total_size(), 8);
+
+        // Keeping as many versions as exist leaves nothing to trim
+        let plan = build_cleanup_plan(&[game_dir], &[modlist], 3).unwrap();
+        assert!(plan.old_versions.is_empty());
+        assert_eq!(plan.total_files(), 1);
+    }
+
+    #[test]
+    fn test_read_only_folders() {
+        use crate::core::games::default_games;
+
+        let folders = vec![
+            std::path::PathBuf::from("/dl/Skyrim Special Edition"),
+            std::path::PathBuf::from("/dl/Fallout 4"),
+            std::path::PathBuf::from("/dl/My Custom Folder"),
+        ];
+        let modlist = ModlistInfo {
+            file_path: std::path::PathBuf::new(),
+            name: "List".to_string(),
+            game: Some("SkyrimSpecialEdition".to_string()),
+            mod_count: 0,
+            used_mod_keys: HashSet::new(),
+            used_mod_file_ids: HashSet::new(),
+            used_file_names: HashSet::new(),
+            archive_games: HashMap::new(),
+            ..Default::default()
+        };
+
+        let read_only = read_only_folders(&folders, &[modlist], &default_games());
+        assert_eq!(read_only, folders[1..].to_vec());
+    }
+
+    #[test]
+    fn test_detect_orphaned_patches() {
+        let dir = tempdir().unwrap();
+        let names = [
+            // Patch with its main file present
+            "Cool Mod-100-1-0-1600000000.7z",
+            "Cool Mod Patch-100-1-1-1610000000.7z",
+            // Patch whose main file is gone
+            "Lonely Hotfix-200-2-0-1620000000.7z",
+        ];
+        for name in names {
+            File::create(dir.path().join(name)).unwrap();
+        }
+
+        let files = get_all_mod_files(&[dir.path().to_path_buf()]).unwrap();
+        let result = detect_orphaned_mods(&files, &[]);
+
+        assert_eq!(result.orphaned_mods.len(), 3);
+        assert_eq!(result.orphaned_patches.len(), 1);
+        assert_eq!(result.orphaned_patches[0].file.file_name, names[2]);
+    }
+
+    #[test]
+    fn test_estimate_reclaimable_matches_plan() {
+        let dir = tempdir().unwrap();
+        let game_dir = dir.path().join("Skyrim");
+        fs::create_dir(&game_dir).unwrap();
+
+        let used = [
+            "SkyUI-12604-5-0-1600000000.7z",
+            "SkyUI-12604-5-2-1620000000.7z",
+        ];
+        fs::write(game_dir.join(used[0]), vec![0u8; 100]).unwrap();
+        fs::write(game_dir.join(used[1]), vec![0u8; 120]).unwrap();
+        fs::write(game_dir.join("Unused-999-1-0-1500000000.7z"), vec![0u8; 50]).unwrap();
+
+        let modlist = ModlistInfo {
+            file_path: std::path::PathBuf::new(),
+            name: "List".to_string(),
+            game: None,
+            mod_count: 2,
+            used_mod_keys: HashSet::new(),
+            used_mod_file_ids: HashSet::new(),
+            used_file_names: used.iter().map(|u| u.to_string()).collect(),
+            archive_games: HashMap::new(),
+            ..Default::default()
+        };
+        let folders = [game_dir];
+
+        let (old_bytes, orphan_bytes) =
+            estimate_reclaimable(&folders, std::slice::from_ref(&modlist)).unwrap();
+        assert_eq!((old_bytes, orphan_bytes), (100, 50));
+
+        let plan = build_cleanup_plan(&folders, &[modlist], 1).unwrap();
+        assert_eq!(plan.old_version_size, old_bytes);
+        assert_eq!(plan.orphaned_size, orphan_bytes);
+    }
+
+    #[test]
+    fn test_split_mixed_version_schemes() {
+        assert_eq!(VersionScheme::of("1-2-3"), VersionScheme::Sequential);
+        assert_eq!(VersionScheme::of("5-2-SE"), VersionScheme::Sequential);
+        assert_eq!(VersionScheme::of("2024-05"), VersionScheme::Calendar);
+        assert_eq!(VersionScheme::of("20240512"), VersionScheme::Calendar);
+        assert_eq!(VersionScheme::of("1000"), VersionScheme::Sequential);
+
+        let dir = tempdir().unwrap();
+        let names = [
+            "Toolkit-5000-1-2-0-1600000000.7z",
+            "Toolkit-5000-1-3-0-1610000000.7z",
+            "Toolkit-5000-2024.05-1620000000.7z",
+        ];
+        for name in names {
+            fs::write(dir.path().join(name), b"data").unwrap();
+        }
+
+        // Grouped together, the calendar file counts as the newest version
+        let merged = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert_eq!(merged.total_files, 2);
+        assert!(merged.split_groups.is_empty());
+
+        let options = DuplicateScanOptions {
+            split_version_schemes: true,
+            ..Default::default()
+        };
+        let split = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        assert_eq!(split.split_groups, vec!["5000:Toolkit"]);
+        assert_eq!(split.total_files, 1);
+        assert_eq!(split.duplicates[0].files[0].file_name, names[0]);
+        assert_eq!(split.duplicates[0].mod_key, "5000:Toolkit#sequential");
+    }
+
+    #[test]
+    fn test_patch_only_releases_keep_newest() {
+        let dir = tempdir().unwrap();
+        let names = [
+            "Weather Patch-4321-1-0-1600000000.7z",
+            "Weather Patch-4321-1-1-1610000000.7z",
+            "Weather Patch-4321-1-2-1620000000.7z",
+        ];
+        for (name, size) in names.iter().zip([1000, 60, 50]) {
+            fs::write(dir.path().join(name), vec![0u8; size]).unwrap();
+        }
+
+        // Every release is a patch, so the newest isn't a patch for an older full file
+        let result = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert_eq!(result.total_files, 2);
+        assert_eq!(result.duplicates[0].files[2].file_name, names[2]);
+        assert_eq!(result.duplicates[0].newest_idx, 2);
+    }
+
+    #[test]
+    fn test_unsafe_delete_all_old_skips_safety_checks() {
+        let dir = tempdir().unwrap();
+        let names = [
+            "Mod-1234-1-0-Main-1600000000.7z",
+            "Mod-1234-1-1-Hotfix-1610000000.7z",
+        ];
+        for name in names {
+            fs::write(dir.path().join(name), b"data").unwrap();
+        }
+
+        // Groups mixing patch and main files are skipped by default
+        let safe = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert_eq!(safe.total_files, 0);
+
+        let options = DuplicateScanOptions {
+            unsafe_delete_all_old: true,
+            ..Default::default()
+        };
+        let result = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        assert_eq!(result.total_files, 1);
+        assert_eq!(result.duplicates[0].files[0].file_name, names[0]);
+    }
+
+    #[test]
+    fn test_aggressive_skips_only_heuristics() {
+        let dir = tempdir().unwrap();
+        // The same version uploaded twice within an hour looks suspicious
+        let reupload = [
+            "Reupload-1234-1-0-1600000000.7z",
+            "Reupload-1234-1-0-1600001000.7z",
+        ];
+        let patched = [
+            "Patched-5678-1-0-Main-1600000000.7z",
+            "Patched-5678-1-1-Hotfix-1610000000.7z",
+        ];
+        for name in reupload.iter().chain(&patched) {
+            fs::write(dir.path().join(name), b"data").unwrap();
+        }
+
+        let safe = scan_folder_for_duplicates(dir.path()).unwrap();
+        assert_eq!(safe.total_files, 0);
+        assert_eq!(safe.heuristic_groups.len(), 1);
+        assert!(safe.heuristic_groups[0].starts_with("1234:"));
+
+        let options = DuplicateScanOptions {
+            aggressive: true,
+            ..Default::default()
+        };
+        let result = scan_folder_for_duplicates_with(dir.path(), &options).unwrap();
+        assert_eq!(result.total_files, 1);
+        assert_eq!(result.duplicates[0].files[0].file_name, reupload[0]);
+        assert_eq!(result.heuristic_groups, safe.heuristic_groups);
+    }
+
+    #[test]
+    fn test_detect_fragmented_mods() {
+        let dir = tempdir().unwrap();
+        let skyrim = dir.path().join("Skyrim Special Edition");
+        let misplaced = dir.path().join("downloads_old");
+        let fallout = dir.path().join("Fallout 4");
+        for folder in [&skyrim, &misplaced, &fallout] {
+            fs::create_dir(folder).unwrap();
+        }
+
+        File::create(skyrim.join("SkyUI-12604-5-2-1620000000.7z")).unwrap();
+        File::create(misplaced.join("SkyUI-12604-5-1-1610000000.7z")).unwrap();
+        // Same ModID in another game is a different mod
+        File::create(fallout.join("Other Mod-12604-1-0-1600000000.7z")).unwrap();
+
+        let files = get_all_mod_files(&[skyrim.clone(), misplaced.clone(), fallout]).unwrap();
+        let fragmented = detect_fragmented_mods(&files);
+
+        assert_eq!(fragmented.len(), 1);
+        assert_eq!(fragmented[0].mod_id, "12604");
+        assert_eq!(fragmented[0].files.len(), 2);
+        let mut expected = vec![skyrim, misplaced];
+        expected.sort();
+        assert_eq!(fragmented[0].folders, expected);
+    }
+
+    #[test]
+    fn test_report_version_drift() {
+        let expected = |name: &str, file_id: &str, version: &str| ExpectedArchive {
+            file_name: name.to_string(),
+            mod_id: "12604".to_string(),
+            file_id: Some(file_id.to_string()),
+            version: Some(version.to_string()),
+        };
+        let on_disk = |name: &str| {
+            let mut f = parse_mod_filename(name).unwrap();
+            f.full_path = std::path::PathBuf::from(name);
+            f
+        };
+
+        let modlist = ModlistInfo {
+            file_path: std::path::PathBuf::new(),
+            name: "Test Modlist".to_string(),
+            game: None,
+            mod_count: 2,
+            used_mod_keys: HashSet::new(),
+            used_mod_file_ids: HashSet::new(),
+            used_file_names: HashSet::new(),
+            archive_games: HashMap::new(),
+            archive_hashes: HashMap::new(),
+            archives: vec![
+                expected("SkyUI-12604-35407-5-2SE-1600000000.7z", "35407", "5.2SE"),
+                expected("SkyUI Extras-12604-40000-1-0-1650000000.7z", "40000", "1.0"),
+                ExpectedArchive {
+                    file_name: "Missing Mod-999-1-0-1600000000.7z".to_string(),
+                    mod_id: "999".to_string(),
+                    file_id: None,
+                    version: None,
+                },
+            ],
+            ..Default::default()
+        };
+        let files = vec![
+            on_disk("SkyUI-12604-35407-5-2SE-1600000000.7z"),
+            on_disk("SkyUI-12604-36000-5-3SE-1610000000.7z"),
+            on_disk("SkyUI Extras-12604-39000-0-9-1640000000.7z"),
+        ];
+
+        let report = report_version_drift(&modlist, &files);
+        assert_eq!(report.len(), 3);
+
+        let missing = &report[0];
+        assert_eq!(missing.mod_name, "Missing Mod");
+        assert!(missing.on_disk.is_empty());
+
+        let skyui = &report[1];
+        assert_eq!(skyui.mod_name, "SkyUI");
+        let kinds: Vec<_> = skyui.on_disk.iter().map(|(_, k)| *k).collect();
+        assert_eq!(
+            kinds,
+            vec![VersionDriftKind::Matching, VersionDriftKind::Newer]
+        );
+
+        let extras = &report[2];
+        assert_eq!(extras.on_disk.len(), 1);
+        assert_eq!(extras.on_disk[0].1, VersionDriftKind::Older);
+
+        // SkyUI has the expected file and Missing Mod has nothing on disk
+        let mismatches = audit_modlist_versions(&modlist, &files);
+        assert_eq!(mismatches.len(), 1);
+        assert_eq!(mismatches[0].modlist, "Test Modlist");
+        assert_eq!(mismatches[0].mod_name, "SkyUI Extras");
+        assert_eq!(mismatches[0].expected.file_id.as_deref(), Some("40000"));
+        assert_eq!(mismatches[0].on_disk[0].file_id.as_deref(), Some("39000"));
+    }
+
+    #[test]
+    fn test_detect_identical_archives() {
+        let file = |dir: &str, name: &str| {
+            let mut f = parse_mod_filename(name).unwrap();
+            f.full_path = std::path::PathBuf::from(dir).join(name);
+            f.size = 100;
+            f
+        };
+        let modlist = |name: &str, archive: &str| {
+            let mut archive_hashes = HashMap::new();
+            archive_hashes.insert(archive.to_string(), "abc=".to_string());
+            ModlistInfo {
+                file_path: std::path::PathBuf::new(),
+                name: name.to_string(),
+                game: None,
+                mod_count: 1,
+                used_mod_keys: HashSet::new(),
+                used_mod_file_ids: HashSet::new(),
+                used_file_names: HashSet::new(),
+                archive_games: HashMap::new(),
+                archive_hashes,
+                ..Default::default()
+            }
+        };
+
+        let used = vec![
+            file("/dl/Skyrim", "SkyUI-12604-5-2SE-1600000000.7z"),
+            file("/dl/Skyrim", "SkyUI 5.2-12604-5-2SE-1600000000.7z"),
+            file("/dl/Skyrim", "Other-999-1-0-1600000000.7z"),
+        ];
+        let modlists = [
+            modlist("A", "SkyUI-12604-5-2SE-1600000000.7z"),
+            modlist("B", "SkyUI 5.2-12604-5-2SE-1600000000.7z"),
+        ];
+
+        let identical = detect_identical_archives(&used, &modlists);
+        assert_eq!(identical.len(), 1);
+        assert_eq!(identical[0].files.len(), 2);
+        assert_eq!(identical[0].reclaimable, 100);
+    }
+
+    #[test]
+    fn test_audit_library() {
+        let dir = tempdir().unwrap();
+        let file = |name: &str, meta: Option<&str>| {
+            let path = dir.path().join(name);
+            fs::write(&path, b"data").unwrap();
+            if let Some(meta) = meta {
+                fs::write(crate::core::meta::meta_path_for(&path), meta).unwrap();
+            }
+            let mut f = parse_mod_filename(name).unwrap();
+            f.full_path = path;
+            f.size = 4;
+            f
+        };
+
+        let mut archive_hashes = HashMap::new();
+        archive_hashes.insert(
+            "Renamed-1001-1-0-1600000000.7z".to_string(),
+            "aaa=".to_string(),
+        );
+        archive_hashes.insert(
+            "Named-2002-1-0-1600000000.7z".to_string(),
+            "bbb=".to_string(),
+        );
+        archive_hashes.insert(
+            "Gone-3003-1-0-1600000000.7z".to_string(),
+            "ccc=".to_string(),
+        );
+        let mut archive_sizes = HashMap::new();
+        archive_sizes.insert("Gone-3003-1-0-1600000000.7z".to_string(), 2048);
+        let modlist = ModlistInfo {
+            name: "List".to_string(),
+            archive_hashes,
+            archive_sizes,
+            ..Default::default()
+        };
+
+        let files = vec![
+            // Matched by the hash in its .meta despite the different name
+            file("Local Copy-1001-1-0-1700000000.7z", Some("hash=aaa=\n")),
+            // No hash, but the modlist knows the name
+            file("Named-2002-1-0-1600000000.7z", None),
+            // Same name as a needed archive, but different content
+            file("Gone-3003-1-0-1600000000.7z", Some("hash=zzz=\n")),
+            file("Unknown-4004-1-0-1600000000.7z", None),
+        ];
+
+        let audit = audit_library(&files, &[modlist]);
+        assert_eq!(audit.kept.len(), 2);
+        assert_eq!(audit.kept_size, 8);
+        assert_eq!(audit.orphaned.len(), 1);
+        assert_eq!(audit.orphaned[0].mod_id, "3003");
+        assert_eq!(audit.unhashed.len(), 1);
+        assert_eq!(audit.missing.len(), 1);
+        assert_eq!(audit.missing[0].hash, "ccc=");
+        assert_eq!(audit.missing[0].modlists, vec!["List".to_string()]);
+        assert_eq!((audit.found(), audit.needed), (2, 3));
+        assert_eq!(audit.missing_size, 2048);
+    }
+
+    #[test]
+    fn test_trim_plan_to_target() {
+        let file = |name: &str, size: u64| {
+            let mut f = parse_mod_filename(name).unwrap();
+            f.size = size;
+            f
+        };
+        let plan = CleanupPlan {
+            orphaned_mods: vec![
+                OrphanedMod {
+                    file: file("Small-111-1-0-1600000000.7z", 50),
+                },
+                OrphanedMod {
+                    file: file("Big-222-1-0-1600000000.7z", 100),
+                },
+            ],
+            old_versions: vec![ModGroup {
+                mod_key: "333:Mod".to_string(),
+                files: vec![
+                    file("Mod-333-1-0-1600000001.7z", 10),
+                    file("Mod-333-1-1-1600000002.7z", 10),
+                    file("Mod-333-1-2-1600000003.7z", 10),
+                ],
+                newest_idx: 2,
+                space_to_free: 20,
+            }],
+            keep_versions: 1,
+            orphaned_size: 150,
+            old_version_files: 2,
+            old_version_size: 20,
+            target: None,
+        };
+
+        // The largest orphan alone reaches the target
+        let mut trimmed = plan.clone();
+        assert!(trim_plan_to_target(&mut trimmed, 80));
+        assert_eq!(trimmed.orphaned_mods.len(), 1);
+        assert_eq!(trimmed.orphaned_mods[0].file.mod_name, "Big");
+        assert!(trimmed.old_versions.is_empty());
+
+        // Old versions are added oldest first once orphans run out
+        let mut trimmed = plan.clone();
+        assert!(trim_plan_to_target(&mut trimmed, 155));
+        assert_eq!(trimmed.total_files(), 3);
+        assert_eq!(trimmed.old_versions[0].newest_idx, 1);
+        assert_eq!(trimmed.total_size(), 160);
+
+        // An unreachable target keeps the whole plan
+        let mut trimmed = plan.clone();
+        assert!(!trim_plan_to_target(&mut trimmed, 1000));
+        assert_eq!(trimmed.total_size(), 170);
+        assert_eq!(trimmed.target, Some(1000));
     }
 }
@@ -0,0 +1,262 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+use std::collections::HashMap;
+use std::fmt;
+use std::io;
+use std::path::{Path, PathBuf};
+use std::sync::{Arc, RwLock};
+
+use anyhow::{Context, Result};
+
+use crate::core::cleaner::RECYCLE_BIN_DIR_NAME;
+use crate::core::fsops::{FileInfo, FileOps, RealFileOps};
+use crate::core::scanner::is_hidden_folder;
+
+/// Size and modification time of a file
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct FileStat {
+    pub size: u64,
+    pub modified: Option<u64>,
+}
+
+impl From<FileInfo> for FileStat {
+    fn from(info: FileInfo) -> Self {
+        Self {
+            size: info.size,
+            modified: info.modified,
+        }
+    }
+}
+
+/// File stats read once and shared by the scans of a single run
+///
+/// Listing a folder records the stat of every file in it, so statistics and
+/// old version scans over the same folders don't read each file again.
+/// Deletion never uses the cache: the cleaner checks every file on disk
+/// right before removing it.
+pub struct StatCache {
+    stats: RwLock<HashMap<PathBuf, FileStat>>,
+    /// Levels of subfolders listed along with each folder; 0 lists only the folder
+    subfolder_depth: usize,
+    /// Folders listed on their own, so never as another folder's subfolder
+    game_folders: Vec<PathBuf>,
+    /// Where folders are listed and files read
+    ops: Arc<dyn FileOps + Send>,
+}
+
+impl Default for StatCache {
+    fn default() -> Self {
+        Self {
+            stats: RwLock::default(),
+            subfolder_depth: 0,
+            game_folders: Vec::new(),
+            ops: Arc::new(RealFileOps),
+        }
+    }
+}
+
+impl fmt::Debug for StatCache {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.debug_struct("StatCache")
+            .field("stats", &self.stats)
+            .field("subfolder_depth", &self.subfolder_depth)
+            .field("game_folders", &self.game_folders)
+            .finish_non_exhaustive()
+    }
+}
+
+impl StatCache {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// A cache whose listings include subfolders up to `depth` levels down
+    ///
+    /// Hidden folders, `__` folders, the recycle bin and any of `game_folders`
+    /// are not entered. The depth limit also stops symlink loops.
+    pub fn with_subfolders(depth: usize, game_folders: &[PathBuf]) -> Self {
+        Self {
+            subfolder_depth: depth,
+            game_folders: game_folders.to_vec(),
+            ..Self::default()
+        }
+    }
+
+    /// The same cache, listing and reading files through `ops`
+    pub fn with_ops(self, ops: Arc<dyn FileOps + Send>) -> Self {
+        Self { ops, ..self }
+    }
+
+    /// List the files (not directories) inside a folder, caching their stats
+    ///
+    /// Files in subfolders are included when the cache was made
+    /// [`with_subfolders`](Self::with_subfolders).
+    pub fn list_folder(&self, folder: &Path) -> Result<Vec<PathBuf>> {
+        let mut files = Vec::new();
+        let mut stats = Vec::new();
+        self.list_into(folder, 0, &mut files, &mut stats)?;
+
+        self.stats
+            .write()
+            .unwrap_or_else(|e| e.into_inner())
+            .extend(stats);
+        Ok(files)
+    }
+
+    fn list_into(
+        &self,
+        folder: &Path,
+        depth: usize,
+        files: &mut Vec<PathBuf>,
+        stats: &mut Vec<(PathBuf, FileStat)>,
+    ) -> Result<()> {
+        let entries = self
+            .ops
+            .read_dir(folder)
+            .with_context(|| format!("Failed to read directory: {:?}", folder))?;
+
+        for (path, info) in entries {
+            if info.as_ref().is_ok_and(|info| info.is_dir) {
+                if depth < self.subfolder_depth && self.enters(&path) {
+                    // A subfolder that can't be read doesn't fail the whole listing
+                    if let Err(e) = self.list_into(&path, depth + 1, files, stats) {
+                        log::warn!("Failed to read subfolder {:?}: {:#}", path, e);
+                    }
+                }
+                continue;
+            }
+            // A file removed since read_dir is left for `stat` to report
+            if let Ok(info) = info {
+                stats.push((path.clone(), info.into()));
+            }
+            files.push(path);
+        }
+        Ok(())
+    }
+
+    /// Whether a subfolder is listed along with its parent
+    fn enters(&self, path: &Path) -> bool {
+        let name = path
+            .file_name()
+            .map(|n| n.to_string_lossy())
+            .unwrap_or_default();
+        !is_hidden_folder(&name)
+            && name != RECYCLE_BIN_DIR_NAME
+            && !self.game_folders.iter().any(|f| f == path)
+    }
+
+    /// Stat of a file, from the cache or read from disk
+    pub fn stat(&self, path: &Path) -> io::Result<FileStat> {
+        let cached = self
+            .stats
+            .read()
+            .unwrap_or_else(|e| e.into_inner())
+            .get(path)
+            .copied();
+        if let Some(stat) = cached {
+            return Ok(stat);
+        }
+
+        let stat = FileStat::from(self.ops.metadata(path)?);
+        self.stats
+            .write()
+            .unwrap_or_else(|e| e.into_inner())
+            .insert(path.to_path_buf(), stat);
+        Ok(stat)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::core::fsops::MemoryFileOps;
+    use std::fs;
+    use tempfile::tempdir;
+
+    #[test]
+    fn test_stat_cache() {
+        let dir = tempdir().unwrap();
+        let file = dir.path().join("SkyUI-12604-5-2-1700000000.7z");
+        fs::write(&file, b"archive").unwrap();
+        fs::create_dir(dir.path().join("WLC_RecycleBin")).unwrap();
+
+        let cache = StatCache::new();
+        assert_eq!(cache.list_folder(dir.path()).unwrap(), vec![file.clone()]);
+
+        // Served from the listing even once the file is gone
+        fs::remove_file(&file).unwrap();
+        assert_eq!(cache.stat(&file).unwrap().size, 7);
+        assert!(StatCache::new().stat(&file).is_err());
+    }
+
+    #[test]
+    fn test_list_folder_with_subfolders() {
+        let dir = tempdir().unwrap();
+        let top = dir.path().join("Top-1-1-0-1.7z");
+        let nested = dir.path().join("Author").join("Nested-2-1-0-1.7z");
+        let deep = dir
+            .path()
+            .join("Author")
+            .join("Old")
+            .join("Deep-3-1-0-1.7z");
+        fs::create_dir_all(deep.parent().unwrap()).unwrap();
+        fs::create_dir_all(dir.path().join("WLC_RecycleBin")).unwrap();
+        fs::create_dir_all(dir.path().join("__temp")).unwrap();
+        for file in [&top, &nested, &deep] {
+            fs::write(file, b"archive").unwrap();
+        }
+        fs::write(
+            dir.path().join("WLC_RecycleBin").join("Moved-4-1-0-1.7z"),
+            b"x",
+        )
+        .unwrap();
+        fs::write(dir.path().join("__temp").join("Hidden-5-1-0-1.7z"), b"x").unwrap();
+
+        let sorted = |cache: StatCache| {
+            let mut files = cache.list_folder(dir.path()).unwrap();
+            files.sort();
+            files
+        };
+        assert_eq!(sorted(StatCache::new()), vec![top.clone()]);
+        assert_eq!(
+            sorted(StatCache::with_subfolders(1, &[])),
+            vec![nested.clone(), top.clone()]
+        );
+        assert_eq!(
+            sorted(StatCache::with_subfolders(5, &[])),
+            vec![nested.clone(), deep.clone(), top.clone()]
+        );
+
+        // A subfolder scanned as a game folder of its own isn't entered
+        let author = dir.path().join("Author");
+        assert_eq!(sorted(StatCache::with_subfolders(5, &[author])), vec![top]);
+    }
+
+    #[test]
+    fn test_list_folder_in_memory() {
+        let dir = Path::new("/downloads/Skyrim");
+        let top = dir.join("Top-1-1-0-1.7z");
+        let nested = dir.join("Author").join("Nested-2-1-0-1.7z");
+        let ops = MemoryFileOps::new();
+        ops.add(&top, b"archive", Some(1));
+        ops.add(&nested, b"nested archive", Some(2));
+
+        let cache = StatCache::with_subfolders(1, &[]).with_ops(Arc::new(ops));
+        let mut files = cache.list_folder(dir).unwrap();
+        files.sort();
+        assert_eq!(files, vec![nested.clone(), top.clone()]);
+        assert_eq!(
+            cache.stat(&nested).unwrap(),
+            FileStat {
+                size: 14,
+                modified: Some(2)
+            }
+        );
+        assert!(cache.list_folder(Path::new("/missing")).is_err());
+    }
+}
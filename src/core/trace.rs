@@ -0,0 +1,89 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+//! Per-file decision trace for diagnosing the cleanup heuristics
+//!
+//! Off by default. Once `start_trace` opens a file, every decision about an
+//! archive (how its name parsed, its group, each safety check's verdict and
+//! the final action) is appended as one JSON object per line, separate from
+//! the main log.
+
+use std::fs::File;
+use std::io::{self, LineWriter, Write};
+use std::path::Path;
+use std::sync::{Mutex, OnceLock};
+
+static TRACE: OnceLock<Mutex<LineWriter<File>>> = OnceLock::new();
+
+/// Write decision records to `path` for the rest of the run
+pub fn start_trace(path: &Path) -> io::Result<()> {
+    let file = File::create(path)?;
+    if TRACE.set(Mutex::new(LineWriter::new(file))).is_err() {
+        return Err(io::Error::new(
+            io::ErrorKind::AlreadyExists,
+            "trace file is already open",
+        ));
+    }
+    Ok(())
+}
+
+/// Whether decisions are being traced; check before building expensive details
+pub fn trace_enabled() -> bool {
+    TRACE.get().is_some()
+}
+
+/// Record one decision about a file
+///
+/// `stage` names the step (parse, group, check, orphan, action) and
+/// `verdict` its outcome. Does nothing unless tracing was started.
+pub fn trace(file: &str, stage: &str, verdict: &str, detail: &str) {
+    let Some(trace) = TRACE.get() else {
+        return;
+    };
+    let record = trace_record(file, stage, verdict, detail);
+    if let Ok(mut w) = trace.lock() {
+        if let Err(e) = writeln!(w, "{}", record) {
+            log::warn!("Failed to write trace record: {}", e);
+        }
+    }
+}
+
+fn trace_record(file: &str, stage: &str, verdict: &str, detail: &str) -> String {
+    let mut record = serde_json::json!({
+        "time": chrono::Local::now().to_rfc3339(),
+        "file": file,
+        "stage": stage,
+        "verdict": verdict,
+    });
+    if !detail.is_empty() {
+        record["detail"] = detail.into();
+    }
+    record.to_string()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_trace_record() {
+        let record: serde_json::Value = serde_json::from_str(&trace_record(
+            "SkyUI-12604-5-2SE-1600000000.7z",
+            "check",
+            "skipped",
+            "suspicious version pattern",
+        ))
+        .unwrap();
+        assert_eq!(record["stage"], "check");
+        assert_eq!(record["verdict"], "skipped");
+        assert_eq!(record["detail"], "suspicious version pattern");
+
+        let record: serde_json::Value =
+            serde_json::from_str(&trace_record("a.7z", "orphan", "used", "")).unwrap();
+        assert!(record.get("detail").is_none());
+    }
+}
@@ -0,0 +1,198 @@
+// Copyright (C) 2025 Berkay Yetgin
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+//! The desktop trash on Linux and macOS
+//!
+//! Linux follows the XDG trash spec: files go to `$XDG_DATA_HOME/Trash/files`
+//! with a `.trashinfo` recording their original path, so file managers can
+//! restore them. Files on other drives are copied into the home trash rather
+//! than a per-drive `.Trash-$uid` folder. On macOS files are moved to
+//! `~/.Trash`; Finder's "Put Back" isn't available for them.
+
+use std::io;
+use std::path::{Path, PathBuf};
+
+/// Folder trashed files end up in, if this platform has a desktop trash
+#[cfg(target_os = "linux")]
+pub fn system_trash_dir() -> Option<PathBuf> {
+    let data_home = std::env::var_os("XDG_DATA_HOME")
+        .map(PathBuf::from)
+        .filter(|p| p.is_absolute())
+        .or_else(|| std::env::var_os("HOME").map(|home| Path::new(&home).join(".local/share")))?;
+    Some(data_home.join("Trash").join("files"))
+}
+
+/// Folder trashed files end up in, if this platform has a desktop trash
+#[cfg(target_os = "macos")]
+pub fn system_trash_dir() -> Option<PathBuf> {
+    std::env::var_os("HOME").map(|home| Path::new(&home).join(".Trash"))
+}
+
+/// Folder trashed files end up in, if this platform has a desktop trash
+#[cfg(not(any(target_os = "linux", target_os = "macos")))]
+pub fn system_trash_dir() -> Option<PathBuf> {
+    None
+}
+
+/// Check if `dir` is the desktop trash rather than a plain backup folder
+pub fn is_system_trash(dir: &Path) -> bool {
+    system_trash_dir().is_some_and(|trash| trash == dir)
+}
+
+/// Move a file to the desktop trash, returning where it ended up
+#[cfg(target_os = "linux")]
+pub fn move_to_trash(path: &Path) -> io::Result<PathBuf> {
+    let files_dir = system_trash_dir().ok_or_else(|| io::Error::other("No home folder"))?;
+    move_to_trash_in(&files_dir, path)
+}
+
+/// Move a file into the trash whose `files` folder is `files_dir`
+#[cfg(target_os = "linux")]
+fn move_to_trash_in(files_dir: &Path, path: &Path) -> io::Result<PathBuf> {
+    use std::fs;
+    use std::io::Write;
+
+    let info_dir = files_dir.with_file_name("info");
+    fs::create_dir_all(files_dir)?;
+    fs::create_dir_all(&info_dir)?;
+
+    let original = std::path::absolute(path)?;
+    let name = file_name(path)?;
+
+    // Creating the .trashinfo first reserves the name against other trashers
+    for attempt in 0.. {
+        let trashed_name = numbered_name(&name, attempt);
+        let info_path = info_dir.join(format!("{}.trashinfo", trashed_name));
+        let dest = files_dir.join(&trashed_name);
+        if dest.exists() {
+            continue;
+        }
+        let mut info = match fs::OpenOptions::new()
+            .write(true)
+            .create_new(true)
+            .open(&info_path)
+        {
+            Ok(file) => file,
+            Err(e) if e.kind() == io::ErrorKind::AlreadyExists => continue,
+            Err(e) => return Err(e),
+        };
+
+        let written = write!(
+            info,
+            "[Trash Info]\nPath={}\nDeletionDate={}\n",
+            encode_path(&original),
+            chrono::Local::now().format("%Y-%m-%dT%H:%M:%S")
+        );
+        let moved = written.and_then(|_| crate::core::cleaner::move_file(path, &dest));
+        if let Err(e) = moved {
+            let _ = fs::remove_file(&info_path);
+            return Err(e);
+        }
+        return Ok(dest);
+    }
+    unreachable!("the attempt counter is unbounded")
+}
+
+/// Move a file to the desktop trash, returning where it ended up
+#[cfg(target_os = "macos")]
+pub fn move_to_trash(path: &Path) -> io::Result<PathBuf> {
+    let trash = system_trash_dir().ok_or_else(|| io::Error::other("No home folder"))?;
+    let name = file_name(path)?;
+    for attempt in 0.. {
+        let dest = trash.join(numbered_name(&name, attempt));
+        if !dest.exists() {
+            crate::core::cleaner::move_file(path, &dest)?;
+            return Ok(dest);
+        }
+    }
+    unreachable!("the attempt counter is unbounded")
+}
+
+/// Move a file to the desktop trash, returning where it ended up
+#[cfg(not(any(target_os = "linux", target_os = "macos")))]
+pub fn move_to_trash(_path: &Path) -> io::Result<PathBuf> {
+    Err(io::Error::new(
+        io::ErrorKind::Unsupported,
+        "No desktop trash on this platform",
+    ))
+}
+
+#[cfg(any(target_os = "linux", target_os = "macos"))]
+fn file_name(path: &Path) -> io::Result<String> {
+    path.file_name()
+        .map(|n| n.to_string_lossy().to_string())
+        .ok_or_else(|| io::Error::other(format!("Not a file: {:?}", path)))
+}
+
+/// "Mod.7z", then "Mod.2.7z", "Mod.3.7z"... for names already in the trash
+#[cfg(any(target_os = "linux", target_os = "macos", test))]
+fn numbered_name(name: &str, attempt: u32) -> String {
+    if attempt == 0 {
+        return name.to_string();
+    }
+    match name.rsplit_once('.') {
+        Some((stem, ext)) if !stem.is_empty() => format!("{}.{}.{}", stem, attempt + 1, ext),
+        _ => format!("{}.{}", name, attempt + 1),
+    }
+}
+
+/// Percent-encode a path for the `Path=` key of a `.trashinfo` file
+#[cfg(any(target_os = "linux", test))]
+fn encode_path(path: &Path) -> String {
+    let mut encoded = String::new();
+    for byte in path.to_string_lossy().bytes() {
+        match byte {
+            b'A'..=b'Z' | b'a'..=b'z' | b'0'..=b'9' | b'-' | b'_' | b'.' | b'~' | b'/' => {
+                encoded.push(byte as char)
+            }
+            _ => encoded.push_str(&format!("%{:02X}", byte)),
+        }
+    }
+    encoded
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_trash_names() {
+        assert_eq!(numbered_name("SkyUI-12604.7z", 0), "SkyUI-12604.7z");
+        assert_eq!(numbered_name("SkyUI-12604.7z", 1), "SkyUI-12604.2.7z");
+        assert_eq!(numbered_name("README", 2), "README.3");
+        assert_eq!(
+            encode_path(Path::new("/mnt/Mods/Sky UI (SE)-12604.7z")),
+            "/mnt/Mods/Sky%20UI%20%28SE%29-12604.7z"
+        );
+    }
+
+    #[cfg(target_os = "linux")]
+    #[test]
+    fn test_move_to_trash() {
+        let dir = tempfile::tempdir().unwrap();
+        let trash = dir.path().join("data").join("Trash").join("files");
+
+        let file = dir.path().join("Sky UI-12604.7z");
+        std::fs::write(&file, b"archive").unwrap();
+        let first = move_to_trash_in(&trash, &file).unwrap();
+        std::fs::write(&file, b"archive").unwrap();
+        let second = move_to_trash_in(&trash, &file).unwrap();
+
+        assert!(!file.exists());
+        assert_eq!(first, trash.join("Sky UI-12604.7z"));
+        assert_eq!(second, trash.join("Sky UI-12604.2.7z"));
+        let info = std::fs::read_to_string(
+            trash
+                .with_file_name("info")
+                .join("Sky UI-12604.2.7z.trashinfo"),
+        )
+        .unwrap();
+        assert!(info.starts_with("[Trash Info]\n"));
+        assert!(info.contains(&format!("Path={}\n", encode_path(&file))));
+        assert!(info.contains("DeletionDate="));
+    }
+}
@@ -5,11 +5,13 @@
 // the Free Software Foundation, either version 3 of the License, or
 // (at your option) any later version.
 
-use std::collections::HashSet;
+use std::collections::{HashMap, HashSet};
 use std::path::PathBuf;
 
+use serde::{Deserialize, Serialize};
+
 /// Represents a parsed mod file from the downloads folder
-#[derive(Debug, Clone)]
+#[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct ModFile {
     pub file_name: String,
     pub full_path: PathBuf,
@@ -20,23 +22,115 @@ pub struct ModFile {
     pub timestamp: String,
     pub size: u64,
     pub is_patch: bool,
+    /// Modification time in seconds since the Unix epoch, recorded at scan time
+    #[serde(default)]
+    pub modified: Option<u64>,
+}
+
+/// Modification time of a file in seconds since the Unix epoch
+pub fn modified_secs(metadata: &std::fs::Metadata) -> Option<u64> {
+    metadata
+        .modified()
+        .ok()?
+        .duration_since(std::time::UNIX_EPOCH)
+        .ok()
+        .map(|d| d.as_secs())
 }
 
 /// Represents a group of mod versions (same mod, different versions)
 #[derive(Debug, Clone)]
 pub struct ModGroup {
     pub mod_key: String,
+    /// Files sorted oldest first, except that files kept by a pin or by
+    /// keeping the oldest versions are moved to the end
     pub files: Vec<ModFile>,
+    /// Index of the oldest file to keep; every file before it is deleted
     pub newest_idx: usize,
     pub space_to_free: u64,
 }
 
+/// How the old version scan decides which files are versions of the same mod
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub enum GroupStrategy {
+    /// ModID, normalized mod name, and part and option indicators
+    #[default]
+    NameAware,
+    /// ModID alone; for libraries whose ModIDs are reliable
+    ModId,
+    /// ModID and Nexus FileID, falling back to name-aware without a FileID
+    ModIdFileId,
+    /// Normalized mod name and indicators alone; for non-Nexus archives
+    NameOnly,
+}
+
+impl GroupStrategy {
+    pub const ALL: [GroupStrategy; 4] = [
+        GroupStrategy::NameAware,
+        GroupStrategy::ModId,
+        GroupStrategy::ModIdFileId,
+        GroupStrategy::NameOnly,
+    ];
+
+    pub fn label(&self) -> &'static str {
+        match self {
+            GroupStrategy::NameAware => "ModID + name",
+            GroupStrategy::ModId => "ModID only",
+            GroupStrategy::ModIdFileId => "ModID + FileID",
+            GroupStrategy::NameOnly => "Name only",
+        }
+    }
+}
+
+/// Which versions of each mod old version cleanups keep
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub enum KeepOrder {
+    #[default]
+    Newest,
+    /// For modlists pinned to the first release they were built with
+    Oldest,
+}
+
+impl KeepOrder {
+    pub const ALL: [KeepOrder; 2] = [KeepOrder::Newest, KeepOrder::Oldest];
+
+    pub fn label(&self) -> &'static str {
+        match self {
+            KeepOrder::Newest => "Newest",
+            KeepOrder::Oldest => "Oldest",
+        }
+    }
+}
+
+/// What decides which of a mod's files is the newest
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum NewestBy {
+    /// The upload timestamp in the file name
+    #[default]
+    Filename,
+    /// The file's modification time, for names whose timestamp is stale
+    Mtime,
+}
+
+impl NewestBy {
+    pub const ALL: [NewestBy; 2] = [NewestBy::Filename, NewestBy::Mtime];
+
+    pub fn label(&self) -> &'static str {
+        match self {
+            NewestBy::Filename => "Name timestamp",
+            NewestBy::Mtime => "Modified time",
+        }
+    }
+}
+
 /// Information about a parsed .wabbajack modlist file
-#[derive(Debug, Clone)]
+#[derive(Debug, Clone, Default)]
 pub struct ModlistInfo {
     #[allow(dead_code)]
     pub file_path: PathBuf,
     pub name: String,
+    /// Game the modlist is built for
+    pub game: Option<String>,
     pub mod_count: usize,
     /// ModID-based keys for quick lookup (backward compatibility)
     pub used_mod_keys: HashSet<String>,
@@ -44,6 +138,115 @@ pub struct ModlistInfo {
     pub used_mod_file_ids: HashSet<String>,
     /// Exact file names from the modlist for precise matching
     pub used_file_names: HashSet<String>,
+    /// Archive file name -> game the modlist downloads it for
+    pub archive_games: HashMap<String, String>,
+    /// Archive file name -> content hash recorded by Wabbajack
+    pub archive_hashes: HashMap<String, String>,
+    /// Archive file name -> download size in bytes
+    pub archive_sizes: HashMap<String, u64>,
+    /// Nexus archives the modlist downloads
+    pub archives: Vec<ExpectedArchive>,
+    /// Short description written by the author
+    pub description: Option<String>,
+    /// Start of the bundled readme, or the readme link when none is bundled
+    pub readme: Option<String>,
+    /// Encoded modlist image from the .wabbajack file
+    pub image: Option<Vec<u8>>,
+}
+
+/// A Nexus archive listed in a modlist, with the file and version it expects
+#[derive(Debug, Clone)]
+pub struct ExpectedArchive {
+    pub file_name: String,
+    pub mod_id: String,
+    pub file_id: Option<String>,
+    pub version: Option<String>,
+}
+
+/// How a download on disk compares with the archive a modlist expects
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum VersionDriftKind {
+    /// The same file the modlist downloads
+    Matching,
+    /// Older than the modlist expects; Wabbajack would download the newer file
+    Older,
+    /// Newer than the modlist expects; the modlist doesn't reference it
+    Newer,
+    /// Neither FileIDs, versions nor timestamps could be compared
+    Unknown,
+}
+
+/// Downloads on disk for one archive a modlist expects
+#[derive(Debug, Clone)]
+pub struct VersionDrift {
+    pub expected: ExpectedArchive,
+    pub mod_name: String,
+    /// Empty when no version of the mod is on disk
+    pub on_disk: Vec<(ModFile, VersionDriftKind)>,
+}
+
+/// A mod a modlist expects whose downloads on disk are all other files
+#[derive(Debug, Clone)]
+pub struct VersionMismatch {
+    pub modlist: String,
+    pub mod_name: String,
+    pub expected: ExpectedArchive,
+    pub on_disk: Vec<ModFile>,
+}
+
+/// How a used archive was matched to a modlist, strongest first
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+pub enum MatchKind {
+    /// The modlist references this exact file name
+    FileName,
+    /// The archive's `.meta` hash matches one the modlist records
+    Hash,
+    /// The modlist references the same Nexus ModID and FileID
+    FileId,
+    /// The modlist only references the same Nexus ModID
+    ModId,
+    /// The modlist references this file name with a different case or underscores
+    SimilarName,
+}
+
+impl MatchKind {
+    pub fn label(&self) -> &'static str {
+        match self {
+            MatchKind::FileName => "file name",
+            MatchKind::FileId => "FileID",
+            MatchKind::ModId => "ModID",
+            MatchKind::Hash => "hash",
+            MatchKind::SimilarName => "similar file name",
+        }
+    }
+}
+
+/// A modlist that references a used archive, and how
+#[derive(Debug, Clone, PartialEq)]
+pub struct KeepReason {
+    pub modlist: String,
+    pub kind: MatchKind,
+}
+
+/// Archives only one active modlist references, which dropping it would orphan
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct ModlistFootprint {
+    pub modlist: String,
+    pub files: usize,
+    pub size: u64,
+}
+
+/// A modlist that references an archive, with the file it downloads
+#[derive(Debug, Clone, PartialEq)]
+pub struct ModlistUse {
+    pub modlist: String,
+    pub kind: MatchKind,
+    /// Version the modlist downloads, when it records one
+    pub expected_version: Option<String>,
+    /// Nexus FileID the modlist downloads, when it records one
+    pub expected_file_id: Option<String>,
+    /// The modlist downloads a different FileID than the file on disk
+    pub other_file_id: bool,
 }
 
 /// Represents a mod file that's not used by any active modlist
@@ -52,24 +255,261 @@ pub struct OrphanedMod {
     pub file: ModFile,
 }
 
-/// Archive extensions supported by Wabbajack
-pub const ARCHIVE_EXTENSIONS: &[&str] = &[".7z", ".zip", ".rar", ".tar", ".gz", ".exe"];
+/// An archive that belongs to a game with no game folder and no active modlist
+#[derive(Debug, Clone)]
+pub struct ForeignGameMod {
+    pub file: ModFile,
+    pub game: String,
+}
 
-/// Result of a scan operation
+/// A mod whose files are spread over more than one game folder
+#[derive(Debug, Clone)]
+pub struct FragmentedMod {
+    pub mod_id: String,
+    pub mod_name: String,
+    pub folders: Vec<PathBuf>,
+    pub files: Vec<ModFile>,
+}
+
+/// Used archives with different paths but the same content hash
+#[derive(Debug, Clone)]
+pub struct IdenticalArchives {
+    pub hash: String,
+    /// Sorted by path; the first file is the one to keep
+    pub files: Vec<ModFile>,
+    /// Space freed by keeping only one copy
+    pub reclaimable: u64,
+}
+
+/// The same archive downloaded into more than one folder
+///
+/// Copies share a ModID, FileID (or file name, when there's no FileID) and size.
+#[derive(Debug, Clone)]
+pub struct CrossFolderDuplicate {
+    pub mod_id: String,
+    pub file_id: Option<String>,
+    pub size: u64,
+    /// The first file is the one to keep
+    pub files: Vec<ModFile>,
+    /// Space freed by keeping only one copy
+    pub reclaimable: u64,
+}
+
+impl CrossFolderDuplicate {
+    /// The copies as an old version group that keeps the first file, so they
+    /// go through the same safety checks when deleted
+    pub fn to_group(&self) -> ModGroup {
+        let mut files = self.files[1..].to_vec();
+        files.push(self.files[0].clone());
+        ModGroup {
+            mod_key: format!("{}:{}", self.mod_id, self.files[0].file_name),
+            newest_idx: files.len() - 1,
+            files,
+            space_to_free: self.reclaimable,
+        }
+    }
+}
+
+/// Files with byte-identical contents, whatever their names
+///
+/// Found by size, then confirmed by content hash.
 #[derive(Debug, Clone)]
+pub struct IdenticalFiles {
+    pub hash: String,
+    pub size: u64,
+    /// The first file, the one with the newest timestamp, is the one to keep
+    pub files: Vec<ModFile>,
+    /// Space freed by keeping only one copy
+    pub reclaimable: u64,
+}
+
+impl IdenticalFiles {
+    /// The copies as an old version group that keeps the first file, so they
+    /// go through the same safety checks when deleted
+    pub fn to_group(&self) -> ModGroup {
+        let mut files = self.files[1..].to_vec();
+        files.push(self.files[0].clone());
+        ModGroup {
+            mod_key: format!("identical:{}", self.files[0].file_name),
+            newest_idx: files.len() - 1,
+            files,
+            space_to_free: self.reclaimable,
+        }
+    }
+}
+
+/// A content hash some modlist needs that no file on disk provides
+#[derive(Debug, Clone)]
+pub struct MissingArchive {
+    pub hash: String,
+    pub file_name: String,
+    /// Download size recorded by the modlist, 0 when unknown
+    pub size: u64,
+    /// Names of the modlists that need it
+    pub modlists: Vec<String>,
+}
+
+/// Every archive on disk checked against the hashes the modlists need
+#[derive(Debug, Clone, Default)]
+pub struct LibraryAudit {
+    /// Files whose hash some modlist needs
+    pub kept: Vec<ModFile>,
+    /// Files whose hash no modlist needs
+    pub orphaned: Vec<ModFile>,
+    /// Files with no hash in their `.meta` and a name no modlist expects
+    pub unhashed: Vec<ModFile>,
+    pub missing: Vec<MissingArchive>,
+    pub kept_size: u64,
+    pub orphaned_size: u64,
+    /// Distinct archives the modlists need
+    pub needed: usize,
+    /// Bytes a fresh install would still have to download
+    pub missing_size: u64,
+}
+
+impl LibraryAudit {
+    /// Needed archives already on disk
+    pub fn found(&self) -> usize {
+        self.needed - self.missing.len()
+    }
+}
+
+/// Archive extensions recognized unless the config lists its own
+///
+/// Compressed tarballs like `.tar.zst` are matched through their last extension.
+pub const ARCHIVE_EXTENSIONS: &[&str] = &[
+    ".7z", ".zip", ".rar", ".tar", ".gz", ".zst", ".bz2", ".xz", ".exe",
+];
+
+/// Result of a scan operation
+#[derive(Debug, Clone, Default)]
 pub struct ScanResult {
     pub used_mods: Vec<ModFile>,
     pub orphaned_mods: Vec<OrphanedMod>,
     pub used_size: u64,
     pub orphaned_size: u64,
+    /// Leftovers from games that have neither a game folder nor an active modlist
+    pub foreign_game_mods: Vec<ForeignGameMod>,
+    /// Orphaned patch files whose main file isn't on disk either
+    pub orphaned_patches: Vec<OrphanedMod>,
+    /// Mods with files in more than one game folder
+    pub fragmented_mods: Vec<FragmentedMod>,
+    /// Used archives downloaded more than once under different paths
+    pub identical_archives: Vec<IdenticalArchives>,
+    /// Modlists referencing each used archive, by path
+    pub keep_reasons: HashMap<PathBuf, Vec<KeepReason>>,
+    /// Orphans left out of `orphaned_mods` for being under the minimum size
+    pub small_orphans: usize,
+    pub small_orphans_size: u64,
+}
+
+impl ScanResult {
+    /// Drop orphans smaller than `min_size` bytes, counting them as skipped
+    pub fn skip_small_orphans(&mut self, min_size: u64) {
+        self.orphaned_mods.retain(|m| {
+            let small = m.file.size < min_size;
+            if small {
+                self.small_orphans += 1;
+                self.small_orphans_size += m.file.size;
+            }
+            !small
+        });
+        self.orphaned_size = self.orphaned_mods.iter().map(|m| m.file.size).sum();
+    }
 }
 
 /// Result of old version scan
-#[derive(Debug, Clone)]
+#[derive(Debug, Clone, Default)]
 pub struct OldVersionScanResult {
     pub duplicates: Vec<ModGroup>,
     pub total_files: usize,
     pub total_space: u64,
+    /// Files that were listed but disappeared before they could be read
+    pub vanished_files: Vec<String>,
+    /// Mod keys whose files were split into separate groups by version scheme
+    pub split_groups: Vec<String>,
+    /// Files left out because their names couldn't be parsed
+    pub skipped_files: Vec<SkippedFile>,
+    /// Mod keys of groups only the suspicious version heuristics flagged.
+    /// Their old versions are kept unless the scan was aggressive.
+    pub heuristic_groups: Vec<String>,
+}
+
+impl OldVersionScanResult {
+    /// Recount the files and space to free after groups were trimmed
+    pub fn update_totals(&mut self) {
+        self.total_files = self.duplicates.iter().map(|g| g.newest_idx).sum();
+        self.total_space = self.duplicates.iter().map(|g| g.space_to_free).sum();
+    }
+}
+
+/// Why the old version scan left a file out
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, PartialOrd, Ord, Serialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum SkipReason {
+    /// Too few dash-separated parts for `Name-ModID-Version-Timestamp`
+    NoDash,
+    /// No 3 to 6 digit ModID in the name or its `.meta`
+    NoModId,
+    /// The name doesn't end in an upload timestamp
+    NoTimestamp,
+    /// Not one of the archive extensions scanned
+    BadExtension,
+    /// A download still in progress or an editor's temporary file
+    TempFile,
+}
+
+impl SkipReason {
+    pub const ALL: [SkipReason; 5] = [
+        SkipReason::NoDash,
+        SkipReason::NoModId,
+        SkipReason::NoTimestamp,
+        SkipReason::BadExtension,
+        SkipReason::TempFile,
+    ];
+
+    /// Short code used in reports and JSON
+    pub fn code(&self) -> &'static str {
+        match self {
+            SkipReason::NoDash => "no-dash",
+            SkipReason::NoModId => "no-modid",
+            SkipReason::NoTimestamp => "no-timestamp",
+            SkipReason::BadExtension => "bad-extension",
+            SkipReason::TempFile => "temp-file",
+        }
+    }
+}
+
+/// A file the old version scan left out, and why
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct SkippedFile {
+    pub path: PathBuf,
+    pub reason: SkipReason,
+}
+
+/// Unified deletion plan from one combined orphan and old version scan
+#[derive(Debug, Clone, Default)]
+pub struct CleanupPlan {
+    /// Archives no selected modlist uses; deleted entirely
+    pub orphaned_mods: Vec<OrphanedMod>,
+    /// Groups of used archives trimmed to the newest `keep_versions` files
+    pub old_versions: Vec<ModGroup>,
+    pub keep_versions: usize,
+    pub orphaned_size: u64,
+    pub old_version_files: usize,
+    pub old_version_size: u64,
+    /// Space the user asked to free, if the plan was trimmed to a target
+    pub target: Option<u64>,
+}
+
+impl CleanupPlan {
+    pub fn total_files(&self) -> usize {
+        self.orphaned_mods.len() + self.old_version_files
+    }
+
+    pub fn total_size(&self) -> u64 {
+        self.orphaned_size + self.old_version_size
+    }
 }
 
 /// Deletion result
@@ -78,9 +518,38 @@ pub struct DeletionResult {
     pub deleted_count: usize,
     pub space_freed: u64,
     pub skipped: Vec<String>,
+    /// Problems not tied to one file, such as a recycle bin folder that can't be created
     pub errors: Vec<String>,
+    /// Files that couldn't be deleted or moved, with the reason
+    pub failed: Vec<(PathBuf, String)>,
     /// Path to the recycle bin folder used, if files were moved instead of deleted
     pub recycle_bin_path: Option<PathBuf>,
+    /// Every file deleted or moved, with its size
+    pub removed: Vec<(PathBuf, u64)>,
+    /// Every file moved into the recycle bin folder, including each part of a
+    /// multi-part archive, with the path it was moved to
+    pub backed_up: Vec<(PathBuf, PathBuf)>,
+    /// Files kept by each old version group that had files removed, by mod key
+    pub kept: Vec<(String, Vec<PathBuf>)>,
+}
+
+impl DeletionResult {
+    /// Whether any file or step failed
+    pub fn has_failures(&self) -> bool {
+        !self.errors.is_empty() || !self.failed.is_empty()
+    }
+}
+
+/// Space used by one game folder
+#[derive(Debug, Clone, Default)]
+pub struct GameStats {
+    pub game: String,
+    pub files: usize,
+    pub size: u64,
+    /// Bytes an old version cleanup keeping one version per mod would free
+    pub old_version_bytes: u64,
+    /// File name and size of the largest archive in the folder
+    pub largest: Option<(String, u64)>,
 }
 
 /// Statistics about the mod library
@@ -88,5 +557,38 @@ pub struct DeletionResult {
 pub struct LibraryStats {
     pub total_files: usize,
     pub total_size: u64,
-    pub by_game: Vec<(String, usize, u64)>,
+    /// Game folders, largest first
+    pub by_game: Vec<GameStats>,
+    /// Uncompressed footprint of the library, only calculated on request.
+    /// Zip entries are summed; other archive formats count at their on-disk size.
+    pub uncompressed_size: Option<u64>,
+    /// Estimated (old version, orphaned) bytes a combined clean would free.
+    /// Only calculated when modlists are selected.
+    pub reclaimable: Option<(u64, u64)>,
+    /// Free space on the downloads drive
+    pub free_space: Option<u64>,
+}
+
+impl LibraryStats {
+    /// Estimated old version bytes across all game folders
+    pub fn old_version_bytes(&self) -> u64 {
+        self.by_game.iter().map(|g| g.old_version_bytes).sum()
+    }
+
+    /// Bytes a cleanup could free: old versions and orphans when the orphan
+    /// estimate was made, otherwise old versions alone
+    pub fn reclaimable_bytes(&self) -> u64 {
+        match self.reclaimable {
+            Some((old_bytes, orphan_bytes)) => old_bytes + orphan_bytes,
+            None => self.old_version_bytes(),
+        }
+    }
+
+    /// Reclaimable bytes as a percentage of the library's size
+    pub fn reclaimable_percent(&self) -> f64 {
+        if self.total_size == 0 {
+            return 0.0;
+        }
+        self.reclaimable_bytes() as f64 * 100.0 / self.total_size as f64
+    }
 }
@@ -3,22 +3,55 @@
 
 //! Single-page GUI for Wabbajack Library Cleaner
 
-use std::path::PathBuf;
+use std::collections::{HashMap, HashSet};
+use std::io::Write;
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicBool, Ordering};
 use std::sync::mpsc::{channel, Receiver, Sender};
+use std::sync::Arc;
 use std::thread;
+use std::time::SystemTime;
 
 use eframe::egui;
 use egui::{Color32, RichText, Rounding, Vec2};
 
 use crate::core::{
-    calculate_library_stats, delete_old_versions, delete_orphaned_mods, detect_orphaned_mods,
-    find_wabbajack_files, format_size, get_all_mod_files, get_game_folders, parse_wabbajack_file,
-    scan_folder_for_duplicates, DeletionResult, LibraryStats, ModlistInfo, OldVersionScanResult,
-    ScanResult,
+    accessed_within, apply_name_repairs, audit_library, audit_modlist_versions, backup_preview,
+    calculate_library_stats_cached, check_backup_space, check_cleanup_permissions,
+    choose_backup_root, delete_cleanup_plan, delete_meta_files, delete_old_versions,
+    delete_orphaned_mods, describe_modlist_use, describe_version_mismatch,
+    detect_cross_folder_duplicates, detect_foreign_game_mods, detect_fragmented_mods,
+    detect_identical_archives, detect_identical_files, detect_orphaned_mods_by_game,
+    download_summary, estimate_reclaimable_cached, exclude_in_use, exclude_in_use_groups,
+    exclude_in_use_orphans, exclude_last_copies, exclude_last_copy_groups,
+    exclude_last_copy_orphans, exclude_listed, exclude_listed_groups, exclude_listed_orphans,
+    exclude_read_only, exclude_recently_accessed, exclude_recently_accessed_groups,
+    exclude_required, exclude_required_groups, exclude_unchecked_orphans, find_modlist_files,
+    find_orphaned_meta_files, find_protected_archives, folder_links, format_size, free_space,
+    free_space_summary, generic_mod_file, get_all_mod_files_cancellable,
+    get_all_mod_files_resumable, get_game_folders, is_flat_library, is_in_folders, is_mo2_instance,
+    is_system_trash, list_backups, load_mo2_instance, looks_like_wabbajack_install,
+    match_orphans_by_hash, parse_mod_filename, parse_wabbajack_file, plan_cleanup,
+    plan_name_repairs, read_only_folders, reclaimable_headline, recycle_bin_subdir,
+    report_version_drift, require_backup, rescue_orphans_by_hash, resolve_game, restore_backup,
+    restore_files, save_cleanup_report, scan_folder_for_duplicates_with, skip_counts,
+    system_trash_dir, trim_plan_to_target, unique_footprint, which_modlists_use,
+    write_audit_report, write_cross_folder_duplicates, write_duplicates_report,
+    write_identical_files, write_keep_reasons_report, write_orphaned_csv, write_orphaned_report,
+    write_statistics, write_unique_footprints, BackupFolder, CleanupPlan, Config,
+    CrossFolderDuplicate, DeletionResult, DuplicateScanOptions, Exclusions, GameEntry,
+    GroupStrategy, HashCache, IdenticalFiles, KeepOrder, KeepPolicy, LibraryAudit, LibraryStats,
+    ModFile, ModGroup, ModlistFootprint, ModlistInfo, NameRepair, NewestBy, OldVersionScanResult,
+    OrphanedMod, ParseOptions, RestoreResult, ScanProgress, ScanResult, StatCache, VersionDrift,
+    VersionDriftKind, VersionMismatch, DEFAULT_RECYCLE_BIN_TEMPLATE, EXCLUSIONS_FILE_NAME,
+    PINS_FILE_NAME, RECYCLE_BIN_DIR_NAME, RECYCLE_BIN_PLACEHOLDERS, SCAN_CANCELLED,
 };
 
 const APP_VERSION: &str = env!("CARGO_PKG_VERSION");
 
+/// Largest orphans listed in the permanent delete confirmation
+const CONFIRM_EXAMPLES: usize = 10;
+
 // Colors
 const COLOR_BG_MAIN: Color32 = Color32::from_rgb(30, 30, 35);
 const COLOR_BG_CARD: Color32 = Color32::from_rgb(42, 42, 50);
@@ -37,8 +70,21 @@ enum AsyncMessage {
     GameFoldersFound(Vec<PathBuf>),
     OrphanedScanComplete(ScanResult),
     OldVersionScanComplete(OldVersionScanResult),
+    CleanupPlanComplete(CleanupPlan),
     DeletionComplete(DeletionResult),
     StatsComplete(LibraryStats),
+    PermissionsChecked(Vec<String>),
+    VersionDriftComplete(String, Vec<VersionDrift>),
+    VersionAuditComplete(Vec<VersionMismatch>),
+    AuditComplete(LibraryAudit),
+    OrphanedMetaFound(Vec<PathBuf>),
+    CrossFolderDuplicatesFound(Vec<CrossFolderDuplicate>),
+    IdenticalFilesFound(Vec<IdenticalFiles>),
+    NameRepairsPlanned(Vec<NameRepair>),
+    NameRepairsApplied(usize, Vec<String>),
+    RestoreComplete(PathBuf, RestoreResult),
+    Info(String),
+    Warning(String),
     Progress(String, Option<(usize, usize)>),
     Error(String),
 }
@@ -47,6 +93,10 @@ enum AsyncMessage {
 enum DeleteAction {
     Orphaned,
     OldVersions,
+    Combined,
+    MetaFiles,
+    CrossFolderDuplicates,
+    IdenticalFiles,
 }
 
 #[derive(PartialEq, Clone, Copy)]
@@ -55,6 +105,11 @@ enum Modal {
     About,
     FolderSelect,
     ConfirmDelete(DeleteAction),
+    ConfirmRename,
+    NewProfile,
+    RestoreBackup,
+    /// The picked downloads folder looks like the Wabbajack installation
+    ConfirmDownloadsDir,
 }
 
 #[derive(Clone, Copy, PartialEq)]
@@ -72,16 +127,98 @@ pub struct WabbajackCleanerApp {
     game_folders: Vec<PathBuf>,
     selected_game_folder: Option<usize>,
     move_to_recycle_bin: bool,
+    /// Never delete permanently, whatever `move_to_recycle_bin` says
+    safe_mode: bool,
+    use_system_trash: bool,
+    include_uncompressed_size: bool,
+    estimate_orphans: bool,
+    read_only_unmapped_folders: bool,
+    split_version_schemes: bool,
+    group_strategy: GroupStrategy,
+    recycle_bin_template: String,
+    /// Folders on other drives that receive moved old versions
+    backup_roots: Vec<PathBuf>,
+    /// Folder for cleanup reports; `None` saves them next to the moved files
+    cleanup_report_dir: Option<PathBuf>,
+    /// Files accessed within this many days are never deleted; 0 turns it off
+    protect_accessed_days: u32,
+    /// Files modified within this many minutes may still be downloading; 0 turns it off
+    in_use_minutes: u32,
+    /// Hash orphan candidates and keep those a modlist lists by hash
+    hash_unmatched: bool,
+    /// Read a `meta.ini` inside archives nothing else identifies
+    inspect_archives: bool,
+    /// Orphans smaller than this many MB are left alone; 0 turns it off
+    orphan_min_size_mb: u64,
+    /// Levels of subfolders scanned inside each game folder; 0 turns it off
+    subfolder_depth: usize,
+    /// Versions of each used mod kept by the combined clean
+    keep_versions: usize,
+    /// Whether the newest or the oldest versions are kept
+    keep_order: KeepOrder,
+    newest_by: NewestBy,
+    /// Keep old versions whose exact FileID any parsed modlist downloads
+    protect_required_versions: bool,
+    /// Space in GB the combined clean should stop at; 0 frees everything
+    reclaim_target_gb: f64,
     pending_delete_mode: bool,
+    /// Downloads folder waiting for the user to confirm it
+    pending_downloads_dir: Option<PathBuf>,
     tx: Sender<AsyncMessage>,
     rx: Receiver<AsyncMessage>,
     is_loading: bool,
     current_operation: String,
     progress: Option<(usize, usize)>,
+    /// Stops the running scan; only set while a scan that deletes nothing runs
+    scan_cancel: Option<Arc<AtomicBool>>,
+    /// Folder the last cleanup moved files into, for the Show Backup Folder button
+    last_backup_dir: Option<PathBuf>,
+    /// Backup folder and original paths of the last cleanup, while it can be undone
+    undo_cleanup: Option<(PathBuf, Vec<PathBuf>)>,
     stats: Option<LibraryStats>,
     orphaned_result: Option<ScanResult>,
+    /// Orphans unticked in the results list, left alone by the next clean
+    orphans_unchecked: HashSet<PathBuf>,
+    /// What dropping each selected modlist would free, from the last orphan scan
+    modlist_footprints: Vec<ModlistFootprint>,
     old_version_result: Option<OldVersionScanResult>,
+    cleanup_plan: Option<CleanupPlan>,
+    /// Modlist images decoded for the selection list, by modlist name
+    modlist_icons: HashMap<String, Option<egui::TextureHandle>>,
+    /// Index of the modlist compared by the version drift report
+    drift_modlist: usize,
+    /// Modlist name and report of the last version drift comparison
+    version_drift: Option<(String, Vec<VersionDrift>)>,
+    /// Result of the last hash-based library audit
+    library_audit: Option<LibraryAudit>,
+    /// Number of `.meta` files without an archive found by the last search
+    orphaned_meta_count: Option<usize>,
+    /// Archives found in more than one folder by the last search
+    cross_folder_count: Option<usize>,
+    identical_count: Option<usize>,
+    /// Renames previewed by "Repair Names", applied once confirmed
+    name_repairs: Vec<NameRepair>,
+    /// Free space and backup lines shown in the confirm dialog
+    delete_preview: Vec<String>,
+    /// Why the backup drive can't take the cleanup, which keeps it from starting
+    backup_space_error: Option<String>,
+    /// Backups listed by "Restore Backup" and the one picked to restore
+    backups: Vec<BackupFolder>,
+    selected_backup: Option<usize>,
     log_messages: Vec<(String, LogLevel)>,
+    permission_problems: Vec<String>,
+    config: Config,
+    /// Settings as last written to disk, so they're only saved when changed
+    saved_config: Config,
+    new_profile_name: String,
+    /// Reuse folders finished by an interrupted scan (`--resume`)
+    resume: bool,
+    /// Skip the old version safety checks (`--unsafe-delete-all-old`)
+    unsafe_delete_all_old: bool,
+    /// Scan folders starting with `.` or `__` as game folders (`--include-hidden`)
+    include_hidden: bool,
+    /// The user confirmed an unsafe old version clean in the folder dialog
+    unsafe_confirmed: bool,
     modal: Modal,
 }
 
@@ -96,23 +233,77 @@ impl Default for WabbajackCleanerApp {
             game_folders: Vec::new(),
             selected_game_folder: None,
             move_to_recycle_bin: true,
+            safe_mode: true,
+            use_system_trash: false,
+            include_uncompressed_size: false,
+            estimate_orphans: true,
+            read_only_unmapped_folders: false,
+            split_version_schemes: false,
+            group_strategy: GroupStrategy::default(),
+            recycle_bin_template: DEFAULT_RECYCLE_BIN_TEMPLATE.to_string(),
+            backup_roots: Vec::new(),
+            cleanup_report_dir: None,
+            protect_accessed_days: 0,
+            in_use_minutes: 10,
+            hash_unmatched: false,
+            inspect_archives: false,
+            orphan_min_size_mb: 0,
+            subfolder_depth: 0,
+            keep_versions: 1,
+            keep_order: KeepOrder::default(),
+            newest_by: NewestBy::default(),
+            protect_required_versions: true,
+            reclaim_target_gb: 0.0,
             pending_delete_mode: false,
+            pending_downloads_dir: None,
             tx,
             rx,
             is_loading: false,
             current_operation: String::new(),
             progress: None,
+            scan_cancel: None,
+            last_backup_dir: None,
+            undo_cleanup: None,
             stats: None,
             orphaned_result: None,
+            orphans_unchecked: HashSet::new(),
+            modlist_footprints: Vec::new(),
             old_version_result: None,
+            cleanup_plan: None,
+            modlist_icons: HashMap::new(),
+            drift_modlist: 0,
+            version_drift: None,
+            library_audit: None,
+            orphaned_meta_count: None,
+            cross_folder_count: None,
+            identical_count: None,
+            name_repairs: Vec::new(),
+            delete_preview: Vec::new(),
+            backup_space_error: None,
+            backups: Vec::new(),
+            selected_backup: None,
             log_messages: Vec::new(),
+            permission_problems: Vec::new(),
+            config: Config::default(),
+            saved_config: Config::default(),
+            new_profile_name: String::new(),
+            resume: false,
+            unsafe_delete_all_old: false,
+            include_hidden: false,
+            unsafe_confirmed: false,
             modal: Modal::None,
         }
     }
 }
 
 impl WabbajackCleanerApp {
-    pub fn new(cc: &eframe::CreationContext<'_>) -> Self {
+    pub fn new(
+        cc: &eframe::CreationContext<'_>,
+        profile: Option<String>,
+        resume: bool,
+        unsafe_delete_all_old: bool,
+        include_hidden: bool,
+    ) -> Self {
         let mut style = (*cc.egui_ctx.style()).clone();
         style.visuals.dark_mode = true;
         style.visuals.window_rounding = Rounding::same(8.0);
@@ -125,7 +316,50 @@ impl WabbajackCleanerApp {
         style.spacing.item_spacing = Vec2::new(8.0, 6.0);
         style.spacing.button_padding = Vec2::new(12.0, 6.0);
         cc.egui_ctx.set_style(style);
-        Self::default()
+
+        let mut app = Self {
+            config: Config::load(),
+            resume,
+            unsafe_delete_all_old,
+            include_hidden,
+            ..Self::default()
+        };
+        if unsafe_delete_all_old {
+            app.log(
+                LogLevel::Warning,
+                "EXPERT MODE: old version scans skip all safety checks and delete every version but the newest. Patches, variants and optional files may be deleted.",
+            );
+        }
+        if let Some(name) = profile {
+            if !app.config.switch_profile(&name) {
+                app.log(
+                    LogLevel::Warning,
+                    &format!(
+                        "Profile '{}' not found, using '{}'",
+                        name, app.config.active_profile
+                    ),
+                );
+            }
+        }
+        app.apply_profile();
+        app.saved_config = app.config.clone();
+        if !app.config.exclusions.is_empty() {
+            let msg = format!(
+                "Never deleting {} mod(s) and pattern(s) from {}",
+                app.config.exclusions.len(),
+                EXCLUSIONS_FILE_NAME
+            );
+            app.log(LogLevel::Info, &msg);
+        }
+        if !app.config.pins.is_empty() {
+            let msg = format!(
+                "Keeping {} pinned version(s) from {}",
+                app.config.pins.len(),
+                PINS_FILE_NAME
+            );
+            app.log(LogLevel::Info, &msg);
+        }
+        app
     }
 
     fn log(&mut self, level: LogLevel, msg: &str) {
@@ -145,14 +379,203 @@ impl WabbajackCleanerApp {
         self.modlist_selected.iter().filter(|&&x| x).count()
     }
 
-    fn get_recycle_bin_path(&self) -> Option<PathBuf> {
-        if !self.move_to_recycle_bin {
+    /// Versions old version cleanups keep, with the pins from the pins file
+    fn keep_policy(&self) -> KeepPolicy {
+        KeepPolicy {
+            order: self.keep_order,
+            newest_by: self.newest_by,
+            pins: self.config.pins.clone(),
+        }
+    }
+
+    /// How scans read archive names: the extensions from the config, and
+    /// whether to look inside archives
+    fn parse_options(&self) -> ParseOptions {
+        let mut parse = ParseOptions::with_extensions(&self.config.archive_extensions);
+        parse.inspect_archives = self.inspect_archives;
+        parse
+    }
+
+    /// "Keep newest" or "Keep oldest", before the number of versions kept
+    fn keep_label(&self) -> String {
+        format!("Keep {}", self.keep_order.label().to_lowercase())
+    }
+
+    /// Whether cleanups move files rather than deleting them for good
+    fn keeps_backup(&self) -> bool {
+        self.move_to_recycle_bin || self.safe_mode
+    }
+
+    /// Folder for this cleanup inside WLC_RecycleBin, named by the profile's template
+    fn get_recycle_bin_path(&mut self, operation: &str, game: &str) -> Option<PathBuf> {
+        if !self.keeps_backup() {
             return None;
         }
-        self.downloads_dir.as_ref().map(|dir| {
-            let ts = chrono::Local::now().format("%Y-%m-%d_%H-%M-%S");
-            dir.join("WLC_RecycleBin").join(ts.to_string())
-        })
+        if let Some(trash) = self.system_trash() {
+            return Some(trash);
+        }
+        let dir = self.downloads_dir.clone()?;
+        let subdir = self.recycle_bin_folder_name(operation, game)?;
+        Some(dir.join(RECYCLE_BIN_DIR_NAME).join(subdir))
+    }
+
+    /// Stop a cleanup that would delete permanently while safe mode is on
+    fn blocked_by_safe_mode(&mut self, recycle_bin: Option<&Path>) -> bool {
+        match require_backup(self.safe_mode, recycle_bin) {
+            Ok(()) => false,
+            Err(e) => {
+                self.log(LogLevel::Error, &e);
+                self.is_loading = false;
+                true
+            }
+        }
+    }
+
+    /// Open the confirm dialog for `action` with what the last analysis says it frees
+    fn confirm_delete(&mut self, action: DeleteAction) {
+        self.delete_preview.clear();
+        self.backup_space_error = None;
+        if let Some(source) = self.downloads_dir.clone() {
+            self.preview_delete(action, &source);
+        }
+        self.modal = Modal::ConfirmDelete(action);
+    }
+
+    /// Fill in the confirm dialog's free space and backup lines for a cleanup of `source`
+    fn preview_delete(&mut self, action: DeleteAction, source: &Path) {
+        let bytes = match action {
+            DeleteAction::Orphaned => self.orphaned_result.as_ref().map(|res| {
+                res.orphaned_mods
+                    .iter()
+                    .filter(|m| !self.orphans_unchecked.contains(&m.file.full_path))
+                    .map(|m| m.file.size)
+                    .sum()
+            }),
+            DeleteAction::OldVersions => self
+                .old_version_result
+                .as_ref()
+                .map(|res| res.duplicates.iter().map(|g| g.space_to_free).sum()),
+            DeleteAction::Combined => self.cleanup_plan.as_ref().map(|plan| plan.total_size()),
+            DeleteAction::MetaFiles
+            | DeleteAction::CrossFolderDuplicates
+            | DeleteAction::IdenticalFiles => None,
+        };
+        let Some(bytes) = bytes else {
+            match free_space(source) {
+                Ok(free) => self
+                    .delete_preview
+                    .push(format!("Free now: {}", format_size(free))),
+                Err(e) => self.delete_preview.push(format!(
+                    "Failed to read free space on {}: {}",
+                    source.display(),
+                    e
+                )),
+            }
+            self.delete_preview
+                .push("Run Analyze first to see how much this frees.".to_string());
+            return;
+        };
+        let mut dest = match action {
+            DeleteAction::Orphaned => self.get_recycle_bin_path("orphaned", "all"),
+            DeleteAction::OldVersions => self.get_recycle_bin_path("old-versions", "all"),
+            _ => self.get_recycle_bin_path("combined", "all"),
+        };
+        // Old versions go to the backup drive with the most room, if any
+        let backed_up = action == DeleteAction::OldVersions
+            && dest.is_some()
+            && self.system_trash().is_none()
+            && !self.backup_roots.is_empty();
+        if backed_up {
+            match choose_backup_root(&self.backup_roots, bytes) {
+                Ok(root) => dest = Some(root.join(RECYCLE_BIN_DIR_NAME)),
+                Err(e) => self.backup_space_error = Some(e),
+            }
+        }
+        match free_space_summary(source, bytes, dest.is_some() && !backed_up) {
+            Ok(summary) => self.delete_preview.push(summary),
+            Err(e) => self.delete_preview.push(format!(
+                "Failed to read free space on {}: {}",
+                source.display(),
+                e
+            )),
+        }
+        if let Some(dest) = dest.filter(|dir| !is_system_trash(dir)) {
+            self.delete_preview
+                .push(backup_preview(source, &dest, bytes));
+            if let Err(e) = check_backup_space(source, &dest, bytes) {
+                self.backup_space_error.get_or_insert(e);
+            }
+        }
+    }
+
+    /// The desktop trash, when the user prefers it and this platform has one
+    fn system_trash(&self) -> Option<PathBuf> {
+        system_trash_dir().filter(|_| self.use_system_trash)
+    }
+
+    /// This cleanup's folder name from the profile's template
+    fn recycle_bin_folder_name(&mut self, operation: &str, game: &str) -> Option<PathBuf> {
+        let now = chrono::Local::now();
+        match recycle_bin_subdir(&self.recycle_bin_template, operation, game, now) {
+            Ok(subdir) => Some(subdir),
+            Err(e) => {
+                self.log(
+                    LogLevel::Warning,
+                    &format!("{}. Using the default folder name.", e),
+                );
+                recycle_bin_subdir(DEFAULT_RECYCLE_BIN_TEMPLATE, operation, game, now).ok()
+            }
+        }
+    }
+
+    /// Save a record of a finished cleanup for later review
+    fn write_cleanup_report(&mut self, result: &DeletionResult) {
+        if result.removed.is_empty() && !result.has_failures() {
+            return;
+        }
+        let Some(dir) = self
+            .cleanup_report_dir
+            .clone()
+            .or_else(|| {
+                result
+                    .recycle_bin_path
+                    .clone()
+                    .filter(|dir| !is_system_trash(dir))
+            })
+            .or_else(|| self.downloads_dir.clone())
+        else {
+            return;
+        };
+        match save_cleanup_report(&dir, result) {
+            Ok(path) => self.log(
+                LogLevel::Info,
+                &format!("Cleanup report saved to {}", path.display()),
+            ),
+            Err(e) => self.log(
+                LogLevel::Error,
+                &format!("Failed to save cleanup report: {}", e),
+            ),
+        }
+    }
+
+    fn choose_cleanup_report_dir(&mut self) {
+        if let Some(path) = rfd::FileDialog::new()
+            .set_title("Select Folder for Cleanup Reports")
+            .pick_folder()
+        {
+            self.cleanup_report_dir = Some(path);
+        }
+    }
+
+    fn add_backup_root(&mut self) {
+        if let Some(path) = rfd::FileDialog::new()
+            .set_title("Select Backup Folder for Old Versions")
+            .pick_folder()
+        {
+            if !self.backup_roots.contains(&path) {
+                self.backup_roots.push(path);
+            }
+        }
     }
 
     fn select_wabbajack_dir(&mut self) {
@@ -160,31 +583,226 @@ impl WabbajackCleanerApp {
             .set_title("Select Wabbajack Installation Folder")
             .pick_folder()
         {
-            self.wabbajack_dir = Some(path.clone());
-            self.log(LogLevel::Info, "Scanning Wabbajack folder...");
-            self.is_loading = true;
-            self.current_operation = "Scanning for modlists...".to_string();
-            let tx = self.tx.clone();
-            thread::spawn(move || scan_wabbajack_dir(path, tx));
+            self.set_wabbajack_dir(path);
         }
     }
 
+    fn set_wabbajack_dir(&mut self, path: PathBuf) {
+        self.wabbajack_dir = Some(path.clone());
+        self.log(LogLevel::Info, "Scanning Wabbajack folder...");
+        self.is_loading = true;
+        self.current_operation = "Scanning for modlists...".to_string();
+        let tx = self.tx.clone();
+        thread::spawn(move || scan_wabbajack_dir(path, tx));
+    }
+
     fn select_downloads_dir(&mut self) {
         if let Some(path) = rfd::FileDialog::new()
             .set_title("Select Downloads Folder")
             .pick_folder()
         {
-            self.downloads_dir = Some(path.clone());
-            self.log(LogLevel::Info, "Indexing downloads folder...");
-            let tx = self.tx.clone();
-            thread::spawn(move || match get_game_folders(&path) {
+            if looks_like_wabbajack_install(&path) {
+                self.pending_downloads_dir = Some(path);
+                self.modal = Modal::ConfirmDownloadsDir;
+            } else {
+                self.set_downloads_dir(path);
+            }
+        }
+    }
+
+    fn set_downloads_dir(&mut self, path: PathBuf) {
+        if looks_like_wabbajack_install(&path) {
+            self.log(
+                LogLevel::Warning,
+                &format!(
+                    "{} looks like the Wabbajack installation folder, not a downloads folder",
+                    path.display()
+                ),
+            );
+        }
+        self.downloads_dir = Some(path.clone());
+        self.log(LogLevel::Info, "Indexing downloads folder...");
+        let tx = self.tx.clone();
+        let include_hidden = self.include_hidden;
+        thread::spawn(move || {
+            tx.send(AsyncMessage::PermissionsChecked(check_cleanup_permissions(
+                &path,
+            )))
+            .ok();
+            match get_game_folders(&path, include_hidden) {
                 Ok(folders) => {
                     tx.send(AsyncMessage::GameFoldersFound(folders)).ok();
                 }
                 Err(e) => {
                     tx.send(AsyncMessage::Error(e.to_string())).ok();
                 }
-            });
+            }
+        });
+    }
+
+    /// Reset folders, modlists and options to the active profile's settings
+    fn apply_profile(&mut self) {
+        let profile = self.config.active().clone();
+
+        self.wabbajack_dir = None;
+        self.downloads_dir = None;
+        self.modlists.clear();
+        self.modlist_selected.clear();
+        self.game_folders.clear();
+        self.selected_game_folder = None;
+        self.stats = None;
+        self.orphaned_result = None;
+        self.orphans_unchecked.clear();
+        self.modlist_footprints.clear();
+        self.old_version_result = None;
+        self.permission_problems.clear();
+        self.move_to_recycle_bin = profile.move_to_recycle_bin;
+        self.safe_mode = profile.safe_mode;
+        self.use_system_trash = profile.use_system_trash;
+        self.include_uncompressed_size = profile.include_uncompressed_size;
+        self.estimate_orphans = profile.estimate_orphans;
+        self.read_only_unmapped_folders = profile.read_only_unmapped_folders;
+        self.split_version_schemes = profile.split_version_schemes;
+        self.group_strategy = profile.group_strategy;
+        self.keep_versions = profile.keep_versions.max(1);
+        self.keep_order = profile.keep_order;
+        self.newest_by = profile.newest_by;
+        self.protect_required_versions = profile.protect_required_versions;
+        self.protect_accessed_days = profile.protect_accessed_days;
+        self.in_use_minutes = profile.in_use_minutes;
+        self.hash_unmatched = profile.hash_unmatched;
+        self.inspect_archives = profile.inspect_archives;
+        self.orphan_min_size_mb = profile.orphan_min_size_mb;
+        self.subfolder_depth = profile.subfolder_depth;
+        self.recycle_bin_template = profile.recycle_bin_template.clone();
+        self.backup_roots = profile.backup_roots.clone();
+        self.cleanup_report_dir = profile.cleanup_report_dir.clone();
+
+        self.log(
+            LogLevel::Info,
+            &format!("Using profile '{}'", self.config.active_profile),
+        );
+
+        if let Some(path) = self.existing_folder(profile.wabbajack_dir, "Wabbajack") {
+            self.set_wabbajack_dir(path);
+        }
+        if let Some(path) = self.existing_folder(profile.downloads_dir, "downloads") {
+            self.set_downloads_dir(path);
+        }
+    }
+
+    /// A saved folder, unless it was moved or deleted since it was saved
+    fn existing_folder(&mut self, path: Option<PathBuf>, name: &str) -> Option<PathBuf> {
+        let path = path?;
+        if path.is_dir() {
+            return Some(path);
+        }
+        self.log(
+            LogLevel::Warning,
+            &format!(
+                "Saved {} folder no longer exists, please select it again: {}",
+                name,
+                path.display()
+            ),
+        );
+        None
+    }
+
+    /// Copy the current folders, selections and options into the active profile
+    fn store_profile(&mut self) {
+        let selected: Vec<String> = self
+            .modlists
+            .iter()
+            .zip(&self.modlist_selected)
+            .filter(|(_, &sel)| sel)
+            .map(|(ml, _)| ml.name.clone())
+            .collect();
+        let modlists_loaded = !self.modlists.is_empty();
+
+        let profile = self.config.active_mut();
+        profile.wabbajack_dir = self.wabbajack_dir.clone();
+        profile.downloads_dir = self.downloads_dir.clone();
+        profile.move_to_recycle_bin = self.move_to_recycle_bin;
+        profile.safe_mode = self.safe_mode;
+        profile.use_system_trash = self.use_system_trash;
+        profile.include_uncompressed_size = self.include_uncompressed_size;
+        profile.estimate_orphans = self.estimate_orphans;
+        profile.read_only_unmapped_folders = self.read_only_unmapped_folders;
+        profile.split_version_schemes = self.split_version_schemes;
+        profile.group_strategy = self.group_strategy;
+        profile.keep_versions = self.keep_versions;
+        profile.keep_order = self.keep_order;
+        profile.newest_by = self.newest_by;
+        profile.protect_required_versions = self.protect_required_versions;
+        profile.protect_accessed_days = self.protect_accessed_days;
+        profile.in_use_minutes = self.in_use_minutes;
+        profile.hash_unmatched = self.hash_unmatched;
+        profile.inspect_archives = self.inspect_archives;
+        profile.orphan_min_size_mb = self.orphan_min_size_mb;
+        profile.subfolder_depth = self.subfolder_depth;
+        profile.recycle_bin_template = self.recycle_bin_template.clone();
+        profile.backup_roots = self.backup_roots.clone();
+        profile.cleanup_report_dir = self.cleanup_report_dir.clone();
+        // Keep the saved selection if the modlists haven't been loaded yet
+        if modlists_loaded {
+            profile.selected_modlists = selected;
+        }
+    }
+
+    fn save_config(&mut self) {
+        // Remembered even on failure, so a read-only config folder isn't retried every frame
+        self.saved_config = self.config.clone();
+        if let Err(e) = self.config.save() {
+            self.log(
+                LogLevel::Error,
+                &format!("Failed to save settings: {:#}", e),
+            );
+        }
+    }
+
+    /// Save the folders, selections and options whenever one of them changed
+    fn save_changed_settings(&mut self) {
+        self.store_profile();
+        if self.config != self.saved_config {
+            self.save_config();
+        }
+    }
+
+    fn switch_profile(&mut self, name: &str) {
+        if name == self.config.active_profile {
+            return;
+        }
+        self.store_profile();
+        if self.config.switch_profile(name) {
+            self.save_config();
+            self.apply_profile();
+        }
+    }
+
+    fn create_profile(&mut self) {
+        let name = self.new_profile_name.trim().to_string();
+        self.store_profile();
+        if self.config.create_profile(&name) {
+            self.new_profile_name.clear();
+            self.modal = Modal::None;
+            self.save_config();
+            self.apply_profile();
+        } else {
+            self.log(
+                LogLevel::Warning,
+                &format!("Profile name '{}' is empty or already in use", name),
+            );
+        }
+    }
+
+    fn delete_active_profile(&mut self) {
+        let name = self.config.active_profile.clone();
+        if self.config.remove_profile(&name) {
+            self.log(LogLevel::Info, &format!("Deleted profile '{}'", name));
+            self.save_config();
+            self.apply_profile();
+        } else {
+            self.log(LogLevel::Warning, "The last profile can't be deleted");
         }
     }
 
@@ -195,76 +813,795 @@ impl WabbajackCleanerApp {
         self.is_loading = true;
         self.current_operation = "Calculating statistics...".to_string();
         let folders = self.game_folders.clone();
+        let downloads_dir = self.downloads_dir.clone();
+        let include_uncompressed = self.include_uncompressed_size;
+        let subfolder_depth = self.subfolder_depth;
+        let parse = self.parse_options();
+        let selected = if self.estimate_orphans {
+            self.selected_modlists()
+        } else {
+            Vec::new()
+        };
+        let games = self.config.games.clone();
+        let group_strategy = self.group_strategy;
+        let keep = self.keep_versions;
+        let policy = self.keep_policy();
         let tx = self.tx.clone();
         thread::spawn(move || {
-            let stats = calculate_library_stats(&folders);
+            // Both passes read the same folders, so each file is only statted once
+            let cache = StatCache::with_subfolders(subfolder_depth, &folders);
+            let mut stats = calculate_library_stats_cached(
+                &folders,
+                include_uncompressed,
+                group_strategy,
+                keep,
+                &policy,
+                &parse,
+                &cache,
+            );
+            if let Some(dir) = downloads_dir {
+                match free_space(&dir) {
+                    Ok(free) => stats.free_space = Some(free),
+                    Err(e) => {
+                        tx.send(AsyncMessage::Warning(format!(
+                            "Failed to read free space on {}: {}",
+                            dir.display(),
+                            e
+                        )))
+                        .ok();
+                    }
+                }
+            }
+            if !selected.is_empty() {
+                match estimate_reclaimable_cached(
+                    &folders,
+                    &selected,
+                    &games,
+                    group_strategy,
+                    keep,
+                    &policy,
+                    &parse,
+                    &cache,
+                ) {
+                    Ok(reclaimable) => stats.reclaimable = Some(reclaimable),
+                    Err(e) => log::warn!("Failed to estimate reclaimable space: {:#}", e),
+                }
+            }
             tx.send(AsyncMessage::StatsComplete(stats)).ok();
         });
     }
 
-    fn run_orphaned_scan(&mut self, delete: bool) {
-        let selected: Vec<ModlistInfo> = self
-            .modlists
-            .iter()
-            .enumerate()
-            .filter(|(i, _)| self.modlist_selected.get(*i).copied().unwrap_or(false))
-            .map(|(_, ml)| ml.clone())
-            .collect();
+    fn run_version_drift(&mut self) {
+        let Some(modlist) = self.modlists.get(self.drift_modlist).cloned() else {
+            return;
+        };
+        self.is_loading = true;
+        self.current_operation = format!("Comparing downloads with {}...", modlist.name);
+        let folders = self.game_folders.clone();
+        let resume = self.resume;
+        let subfolder_depth = self.subfolder_depth;
+        let parse = self.parse_options();
+        let cancel = self.cancellable_scan();
+        let tx = self.tx.clone();
+        thread::spawn(move || {
+            match index_mod_files(&folders, &parse, resume, subfolder_depth, &cancel) {
+                Ok(files) => {
+                    let report = report_version_drift(&modlist, &files);
+                    tx.send(AsyncMessage::VersionDriftComplete(modlist.name, report))
+                        .ok();
+                }
+                Err(e) => {
+                    tx.send(AsyncMessage::Error(e.to_string())).ok();
+                }
+            }
+        });
+    }
 
-        if selected.is_empty() {
-            self.log(LogLevel::Warning, "Please select at least one modlist!");
+    /// Check every selected modlist for mods downloaded in another file than it expects
+    fn run_version_audit(&mut self) {
+        let modlists = self.selected_modlists();
+        if modlists.is_empty() {
+            return;
+        }
+        self.is_loading = true;
+        self.current_operation = "Comparing downloads with the selected modlists...".to_string();
+        let folders = self.game_folders.clone();
+        let resume = self.resume;
+        let subfolder_depth = self.subfolder_depth;
+        let parse = self.parse_options();
+        let cancel = self.cancellable_scan();
+        let tx = self.tx.clone();
+        thread::spawn(move || {
+            match index_mod_files(&folders, &parse, resume, subfolder_depth, &cancel) {
+                Ok(files) => {
+                    let mismatches = modlists
+                        .iter()
+                        .flat_map(|modlist| audit_modlist_versions(modlist, &files))
+                        .collect();
+                    tx.send(AsyncMessage::VersionAuditComplete(mismatches)).ok();
+                }
+                Err(e) => {
+                    tx.send(AsyncMessage::Error(e.to_string())).ok();
+                }
+            }
+        });
+    }
+
+    fn run_library_audit(&mut self) {
+        if !self.is_ready() {
             return;
         }
+        self.is_loading = true;
+        self.current_operation = "Auditing library...".to_string();
+        let folders = self.game_folders.clone();
+        let selected = self.selected_modlists();
+        let resume = self.resume;
+        let subfolder_depth = self.subfolder_depth;
+        let parse = self.parse_options();
+        let cancel = self.cancellable_scan();
+        let tx = self.tx.clone();
+        thread::spawn(move || {
+            match index_mod_files(&folders, &parse, resume, subfolder_depth, &cancel) {
+                Ok(files) => {
+                    tx.send(AsyncMessage::Progress(
+                        "Reading archive hashes...".to_string(),
+                        None,
+                    ))
+                    .ok();
+                    let audit = audit_library(&files, &selected);
+                    tx.send(AsyncMessage::AuditComplete(audit)).ok();
+                }
+                Err(e) => {
+                    tx.send(AsyncMessage::Error(e.to_string())).ok();
+                }
+            }
+        });
+    }
 
+    /// Find `.meta` files whose archive is gone, removing them if `delete` is set
+    fn run_meta_cleanup(&mut self, delete: bool) {
         self.is_loading = true;
         self.current_operation = if delete {
-            "Cleaning orphaned mods..."
+            "Removing orphaned .meta files..."
         } else {
-            "Scanning for orphaned mods..."
+            "Looking for orphaned .meta files..."
         }
         .to_string();
-
-        let path = match self.downloads_dir.clone() {
-            Some(p) => p,
-            None => {
-                self.log(LogLevel::Error, "Downloads directory not selected!");
-                self.is_loading = false;
-                return;
-            }
+        let folders = self.game_folders.clone();
+        if delete {
+            self.orphaned_meta_count = None;
+        }
+        let recycle_bin = if delete {
+            self.get_recycle_bin_path("meta", "all")
+        } else {
+            None
         };
+        if delete && self.blocked_by_safe_mode(recycle_bin.as_deref()) {
+            return;
+        }
+        let safe_mode = self.safe_mode;
+        let tx = self.tx.clone();
+        thread::spawn(move || {
+            let meta_files = find_orphaned_meta_files(&folders);
+            if delete && !meta_files.is_empty() {
+                let del = delete_meta_files(&meta_files, safe_mode, recycle_bin.as_deref());
+                tx.send(AsyncMessage::DeletionComplete(del)).ok();
+            } else {
+                tx.send(AsyncMessage::OrphanedMetaFound(meta_files)).ok();
+            }
+        });
+    }
 
+    /// Find archives saved in more than one folder, removing all but one copy if `delete` is set
+    fn run_cross_folder_cleanup(&mut self, delete: bool) {
+        self.is_loading = true;
+        self.current_operation = if delete {
+            "Removing duplicate copies..."
+        } else {
+            "Looking for archives in more than one folder..."
+        }
+        .to_string();
+        let folders = self.game_folders.clone();
+        let games = self.config.games.clone();
+        let exclusions = self.config.exclusions.clone();
+        let subfolder_depth = self.subfolder_depth;
+        let parse = self.parse_options();
+        if delete {
+            self.cross_folder_count = None;
+        }
         let recycle_bin = if delete {
-            self.get_recycle_bin_path()
+            self.get_recycle_bin_path("duplicates", "all")
         } else {
             None
         };
+        if delete && self.blocked_by_safe_mode(recycle_bin.as_deref()) {
+            return;
+        }
+        let safe_mode = self.safe_mode;
+        let cancel = if delete {
+            Arc::default()
+        } else {
+            self.cancellable_scan()
+        };
         let tx = self.tx.clone();
-        thread::spawn(move || scan_orphaned_mods_async(path, selected, delete, recycle_bin, tx));
+        thread::spawn(move || {
+            let files = match index_mod_files(&folders, &parse, false, subfolder_depth, &cancel) {
+                Ok(files) => files,
+                Err(e) => {
+                    tx.send(AsyncMessage::Error(e.to_string())).ok();
+                    return;
+                }
+            };
+            let duplicates = detect_cross_folder_duplicates(&files, &folders, &games);
+            if delete && !duplicates.is_empty() {
+                let mut groups: Vec<ModGroup> = duplicates.iter().map(|d| d.to_group()).collect();
+                let excluded = exclude_listed_groups(&mut groups, &exclusions);
+                let mut del = delete_old_versions(&groups, safe_mode, recycle_bin.as_deref(), None);
+                del.skipped.extend(excluded);
+                tx.send(AsyncMessage::DeletionComplete(del)).ok();
+            } else {
+                tx.send(AsyncMessage::CrossFolderDuplicatesFound(duplicates))
+                    .ok();
+            }
+        });
     }
 
-    fn run_old_version_scan(&mut self, delete: bool) {
-        if self.game_folders.is_empty() {
-            self.log(LogLevel::Warning, "No game folders found.");
+    /// Find byte-identical files under different names, keeping only the newest if `delete` is set
+    fn run_identical_cleanup(&mut self, delete: bool) {
+        self.is_loading = true;
+        self.current_operation = if delete {
+            "Removing identical copies..."
+        } else {
+            "Looking for identical files..."
+        }
+        .to_string();
+        let folders = self.game_folders.clone();
+        let exclusions = self.config.exclusions.clone();
+        let subfolder_depth = self.subfolder_depth;
+        let parse = self.parse_options();
+        if delete {
+            self.identical_count = None;
+        }
+        let recycle_bin = if delete {
+            self.get_recycle_bin_path("identical", "all")
+        } else {
+            None
+        };
+        if delete && self.blocked_by_safe_mode(recycle_bin.as_deref()) {
             return;
         }
-        self.pending_delete_mode = delete;
-        self.modal = Modal::FolderSelect;
+        let safe_mode = self.safe_mode;
+        let cancel = if delete {
+            Arc::default()
+        } else {
+            self.cancellable_scan()
+        };
+        let tx = self.tx.clone();
+        thread::spawn(move || {
+            let files = match index_mod_files(&folders, &parse, false, subfolder_depth, &cancel) {
+                Ok(files) => files,
+                Err(e) => {
+                    tx.send(AsyncMessage::Error(e.to_string())).ok();
+                    return;
+                }
+            };
+            tx.send(AsyncMessage::Progress(
+                "Hashing files of the same size...".to_string(),
+                None,
+            ))
+            .ok();
+            let cache = HashCache::default_path()
+                .map(|path| HashCache::open(&path))
+                .unwrap_or_default();
+            let identical = detect_identical_files(&files, &cache);
+            save_hash_cache(&cache, &tx);
+            if delete && !identical.is_empty() {
+                let mut groups: Vec<ModGroup> = identical.iter().map(|d| d.to_group()).collect();
+                let excluded = exclude_listed_groups(&mut groups, &exclusions);
+                let mut del = delete_old_versions(&groups, safe_mode, recycle_bin.as_deref(), None);
+                del.skipped.extend(excluded);
+                tx.send(AsyncMessage::DeletionComplete(del)).ok();
+            } else {
+                tx.send(AsyncMessage::IdenticalFilesFound(identical)).ok();
+            }
+        });
     }
 
-    fn start_old_version_scan(&mut self) {
-        if let Some(idx) = self.selected_game_folder {
-            let folder = self.game_folders[idx].clone();
-            let delete = self.pending_delete_mode;
-            let recycle_bin = if delete {
-                self.get_recycle_bin_path()
-            } else {
+    /// Arm the Cancel button for a scan that is about to start
+    fn cancellable_scan(&mut self) -> Arc<AtomicBool> {
+        let cancel = Arc::new(AtomicBool::new(false));
+        self.scan_cancel = Some(cancel.clone());
+        cancel
+    }
+
+    fn cancel_scan(&mut self) {
+        let Some(cancel) = self.scan_cancel.take() else {
+            return;
+        };
+        cancel.store(true, Ordering::Relaxed);
+        self.is_loading = false;
+        self.progress = None;
+        self.log(LogLevel::Warning, "Cancelled");
+    }
+
+    fn export_report(&mut self) {
+        let Some(path) = rfd::FileDialog::new()
+            .set_title("Export Report")
+            .set_file_name("wlc_report.txt")
+            .add_filter("Text", &["txt"])
+            .add_filter("CSV (orphaned mods scan)", &["csv"])
+            .save_file()
+        else {
+            return;
+        };
+
+        match self.write_report(&path) {
+            Ok(()) => self.log(
+                LogLevel::Info,
+                &format!("Report saved to {}", path.display()),
+            ),
+            Err(e) => self.log(LogLevel::Error, &format!("Failed to save report: {}", e)),
+        }
+    }
+
+    fn write_report(&self, path: &Path) -> std::io::Result<()> {
+        let csv = path
+            .extension()
+            .is_some_and(|ext| ext.eq_ignore_ascii_case("csv"));
+        if csv {
+            let Some(res) = &self.orphaned_result else {
+                return Err(std::io::Error::other(
+                    "CSV reports list an orphaned mods scan; run one first",
+                ));
+            };
+            let mut w = std::io::BufWriter::new(std::fs::File::create(path)?);
+            write_orphaned_csv(&mut w, res)?;
+            return w.flush();
+        }
+
+        let mut w = std::io::BufWriter::new(std::fs::File::create(path)?);
+        if let Some(stats) = &self.stats {
+            write_statistics(&mut w, stats)?;
+            writeln!(w)?;
+        }
+        if let Some(res) = &self.orphaned_result {
+            write_orphaned_report(&mut w, res)?;
+            writeln!(w)?;
+            write_keep_reasons_report(&mut w, res)?;
+            writeln!(w)?;
+            if self.modlist_footprints.len() > 1 {
+                write_unique_footprints(&mut w, &self.modlist_footprints)?;
+                writeln!(w)?;
+            }
+        }
+        if let Some(res) = &self.old_version_result {
+            write_duplicates_report(&mut w, res)?;
+            writeln!(w)?;
+        }
+        if let Some(audit) = &self.library_audit {
+            write_audit_report(&mut w, audit)?;
+        }
+        w.flush()
+    }
+
+    fn preview_name_repairs(&mut self) {
+        self.is_loading = true;
+        self.current_operation = "Looking for archives to rename...".to_string();
+        let folders = self.game_folders.clone();
+        let tx = self.tx.clone();
+        thread::spawn(move || match plan_name_repairs(&folders) {
+            Ok(repairs) => {
+                tx.send(AsyncMessage::NameRepairsPlanned(repairs)).ok();
+            }
+            Err(e) => {
+                tx.send(AsyncMessage::Error(e.to_string())).ok();
+            }
+        });
+    }
+
+    fn apply_name_repairs(&mut self) {
+        self.modal = Modal::None;
+        self.is_loading = true;
+        self.current_operation = "Renaming archives...".to_string();
+        let repairs = std::mem::take(&mut self.name_repairs);
+        let tx = self.tx.clone();
+        thread::spawn(move || {
+            let (renamed, errors) = apply_name_repairs(&repairs);
+            tx.send(AsyncMessage::NameRepairsApplied(renamed, errors))
+                .ok();
+        });
+    }
+
+    /// WLC_RecycleBin folders in the downloads folder and on every backup drive
+    fn recycle_bin_roots(&self) -> Vec<PathBuf> {
+        self.downloads_dir
+            .iter()
+            .chain(&self.backup_roots)
+            .map(|dir| dir.join(RECYCLE_BIN_DIR_NAME))
+            .collect()
+    }
+
+    /// Log which modlists use an archive the user picks, and the version each expects
+    fn show_modlist_uses(&mut self) {
+        let mut dialog = rfd::FileDialog::new().set_title("Select an Archive");
+        if let Some(dir) = &self.downloads_dir {
+            dialog = dialog.set_directory(dir);
+        }
+        let Some(path) = dialog.pick_file() else {
+            return;
+        };
+        let file_name = path
+            .file_name()
+            .map(|n| n.to_string_lossy().to_string())
+            .unwrap_or_default();
+        let mut mod_file =
+            parse_mod_filename(&file_name).unwrap_or_else(|| generic_mod_file(&file_name));
+        mod_file.full_path = path;
+
+        let uses = which_modlists_use(&mod_file, &self.modlists);
+        if uses.is_empty() {
+            self.log(
+                LogLevel::Info,
+                &format!("{} is not used by any modlist", file_name),
+            );
+            return;
+        }
+        self.log(
+            LogLevel::Info,
+            &format!("{} is used by {} modlist(s):", file_name, uses.len()),
+        );
+        for modlist_use in &uses {
+            let level = if modlist_use.other_file_id {
+                LogLevel::Warning
+            } else {
+                LogLevel::Info
+            };
+            self.log(level, &format!("  {}", describe_modlist_use(modlist_use)));
+        }
+    }
+
+    fn show_backups(&mut self) {
+        self.backups = list_backups(&self.recycle_bin_roots());
+        self.selected_backup = None;
+        if self.backups.is_empty() {
+            self.log(
+                LogLevel::Info,
+                &format!("No restorable backups found in {}", RECYCLE_BIN_DIR_NAME),
+            );
+        } else {
+            self.modal = Modal::RestoreBackup;
+        }
+    }
+
+    fn restore_selected_backup(&mut self) {
+        let Some(backup) = self
+            .selected_backup
+            .and_then(|i| self.backups.get(i))
+            .map(|b| b.path.clone())
+        else {
+            return;
+        };
+        self.modal = Modal::None;
+        self.backups.clear();
+        self.selected_backup = None;
+        self.is_loading = true;
+        self.current_operation = "Restoring backup...".to_string();
+        let tx = self.tx.clone();
+        thread::spawn(move || match restore_backup(&backup) {
+            Ok(result) => {
+                tx.send(AsyncMessage::RestoreComplete(backup, result)).ok();
+            }
+            Err(e) => {
+                tx.send(AsyncMessage::Error(format!("{:#}", e))).ok();
+            }
+        });
+    }
+
+    /// Move the files of the last cleanup back from its backup folder
+    fn undo_last_cleanup(&mut self) {
+        let Some((backup, files)) = self.undo_cleanup.clone() else {
+            return;
+        };
+        self.is_loading = true;
+        self.current_operation = "Undoing last cleanup...".to_string();
+        let tx = self.tx.clone();
+        thread::spawn(move || match restore_files(&backup, &files) {
+            Ok(result) => {
+                tx.send(AsyncMessage::RestoreComplete(backup, result)).ok();
+            }
+            Err(e) => {
+                tx.send(AsyncMessage::Error(format!("{:#}", e))).ok();
+            }
+        });
+    }
+
+    fn selected_modlists(&self) -> Vec<ModlistInfo> {
+        self.modlists
+            .iter()
+            .enumerate()
+            .filter(|(i, _)| self.modlist_selected.get(*i).copied().unwrap_or(false))
+            .map(|(_, ml)| ml.clone())
+            .collect()
+    }
+
+    /// Every parsed modlist, whose exact FileIDs old version cleanups keep
+    fn required_by(&self) -> Vec<ModlistInfo> {
+        if self.protect_required_versions {
+            self.modlists.clone()
+        } else {
+            Vec::new()
+        }
+    }
+
+    /// Folders where cleanup only reports, when game-aware protection is on
+    fn read_only_folders(&mut self, modlists: &[ModlistInfo]) -> Vec<PathBuf> {
+        if !self.read_only_unmapped_folders {
+            return Vec::new();
+        }
+
+        let folders = read_only_folders(&self.game_folders, modlists, &self.config.games);
+        for folder in &folders {
+            let name = folder
+                .file_name()
+                .map(|n| n.to_string_lossy().to_string())
+                .unwrap_or_default();
+            self.log(
+                LogLevel::Warning,
+                &format!(
+                    "Folder {} not mapped to a modlist game — treating as read-only.",
+                    name
+                ),
+            );
+        }
+        folders
+    }
+
+    fn run_orphaned_scan(&mut self, delete: bool) {
+        let selected = self.selected_modlists();
+
+        if selected.is_empty() {
+            self.log(LogLevel::Warning, "Please select at least one modlist!");
+            return;
+        }
+
+        self.is_loading = true;
+        self.current_operation = if delete {
+            "Cleaning orphaned mods..."
+        } else {
+            "Scanning for orphaned mods..."
+        }
+        .to_string();
+
+        let path = match self.downloads_dir.clone() {
+            Some(p) => p,
+            None => {
+                self.log(LogLevel::Error, "Downloads directory not selected!");
+                self.is_loading = false;
+                return;
+            }
+        };
+
+        let recycle_bin = if delete {
+            self.get_recycle_bin_path("orphaned", "all")
+        } else {
+            None
+        };
+        if delete && self.blocked_by_safe_mode(recycle_bin.as_deref()) {
+            return;
+        }
+        let tx = self.tx.clone();
+        let read_only = if delete {
+            self.read_only_folders(&selected)
+        } else {
+            Vec::new()
+        };
+        let games = self.config.games.clone();
+        let protect_accessed_days = self.protect_accessed_days;
+        let in_use_minutes = self.in_use_minutes;
+        let hash_unmatched = self.hash_unmatched;
+        let min_size = self.orphan_min_size_mb * 1024 * 1024;
+        let exclusions = self.config.exclusions.clone();
+        let unchecked = self.orphans_unchecked.clone();
+        let resume = self.resume;
+        let subfolder_depth = self.subfolder_depth;
+        let parse = self.parse_options();
+        let include_hidden = self.include_hidden;
+        let safe_mode = self.safe_mode;
+        let cancel = if delete {
+            Arc::default()
+        } else {
+            self.cancellable_scan()
+        };
+        thread::spawn(move || {
+            scan_orphaned_mods_async(
+                path,
+                selected,
+                games,
+                read_only,
+                protect_accessed_days,
+                in_use_minutes,
+                hash_unmatched,
+                min_size,
+                exclusions,
+                unchecked,
+                resume,
+                subfolder_depth,
+                parse,
+                include_hidden,
+                delete,
+                safe_mode,
+                recycle_bin,
+                cancel,
+                tx,
+            )
+        });
+    }
+
+    fn run_combined_clean(&mut self, delete: bool) {
+        let selected = self.selected_modlists();
+        if selected.is_empty() {
+            self.log(LogLevel::Warning, "Please select at least one modlist!");
+            return;
+        }
+        if self.game_folders.is_empty() {
+            self.log(LogLevel::Warning, "No game folders found.");
+            return;
+        }
+
+        self.is_loading = true;
+        self.current_operation = if delete {
+            "Running combined clean..."
+        } else {
+            "Building cleanup plan..."
+        }
+        .to_string();
+
+        let read_only = if delete {
+            self.read_only_folders(&selected)
+        } else {
+            Vec::new()
+        };
+        let folders = self.game_folders.clone();
+        let games = self.config.games.clone();
+        let keep = self.keep_versions;
+        let keep_policy = self.keep_policy();
+        let group_strategy = self.group_strategy;
+        let required_by = self.required_by();
+        let target = (self.reclaim_target_gb > 0.0)
+            .then_some((self.reclaim_target_gb * 1024.0 * 1024.0 * 1024.0) as u64);
+        let protect_accessed_days = self.protect_accessed_days;
+        let in_use_minutes = self.in_use_minutes;
+        let hash_unmatched = self.hash_unmatched;
+        let exclusions = self.config.exclusions.clone();
+        let resume = self.resume;
+        let subfolder_depth = self.subfolder_depth;
+        let parse = self.parse_options();
+        let recycle_bin = if delete {
+            self.get_recycle_bin_path("combined", "all")
+        } else {
+            None
+        };
+        if delete && self.blocked_by_safe_mode(recycle_bin.as_deref()) {
+            return;
+        }
+        let safe_mode = self.safe_mode;
+        let cancel = if delete {
+            Arc::default()
+        } else {
+            self.cancellable_scan()
+        };
+        let tx = self.tx.clone();
+        thread::spawn(move || {
+            combined_clean_async(
+                folders,
+                selected,
+                games,
+                keep,
+                keep_policy,
+                group_strategy,
+                required_by,
+                target,
+                read_only,
+                protect_accessed_days,
+                in_use_minutes,
+                hash_unmatched,
+                exclusions,
+                resume,
+                subfolder_depth,
+                parse,
+                delete,
+                safe_mode,
+                recycle_bin,
+                cancel,
+                tx,
+            )
+        });
+    }
+
+    fn run_old_version_scan(&mut self, delete: bool) {
+        if self.game_folders.is_empty() {
+            self.log(LogLevel::Warning, "No game folders found.");
+            return;
+        }
+        self.pending_delete_mode = delete;
+        self.modal = Modal::FolderSelect;
+    }
+
+    fn start_old_version_scan(&mut self) {
+        if let Some(idx) = self.selected_game_folder {
+            let folder = self.game_folders[idx].clone();
+            let mut delete = self.pending_delete_mode;
+            if delete {
+                let selected = self.selected_modlists();
+                if self.read_only_folders(&selected).contains(&folder) {
+                    self.log(
+                        LogLevel::Warning,
+                        "Cleanup skipped; showing old versions in the read-only folder.",
+                    );
+                    delete = false;
+                }
+            }
+            let game = folder
+                .file_name()
+                .map(|n| n.to_string_lossy().to_string())
+                .unwrap_or_default();
+            let recycle_bin = if delete {
+                self.get_recycle_bin_path("old-versions", &game)
+            } else {
+                None
+            };
+            if delete && self.blocked_by_safe_mode(recycle_bin.as_deref()) {
+                self.modal = Modal::None;
+                return;
+            }
+            // Old versions go to the backup drive with the most room, if any
+            let backup = if recycle_bin.is_some()
+                && self.system_trash().is_none()
+                && !self.backup_roots.is_empty()
+            {
+                self.recycle_bin_folder_name("old-versions", &game)
+                    .map(|subdir| (self.backup_roots.clone(), subdir))
+            } else {
                 None
             };
+            let options = DuplicateScanOptions {
+                split_version_schemes: self.split_version_schemes,
+                unsafe_delete_all_old: self.unsafe_delete_all_old,
+                aggressive: false,
+                group_strategy: self.group_strategy,
+                keep_versions: self.keep_versions,
+                keep_policy: self.keep_policy(),
+                subfolder_depth: self.subfolder_depth,
+                parse: self.parse_options(),
+            };
+            self.unsafe_confirmed = false;
+            // Checked before deleting so no needed archive loses its last copy
+            let modlists = self.selected_modlists();
+            let required_by = self.required_by();
+            let protect_accessed_days = self.protect_accessed_days;
+            let in_use_minutes = self.in_use_minutes;
+            let exclusions = self.config.exclusions.clone();
+            let safe_mode = self.safe_mode;
             let tx = self.tx.clone();
             self.modal = Modal::None;
             self.is_loading = true;
             self.current_operation = "Scanning for old versions...".to_string();
-            thread::spawn(move || scan_old_versions_async(folder, delete, recycle_bin, tx));
+            thread::spawn(move || {
+                scan_old_versions_async(
+                    folder,
+                    options,
+                    modlists,
+                    required_by,
+                    protect_accessed_days,
+                    in_use_minutes,
+                    exclusions,
+                    delete,
+                    safe_mode,
+                    recycle_bin,
+                    backup,
+                    tx,
+                )
+            });
         }
     }
 
@@ -273,8 +1610,14 @@ impl WabbajackCleanerApp {
             match msg {
                 AsyncMessage::ModlistsParsed(list) => {
                     self.log(LogLevel::Info, &format!("Found {} modlists", list.len()));
-                    self.modlist_selected = vec![true; list.len()];
+                    let saved = &self.config.active().selected_modlists;
+                    self.modlist_selected = if saved.is_empty() {
+                        vec![true; list.len()]
+                    } else {
+                        list.iter().map(|ml| saved.contains(&ml.name)).collect()
+                    };
                     self.modlists = list;
+                    self.modlist_icons.clear();
                     self.is_loading = false;
                     self.progress = None;
                     if self.downloads_dir.is_some() {
@@ -282,16 +1625,65 @@ impl WabbajackCleanerApp {
                     }
                 }
                 AsyncMessage::GameFoldersFound(folders) => {
-                    self.log(
-                        LogLevel::Info,
-                        &format!("Found {} game folders", folders.len()),
-                    );
+                    let flat = self
+                        .downloads_dir
+                        .as_deref()
+                        .is_some_and(|dir| is_flat_library(dir, &folders));
+                    if flat {
+                        self.log(
+                            LogLevel::Info,
+                            "No game folders found; scanning the archives in the downloads folder as one folder",
+                        );
+                    } else if folders.is_empty() {
+                        self.log(
+                            LogLevel::Warning,
+                            "No archives or game folders in the downloads folder",
+                        );
+                    } else {
+                        self.log(
+                            LogLevel::Info,
+                            &format!("Found {} game folders", folders.len()),
+                        );
+                    }
+                    for (link, target) in folder_links(&folders) {
+                        self.log(
+                            LogLevel::Warning,
+                            &format!(
+                                "{} is a link to {}; free space is that of the drive it points to",
+                                link.display(),
+                                target.display()
+                            ),
+                        );
+                    }
+                    // The downloads folder of a flat library isn't named after a game
+                    let unmapped: Vec<String> = folders
+                        .iter()
+                        .filter(|_| !flat)
+                        .filter_map(|f| f.file_name())
+                        .map(|n| n.to_string_lossy().to_string())
+                        .filter(|n| resolve_game(&self.config.games, n).is_none())
+                        .collect();
+                    if !unmapped.is_empty() {
+                        self.log(
+                            LogLevel::Info,
+                            &format!(
+                                "Unrecognized game folders: {}. Add them to the games list in config.json for game-aware checks.",
+                                unmapped.join(", ")
+                            ),
+                        );
+                    }
                     self.game_folders = folders;
                     self.progress = None;
                     if self.wabbajack_dir.is_some() {
                         self.run_analysis();
                     }
                 }
+                AsyncMessage::PermissionsChecked(problems) => {
+                    for problem in &problems {
+                        self.log(LogLevel::Warning, problem);
+                    }
+                    self.permission_problems = problems;
+                }
                 AsyncMessage::StatsComplete(stats) => {
                     self.stats = Some(stats);
                     self.is_loading = false;
@@ -306,6 +1698,47 @@ impl WabbajackCleanerApp {
                             format_size(res.orphaned_size)
                         ),
                     );
+                    if res.small_orphans > 0 {
+                        self.log(
+                            LogLevel::Info,
+                            &format!(
+                                "Skipped (too small): {} files ({})",
+                                res.small_orphans,
+                                format_size(res.small_orphans_size)
+                            ),
+                        );
+                    }
+                    if !res.fragmented_mods.is_empty() {
+                        self.log(
+                            LogLevel::Warning,
+                            &format!(
+                                "{} mod(s) have files in more than one game folder; old version scans can't compare them",
+                                res.fragmented_mods.len()
+                            ),
+                        );
+                    }
+                    if !res.identical_archives.is_empty() {
+                        let reclaimable: u64 =
+                            res.identical_archives.iter().map(|d| d.reclaimable).sum();
+                        self.log(
+                            LogLevel::Warning,
+                            &format!(
+                                "{} used archive(s) were downloaded more than once under different names ({} reclaimable)",
+                                res.identical_archives.len(),
+                                format_size(reclaimable)
+                            ),
+                        );
+                    }
+                    if !res.foreign_game_mods.is_empty() {
+                        self.log(
+                            LogLevel::Warning,
+                            &format!(
+                                "Found {} archives for games with no folder or selected modlist",
+                                res.foreign_game_mods.len()
+                            ),
+                        );
+                    }
+                    self.modlist_footprints = unique_footprint(&self.selected_modlists(), &res);
                     self.orphaned_result = Some(res);
                     self.is_loading = false;
                     self.progress = None;
@@ -319,12 +1752,69 @@ impl WabbajackCleanerApp {
                             format_size(res.total_space)
                         ),
                     );
-                    self.old_version_result = Some(res);
-                    self.is_loading = false;
-                    self.progress = None;
-                }
-                AsyncMessage::DeletionComplete(res) => {
-                    if let Some(ref path) = res.recycle_bin_path {
+                    if !res.vanished_files.is_empty() {
+                        self.log(
+                            LogLevel::Warning,
+                            &format!(
+                                "{} file(s) disappeared during the scan and were ignored.",
+                                res.vanished_files.len()
+                            ),
+                        );
+                    }
+                    if !res.split_groups.is_empty() {
+                        self.log(
+                            LogLevel::Warning,
+                            &format!(
+                                "Split {} mod(s) with incompatible version schemes into separate groups: {}",
+                                res.split_groups.len(),
+                                res.split_groups.join(", ")
+                            ),
+                        );
+                    }
+                    if !res.heuristic_groups.is_empty() {
+                        self.log(
+                            LogLevel::Info,
+                            &format!(
+                                "Kept {} mod(s) whose versions look unusual, such as same-version re-uploads: {}",
+                                res.heuristic_groups.len(),
+                                res.heuristic_groups.join(", ")
+                            ),
+                        );
+                    }
+                    self.old_version_result = Some(res);
+                    self.is_loading = false;
+                    self.progress = None;
+                }
+                AsyncMessage::CleanupPlanComplete(plan) => {
+                    self.log(
+                        LogLevel::Info,
+                        &format!(
+                            "Cleanup plan: {} orphaned and {} old versions ({})",
+                            plan.orphaned_mods.len(),
+                            plan.old_version_files,
+                            format_size(plan.total_size())
+                        ),
+                    );
+                    self.cleanup_plan = Some(plan);
+                    self.is_loading = false;
+                    self.progress = None;
+                }
+                AsyncMessage::DeletionComplete(res) => {
+                    if res.deleted_count > 0 {
+                        self.last_backup_dir = res.recycle_bin_path.clone();
+                    }
+                    // Undo always refers to the latest cleanup, even one that moved nothing.
+                    // Files in the system trash have no manifest to restore from.
+                    self.undo_cleanup = res
+                        .recycle_bin_path
+                        .clone()
+                        .filter(|dir| !is_system_trash(dir) && !res.backed_up.is_empty())
+                        .map(|dir| {
+                            // Every part moved, not just the first of a multi-part archive
+                            let files = res.backed_up.iter().map(|(p, _)| p.clone()).collect();
+                            (dir, files)
+                        });
+                    if let Some(ref path) = res.recycle_bin_path {
                         self.log(
                             LogLevel::Info,
                             &format!(
@@ -350,6 +1840,176 @@ impl WabbajackCleanerApp {
                             &format!("{} error(s) occurred during cleanup.", res.errors.len()),
                         );
                     }
+                    if !res.failed.is_empty() {
+                        self.log(
+                            LogLevel::Error,
+                            &format!("Failed to delete {} files (see log):", res.failed.len()),
+                        );
+                        for (path, error) in &res.failed {
+                            self.log(LogLevel::Error, &format!("  {}: {}", path.display(), error));
+                        }
+                    }
+                    self.write_cleanup_report(&res);
+                    self.is_loading = false;
+                    self.progress = None;
+                    self.run_analysis();
+                }
+                AsyncMessage::VersionDriftComplete(name, report) => {
+                    let count = |kind| {
+                        report
+                            .iter()
+                            .filter(|d| d.on_disk.iter().any(|(_, k)| *k == kind))
+                            .count()
+                    };
+                    self.log(
+                        LogLevel::Info,
+                        &format!(
+                            "{}: {} archives match, {} have older downloads, {} have newer downloads, {} not downloaded",
+                            name,
+                            count(VersionDriftKind::Matching),
+                            count(VersionDriftKind::Older),
+                            count(VersionDriftKind::Newer),
+                            report.iter().filter(|d| d.on_disk.is_empty()).count()
+                        ),
+                    );
+                    self.version_drift = Some((name, report));
+                    self.is_loading = false;
+                    self.progress = None;
+                }
+                AsyncMessage::VersionAuditComplete(mismatches) => {
+                    if mismatches.is_empty() {
+                        self.log(
+                            LogLevel::Info,
+                            "Version audit: every mod on disk is the file its modlists expect",
+                        );
+                    } else {
+                        self.log(
+                            LogLevel::Warning,
+                            &format!(
+                                "Version audit: {} mod(s) on disk aren't the file their modlist expects; download these again:",
+                                mismatches.len()
+                            ),
+                        );
+                        for mismatch in &mismatches {
+                            self.log(
+                                LogLevel::Warning,
+                                &format!("  {}", describe_version_mismatch(mismatch)),
+                            );
+                        }
+                    }
+                    self.is_loading = false;
+                    self.progress = None;
+                }
+                AsyncMessage::OrphanedMetaFound(meta_files) => {
+                    let size: u64 = meta_files
+                        .iter()
+                        .filter_map(|path| std::fs::metadata(path).ok())
+                        .map(|m| m.len())
+                        .sum();
+                    self.log(
+                        LogLevel::Info,
+                        &format!(
+                            "Orphaned .meta files: {} ({})",
+                            meta_files.len(),
+                            format_size(size)
+                        ),
+                    );
+                    for path in &meta_files {
+                        self.log(LogLevel::Info, &format!("  {}", path.display()));
+                    }
+                    self.orphaned_meta_count = Some(meta_files.len());
+                    self.is_loading = false;
+                    self.progress = None;
+                }
+                AsyncMessage::CrossFolderDuplicatesFound(duplicates) => {
+                    let mut out = Vec::new();
+                    if write_cross_folder_duplicates(&mut out, &duplicates).is_ok() {
+                        for line in String::from_utf8_lossy(&out).lines() {
+                            self.log(LogLevel::Info, line);
+                        }
+                    }
+                    self.cross_folder_count = Some(duplicates.len());
+                    self.is_loading = false;
+                    self.progress = None;
+                }
+                AsyncMessage::IdenticalFilesFound(identical) => {
+                    let mut out = Vec::new();
+                    if write_identical_files(&mut out, &identical).is_ok() {
+                        for line in String::from_utf8_lossy(&out).lines() {
+                            self.log(LogLevel::Info, line);
+                        }
+                    }
+                    self.identical_count = Some(identical.len());
+                    self.is_loading = false;
+                    self.progress = None;
+                }
+                AsyncMessage::AuditComplete(audit) => {
+                    self.log(
+                        LogLevel::Info,
+                        &format!(
+                            "Library audit: {} needed, {} orphaned ({}), {} missing, {} without a hash",
+                            audit.kept.len(),
+                            audit.orphaned.len(),
+                            format_size(audit.orphaned_size),
+                            audit.missing.len(),
+                            audit.unhashed.len()
+                        ),
+                    );
+                    self.log(LogLevel::Info, &download_summary(&audit));
+                    self.library_audit = Some(audit);
+                    self.is_loading = false;
+                    self.progress = None;
+                }
+                AsyncMessage::NameRepairsPlanned(repairs) => {
+                    self.is_loading = false;
+                    self.progress = None;
+                    if repairs.is_empty() {
+                        self.log(LogLevel::Info, "No archive names need repairing.");
+                    } else {
+                        self.log(
+                            LogLevel::Info,
+                            &format!("{} archive(s) can be renamed", repairs.len()),
+                        );
+                        self.name_repairs = repairs;
+                        self.modal = Modal::ConfirmRename;
+                    }
+                }
+                AsyncMessage::NameRepairsApplied(renamed, errors) => {
+                    self.log(LogLevel::Info, &format!("Renamed {} archive(s)", renamed));
+                    for e in &errors {
+                        self.log(LogLevel::Error, e);
+                    }
+                    self.is_loading = false;
+                    self.progress = None;
+                    self.run_analysis();
+                }
+                AsyncMessage::RestoreComplete(backup, result) => {
+                    if result.conflicts.is_empty()
+                        && result.errors.is_empty()
+                        && self
+                            .undo_cleanup
+                            .as_ref()
+                            .is_some_and(|(dir, _)| *dir == backup)
+                    {
+                        self.undo_cleanup = None;
+                    }
+                    self.log(
+                        LogLevel::Info,
+                        &format!(
+                            "Restored {} file(s) from {}",
+                            result.restored,
+                            backup.display()
+                        ),
+                    );
+                    for path in &result.conflicts {
+                        self.log(
+                            LogLevel::Warning,
+                            &format!("Not restored, a file already exists at {}", path.display()),
+                        );
+                    }
+                    for e in &result.errors {
+                        self.log(LogLevel::Error, e);
+                    }
                     self.is_loading = false;
                     self.progress = None;
                     self.run_analysis();
@@ -358,6 +2018,14 @@ impl WabbajackCleanerApp {
                     self.current_operation = s;
                     self.progress = prog;
                 }
+                AsyncMessage::Info(msg) => {
+                    self.log(LogLevel::Info, &msg);
+                }
+                AsyncMessage::Warning(w) => {
+                    self.log(LogLevel::Warning, &w);
+                }
+                // Already reported when the Cancel button was pressed
+                AsyncMessage::Error(e) if e == SCAN_CANCELLED => {}
                 AsyncMessage::Error(e) => {
                     self.log(LogLevel::Error, &format!("Error: {}", e));
                     self.is_loading = false;
@@ -365,6 +2033,9 @@ impl WabbajackCleanerApp {
                 }
             }
         }
+        if !self.is_loading {
+            self.scan_cancel = None;
+        }
     }
 }
 
@@ -402,8 +2073,35 @@ impl eframe::App for WabbajackCleanerApp {
                             self.modal = Modal::About;
                         }
                         ui.add_space(16.0);
-                        ui.checkbox(&mut self.move_to_recycle_bin, "Move to Recycle Bin")
-                            .on_hover_text("Moves deleted files to a timestamped WLC_RecycleBin folder in your downloads directory instead of permanently deleting them. This is NOT Windows' Recycle Bin — files go to WLC_RecycleBin\\<timestamp>\\ and can be manually deleted later.");
+                        self.render_profile_selector(ui);
+                        ui.add_space(16.0);
+                        ui.checkbox(&mut self.read_only_unmapped_folders, "Protect unmapped folders")
+                            .on_hover_text("Never delete from game folders that don't match the game of a selected modlist. Files there are still listed in scan results.");
+                        ui.add_space(16.0);
+                        ui.checkbox(&mut self.inspect_archives, "Look inside archives")
+                            .on_hover_text("When an archive's name has no ModID and it has no .meta file, read the meta.ini some authors pack inside it. Slow: every such archive is opened. .7z and .rar archives need 7-Zip installed.");
+                        ui.add_space(16.0);
+                        // Right to left: the value sits after its label
+                        ui.add(egui::DragValue::new(&mut self.subfolder_depth).range(0..=10))
+                            .on_hover_text("Also scan folders inside each game folder, this many levels deep, e.g. downloads sorted by author. Files are grouped with the game folder's own. Hidden, __ and WLC_RecycleBin folders are skipped. 0 scans only the game folders.");
+                        ui.label("Subfolder levels");
+                        ui.add_space(16.0);
+                        ui.checkbox(&mut self.safe_mode, "Safe mode")
+                            .on_hover_text("Never delete permanently: files always go to the recycle bin or trash, and a cleanup stops if there's nowhere to move them.");
+                        ui.add_space(16.0);
+                        let mut keeps_backup = self.keeps_backup();
+                        ui.add_enabled(
+                            !self.safe_mode,
+                            egui::Checkbox::new(&mut keeps_backup, "Move to Recycle Bin"),
+                        )
+                        .on_hover_text("Moves deleted files to a timestamped WLC_RecycleBin folder in your downloads directory instead of permanently deleting them. This is NOT Windows' Recycle Bin — files go to WLC_RecycleBin\\<timestamp>\\ and can be manually deleted later.");
+                        if !self.safe_mode {
+                            self.move_to_recycle_bin = keeps_backup;
+                        }
+                        if self.keeps_backup() && system_trash_dir().is_some() {
+                            ui.checkbox(&mut self.use_system_trash, "Use system trash")
+                                .on_hover_text("Move files to your desktop trash instead of WLC_RecycleBin. Your file manager can restore them to their original folder.");
+                        }
                     });
                 });
             });
@@ -434,6 +2132,14 @@ impl eframe::App for WabbajackCleanerApp {
                                 );
                             }
                         }
+                        if self.scan_cancel.is_some()
+                            && ui
+                                .small_button("Cancel")
+                                .on_hover_text("Stop the scan")
+                                .clicked()
+                        {
+                            self.cancel_scan();
+                        }
                     } else {
                         ui.label(RichText::new("Ready").color(COLOR_SUCCESS));
                     }
@@ -451,6 +2157,20 @@ impl eframe::App for WabbajackCleanerApp {
                         if ui.small_button("Clear Log").clicked() {
                             self.log_messages.clear();
                         }
+                        if let Some(dir) = self.last_backup_dir.clone() {
+                            if ui
+                                .small_button("Show Backup Folder")
+                                .on_hover_text(dir.display().to_string())
+                                .clicked()
+                            {
+                                if let Err(e) = reveal_in_file_manager(&dir) {
+                                    self.log(
+                                        LogLevel::Error,
+                                        &format!("Failed to open {}: {}", dir.display(), e),
+                                    );
+                                }
+                            }
+                        }
                     });
                 });
                 ui.separator();
@@ -474,6 +2194,7 @@ impl eframe::App for WabbajackCleanerApp {
             .frame(egui::Frame::none().fill(COLOR_BG_MAIN).inner_margin(16.0))
             .show(ctx, |ui| {
                 egui::ScrollArea::vertical().show(ui, |ui| {
+                    self.render_permission_banner(ui);
                     self.render_paths_section(ui);
                     ui.add_space(12.0);
                     self.render_modlist_section(ui);
@@ -485,6 +2206,7 @@ impl eframe::App for WabbajackCleanerApp {
             });
 
         self.render_modals(ctx);
+        self.save_changed_settings();
     }
 }
 
@@ -507,13 +2229,96 @@ impl WabbajackCleanerApp {
             });
     }
 
+    fn render_profile_selector(&mut self, ui: &mut egui::Ui) {
+        let enabled = !self.is_loading;
+
+        if ui
+            .add_enabled(enabled, egui::Button::new("Delete"))
+            .on_hover_text("Delete the current profile")
+            .clicked()
+        {
+            self.delete_active_profile();
+        }
+        if ui
+            .add_enabled(enabled, egui::Button::new("New"))
+            .on_hover_text("Create a new profile with its own folders and options")
+            .clicked()
+        {
+            self.modal = Modal::NewProfile;
+        }
+
+        let mut selected = None;
+        ui.add_enabled_ui(enabled, |ui| {
+            egui::ComboBox::from_id_salt("profile_selector")
+                .selected_text(self.config.active_profile.as_str())
+                .show_ui(ui, |ui| {
+                    for name in self.config.profile_names() {
+                        let is_active = name == self.config.active_profile;
+                        if ui.selectable_label(is_active, name.as_str()).clicked() {
+                            selected = Some(name);
+                        }
+                    }
+                });
+        });
+        ui.label(RichText::new("Profile:").color(COLOR_TEXT_SECONDARY));
+
+        if let Some(name) = selected {
+            self.switch_profile(&name);
+        }
+    }
+
+    fn render_permission_banner(&mut self, ui: &mut egui::Ui) {
+        if self.permission_problems.is_empty() {
+            return;
+        }
+
+        egui::Frame::none()
+            .fill(COLOR_BG_CARD)
+            .stroke(egui::Stroke::new(1.0, COLOR_DANGER))
+            .rounding(Rounding::same(8.0))
+            .inner_margin(12.0)
+            .show(ui, |ui| {
+                ui.set_width(ui.available_width());
+                ui.label(
+                    RichText::new("Insufficient permissions")
+                        .size(13.0)
+                        .strong()
+                        .color(COLOR_DANGER),
+                );
+                ui.label(
+                    RichText::new(
+                        "Files in the downloads folder cannot be moved or deleted. Cleanup will fail for every file.",
+                    )
+                    .color(COLOR_TEXT_PRIMARY),
+                );
+                for problem in &self.permission_problems {
+                    ui.label(
+                        RichText::new(problem)
+                            .size(11.0)
+                            .monospace()
+                            .color(COLOR_TEXT_SECONDARY),
+                    );
+                }
+                ui.label(
+                    RichText::new(
+                        "Run the cleaner as administrator, or move the downloads folder out of protected locations like Program Files.",
+                    )
+                    .size(12.0)
+                    .color(COLOR_WARNING),
+                );
+            });
+        ui.add_space(12.0);
+    }
+
     fn render_paths_section(&mut self, ui: &mut egui::Ui) {
+        let mut rerun_stats = false;
+        let has_selection = self.modlist_selected.iter().any(|&selected| selected);
         Self::section_frame(ui, "Step 1: Select Folders", |ui| {
             ui.columns(2, |cols| {
                 // Wabbajack
                 cols[0].label(RichText::new("Wabbajack Installation").color(COLOR_TEXT_PRIMARY));
                 cols[0].label(
-                    RichText::new("Folder containing Wabbajack.exe")
+                    RichText::new("Folder containing Wabbajack.exe, or an installed MO2 instance")
                         .size(11.0)
                         .color(COLOR_TEXT_MUTED),
                 );
@@ -577,9 +2382,165 @@ impl WabbajackCleanerApp {
                             .size(12.0)
                             .color(COLOR_TEXT_SECONDARY),
                     );
+                    if let Some(uncompressed) = stats.uncompressed_size {
+                        ui.label(RichText::new(" | ").color(COLOR_TEXT_MUTED));
+                        ui.label(
+                            RichText::new(format!("{} uncompressed", format_size(uncompressed)))
+                                .size(12.0)
+                                .color(COLOR_TEXT_SECONDARY),
+                        );
+                    }
+                    if let Some(free) = stats.free_space {
+                        ui.label(RichText::new(" | ").color(COLOR_TEXT_MUTED));
+                        ui.label(
+                            RichText::new(format!("{} free", format_size(free)))
+                                .size(12.0)
+                                .color(COLOR_TEXT_SECONDARY),
+                        );
+                    }
+
+                    ui.with_layout(egui::Layout::right_to_left(egui::Align::Center), |ui| {
+                        let orphans = ui
+                            .add_enabled(
+                                !self.is_loading && has_selection,
+                                egui::Checkbox::new(
+                                    &mut self.estimate_orphans,
+                                    RichText::new("Orphans").size(12.0),
+                                ),
+                            )
+                            .on_hover_text("Also estimate the space orphaned mods take. Matches every archive against the selected modlists, so it takes longer.");
+                        if orphans.changed() {
+                            rerun_stats = true;
+                        }
+                        let toggle = ui
+                            .add_enabled(
+                                !self.is_loading,
+                                egui::Checkbox::new(
+                                    &mut self.include_uncompressed_size,
+                                    RichText::new("Uncompressed size").size(12.0),
+                                ),
+                            )
+                            .on_hover_text("Opens every .zip archive to sum the uncompressed size of its contents. Other archive formats are counted at their on-disk size. Slow on large libraries.");
+                        if toggle.changed() {
+                            rerun_stats = true;
+                        }
+                    });
                 });
+                if stats.total_size > 0 {
+                    let headline = ui.label(
+                        RichText::new(reclaimable_headline(stats))
+                            .size(12.0)
+                            .color(COLOR_WARNING),
+                    );
+                    match stats.reclaimable {
+                        Some((old_bytes, orphan_bytes)) => {
+                            headline.on_hover_text(format!(
+                                "Old versions: {}\nOrphaned: {}",
+                                format_size(old_bytes),
+                                format_size(orphan_bytes)
+                            ));
+                        }
+                        None => {
+                            headline.on_hover_text(
+                                "Select modlists and tick Orphans to include orphaned mods",
+                            );
+                        }
+                    }
+                }
+                if !stats.by_game.is_empty() {
+                    Self::render_space_by_game(ui, stats);
+                }
             }
         });
+
+        if rerun_stats {
+            self.run_analysis();
+        }
+    }
+
+    /// The largest orphans of the last analysis, shown before deleting them
+    fn render_largest_orphans(ui: &mut egui::Ui, orphans: &[OrphanedMod]) {
+        if orphans.is_empty() {
+            return;
+        }
+        ui.add_space(12.0);
+        ui.label(
+            RichText::new("Largest from the last analysis:")
+                .size(12.0)
+                .color(COLOR_TEXT_SECONDARY),
+        );
+        for m in orphans.iter().take(CONFIRM_EXAMPLES) {
+            ui.label(
+                RichText::new(format!(
+                    "{} ({})",
+                    m.file.file_name,
+                    format_size(m.file.size)
+                ))
+                .size(11.0)
+                .color(COLOR_TEXT_PRIMARY),
+            );
+        }
+        let rest = orphans.get(CONFIRM_EXAMPLES..).unwrap_or_default();
+        if !rest.is_empty() {
+            let rest_size: u64 = rest.iter().map(|m| m.file.size).sum();
+            ui.label(
+                RichText::new(format!(
+                    "...and {} more ({})",
+                    rest.len(),
+                    format_size(rest_size)
+                ))
+                .size(11.0)
+                .color(COLOR_TEXT_MUTED),
+            );
+        }
+    }
+
+    /// Per-game breakdown of library space, largest folders first
+    fn render_space_by_game(ui: &mut egui::Ui, stats: &LibraryStats) {
+        ui.collapsing("Space by game", |ui| {
+            let total = stats.total_size.max(1) as f32;
+            let old_bytes = stats.old_version_bytes();
+            ui.add(
+                egui::ProgressBar::new(old_bytes as f32 / total)
+                    .desired_width(300.0)
+                    .text(format!(
+                        "{} of {} in old versions",
+                        format_size(old_bytes),
+                        format_size(stats.total_size)
+                    )),
+            );
+            ui.add_space(4.0);
+            egui::Grid::new("space_by_game_grid")
+                .num_columns(5)
+                .spacing([12.0, 4.0])
+                .show(ui, |ui| {
+                    for header in ["Game", "Size", "Files", "Old versions", "Largest mod"] {
+                        ui.label(RichText::new(header).size(11.0).color(COLOR_TEXT_MUTED));
+                    }
+                    ui.end_row();
+                    for game in &stats.by_game {
+                        ui.label(RichText::new(&game.game).color(COLOR_TEXT_PRIMARY));
+                        ui.add(
+                            egui::ProgressBar::new(game.size as f32 / total)
+                                .desired_width(140.0)
+                                .text(format_size(game.size)),
+                        );
+                        ui.label(RichText::new(game.files.to_string()).color(COLOR_TEXT_SECONDARY));
+                        ui.label(
+                            RichText::new(format_size(game.old_version_bytes)).color(COLOR_WARNING),
+                        );
+                        match &game.largest {
+                            Some((name, size)) => ui.label(
+                                RichText::new(format!("{} ({})", name, format_size(*size)))
+                                    .size(11.0)
+                                    .color(COLOR_TEXT_SECONDARY),
+                            ),
+                            None => ui.label(""),
+                        };
+                        ui.end_row();
+                    }
+                });
+        });
     }
 
     fn render_modlist_section(&mut self, ui: &mut egui::Ui) {
@@ -623,18 +2584,39 @@ impl WabbajackCleanerApp {
                             } else {
                                 COLOR_TEXT_MUTED
                             };
-                            if ui
-                                .checkbox(
+                            let icon =
+                                self.modlist_icons
+                                    .entry(ml.name.clone())
+                                    .or_insert_with(|| {
+                                        ml.image.as_deref().and_then(|bytes| {
+                                            load_modlist_icon(ui.ctx(), &ml.name, bytes)
+                                        })
+                                    });
+                            ui.horizontal(|ui| {
+                                if let Some(texture) = icon {
+                                    ui.add(
+                                        egui::Image::new(&*texture)
+                                            .fit_to_exact_size(Vec2::splat(18.0)),
+                                    );
+                                }
+                                let mut response = ui.checkbox(
                                     &mut new_checked,
                                     RichText::new(format!("{} ({} mods)", ml.name, ml.mod_count))
                                         .color(color),
-                                )
-                                .changed()
-                            {
-                                if let Some(sel) = self.modlist_selected.get_mut(i) {
-                                    *sel = new_checked;
+                                );
+                                let about: Vec<&str> = [&ml.description, &ml.readme]
+                                    .into_iter()
+                                    .filter_map(|t| t.as_deref())
+                                    .collect();
+                                if !about.is_empty() {
+                                    response = response.on_hover_text(about.join("\n\n"));
                                 }
-                            }
+                                if response.changed() {
+                                    if let Some(sel) = self.modlist_selected.get_mut(i) {
+                                        *sel = new_checked;
+                                    }
+                                }
+                            });
                         }
                     });
             }
@@ -645,24 +2627,125 @@ impl WabbajackCleanerApp {
         Self::section_frame(ui, "Step 3: Cleanup Actions", |ui| {
             let ready = self.is_ready() && !self.is_loading;
 
-            ui.columns(2, |cols| {
-                // Orphaned Mods
-                cols[0].label(
-                    RichText::new("Orphaned Mods")
-                        .strong()
-                        .color(COLOR_TEXT_PRIMARY),
-                );
-                cols[0].label(
-                    RichText::new("Mods not used by selected modlists")
-                        .size(11.0)
-                        .color(COLOR_TEXT_MUTED),
+            if let Some(trash) = self.system_trash().filter(|_| self.keeps_backup()) {
+                ui.label(
+                    RichText::new(format!("Files go to the system trash: {}", trash.display()))
+                        .size(12.0)
+                        .color(COLOR_TEXT_SECONDARY),
                 );
-                cols[0].add_space(4.0);
-                cols[0].horizontal(|ui| {
-                    if ui
-                        .add_enabled(ready, egui::Button::new("Analyze"))
-                        .clicked()
-                    {
+                ui.add_space(8.0);
+            } else if self.keeps_backup() {
+                ui.horizontal(|ui| {
+                    ui.label(
+                        RichText::new(format!("Recycle Bin folder: {}/", RECYCLE_BIN_DIR_NAME))
+                            .size(12.0)
+                            .color(COLOR_TEXT_SECONDARY),
+                    );
+                    ui.add(
+                        egui::TextEdit::singleline(&mut self.recycle_bin_template)
+                            .desired_width(220.0),
+                    )
+                    .on_hover_text(format!(
+                        "Name of each cleanup's folder. Placeholders: {}. Use / for subfolders.",
+                        RECYCLE_BIN_PLACEHOLDERS.join(", ")
+                    ));
+                    if let Err(e) = recycle_bin_subdir(
+                        &self.recycle_bin_template,
+                        "orphaned",
+                        "all",
+                        chrono::Local::now(),
+                    ) {
+                        ui.label(RichText::new(e).size(11.0).color(COLOR_DANGER));
+                    }
+                });
+                ui.horizontal_wrapped(|ui| {
+                    ui.label(
+                        RichText::new("Backup drives for old versions:")
+                            .size(12.0)
+                            .color(COLOR_TEXT_SECONDARY),
+                    )
+                    .on_hover_text("Old versions are moved to the folder with the most free space instead of the downloads drive. Leave empty to use WLC_RecycleBin in the downloads folder.");
+                    let mut remove = None;
+                    for (i, root) in self.backup_roots.iter().enumerate() {
+                        ui.label(
+                            RichText::new(root.display().to_string())
+                                .size(11.0)
+                                .color(COLOR_TEXT_PRIMARY),
+                        );
+                        if ui.small_button("x").on_hover_text("Remove").clicked() {
+                            remove = Some(i);
+                        }
+                    }
+                    if let Some(i) = remove {
+                        self.backup_roots.remove(i);
+                    }
+                    if ui
+                        .add_enabled(!self.is_loading, egui::Button::new("Add..."))
+                        .clicked()
+                    {
+                        self.add_backup_root();
+                    }
+                });
+                ui.add_space(8.0);
+            }
+
+            ui.horizontal(|ui| {
+                ui.label(
+                    RichText::new("Cleanup reports:")
+                        .size(12.0)
+                        .color(COLOR_TEXT_SECONDARY),
+                );
+                let location = match &self.cleanup_report_dir {
+                    Some(dir) => dir.display().to_string(),
+                    None => "next to the moved files".to_string(),
+                };
+                ui.label(RichText::new(location).size(11.0).color(COLOR_TEXT_PRIMARY));
+                if ui
+                    .add_enabled(!self.is_loading, egui::Button::new("Change..."))
+                    .clicked()
+                {
+                    self.choose_cleanup_report_dir();
+                }
+                if self.cleanup_report_dir.is_some() && ui.small_button("Reset").clicked() {
+                    self.cleanup_report_dir = None;
+                }
+            });
+            ui.add_space(8.0);
+
+            ui.horizontal(|ui| {
+                ui.label(RichText::new("Keep files accessed in the last").color(COLOR_TEXT_SECONDARY));
+                ui.add(egui::DragValue::new(&mut self.protect_accessed_days).range(0..=365));
+                ui.label(RichText::new("days (0 = off)").color(COLOR_TEXT_SECONDARY));
+            })
+            .response
+            .on_hover_text("Uses the file system's last-access time, which is often unreliable: it may be disabled (noatime), updated only once a day, or touched by antivirus and backup tools. Where it isn't recorded, nothing is protected.");
+            ui.horizontal(|ui| {
+                ui.label(RichText::new("Skip files modified in the last").color(COLOR_TEXT_SECONDARY));
+                ui.add(egui::DragValue::new(&mut self.in_use_minutes).range(0..=1440));
+                ui.label(RichText::new("minutes (0 = off)").color(COLOR_TEXT_SECONDARY));
+            })
+            .response
+            .on_hover_text("Wabbajack writes downloads in place, so a file changed moments ago may still be downloading. Such files are marked as possibly in use and never removed.");
+            ui.add_space(8.0);
+
+            ui.columns(2, |cols| {
+                // Orphaned Mods
+                cols[0].label(
+                    RichText::new("Orphaned Mods")
+                        .strong()
+                        .color(COLOR_TEXT_PRIMARY),
+                );
+                cols[0].label(
+                    RichText::new("Mods not used by selected modlists")
+                        .size(11.0)
+                        .color(COLOR_TEXT_MUTED),
+                );
+                cols[0].add_space(4.0);
+                cols[0].horizontal(|ui| {
+                    if ui
+                        .add_enabled(ready, egui::Button::new("Analyze"))
+                        .clicked()
+                    {
                         self.run_orphaned_scan(false);
                     }
                     if ui
@@ -673,13 +2756,18 @@ impl WabbajackCleanerApp {
                         )
                         .clicked()
                     {
-                        if self.move_to_recycle_bin {
-                            self.run_orphaned_scan(true);
-                        } else {
-                            self.modal = Modal::ConfirmDelete(DeleteAction::Orphaned);
-                        }
+                        self.confirm_delete(DeleteAction::Orphaned);
                     }
                 });
+                cols[0].horizontal(|ui| {
+                    ui.label(RichText::new("Skip under").color(COLOR_TEXT_SECONDARY));
+                    ui.add(egui::DragValue::new(&mut self.orphan_min_size_mb).range(0..=100_000))
+                        .on_hover_text("Leave orphans smaller than this alone; they're listed as skipped (too small)");
+                    ui.label(RichText::new("MB (0 = off)").color(COLOR_TEXT_SECONDARY));
+                });
+                cols[0]
+                    .checkbox(&mut self.hash_unmatched, "Match by hash")
+                    .on_hover_text("Hash archives no modlist matches by name or ID, and keep those a modlist lists by hash. Slow on large libraries; hashes are cached between runs.");
 
                 // Old Versions
                 cols[1].label(
@@ -708,44 +2796,820 @@ impl WabbajackCleanerApp {
                         )
                         .clicked()
                     {
-                        if self.move_to_recycle_bin {
-                            self.run_old_version_scan(true);
-                        } else {
-                            self.modal = Modal::ConfirmDelete(DeleteAction::OldVersions);
+                        self.confirm_delete(DeleteAction::OldVersions);
+                    }
+                });
+                cols[1].horizontal(|ui| {
+                    ui.label(RichText::new(self.keep_label()).color(COLOR_TEXT_SECONDARY));
+                    ui.add(egui::DragValue::new(&mut self.keep_versions).range(1..=10))
+                        .on_hover_text("Versions of each mod to keep; shared with Combined Clean");
+                    ui.label(RichText::new("per mod").color(COLOR_TEXT_SECONDARY));
+                });
+            });
+
+            ui.add_space(8.0);
+            ui.separator();
+            ui.label(
+                RichText::new("Combined Clean")
+                    .strong()
+                    .color(COLOR_TEXT_PRIMARY),
+            );
+            ui.label(
+                RichText::new(
+                    "Remove orphaned mods and trim used mods to their newest versions in one pass",
+                )
+                .size(11.0)
+                .color(COLOR_TEXT_MUTED),
+            );
+            ui.add_space(4.0);
+            ui.horizontal(|ui| {
+                ui.label(RichText::new(self.keep_label()).color(COLOR_TEXT_SECONDARY));
+                ui.add(egui::DragValue::new(&mut self.keep_versions).range(1..=10));
+                ui.label(RichText::new("per mod").color(COLOR_TEXT_SECONDARY));
+                ui.add_space(12.0);
+                ui.label(RichText::new("Free up").color(COLOR_TEXT_SECONDARY));
+                ui.add(
+                    egui::DragValue::new(&mut self.reclaim_target_gb)
+                        .range(0.0..=100_000.0)
+                        .speed(1.0),
+                )
+                .on_hover_text("Stop once this much space is freed: orphaned mods first, largest first, then the oldest old versions. 0 frees everything.");
+                ui.label(RichText::new("GB").color(COLOR_TEXT_SECONDARY));
+                ui.add_space(12.0);
+                if ui
+                    .add_enabled(ready, egui::Button::new("Analyze"))
+                    .clicked()
+                {
+                    self.run_combined_clean(false);
+                }
+                if ui
+                    .add_enabled(
+                        ready,
+                        egui::Button::new(RichText::new("Clean").color(COLOR_TEXT_PRIMARY))
+                            .fill(COLOR_DANGER),
+                    )
+                    .clicked()
+                {
+                    self.confirm_delete(DeleteAction::Combined);
+                }
+            });
+
+            ui.add_space(8.0);
+            ui.separator();
+            ui.label(
+                RichText::new("Version Drift")
+                    .strong()
+                    .color(COLOR_TEXT_PRIMARY),
+            );
+            ui.label(
+                RichText::new("Compare the versions a modlist expects with the downloads on disk")
+                    .size(11.0)
+                    .color(COLOR_TEXT_MUTED),
+            );
+            ui.add_space(4.0);
+            ui.horizontal(|ui| {
+                let selected_name = self
+                    .modlists
+                    .get(self.drift_modlist)
+                    .map(|m| m.name.clone())
+                    .unwrap_or_default();
+                egui::ComboBox::from_id_salt("drift_modlist")
+                    .selected_text(selected_name)
+                    .show_ui(ui, |ui| {
+                        for (i, modlist) in self.modlists.iter().enumerate() {
+                            if ui
+                                .selectable_label(self.drift_modlist == i, modlist.name.as_str())
+                                .clicked()
+                            {
+                                self.drift_modlist = i;
+                            }
+                        }
+                    });
+                if ui
+                    .add_enabled(
+                        ready && self.drift_modlist < self.modlists.len(),
+                        egui::Button::new("Compare"),
+                    )
+                    .clicked()
+                {
+                    self.run_version_drift();
+                }
+                if ui
+                    .add_enabled(
+                        ready && self.modlist_selected.contains(&true),
+                        egui::Button::new("Audit Selected"),
+                    )
+                    .on_hover_text(
+                        "List the mods each selected modlist expects in another file than the one downloaded",
+                    )
+                    .clicked()
+                {
+                    self.run_version_audit();
+                }
+            });
+
+            ui.add_space(8.0);
+            ui.separator();
+            ui.label(
+                RichText::new("Which Modlists Use a File")
+                    .strong()
+                    .color(COLOR_TEXT_PRIMARY),
+            );
+            ui.label(
+                RichText::new(
+                    "List the modlists that reference an archive and the version each expects",
+                )
+                .size(11.0)
+                .color(COLOR_TEXT_MUTED),
+            );
+            ui.add_space(4.0);
+            if ui
+                .add_enabled(
+                    !self.modlists.is_empty() && !self.is_loading,
+                    egui::Button::new("Choose File..."),
+                )
+                .clicked()
+            {
+                self.show_modlist_uses();
+            }
+
+            ui.add_space(8.0);
+            ui.separator();
+            ui.label(
+                RichText::new("Library Audit")
+                    .strong()
+                    .color(COLOR_TEXT_PRIMARY),
+            );
+            ui.label(
+                RichText::new(
+                    "Match every archive to the selected modlists by content hash instead of file name",
+                )
+                .size(11.0)
+                .color(COLOR_TEXT_MUTED),
+            );
+            ui.add_space(4.0);
+            if ui.add_enabled(ready, egui::Button::new("Audit")).clicked() {
+                self.run_library_audit();
+            }
+
+            ui.add_space(8.0);
+            ui.separator();
+            ui.label(
+                RichText::new("Orphaned .meta Files")
+                    .strong()
+                    .color(COLOR_TEXT_PRIMARY),
+            );
+            ui.label(
+                RichText::new("Find .meta files left behind by archives that were deleted")
+                    .size(11.0)
+                    .color(COLOR_TEXT_MUTED),
+            );
+            ui.add_space(4.0);
+            ui.horizontal(|ui| {
+                let can_scan = !self.game_folders.is_empty() && !self.is_loading;
+                if ui
+                    .add_enabled(can_scan, egui::Button::new("Find"))
+                    .clicked()
+                {
+                    self.run_meta_cleanup(false);
+                }
+                if ui
+                    .add_enabled(
+                        can_scan && self.orphaned_meta_count.is_some_and(|n| n > 0),
+                        egui::Button::new(RichText::new("Clean").color(COLOR_TEXT_PRIMARY))
+                            .fill(COLOR_DANGER),
+                    )
+                    .clicked()
+                {
+                    self.confirm_delete(DeleteAction::MetaFiles);
+                }
+                if let Some(count) = self.orphaned_meta_count {
+                    ui.label(
+                        RichText::new(format!("{} found", count))
+                            .size(11.0)
+                            .color(COLOR_TEXT_SECONDARY),
+                    );
+                }
+            });
+
+            ui.add_space(8.0);
+            ui.separator();
+            ui.label(
+                RichText::new("Duplicates Across Folders")
+                    .strong()
+                    .color(COLOR_TEXT_PRIMARY),
+            );
+            ui.label(
+                RichText::new("Find the same archive saved in more than one game folder; Clean keeps one copy")
+                    .size(11.0)
+                    .color(COLOR_TEXT_MUTED),
+            );
+            ui.add_space(4.0);
+            ui.horizontal(|ui| {
+                let can_scan = !self.game_folders.is_empty() && !self.is_loading;
+                if ui
+                    .add_enabled(can_scan, egui::Button::new("Find"))
+                    .on_hover_text("Copies must have the same ModID, FileID and size. Copies whose .meta files name different games are left alone.")
+                    .clicked()
+                {
+                    self.run_cross_folder_cleanup(false);
+                }
+                if ui
+                    .add_enabled(
+                        can_scan && self.cross_folder_count.is_some_and(|n| n > 0),
+                        egui::Button::new(RichText::new("Clean").color(COLOR_TEXT_PRIMARY))
+                            .fill(COLOR_DANGER),
+                    )
+                    .clicked()
+                {
+                    self.confirm_delete(DeleteAction::CrossFolderDuplicates);
+                }
+                if let Some(count) = self.cross_folder_count {
+                    ui.label(
+                        RichText::new(format!("{} found", count))
+                            .size(11.0)
+                            .color(COLOR_TEXT_SECONDARY),
+                    );
+                }
+            });
+
+            ui.add_space(8.0);
+            ui.separator();
+            ui.label(
+                RichText::new("Identical Files")
+                    .strong()
+                    .color(COLOR_TEXT_PRIMARY),
+            );
+            ui.label(
+                RichText::new("Find files with the same contents under different names, such as re-downloads; Clean keeps the newest copy")
+                    .size(11.0)
+                    .color(COLOR_TEXT_MUTED),
+            );
+            ui.add_space(4.0);
+            ui.horizontal(|ui| {
+                let can_scan = !self.game_folders.is_empty() && !self.is_loading;
+                if ui
+                    .add_enabled(can_scan, egui::Button::new("Find"))
+                    .on_hover_text("Only files of the same size are hashed. Hashes are cached, so later scans are quicker.")
+                    .clicked()
+                {
+                    self.run_identical_cleanup(false);
+                }
+                if ui
+                    .add_enabled(
+                        can_scan && self.identical_count.is_some_and(|n| n > 0),
+                        egui::Button::new(RichText::new("Clean").color(COLOR_TEXT_PRIMARY))
+                            .fill(COLOR_DANGER),
+                    )
+                    .clicked()
+                {
+                    self.confirm_delete(DeleteAction::IdenticalFiles);
+                }
+                if let Some(count) = self.identical_count {
+                    ui.label(
+                        RichText::new(format!("{} found", count))
+                            .size(11.0)
+                            .color(COLOR_TEXT_SECONDARY),
+                    );
+                }
+            });
+
+            ui.add_space(8.0);
+            ui.separator();
+            ui.label(
+                RichText::new("Repair Names")
+                    .strong()
+                    .color(COLOR_TEXT_PRIMARY),
+            );
+            ui.label(
+                RichText::new(
+                    "Rename unrecognized archives to the Wabbajack pattern using their .meta files",
+                )
+                .size(11.0)
+                .color(COLOR_TEXT_MUTED),
+            );
+            ui.add_space(4.0);
+            if ui
+                .add_enabled(
+                    !self.game_folders.is_empty() && !self.is_loading,
+                    egui::Button::new("Preview"),
+                )
+                .clicked()
+            {
+                self.preview_name_repairs();
+            }
+
+            ui.add_space(8.0);
+            ui.separator();
+            ui.label(
+                RichText::new("Restore Backup")
+                    .strong()
+                    .color(COLOR_TEXT_PRIMARY),
+            );
+            ui.label(
+                RichText::new(format!(
+                    "Move files from a {} folder back to where they were deleted from",
+                    RECYCLE_BIN_DIR_NAME
+                ))
+                .size(11.0)
+                .color(COLOR_TEXT_MUTED),
+            );
+            ui.add_space(4.0);
+            if ui
+                .add_enabled(
+                    self.downloads_dir.is_some() && !self.is_loading,
+                    egui::Button::new("Choose Backup..."),
+                )
+                .clicked()
+            {
+                self.show_backups();
+            }
+            if let Some((dir, files)) = &self.undo_cleanup {
+                let hover = format!(
+                    "Move the {} file(s) the last cleanup moved to {} back",
+                    files.len(),
+                    dir.display()
+                );
+                if ui
+                    .add_enabled(!self.is_loading, egui::Button::new("Undo Last Cleanup"))
+                    .on_hover_text(hover)
+                    .clicked()
+                {
+                    self.undo_last_cleanup();
+                }
+            }
+        });
+    }
+
+    fn render_results_section(&mut self, ui: &mut egui::Ui) {
+        if self.orphaned_result.is_none()
+            && self.old_version_result.is_none()
+            && self.cleanup_plan.is_none()
+            && self.version_drift.is_none()
+            && self.library_audit.is_none()
+        {
+            return;
+        }
+
+        let mut export = false;
+        Self::section_frame(ui, "Results", |ui| {
+            if (self.orphaned_result.is_some()
+                || self.old_version_result.is_some()
+                || self.library_audit.is_some())
+                && ui
+                    .add_enabled(!self.is_loading, egui::Button::new("Export Report"))
+                    .on_hover_text("Save the statistics and scan results as a text file, or the orphaned mods scan as CSV")
+                    .clicked()
+            {
+                export = true;
+            }
+
+            if let Some(res) = &self.orphaned_result {
+                let unchecked = &mut self.orphans_unchecked;
+                ui.horizontal(|ui| {
+                    ui.label(
+                        RichText::new("Orphaned Mods:")
+                            .strong()
+                            .color(COLOR_TEXT_PRIMARY),
+                    );
+                    ui.label(
+                        RichText::new(format!("{} files", res.orphaned_mods.len()))
+                            .color(COLOR_TEXT_SECONDARY),
+                    );
+                    ui.label(RichText::new(format_size(res.orphaned_size)).color(COLOR_DANGER));
+                    if res.small_orphans > 0 {
+                        ui.label(
+                            RichText::new(format!("({} skipped, too small)", res.small_orphans))
+                                .size(11.0)
+                                .color(COLOR_TEXT_MUTED),
+                        );
+                    }
+                    ui.with_layout(egui::Layout::right_to_left(egui::Align::Center), |ui| {
+                        if ui.small_button("None").clicked() {
+                            unchecked
+                                .extend(res.orphaned_mods.iter().map(|m| m.file.full_path.clone()));
+                        }
+                        if ui.small_button("All").clicked() {
+                            unchecked.clear();
+                        }
+                        let checked = res
+                            .orphaned_mods
+                            .iter()
+                            .filter(|m| !unchecked.contains(&m.file.full_path))
+                            .count();
+                        ui.label(
+                            RichText::new(format!(
+                                "{}/{} selected",
+                                checked,
+                                res.orphaned_mods.len()
+                            ))
+                            .size(12.0)
+                            .color(COLOR_TEXT_SECONDARY),
+                        );
+                    });
+                });
+                egui::ScrollArea::vertical()
+                    .max_height(120.0)
+                    .id_salt("orphaned")
+                    .show(ui, |ui| {
+                        for m in &res.orphaned_mods {
+                            ui.horizontal(|ui| {
+                                let path = &m.file.full_path;
+                                let mut checked = !unchecked.contains(path);
+                                let color = if checked {
+                                    COLOR_TEXT_PRIMARY
+                                } else {
+                                    COLOR_TEXT_MUTED
+                                };
+                                let response = ui.checkbox(
+                                    &mut checked,
+                                    RichText::new(&m.file.file_name).size(11.0).color(color),
+                                );
+                                if response.changed() {
+                                    if checked {
+                                        unchecked.remove(path);
+                                    } else {
+                                        unchecked.insert(path.clone());
+                                    }
+                                }
+                                ui.with_layout(
+                                    egui::Layout::right_to_left(egui::Align::Center),
+                                    |ui| {
+                                        ui.label(
+                                            RichText::new(format_size(m.file.size))
+                                                .size(11.0)
+                                                .color(COLOR_TEXT_MUTED),
+                                        );
+                                    },
+                                );
+                            });
+                        }
+                    });
+                ui.add_space(8.0);
+
+                if !res.orphaned_patches.is_empty() {
+                    let patch_size: u64 = res.orphaned_patches.iter().map(|m| m.file.size).sum();
+                    ui.horizontal(|ui| {
+                        ui.label(
+                            RichText::new("Orphaned Patches (no main file):")
+                                .strong()
+                                .color(COLOR_TEXT_PRIMARY),
+                        );
+                        ui.label(
+                            RichText::new(format!("{} files", res.orphaned_patches.len()))
+                                .color(COLOR_TEXT_SECONDARY),
+                        );
+                        ui.label(RichText::new(format_size(patch_size)).color(COLOR_DANGER));
+                    });
+                    egui::ScrollArea::vertical()
+                        .max_height(120.0)
+                        .id_salt("patches")
+                        .show(ui, |ui| {
+                            for m in &res.orphaned_patches {
+                                ui.horizontal(|ui| {
+                                    ui.label(
+                                        RichText::new(&m.file.file_name)
+                                            .size(11.0)
+                                            .color(COLOR_TEXT_PRIMARY),
+                                    );
+                                    ui.with_layout(
+                                        egui::Layout::right_to_left(egui::Align::Center),
+                                        |ui| {
+                                            ui.label(
+                                                RichText::new(format_size(m.file.size))
+                                                    .size(11.0)
+                                                    .color(COLOR_TEXT_MUTED),
+                                            );
+                                        },
+                                    );
+                                });
+                            }
+                        });
+                    ui.add_space(8.0);
+                }
+
+                if !res.used_mods.is_empty() {
+                    ui.collapsing(
+                        format!("Why {} used files were kept", res.used_mods.len()),
+                        |ui| {
+                            egui::ScrollArea::vertical()
+                                .max_height(150.0)
+                                .id_salt("kept")
+                                .show(ui, |ui| {
+                                    for f in &res.used_mods {
+                                        let reasons = res
+                                            .keep_reasons
+                                            .get(&f.full_path)
+                                            .map(|reasons| {
+                                                reasons
+                                                    .iter()
+                                                    .map(|r| {
+                                                        format!(
+                                                            "{} ({})",
+                                                            r.modlist,
+                                                            r.kind.label()
+                                                        )
+                                                    })
+                                                    .collect::<Vec<_>>()
+                                                    .join(", ")
+                                            })
+                                            .unwrap_or_default();
+                                        ui.label(
+                                            RichText::new(format!("{} - {}", f.file_name, reasons))
+                                                .size(11.0)
+                                                .color(COLOR_TEXT_SECONDARY),
+                                        );
+                                    }
+                                });
+                        },
+                    );
+                    ui.add_space(8.0);
+                }
+
+                if self.modlist_footprints.len() > 1 {
+                    ui.collapsing("Space only one modlist uses", |ui| {
+                        ui.label(
+                            RichText::new("Archives no other selected modlist uses; they become orphans if you stop using that modlist")
+                                .size(11.0)
+                                .color(COLOR_TEXT_MUTED),
+                        );
+                        egui::Grid::new("modlist_footprints_grid")
+                            .num_columns(3)
+                            .spacing([12.0, 4.0])
+                            .show(ui, |ui| {
+                                for f in &self.modlist_footprints {
+                                    ui.label(
+                                        RichText::new(format!("Dropping {} would free", f.modlist))
+                                            .size(11.0)
+                                            .color(COLOR_TEXT_SECONDARY),
+                                    );
+                                    ui.label(
+                                        RichText::new(format_size(f.size))
+                                            .size(11.0)
+                                            .color(COLOR_TEXT_PRIMARY),
+                                    );
+                                    ui.label(
+                                        RichText::new(format!("{} archives", f.files))
+                                            .size(11.0)
+                                            .color(COLOR_TEXT_MUTED),
+                                    );
+                                    ui.end_row();
+                                }
+                            });
+                    });
+                    ui.add_space(8.0);
+                }
+
+                if !res.identical_archives.is_empty() {
+                    let reclaimable: u64 =
+                        res.identical_archives.iter().map(|d| d.reclaimable).sum();
+                    ui.horizontal(|ui| {
+                        ui.label(
+                            RichText::new("Identical Downloads:")
+                                .strong()
+                                .color(COLOR_TEXT_PRIMARY),
+                        );
+                        ui.label(
+                            RichText::new(format!("{} archives", res.identical_archives.len()))
+                                .color(COLOR_TEXT_SECONDARY),
+                        );
+                        ui.label(RichText::new(format_size(reclaimable)).color(COLOR_WARNING));
+                    })
+                    .response
+                    .on_hover_text("Each copy is used by a selected modlist, so nothing is deleted automatically. Keep one copy and remove or link the others, then rename it for the modlist that used the other name.");
+                    egui::ScrollArea::vertical()
+                        .max_height(120.0)
+                        .id_salt("identical")
+                        .show(ui, |ui| {
+                            for d in &res.identical_archives {
+                                for (i, f) in d.files.iter().enumerate() {
+                                    let action = if i == 0 { "KEEP" } else { "REDUNDANT" };
+                                    ui.label(
+                                        RichText::new(format!(
+                                            "{} - {} ({})",
+                                            action,
+                                            f.full_path.display(),
+                                            format_size(f.size)
+                                        ))
+                                        .size(11.0)
+                                        .color(
+                                            if i == 0 {
+                                                COLOR_TEXT_PRIMARY
+                                            } else {
+                                                COLOR_WARNING
+                                            },
+                                        ),
+                                    );
+                                }
+                            }
+                        });
+                    ui.add_space(8.0);
+                }
+
+                if !res.fragmented_mods.is_empty() {
+                    ui.horizontal(|ui| {
+                        ui.label(
+                            RichText::new("Mods Split Across Folders:")
+                                .strong()
+                                .color(COLOR_TEXT_PRIMARY),
+                        );
+                        ui.label(
+                            RichText::new(format!("{} mods", res.fragmented_mods.len()))
+                                .color(COLOR_TEXT_SECONDARY),
+                        );
+                    });
+                    egui::ScrollArea::vertical()
+                        .max_height(120.0)
+                        .id_salt("fragmented")
+                        .show(ui, |ui| {
+                            for m in &res.fragmented_mods {
+                                ui.label(
+                                    RichText::new(format!("{} ({})", m.mod_name, m.mod_id))
+                                        .size(11.0)
+                                        .strong()
+                                        .color(COLOR_ACCENT),
+                                );
+                                for f in &m.files {
+                                    let folder = f
+                                        .full_path
+                                        .parent()
+                                        .and_then(|p| p.file_name())
+                                        .map(|n| n.to_string_lossy().to_string())
+                                        .unwrap_or_default();
+                                    ui.label(
+                                        RichText::new(format!("  [{}] {}", folder, f.file_name))
+                                            .size(11.0)
+                                            .color(COLOR_TEXT_PRIMARY),
+                                    );
+                                }
+                            }
+                        });
+                    ui.add_space(8.0);
+                }
+
+                if !res.foreign_game_mods.is_empty() {
+                    let foreign_size: u64 = res.foreign_game_mods.iter().map(|m| m.file.size).sum();
+                    ui.horizontal(|ui| {
+                        ui.label(
+                            RichText::new("Other Game Leftovers:")
+                                .strong()
+                                .color(COLOR_TEXT_PRIMARY),
+                        );
+                        ui.label(
+                            RichText::new(format!("{} files", res.foreign_game_mods.len()))
+                                .color(COLOR_TEXT_SECONDARY),
+                        );
+                        ui.label(RichText::new(format_size(foreign_size)).color(COLOR_WARNING));
+                    });
+                    egui::ScrollArea::vertical()
+                        .max_height(120.0)
+                        .id_salt("foreign")
+                        .show(ui, |ui| {
+                            for m in &res.foreign_game_mods {
+                                ui.horizontal(|ui| {
+                                    ui.label(
+                                        RichText::new(format!("[{}] {}", m.game, m.file.file_name))
+                                            .size(11.0)
+                                            .color(COLOR_TEXT_PRIMARY),
+                                    );
+                                    ui.with_layout(
+                                        egui::Layout::right_to_left(egui::Align::Center),
+                                        |ui| {
+                                            ui.label(
+                                                RichText::new(format_size(m.file.size))
+                                                    .size(11.0)
+                                                    .color(COLOR_TEXT_MUTED),
+                                            );
+                                        },
+                                    );
+                                });
+                            }
+                        });
+                    ui.add_space(8.0);
+                }
+            }
+
+            if let Some(res) = &self.old_version_result {
+                ui.horizontal(|ui| {
+                    ui.label(
+                        RichText::new("Old Versions:")
+                            .strong()
+                            .color(COLOR_TEXT_PRIMARY),
+                    );
+                    ui.label(
+                        RichText::new(format!("{} files", res.total_files))
+                            .color(COLOR_TEXT_SECONDARY),
+                    );
+                    ui.label(RichText::new(format_size(res.total_space)).color(COLOR_WARNING));
+                    if !res.skipped_files.is_empty() {
+                        let details = res
+                            .skipped_files
+                            .iter()
+                            .map(|s| format!("{}: {}", s.reason.code(), s.path.display()))
+                            .collect::<Vec<_>>()
+                            .join("\n");
+                        ui.label(
+                            RichText::new(format!(
+                                "({} unrecognized files skipped: {})",
+                                res.skipped_files.len(),
+                                skip_counts(&res.skipped_files)
+                            ))
+                            .size(11.0)
+                            .color(COLOR_TEXT_MUTED),
+                        )
+                        .on_hover_text(details);
+                    }
+                });
+                egui::ScrollArea::vertical()
+                    .max_height(150.0)
+                    .id_salt("oldver")
+                    .show(ui, |ui| {
+                        for group in &res.duplicates {
+                            let is_split = res
+                                .split_groups
+                                .iter()
+                                .any(|key| group.mod_key.starts_with(&format!("{}#", key)));
+                            let title = if is_split {
+                                format!("{} (split by version scheme)", group.mod_key)
+                            } else {
+                                group.mod_key.clone()
+                            };
+                            ui.label(RichText::new(title).size(11.0).strong().color(COLOR_ACCENT));
+                            for (i, f) in group.files.iter().enumerate() {
+                                let is_keep = i >= group.newest_idx;
+                                let (status, color) = if is_keep {
+                                    ("KEEP", COLOR_SUCCESS)
+                                } else {
+                                    ("DELETE", COLOR_DANGER)
+                                };
+                                ui.horizontal(|ui| {
+                                    ui.label(
+                                        RichText::new(format!("  {} - {}", status, f.file_name))
+                                            .size(11.0)
+                                            .color(color),
+                                    );
+                                    ui.with_layout(
+                                        egui::Layout::right_to_left(egui::Align::Center),
+                                        |ui| {
+                                            ui.label(
+                                                RichText::new(format_size(f.size))
+                                                    .size(11.0)
+                                                    .color(COLOR_TEXT_MUTED),
+                                            );
+                                        },
+                                    );
+                                });
+                            }
                         }
-                    }
-                });
-            });
-        });
-    }
-
-    fn render_results_section(&mut self, ui: &mut egui::Ui) {
-        if self.orphaned_result.is_none() && self.old_version_result.is_none() {
-            return;
-        }
+                    });
+            }
 
-        Self::section_frame(ui, "Results", |ui| {
-            if let Some(res) = &self.orphaned_result {
+            if let Some(plan) = &self.cleanup_plan {
+                ui.add_space(8.0);
                 ui.horizontal(|ui| {
                     ui.label(
-                        RichText::new("Orphaned Mods:")
+                        RichText::new("Combined Clean Plan:")
                             .strong()
                             .color(COLOR_TEXT_PRIMARY),
                     );
                     ui.label(
-                        RichText::new(format!("{} files", res.orphaned_mods.len()))
-                            .color(COLOR_TEXT_SECONDARY),
+                        RichText::new(format!(
+                            "{} orphaned + {} old versions (keeping {})",
+                            plan.orphaned_mods.len(),
+                            plan.old_version_files,
+                            plan.keep_versions
+                        ))
+                        .color(COLOR_TEXT_SECONDARY),
                     );
-                    ui.label(RichText::new(format_size(res.orphaned_size)).color(COLOR_DANGER));
+                    ui.label(RichText::new(format_size(plan.total_size())).color(COLOR_DANGER));
                 });
+                if let Some(target) = plan.target.filter(|t| *t > 0) {
+                    ui.add(
+                        egui::ProgressBar::new(
+                            (plan.total_size() as f64 / target as f64).min(1.0) as f32
+                        )
+                        .desired_width(300.0)
+                        .text(format!(
+                            "{} of {} target",
+                            format_size(plan.total_size()),
+                            format_size(target)
+                        )),
+                    );
+                }
                 egui::ScrollArea::vertical()
-                    .max_height(120.0)
-                    .id_salt("orphaned")
+                    .max_height(150.0)
+                    .id_salt("plan")
                     .show(ui, |ui| {
-                        for m in &res.orphaned_mods {
+                        let orphaned = plan.orphaned_mods.iter().map(|m| (&m.file, "ORPHANED"));
+                        let old = plan
+                            .old_versions
+                            .iter()
+                            .flat_map(|g| g.files[..g.newest_idx].iter())
+                            .map(|f| (f, "OLD"));
+                        for (f, reason) in orphaned.chain(old) {
                             ui.horizontal(|ui| {
                                 ui.label(
-                                    RichText::new(&m.file.file_name)
+                                    RichText::new(format!("{} - {}", reason, f.file_name))
                                         .size(11.0)
                                         .color(COLOR_TEXT_PRIMARY),
                                 );
@@ -753,7 +3617,7 @@ impl WabbajackCleanerApp {
                                     egui::Layout::right_to_left(egui::Align::Center),
                                     |ui| {
                                         ui.label(
-                                            RichText::new(format_size(m.file.size))
+                                            RichText::new(format_size(f.size))
                                                 .size(11.0)
                                                 .color(COLOR_TEXT_MUTED),
                                         );
@@ -762,62 +3626,141 @@ impl WabbajackCleanerApp {
                             });
                         }
                     });
-                ui.add_space(8.0);
             }
 
-            if let Some(res) = &self.old_version_result {
+            if let Some((name, report)) = &self.version_drift {
+                ui.add_space(8.0);
                 ui.horizontal(|ui| {
                     ui.label(
-                        RichText::new("Old Versions:")
+                        RichText::new(format!("Version Drift ({}):", name))
                             .strong()
                             .color(COLOR_TEXT_PRIMARY),
                     );
                     ui.label(
-                        RichText::new(format!("{} files", res.total_files))
+                        RichText::new(format!("{} archives", report.len()))
                             .color(COLOR_TEXT_SECONDARY),
                     );
-                    ui.label(RichText::new(format_size(res.total_space)).color(COLOR_WARNING));
                 });
                 egui::ScrollArea::vertical()
                     .max_height(150.0)
-                    .id_salt("oldver")
+                    .id_salt("drift")
                     .show(ui, |ui| {
-                        for group in &res.duplicates {
-                            ui.label(
-                                RichText::new(&group.mod_key)
+                        for drift in report {
+                            let expected = drift
+                                .expected
+                                .version
+                                .as_deref()
+                                .unwrap_or(drift.expected.file_name.as_str());
+                            if drift.on_disk.is_empty() {
+                                ui.label(
+                                    RichText::new(format!(
+                                        "{} - expects {}, not downloaded",
+                                        drift.mod_name, expected
+                                    ))
                                     .size(11.0)
-                                    .strong()
-                                    .color(COLOR_ACCENT),
-                            );
-                            for (i, f) in group.files.iter().enumerate() {
-                                let is_keep = i == group.newest_idx;
-                                let (status, color) = if is_keep {
-                                    ("KEEP", COLOR_SUCCESS)
-                                } else {
-                                    ("DELETE", COLOR_DANGER)
+                                    .color(COLOR_TEXT_MUTED),
+                                );
+                            }
+                            for (f, kind) in &drift.on_disk {
+                                let (label, color) = match kind {
+                                    VersionDriftKind::Matching => ("matches", COLOR_SUCCESS),
+                                    VersionDriftKind::Older => {
+                                        ("older, will be re-downloaded", COLOR_WARNING)
+                                    }
+                                    VersionDriftKind::Newer => {
+                                        ("newer, not used by the modlist", COLOR_ACCENT)
+                                    }
+                                    VersionDriftKind::Unknown => {
+                                        ("can't compare", COLOR_TEXT_SECONDARY)
+                                    }
                                 };
-                                ui.horizontal(|ui| {
-                                    ui.label(
-                                        RichText::new(format!("  {} - {}", status, f.file_name))
-                                            .size(11.0)
-                                            .color(color),
-                                    );
-                                    ui.with_layout(
-                                        egui::Layout::right_to_left(egui::Align::Center),
-                                        |ui| {
-                                            ui.label(
-                                                RichText::new(format_size(f.size))
-                                                    .size(11.0)
-                                                    .color(COLOR_TEXT_MUTED),
-                                            );
-                                        },
-                                    );
-                                });
+                                ui.label(
+                                    RichText::new(format!(
+                                        "{} - expects {}, have {} ({})",
+                                        drift.mod_name, expected, f.file_name, label
+                                    ))
+                                    .size(11.0)
+                                    .color(color),
+                                );
                             }
                         }
                     });
             }
+
+            if let Some(audit) = &self.library_audit {
+                ui.add_space(8.0);
+                egui::Frame::none()
+                    .fill(COLOR_BG_HEADER)
+                    .rounding(Rounding::same(6.0))
+                    .inner_margin(8.0)
+                    .show(ui, |ui| {
+                        ui.set_width(ui.available_width());
+                        let color = if audit.missing.is_empty() {
+                            COLOR_SUCCESS
+                        } else {
+                            COLOR_ACCENT
+                        };
+                        ui.label(RichText::new(download_summary(audit)).strong().color(color));
+                    });
+                ui.add_space(4.0);
+                ui.horizontal(|ui| {
+                    ui.label(
+                        RichText::new("Library Audit:")
+                            .strong()
+                            .color(COLOR_TEXT_PRIMARY),
+                    );
+                    ui.label(
+                        RichText::new(format!(
+                            "{} needed ({}), {} orphaned ({}), {} missing",
+                            audit.kept.len(),
+                            format_size(audit.kept_size),
+                            audit.orphaned.len(),
+                            format_size(audit.orphaned_size),
+                            audit.missing.len()
+                        ))
+                        .color(COLOR_TEXT_SECONDARY),
+                    );
+                });
+                egui::ScrollArea::vertical()
+                    .max_height(150.0)
+                    .id_salt("audit")
+                    .show(ui, |ui| {
+                        for f in &audit.orphaned {
+                            ui.label(
+                                RichText::new(format!(
+                                    "{} ({}) - not needed",
+                                    f.file_name,
+                                    format_size(f.size)
+                                ))
+                                .size(11.0)
+                                .color(COLOR_WARNING),
+                            );
+                        }
+                        for m in &audit.missing {
+                            ui.label(
+                                RichText::new(format!(
+                                    "{} - missing, needed by {}",
+                                    m.file_name,
+                                    m.modlists.join(", ")
+                                ))
+                                .size(11.0)
+                                .color(COLOR_DANGER),
+                            );
+                        }
+                        for f in &audit.unhashed {
+                            ui.label(
+                                RichText::new(format!("{} - no hash to check", f.file_name))
+                                    .size(11.0)
+                                    .color(COLOR_TEXT_MUTED),
+                            );
+                        }
+                    });
+            }
         });
+
+        if export {
+            self.export_report();
+        }
     }
 
     fn render_modals(&mut self, ctx: &egui::Context) {
@@ -907,61 +3850,293 @@ impl WabbajackCleanerApp {
                         });
                     });
 
-                    ui.add_space(20.0);
-                    ui.separator();
-                    ui.add_space(10.0);
-                    ui.vertical_centered(|ui| {
-                        if ui.button(RichText::new("Close").size(14.0)).clicked() {
+                    ui.add_space(20.0);
+                    ui.separator();
+                    ui.add_space(10.0);
+                    ui.vertical_centered(|ui| {
+                        if ui.button(RichText::new("Close").size(14.0)).clicked() {
+                            self.modal = Modal::None;
+                        }
+                    });
+                });
+        }
+
+        if let Modal::ConfirmDelete(action) = self.modal {
+            egui::Window::new("Confirm Deletion")
+                .collapsible(false)
+                .resizable(false)
+                .default_width(350.0)
+                .anchor(egui::Align2::CENTER_CENTER, [0.0, 0.0])
+                .show(ctx, |ui| {
+                    ui.vertical_centered(|ui| {
+                        ui.label(
+                            RichText::new("WARNING")
+                                .size(20.0)
+                                .strong()
+                                .color(COLOR_DANGER),
+                        );
+                        ui.add_space(12.0);
+                        if self.keeps_backup() {
+                            ui.label("Files will be moved to the backup folder.");
+                        } else {
+                            ui.label("Move to Recycle Bin is DISABLED.");
+                            ui.label("Files will be PERMANENTLY DELETED.");
+                            ui.label("This action cannot be undone.");
+                        }
+                        ui.add_space(8.0);
+                        for line in &self.delete_preview {
+                            ui.label(RichText::new(line).color(COLOR_TEXT_SECONDARY));
+                        }
+                        if let Some(e) = &self.backup_space_error {
+                            ui.label(RichText::new(e).color(COLOR_DANGER));
+                        }
+                        if let (DeleteAction::Orphaned, Some(res)) = (action, &self.orphaned_result)
+                        {
+                            let checked: Vec<OrphanedMod> = res
+                                .orphaned_mods
+                                .iter()
+                                .filter(|m| !self.orphans_unchecked.contains(&m.file.full_path))
+                                .cloned()
+                                .collect();
+                            Self::render_largest_orphans(ui, &checked);
+                        }
+                        ui.add_space(20.0);
+                        ui.horizontal(|ui| {
+                            let label = if self.keeps_backup() {
+                                "Yes, Move Files"
+                            } else {
+                                "Yes, Delete Files"
+                            };
+                            if ui
+                                .add_enabled(
+                                    self.backup_space_error.is_none(),
+                                    egui::Button::new(
+                                        RichText::new(label).strong().color(COLOR_DANGER),
+                                    ),
+                                )
+                                .clicked()
+                            {
+                                match action {
+                                    DeleteAction::Orphaned => {
+                                        self.run_orphaned_scan(true);
+                                        self.modal = Modal::None;
+                                    }
+                                    DeleteAction::OldVersions => {
+                                        // run_old_version_scan sets modal = FolderSelect;
+                                        // do not override it with None here
+                                        self.run_old_version_scan(true);
+                                    }
+                                    DeleteAction::Combined => {
+                                        self.run_combined_clean(true);
+                                        self.modal = Modal::None;
+                                    }
+                                    DeleteAction::MetaFiles => {
+                                        self.run_meta_cleanup(true);
+                                        self.modal = Modal::None;
+                                    }
+                                    DeleteAction::CrossFolderDuplicates => {
+                                        self.run_cross_folder_cleanup(true);
+                                        self.modal = Modal::None;
+                                    }
+                                    DeleteAction::IdenticalFiles => {
+                                        self.run_identical_cleanup(true);
+                                        self.modal = Modal::None;
+                                    }
+                                }
+                            }
+                            if ui.button("Cancel").clicked() {
+                                self.modal = Modal::None;
+                            }
+                        });
+                    });
+                });
+        }
+
+        if self.modal == Modal::ConfirmRename {
+            egui::Window::new("Confirm Rename")
+                .collapsible(false)
+                .resizable(true)
+                .default_width(600.0)
+                .anchor(egui::Align2::CENTER_CENTER, [0.0, 0.0])
+                .show(ctx, |ui| {
+                    ui.label(format!(
+                        "{} archive(s) will be renamed together with their .meta files:",
+                        self.name_repairs.len()
+                    ));
+                    ui.add_space(8.0);
+                    egui::ScrollArea::vertical()
+                        .max_height(300.0)
+                        .show(ui, |ui| {
+                            for repair in &self.name_repairs {
+                                let name = |p: &PathBuf| {
+                                    p.file_name()
+                                        .unwrap_or_default()
+                                        .to_string_lossy()
+                                        .to_string()
+                                };
+                                ui.label(
+                                    RichText::new(name(&repair.from))
+                                        .size(12.0)
+                                        .color(COLOR_TEXT_SECONDARY),
+                                );
+                                ui.label(
+                                    RichText::new(format!("  → {}", name(&repair.to)))
+                                        .size(12.0)
+                                        .color(COLOR_TEXT_PRIMARY),
+                                );
+                            }
+                        });
+                    ui.add_space(8.0);
+                    ui.horizontal(|ui| {
+                        if ui
+                            .add(egui::Button::new("Rename Files").fill(COLOR_ACCENT))
+                            .clicked()
+                        {
+                            self.apply_name_repairs();
+                        }
+                        if ui.button("Cancel").clicked() {
+                            self.name_repairs.clear();
+                            self.modal = Modal::None;
+                        }
+                    });
+                });
+        }
+
+        if self.modal == Modal::ConfirmDownloadsDir {
+            let path = self.pending_downloads_dir.clone().unwrap_or_default();
+            egui::Window::new("Wabbajack Folder Selected")
+                .collapsible(false)
+                .resizable(false)
+                .default_width(500.0)
+                .anchor(egui::Align2::CENTER_CENTER, [0.0, 0.0])
+                .show(ctx, |ui| {
+                    ui.label(
+                        RichText::new(path.display().to_string())
+                            .strong()
+                            .color(COLOR_TEXT_PRIMARY),
+                    );
+                    ui.add_space(4.0);
+                    ui.label(
+                        "This folder has Wabbajack.exe or a downloaded_mod_lists folder, so it is \
+                         probably where Wabbajack is installed. Its version folders would be \
+                         scanned as game folders.",
+                    );
+                    ui.add_space(4.0);
+                    ui.label(
+                        RichText::new(
+                            "Pick the folder your modlists download archives into instead. \
+                             It is shown as the downloads location when installing a modlist.",
+                        )
+                        .size(12.0)
+                        .color(COLOR_TEXT_SECONDARY),
+                    );
+                    ui.add_space(8.0);
+                    ui.horizontal(|ui| {
+                        if ui
+                            .add(egui::Button::new("Choose Another Folder").fill(COLOR_ACCENT))
+                            .clicked()
+                        {
+                            self.pending_downloads_dir = None;
+                            self.modal = Modal::None;
+                            self.select_downloads_dir();
+                        }
+                        if ui.button("Use Anyway").clicked() {
+                            self.pending_downloads_dir = None;
+                            self.modal = Modal::None;
+                            self.set_downloads_dir(path.clone());
+                        }
+                        if ui.button("Cancel").clicked() {
+                            self.pending_downloads_dir = None;
+                            self.modal = Modal::None;
+                        }
+                    });
+                });
+        }
+
+        if self.modal == Modal::NewProfile {
+            egui::Window::new("New Profile")
+                .collapsible(false)
+                .resizable(false)
+                .default_width(300.0)
+                .anchor(egui::Align2::CENTER_CENTER, [0.0, 0.0])
+                .show(ctx, |ui| {
+                    ui.label("Profile name:");
+                    ui.text_edit_singleline(&mut self.new_profile_name);
+                    ui.add_space(8.0);
+                    ui.horizontal(|ui| {
+                        if ui
+                            .add_enabled(
+                                !self.new_profile_name.trim().is_empty(),
+                                egui::Button::new("Create").fill(COLOR_ACCENT),
+                            )
+                            .clicked()
+                        {
+                            self.create_profile();
+                        }
+                        if ui.button("Cancel").clicked() {
+                            self.new_profile_name.clear();
                             self.modal = Modal::None;
                         }
                     });
                 });
         }
 
-        if let Modal::ConfirmDelete(action) = self.modal {
-            egui::Window::new("Confirm Deletion")
+        if self.modal == Modal::RestoreBackup {
+            egui::Window::new("Restore Backup")
                 .collapsible(false)
-                .resizable(false)
-                .default_width(350.0)
+                .resizable(true)
+                .default_width(500.0)
                 .anchor(egui::Align2::CENTER_CENTER, [0.0, 0.0])
                 .show(ctx, |ui| {
-                    ui.vertical_centered(|ui| {
-                        ui.label(
-                            RichText::new("WARNING")
-                                .size(20.0)
-                                .strong()
-                                .color(COLOR_DANGER),
-                        );
-                        ui.add_space(12.0);
-                        ui.label("Move to Recycle Bin is DISABLED.");
-                        ui.label("Files will be PERMANENTLY DELETED.");
-                        ui.label("This action cannot be undone.");
-                        ui.add_space(20.0);
-                        ui.horizontal(|ui| {
-                            if ui
-                                .button(
-                                    RichText::new("Yes, Delete Files")
-                                        .strong()
-                                        .color(COLOR_DANGER),
-                                )
-                                .clicked()
-                            {
-                                match action {
-                                    DeleteAction::Orphaned => {
-                                        self.run_orphaned_scan(true);
-                                        self.modal = Modal::None;
-                                    }
-                                    DeleteAction::OldVersions => {
-                                        // run_old_version_scan sets modal = FolderSelect;
-                                        // do not override it with None here
-                                        self.run_old_version_scan(true);
-                                    }
+                    ui.label("Select a backup to move back to its original folders:");
+                    ui.add_space(8.0);
+                    egui::ScrollArea::vertical()
+                        .max_height(300.0)
+                        .show(ui, |ui| {
+                            for (i, backup) in self.backups.iter().enumerate() {
+                                let date = backup
+                                    .modified
+                                    .map(|t| {
+                                        chrono::DateTime::<chrono::Local>::from(t)
+                                            .format("%Y-%m-%d %H:%M")
+                                            .to_string()
+                                    })
+                                    .unwrap_or_default();
+                                let text = format!(
+                                    "{}  ({} files, {})",
+                                    backup.path.display(),
+                                    backup.file_count,
+                                    date
+                                );
+                                if ui
+                                    .selectable_label(self.selected_backup == Some(i), text)
+                                    .clicked()
+                                {
+                                    self.selected_backup = Some(i);
                                 }
                             }
-                            if ui.button("Cancel").clicked() {
-                                self.modal = Modal::None;
-                            }
                         });
+                    ui.add_space(8.0);
+                    ui.label(
+                        RichText::new("Files whose original location is taken stay in the backup.")
+                            .size(11.0)
+                            .color(COLOR_TEXT_MUTED),
+                    );
+                    ui.add_space(8.0);
+                    ui.horizontal(|ui| {
+                        if ui
+                            .add_enabled(
+                                self.selected_backup.is_some(),
+                                egui::Button::new("Restore").fill(COLOR_ACCENT),
+                            )
+                            .clicked()
+                        {
+                            self.restore_selected_backup();
+                        }
+                        if ui.button("Cancel").clicked() {
+                            self.backups.clear();
+                            self.modal = Modal::None;
+                        }
                     });
                 });
         }
@@ -995,6 +4170,78 @@ impl WabbajackCleanerApp {
                             }
                         });
                     ui.add_space(8.0);
+                    ui.checkbox(
+                        &mut self.split_version_schemes,
+                        "Separate mismatched version schemes",
+                    )
+                    .on_hover_text("Treat files of one mod as separate mods when their versions can't be compared, e.g. \"1.2.3\" and \"2024.05\". Use this for Nexus pages that host unrelated tools under one ModID.");
+                    ui.add_space(8.0);
+                    ui.horizontal(|ui| {
+                        ui.label("Group versions by:");
+                        egui::ComboBox::from_id_salt("group_strategy")
+                            .selected_text(self.group_strategy.label())
+                            .show_ui(ui, |ui| {
+                                for strategy in GroupStrategy::ALL {
+                                    ui.selectable_value(
+                                        &mut self.group_strategy,
+                                        strategy,
+                                        strategy.label(),
+                                    );
+                                }
+                            });
+                    })
+                    .response
+                    .on_hover_text("ModID + name suits most libraries. ModID only is stricter and groups every file of a Nexus page together. Name only is for archives without reliable ModIDs.");
+                    ui.add_space(8.0);
+                    ui.horizontal(|ui| {
+                        ui.label("Versions to keep:");
+                        egui::ComboBox::from_id_salt("keep_order")
+                            .selected_text(self.keep_order.label())
+                            .show_ui(ui, |ui| {
+                                for order in KeepOrder::ALL {
+                                    ui.selectable_value(&mut self.keep_order, order, order.label());
+                                }
+                            });
+                    })
+                    .response
+                    .on_hover_text(format!("Oldest suits modlists pinned to the release they were built with. FileIDs listed in {} are kept either way.", PINS_FILE_NAME));
+                    ui.horizontal(|ui| {
+                        ui.label("Newest by:");
+                        egui::ComboBox::from_id_salt("newest_by")
+                            .selected_text(self.newest_by.label())
+                            .show_ui(ui, |ui| {
+                                for newest_by in NewestBy::ALL {
+                                    ui.selectable_value(
+                                        &mut self.newest_by,
+                                        newest_by,
+                                        newest_by.label(),
+                                    );
+                                }
+                            });
+                    })
+                    .response
+                    .on_hover_text("Versions are compared first where they can be. Files of the same version are ordered by the upload timestamp in their names, or by when they were last modified, for names whose timestamp is stale.");
+                    ui.checkbox(
+                        &mut self.protect_required_versions,
+                        "Keep versions any modlist asks for",
+                    )
+                    .on_hover_text("Never remove an old version whose exact FileID a modlist in the Wabbajack folder downloads, even one that isn't selected.");
+                    ui.add_space(8.0);
+                    let needs_confirmation = is_clean && self.unsafe_delete_all_old;
+                    if needs_confirmation {
+                        ui.label(
+                            RichText::new("SAFETY CHECKS DISABLED")
+                                .strong()
+                                .color(COLOR_DANGER),
+                        );
+                        ui.label(
+                            RichText::new("Every version but the newest will be removed, including patches, variants and optional files.")
+                                .size(11.0)
+                                .color(COLOR_DANGER),
+                        );
+                        ui.checkbox(&mut self.unsafe_confirmed, "I understand, clean without safety checks");
+                        ui.add_space(8.0);
+                    }
                     ui.horizontal(|ui| {
                         let btn_label = if is_clean {
                             "Start Clean"
@@ -1008,7 +4255,8 @@ impl WabbajackCleanerApp {
                         };
                         if ui
                             .add_enabled(
-                                self.selected_game_folder.is_some(),
+                                self.selected_game_folder.is_some()
+                                    && (!needs_confirmation || self.unsafe_confirmed),
                                 egui::Button::new(btn_label).fill(btn_color),
                             )
                             .clicked()
@@ -1016,6 +4264,7 @@ impl WabbajackCleanerApp {
                             self.start_old_version_scan();
                         }
                         if ui.button("Cancel").clicked() {
+                            self.unsafe_confirmed = false;
                             self.modal = Modal::None;
                         }
                     });
@@ -1028,82 +4277,30 @@ impl WabbajackCleanerApp {
 fn scan_wabbajack_dir(path: PathBuf, tx: Sender<AsyncMessage>) {
     tx.send(AsyncMessage::Progress("Scanning...".to_string(), None))
         .ok();
-    let mut modlist_map: std::collections::HashMap<String, (PathBuf, String)> =
-        std::collections::HashMap::new();
-
-    // 1. Check if the selected directory itself contains `.wabbajack` files directly
-    if let Ok(files) = find_wabbajack_files(&path) {
-        for wbfile in files {
-            let basename = wbfile
-                .file_name()
-                .map(|n| n.to_string_lossy().to_string())
-                .unwrap_or_default();
-            modlist_map.insert(basename, (wbfile, String::new()));
-        }
-    }
-
-    // 2. Check if a `downloaded_mod_lists` folder exists directly inside the selected path
-    if modlist_map.is_empty() {
-        let direct_modlists_path = path.join("downloaded_mod_lists");
-        if direct_modlists_path.exists() {
-            if let Ok(files) = find_wabbajack_files(&direct_modlists_path) {
-                for wbfile in files {
-                    let basename = wbfile
-                        .file_name()
-                        .map(|n| n.to_string_lossy().to_string())
-                        .unwrap_or_default();
-                    modlist_map.insert(basename, (wbfile, String::new()));
-                }
-            }
-        }
-    }
-
-    // 3. Fall back to scanning subdirectories (original Wabbajack structure) if no files found yet
-    if modlist_map.is_empty() {
-        let entries = match std::fs::read_dir(&path) {
-            Ok(e) => e,
-            Err(e) => {
-                tx.send(AsyncMessage::Error(e.to_string())).ok();
-                return;
-            }
+    if is_mo2_instance(&path) {
+        match load_mo2_instance(&path) {
+            Ok(info) => tx.send(AsyncMessage::ModlistsParsed(vec![info])).ok(),
+            Err(e) => tx.send(AsyncMessage::Error(format!("{:#}", e))).ok(),
         };
-
-        for entry in entries.flatten() {
-            if !entry.file_type().map(|t| t.is_dir()).unwrap_or(false) {
-                continue;
-            }
-            let version_name = entry.file_name().to_string_lossy().to_string();
-            let modlists_path = entry.path().join("downloaded_mod_lists");
-            if modlists_path.exists() {
-                if let Ok(files) = find_wabbajack_files(&modlists_path) {
-                    for wbfile in files {
-                        let basename = wbfile
-                            .file_name()
-                            .map(|n| n.to_string_lossy().to_string())
-                            .unwrap_or_default();
-                        let key = basename;
-                        if modlist_map
-                            .get(&key)
-                            .map(|(_, v)| &version_name > v)
-                            .unwrap_or(true)
-                        {
-                            modlist_map.insert(key, (wbfile, version_name.clone()));
-                        }
-                    }
-                }
-            }
-        }
+        return;
     }
+    let modlist_files = match find_modlist_files(&path) {
+        Ok(files) => files,
+        Err(e) => {
+            tx.send(AsyncMessage::Error(e.to_string())).ok();
+            return;
+        }
+    };
 
-    if modlist_map.is_empty() {
+    if modlist_files.is_empty() {
         tx.send(AsyncMessage::Error("No modlists found.".to_string()))
             .ok();
         return;
     }
 
-    let total = modlist_map.len();
+    let total = modlist_files.len();
     let mut modlists = Vec::new();
-    for (i, (_, (p, _))) in modlist_map.into_iter().enumerate() {
+    for (i, p) in modlist_files.into_iter().enumerate() {
         tx.send(AsyncMessage::Progress(
             "Parsing modlists...".to_string(),
             Some((i + 1, total)),
@@ -1116,11 +4313,135 @@ fn scan_wabbajack_dir(path: PathBuf, tx: Sender<AsyncMessage>) {
     tx.send(AsyncMessage::ModlistsParsed(modlists)).ok();
 }
 
+/// Decode a modlist image into a texture for the selection list
+fn load_modlist_icon(ctx: &egui::Context, name: &str, bytes: &[u8]) -> Option<egui::TextureHandle> {
+    let image = image::ImageReader::new(std::io::Cursor::new(bytes))
+        .with_guessed_format()
+        .ok()?
+        .decode()
+        .map_err(|e| log::info!("Failed to decode image of modlist {}: {}", name, e))
+        .ok()?;
+    let rgba = image.to_rgba8();
+    let (width, height) = rgba.dimensions();
+    let color_image = egui::ColorImage::from_rgba_unmultiplied(
+        [width as usize, height as usize],
+        &rgba.into_raw(),
+    );
+    Some(ctx.load_texture(
+        format!("modlist-icon-{}", name),
+        color_image,
+        egui::TextureOptions::LINEAR,
+    ))
+}
+
+/// Warn about cleanup candidates whose `.meta` flags keep them from being deleted
+fn warn_protected_archives<'a>(
+    files: impl IntoIterator<Item = &'a ModFile>,
+    tx: &Sender<AsyncMessage>,
+) {
+    let protected = find_protected_archives(files);
+    if !protected.is_empty() {
+        tx.send(AsyncMessage::Warning(format!(
+            "{} file(s) will be kept because they can't be downloaded again: {}",
+            protected.len(),
+            protected.join(", ")
+        )))
+        .ok();
+    }
+}
+
+/// List the files kept because they're on the exclusion list
+fn warn_excluded(file_names: &[String], tx: &Sender<AsyncMessage>) {
+    if !file_names.is_empty() {
+        tx.send(AsyncMessage::Warning(format!(
+            "{} file(s) are on the exclusion list ({}) and were kept: {}",
+            file_names.len(),
+            EXCLUSIONS_FILE_NAME,
+            file_names.join(", ")
+        )))
+        .ok();
+    }
+}
+
+/// Warn loudly about deletions cancelled to keep the last copy of a needed archive
+fn warn_last_copies(file_names: &[String], tx: &Sender<AsyncMessage>) {
+    if !file_names.is_empty() {
+        tx.send(AsyncMessage::Warning(format!(
+            "SAFETY CHECK: {} file(s) were planned for deletion but are the last copy of an archive a selected modlist needs. They were kept: {}",
+            file_names.len(),
+            file_names.join(", ")
+        )))
+        .ok();
+    }
+}
+
+/// Warn about files left out because Wabbajack may still be writing them
+fn warn_in_use(file_names: &[String], tx: &Sender<AsyncMessage>) {
+    if !file_names.is_empty() {
+        tx.send(AsyncMessage::Warning(format!(
+            "{} file(s) were modified in the last few minutes and may still be downloading. Marked as possibly in use and left alone: {}",
+            file_names.len(),
+            file_names.join(", ")
+        )))
+        .ok();
+    }
+}
+
+/// Warn about old versions kept because a modlist downloads their exact FileID
+fn warn_required(file_names: &[String], tx: &Sender<AsyncMessage>) {
+    if !file_names.is_empty() {
+        tx.send(AsyncMessage::Warning(format!(
+            "{} old version(s) are the exact file a modlist downloads and were kept: {}",
+            file_names.len(),
+            file_names.join(", ")
+        )))
+        .ok();
+    }
+}
+
+/// Index every game folder, saving progress so an interrupted scan can resume
+///
+/// Stops with [`SCAN_CANCELLED`] once `cancel` is set.
+fn index_mod_files(
+    folders: &[PathBuf],
+    parse: &ParseOptions,
+    resume: bool,
+    subfolder_depth: usize,
+    cancel: &AtomicBool,
+) -> anyhow::Result<Vec<ModFile>> {
+    // Saved progress only fingerprints the top of each folder
+    if subfolder_depth > 0 {
+        let cache = StatCache::with_subfolders(subfolder_depth, folders);
+        return get_all_mod_files_cancellable(folders, parse, &cache, cancel);
+    }
+    match ScanProgress::default_path() {
+        Some(path) => {
+            get_all_mod_files_resumable(folders, parse, ScanProgress::open(&path, resume), cancel)
+        }
+        None => get_all_mod_files_cancellable(folders, parse, &StatCache::new(), cancel),
+    }
+}
+
+#[allow(clippy::too_many_arguments)]
 fn scan_orphaned_mods_async(
     path: PathBuf,
     modlists: Vec<ModlistInfo>,
+    games: Vec<GameEntry>,
+    read_only: Vec<PathBuf>,
+    protect_accessed_days: u32,
+    in_use_minutes: u32,
+    hash_unmatched: bool,
+    min_size: u64,
+    exclusions: Exclusions,
+    unchecked: HashSet<PathBuf>,
+    resume: bool,
+    subfolder_depth: usize,
+    parse: ParseOptions,
+    include_hidden: bool,
     delete: bool,
+    safe_mode: bool,
     recycle_bin: Option<PathBuf>,
+    cancel: Arc<AtomicBool>,
     tx: Sender<AsyncMessage>,
 ) {
     tx.send(AsyncMessage::Progress(
@@ -1128,14 +4449,14 @@ fn scan_orphaned_mods_async(
         None,
     ))
     .ok();
-    let folders = match get_game_folders(&path) {
+    let folders = match get_game_folders(&path, include_hidden) {
         Ok(f) => f,
         Err(e) => {
             tx.send(AsyncMessage::Error(e.to_string())).ok();
             return;
         }
     };
-    let files = match get_all_mod_files(&folders) {
+    let files = match index_mod_files(&folders, &parse, resume, subfolder_depth, &cancel) {
         Ok(f) => f,
         Err(e) => {
             tx.send(AsyncMessage::Error(e.to_string())).ok();
@@ -1147,9 +4468,67 @@ fn scan_orphaned_mods_async(
         None,
     ))
     .ok();
-    let result = detect_orphaned_mods(&files, &modlists);
-    if delete && !result.orphaned_mods.is_empty() {
-        let total = result.orphaned_mods.len();
+    let mut result = detect_orphaned_mods_by_game(&files, &modlists, &folders, &games);
+    if hash_unmatched && !result.orphaned_mods.is_empty() {
+        let cache = open_hash_cache(result.orphaned_mods.len(), &tx);
+        let rescued = match_orphans_by_hash(&mut result, &modlists, &cache);
+        log::info!("Kept {} archive(s) matched by hash", rescued);
+        save_hash_cache(&cache, &tx);
+    }
+    result.skip_small_orphans(min_size);
+    if delete && result.small_orphans > 0 {
+        tx.send(AsyncMessage::Info(format!(
+            "Skipped (too small): {} files ({})",
+            result.small_orphans,
+            format_size(result.small_orphans_size)
+        )))
+        .ok();
+    }
+    result.foreign_game_mods = detect_foreign_game_mods(&files, &folders, &modlists, &games);
+    result.fragmented_mods = detect_fragmented_mods(&files);
+    result.identical_archives = detect_identical_archives(&result.used_mods, &modlists);
+    let in_use = exclude_in_use_orphans(&mut result.orphaned_mods, in_use_minutes);
+    warn_in_use(&in_use, &tx);
+    result.orphaned_size = result.orphaned_mods.iter().map(|m| m.file.size).sum();
+    warn_protected_archives(result.orphaned_mods.iter().map(|m| &m.file), &tx);
+    let now = SystemTime::now();
+    let (protected, mut deletable): (Vec<_>, Vec<_>) =
+        result.orphaned_mods.iter().cloned().partition(|m| {
+            is_in_folders(&m.file, &read_only, &folders)
+                || accessed_within(&m.file, protect_accessed_days, now)
+        });
+    let excluded = if delete {
+        exclude_listed_orphans(&mut deletable, &exclusions)
+    } else {
+        Vec::new()
+    };
+    warn_excluded(&excluded, &tx);
+    let unticked = if delete {
+        exclude_unchecked_orphans(&mut deletable, &unchecked)
+    } else {
+        Vec::new()
+    };
+    if !unticked.is_empty() {
+        tx.send(AsyncMessage::Info(format!(
+            "Left {} unticked file(s) alone",
+            unticked.len()
+        )))
+        .ok();
+    }
+    let last_copies = if delete {
+        exclude_last_copy_orphans(&mut deletable, &files, &modlists)
+    } else {
+        Vec::new()
+    };
+    warn_last_copies(&last_copies, &tx);
+    if delete && !deletable.is_empty() {
+        if let Some(folder) = folders.first() {
+            let bytes = deletable.iter().map(|m| m.file.size).sum();
+            if backup_lacks_space(folder, recycle_bin.as_deref(), bytes, &tx) {
+                return;
+            }
+        }
+        let total = deletable.len();
         tx.send(AsyncMessage::Progress(
             "Cleaning...".to_string(),
             Some((0, total)),
@@ -1164,34 +4543,277 @@ fn scan_orphaned_mods_async(
                 ))
                 .ok();
         };
-        let del = delete_orphaned_mods(
-            &result.orphaned_mods,
+        let mut del = delete_orphaned_mods(
+            &deletable,
+            safe_mode,
             recycle_bin.as_deref(),
             Some(&progress_cb),
         );
+        del.skipped
+            .extend(protected.into_iter().map(|m| m.file.file_name));
+        del.skipped.extend(excluded);
+        del.skipped.extend(unticked);
+        del.skipped.extend(last_copies);
         tx.send(AsyncMessage::DeletionComplete(del)).ok();
     } else {
         tx.send(AsyncMessage::OrphanedScanComplete(result)).ok();
     }
 }
 
+/// Report an error and return true when the backup folder can't take `bytes` more
+fn backup_lacks_space(
+    source: &Path,
+    recycle_bin: Option<&Path>,
+    bytes: u64,
+    tx: &Sender<AsyncMessage>,
+) -> bool {
+    let Some(dest) = recycle_bin.filter(|dir| !is_system_trash(dir)) else {
+        return false;
+    };
+    match check_backup_space(source, dest, bytes) {
+        Ok(()) => false,
+        Err(e) => {
+            tx.send(AsyncMessage::Error(e)).ok();
+            true
+        }
+    }
+}
+
+/// Open `dir` in the platform's file manager
+fn reveal_in_file_manager(dir: &Path) -> std::io::Result<()> {
+    let program = if cfg!(windows) {
+        "explorer"
+    } else if cfg!(target_os = "macos") {
+        "open"
+    } else {
+        "xdg-open"
+    };
+    std::process::Command::new(program)
+        .arg(dir)
+        .spawn()
+        .map(|_| ())
+}
+
+/// Load the hash cache before hashing unmatched archives
+fn open_hash_cache(unmatched: usize, tx: &Sender<AsyncMessage>) -> HashCache {
+    tx.send(AsyncMessage::Progress(
+        format!("Hashing {} unmatched archives...", unmatched),
+        None,
+    ))
+    .ok();
+    HashCache::default_path()
+        .map(|path| HashCache::open(&path))
+        .unwrap_or_default()
+}
+
+fn save_hash_cache(cache: &HashCache, tx: &Sender<AsyncMessage>) {
+    if let Err(e) = cache.save() {
+        tx.send(AsyncMessage::Warning(format!(
+            "Failed to save hash cache: {:#}",
+            e
+        )))
+        .ok();
+    }
+}
+
+#[allow(clippy::too_many_arguments)]
+fn combined_clean_async(
+    folders: Vec<PathBuf>,
+    modlists: Vec<ModlistInfo>,
+    games: Vec<GameEntry>,
+    keep_versions: usize,
+    keep_policy: KeepPolicy,
+    group_strategy: GroupStrategy,
+    required_by: Vec<ModlistInfo>,
+    reclaim_target: Option<u64>,
+    read_only: Vec<PathBuf>,
+    protect_accessed_days: u32,
+    in_use_minutes: u32,
+    hash_unmatched: bool,
+    exclusions: Exclusions,
+    resume: bool,
+    subfolder_depth: usize,
+    parse: ParseOptions,
+    delete: bool,
+    safe_mode: bool,
+    recycle_bin: Option<PathBuf>,
+    cancel: Arc<AtomicBool>,
+    tx: Sender<AsyncMessage>,
+) {
+    tx.send(AsyncMessage::Progress(
+        "Indexing files...".to_string(),
+        None,
+    ))
+    .ok();
+    let files = match index_mod_files(&folders, &parse, resume, subfolder_depth, &cancel) {
+        Ok(f) => f,
+        Err(e) => {
+            tx.send(AsyncMessage::Error(e.to_string())).ok();
+            return;
+        }
+    };
+    let mut plan = plan_cleanup(
+        &files,
+        &folders,
+        &modlists,
+        &games,
+        group_strategy,
+        keep_versions,
+        &keep_policy,
+    );
+    if hash_unmatched && !plan.orphaned_mods.is_empty() {
+        let cache = open_hash_cache(plan.orphaned_mods.len(), &tx);
+        let rescued = rescue_orphans_by_hash(&mut plan.orphaned_mods, &modlists, &cache);
+        log::info!("Kept {} archive(s) matched by hash", rescued.len());
+        plan.orphaned_size = plan.orphaned_mods.iter().map(|m| m.file.size).sum();
+        save_hash_cache(&cache, &tx);
+    }
+    let in_use = exclude_in_use(&mut plan, in_use_minutes);
+    warn_in_use(&in_use, &tx);
+    warn_protected_archives(
+        plan.orphaned_mods.iter().map(|m| &m.file).chain(
+            plan.old_versions
+                .iter()
+                .flat_map(|g| g.files[..g.newest_idx].iter()),
+        ),
+        &tx,
+    );
+    let mut protected = if delete {
+        let mut protected = exclude_read_only(&mut plan, &read_only, &folders);
+        protected.extend(exclude_recently_accessed(&mut plan, protect_accessed_days));
+        let excluded = exclude_listed(&mut plan, &exclusions);
+        warn_excluded(&excluded, &tx);
+        protected.extend(excluded);
+        protected
+    } else {
+        Vec::new()
+    };
+    if let Some(target) = reclaim_target {
+        if !trim_plan_to_target(&mut plan, target) {
+            tx.send(AsyncMessage::Warning(format!(
+                "Only {} can be reclaimed, less than the {} target. Cleaning everything eligible.",
+                format_size(plan.total_size()),
+                format_size(target)
+            )))
+            .ok();
+        }
+    }
+    if delete {
+        let last = exclude_last_copies(&mut plan, &files, &modlists);
+        warn_last_copies(&last, &tx);
+        protected.extend(last);
+        let required = exclude_required(&mut plan, &required_by);
+        warn_required(&required, &tx);
+        protected.extend(required);
+    }
+    if delete && plan.total_files() > 0 {
+        if let Some(folder) = folders.first() {
+            if backup_lacks_space(folder, recycle_bin.as_deref(), plan.total_size(), &tx) {
+                return;
+            }
+        }
+        let total = plan.total_files();
+        tx.send(AsyncMessage::Progress(
+            "Cleaning...".to_string(),
+            Some((0, total)),
+        ))
+        .ok();
+        let tx_cb = tx.clone();
+        let progress_cb = move |i: usize, t: usize| {
+            tx_cb
+                .send(AsyncMessage::Progress(
+                    format!("Cleaning... {}/{}", i, t),
+                    Some((i, t)),
+                ))
+                .ok();
+        };
+        let mut del =
+            delete_cleanup_plan(&plan, safe_mode, recycle_bin.as_deref(), Some(&progress_cb));
+        if let Some(target) = reclaim_target {
+            tx.send(AsyncMessage::Info(format!(
+                "Reclaimed {} of the {} target",
+                format_size(del.space_freed),
+                format_size(target)
+            )))
+            .ok();
+        }
+        del.skipped.extend(protected);
+        tx.send(AsyncMessage::DeletionComplete(del)).ok();
+    } else {
+        tx.send(AsyncMessage::CleanupPlanComplete(plan)).ok();
+    }
+}
+
+#[allow(clippy::too_many_arguments)]
 fn scan_old_versions_async(
     path: PathBuf,
+    options: DuplicateScanOptions,
+    modlists: Vec<ModlistInfo>,
+    required_by: Vec<ModlistInfo>,
+    protect_accessed_days: u32,
+    in_use_minutes: u32,
+    exclusions: Exclusions,
     delete: bool,
+    safe_mode: bool,
     recycle_bin: Option<PathBuf>,
+    backup: Option<(Vec<PathBuf>, PathBuf)>,
     tx: Sender<AsyncMessage>,
 ) {
     tx.send(AsyncMessage::Progress("Scanning...".to_string(), None))
         .ok();
-    let result = match scan_folder_for_duplicates(&path) {
+    let mut result = match scan_folder_for_duplicates_with(&path, &options) {
         Ok(r) => r,
         Err(e) => {
             tx.send(AsyncMessage::Error(e.to_string())).ok();
             return;
         }
     };
+    let in_use = exclude_in_use_groups(&mut result.duplicates, in_use_minutes);
+    warn_in_use(&in_use, &tx);
+    result.update_totals();
+    warn_protected_archives(
+        result
+            .duplicates
+            .iter()
+            .flat_map(|g| g.files[..g.newest_idx].iter()),
+        &tx,
+    );
+    let protected = if delete {
+        let mut protected =
+            exclude_recently_accessed_groups(&mut result.duplicates, protect_accessed_days);
+        let excluded = exclude_listed_groups(&mut result.duplicates, &exclusions);
+        warn_excluded(&excluded, &tx);
+        protected.extend(excluded);
+        let last = exclude_last_copy_groups(&mut result.duplicates, &modlists);
+        warn_last_copies(&last, &tx);
+        protected.extend(last);
+        let required = exclude_required_groups(&mut result.duplicates, &required_by);
+        warn_required(&required, &tx);
+        protected.extend(required);
+        protected
+    } else {
+        Vec::new()
+    };
     if delete && !result.duplicates.is_empty() {
-        let total = result.total_files;
+        // Backups go to a location chosen for its free space, off the downloads drive
+        let recycle_bin = match backup {
+            Some((roots, subdir)) => {
+                let needed = result.duplicates.iter().map(|g| g.space_to_free).sum();
+                match choose_backup_root(&roots, needed) {
+                    Ok(root) => Some(root.join(RECYCLE_BIN_DIR_NAME).join(subdir)),
+                    Err(e) => {
+                        tx.send(AsyncMessage::Error(e)).ok();
+                        return;
+                    }
+                }
+            }
+            None => recycle_bin,
+        };
+        let bytes = result.duplicates.iter().map(|g| g.space_to_free).sum();
+        if backup_lacks_space(&path, recycle_bin.as_deref(), bytes, &tx) {
+            return;
+        }
+        let total = result.duplicates.iter().map(|g| g.newest_idx).sum();
         tx.send(AsyncMessage::Progress(
             "Cleaning...".to_string(),
             Some((0, total)),
@@ -1206,11 +4828,13 @@ fn scan_old_versions_async(
                 ))
                 .ok();
         };
-        let del = delete_old_versions(
+        let mut del = delete_old_versions(
             &result.duplicates,
+            safe_mode,
             recycle_bin.as_deref(),
             Some(&progress_cb),
         );
+        del.skipped.extend(protected);
         tx.send(AsyncMessage::DeletionComplete(del)).ok();
     } else {
         tx.send(AsyncMessage::OldVersionScanComplete(result)).ok();
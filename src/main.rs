@@ -10,6 +10,10 @@
 use eframe::egui;
 use egui::IconData;
 use std::io::Cursor;
+use wabbajack_library_cleaner::cli;
+use wabbajack_library_cleaner::core::{
+    log_file_path, open_log_file, parse_log_level, start_trace, Config,
+};
 use wabbajack_library_cleaner::gui::WabbajackCleanerApp;
 
 fn load_icon() -> Option<IconData> {
@@ -41,14 +45,122 @@ fn load_icon() -> Option<IconData> {
     })
 }
 
+/// Read the value of `-<name> <value>`, `--<name> <value>` or `--<name>=<value>`
+fn flag_value(name: &str) -> Option<String> {
+    let mut args = std::env::args().skip(1);
+    while let Some(arg) = args.next() {
+        let Some(flag) = arg.strip_prefix("--").or_else(|| arg.strip_prefix('-')) else {
+            continue;
+        };
+        if flag == name {
+            return args.next();
+        }
+        if let Some(value) = flag.strip_prefix(name).and_then(|v| v.strip_prefix('=')) {
+            return Some(value.to_string());
+        }
+    }
+    None
+}
+
+/// Send log messages to stderr at the configured level, or where `-log` and
+/// `-log-level` say
+///
+/// `RUST_LOG` still overrides the configured level, but not `-log-level`.
+fn init_logging() {
+    let level = flag_value("log-level").map(|text| {
+        parse_log_level(&text).unwrap_or_else(|| {
+            attach_parent_console();
+            eprintln!(
+                "-log-level must be error, warn, info or debug: {}\n\n{}",
+                text,
+                cli::USAGE
+            );
+            std::process::exit(cli::EXIT_USAGE);
+        })
+    });
+    // Read the file directly; Config::load would log before the logger exists
+    let config = Config::default_path()
+        .filter(|path| path.exists())
+        .and_then(|path| Config::load_from(&path).ok())
+        .unwrap_or_default();
+
+    let mut builder = env_logger::Builder::from_env(
+        env_logger::Env::default().default_filter_or(config.log_filter().as_str()),
+    );
+    builder.format_timestamp(Some(env_logger::TimestampPrecision::Seconds));
+    if let Some(level) = level {
+        builder.filter_level(level);
+    }
+    let mut log_error = None;
+    if let Some(arg) = flag_value("log").filter(|arg| arg != "-") {
+        let path = log_file_path(&arg);
+        let max_bytes = config.log_max_size_mb.saturating_mul(1024 * 1024);
+        match open_log_file(&path, max_bytes, config.log_keep) {
+            Ok(file) => {
+                builder.target(env_logger::Target::Pipe(Box::new(file)));
+            }
+            Err(e) => {
+                log_error = Some(format!("Failed to open log file {}: {}", path.display(), e))
+            }
+        }
+    }
+    builder.init();
+    if let Some(e) = log_error {
+        log::warn!("{}; logging to stderr", e);
+    }
+}
+
+/// Attach to the console that started us so command line output is visible
+///
+/// Release builds use the Windows GUI subsystem and get no console of their own.
+#[cfg(windows)]
+fn attach_parent_console() {
+    const ATTACH_PARENT_PROCESS: u32 = u32::MAX;
+
+    #[link(name = "kernel32")]
+    extern "system" {
+        fn AttachConsole(process_id: u32) -> i32;
+    }
+
+    // SAFETY: AttachConsole takes no pointers; failure just leaves output detached
+    unsafe {
+        AttachConsole(ATTACH_PARENT_PROCESS);
+    }
+}
+
+#[cfg(not(windows))]
+fn attach_parent_console() {}
+
 fn main() -> eframe::Result<()> {
-    // Initialize logging
-    env_logger::Builder::from_env(env_logger::Env::default().default_filter_or("info"))
-        .format_timestamp(Some(env_logger::TimestampPrecision::Seconds))
-        .init();
+    init_logging();
 
     log::info!("=== Wabbajack Library Cleaner Started ===");
 
+    let flags = cli::parse_flags(std::env::args().skip(1)).unwrap_or_else(|e| {
+        attach_parent_console();
+        eprintln!("{}\n\n{}", e, cli::USAGE);
+        std::process::exit(cli::EXIT_USAGE);
+    });
+
+    if let Some(path) = &flags.trace {
+        match start_trace(path) {
+            Ok(()) => log::info!("Tracing file decisions to {:?}", path),
+            Err(e) => log::warn!("Failed to open trace file {:?}: {}", path, e),
+        }
+    }
+
+    if flags.unsafe_delete_all_old {
+        log::warn!("!!! --unsafe-delete-all-old: old version safety checks are DISABLED !!!");
+    }
+    if flags.include_hidden {
+        log::info!("Including hidden folders as game folders");
+    }
+
+    if flags.has_operation() {
+        attach_parent_console();
+        std::process::exit(cli::run(&flags));
+    }
+
     let icon = load_icon();
 
     let options = eframe::NativeOptions {
@@ -63,6 +175,14 @@ fn main() -> eframe::Result<()> {
     eframe::run_native(
         "Wabbajack Library Cleaner",
         options,
-        Box::new(|cc| Ok(Box::new(WabbajackCleanerApp::new(cc)))),
+        Box::new(|cc| {
+            Ok(Box::new(WabbajackCleanerApp::new(
+                cc,
+                flags.profile,
+                flags.resume,
+                flags.unsafe_delete_all_old,
+                flags.include_hidden,
+            )))
+        }),
     )
 }
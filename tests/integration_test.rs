@@ -131,17 +131,24 @@ fn create_mod_file(
     let path = dir.join(&filename);
     let mut file = File::create(&path).unwrap();
 
-    // Write content to achieve desired size
-    let content = vec![b'x'; size];
-    file.write_all(&content).unwrap();
+    file.write_all(&archive_content(size)).unwrap();
 }
 
 /// Create a mod file with simple name format (for old version tests)
 fn create_simple_mod_file(dir: &Path, filename: &str, size: usize) {
     let path = dir.join(filename);
     let mut file = File::create(&path).unwrap();
-    let content = vec![b'x'; size];
-    file.write_all(&content).unwrap();
+    file.write_all(&archive_content(size)).unwrap();
+}
+
+/// Content of the given size that starts with a 7z header, so the file
+/// passes the archive integrity check
+fn archive_content(size: usize) -> Vec<u8> {
+    const SEVEN_ZIP_MAGIC: &[u8] = b"7z\xBC\xAF\x27\x1C";
+    let mut content = vec![b'x'; size];
+    let len = SEVEN_ZIP_MAGIC.len().min(size);
+    content[..len].copy_from_slice(&SEVEN_ZIP_MAGIC[..len]);
+    content
 }
 
 // ============================================================================
@@ -499,10 +506,11 @@ fn test_delete_orphaned_to_backup() {
     };
 
     // Delete with backup
-    let result = delete_orphaned_mods(&[orphaned], Some(&backup_dir), None);
+    let result = delete_orphaned_mods(&[orphaned], false, Some(&backup_dir), None);
 
     assert_eq!(result.deleted_count, 1);
     assert_eq!(result.errors.len(), 0);
+    assert_eq!(result.failed.len(), 0);
 
     // Original should be gone
     assert!(!downloads_dir.join(filename).exists());
@@ -526,7 +534,7 @@ fn test_delete_orphaned_permanent() {
     };
 
     // Delete without backup (permanent)
-    let result = delete_orphaned_mods(&[orphaned], None, None);
+    let result = delete_orphaned_mods(&[orphaned], false, None, None);
 
     assert_eq!(result.deleted_count, 1);
     assert!(!downloads_dir.join(filename).exists());
@@ -547,7 +555,8 @@ fn test_delete_old_versions_safety() {
     let scan_result = scan_folder_for_duplicates(&downloads_dir).unwrap();
 
     // Delete old versions
-    let deletion_result = delete_old_versions(&scan_result.duplicates, Some(&backup_dir), None);
+    let deletion_result =
+        delete_old_versions(&scan_result.duplicates, false, Some(&backup_dir), None);
 
     assert_eq!(
         deletion_result.deleted_count, 2,
@@ -819,7 +828,7 @@ fn test_meta_file_cleanup() {
     };
 
     // Delete with backup
-    delete_orphaned_mods(&[orphaned], Some(&backup_dir), None);
+    delete_orphaned_mods(&[orphaned], false, Some(&backup_dir), None);
 
     // Both files should be moved
     assert!(!downloads_dir.join(mod_filename).exists());
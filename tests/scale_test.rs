@@ -0,0 +1,92 @@
+// Scale benchmarks for Wabbajack Library Cleaner
+// Ignored by default; run with `cargo test --release --test scale_test -- --ignored --nocapture`
+//
+// Estimated footprint at 100k files: each indexed ModFile takes about 400
+// bytes with its strings (~40 MB), and the used/orphaned result clones them
+// once more. Three modlists of 12k archives hold about 2.5 MB each, and the
+// merged lookup set used during classification stays under 1 MB.
+
+use std::collections::HashSet;
+use std::fs::File;
+use std::path::PathBuf;
+use std::time::Instant;
+use tempfile::TempDir;
+use wabbajack_library_cleaner::core::{
+    detect_orphaned_mods, get_all_mod_files, parse_mod_filename, ModFile, ModlistInfo,
+};
+
+const FILES_ON_DISK: usize = 100_000;
+const ARCHIVES_PER_MODLIST: usize = 12_000;
+const MODLISTS: usize = 3;
+
+fn archive_name(i: usize) -> String {
+    format!("Mod {}-{}-1-0-{}.7z", i, 10_000 + i, 1_600_000_000 + i)
+}
+
+fn synthetic_files(count: usize) -> Vec<ModFile> {
+    (0..count)
+        .map(|i| {
+            let mut f = parse_mod_filename(&archive_name(i)).unwrap();
+            f.full_path = PathBuf::from("/downloads/Skyrim").join(&f.file_name);
+            f.size = 1024;
+            f
+        })
+        .collect()
+}
+
+fn synthetic_modlist(index: usize) -> ModlistInfo {
+    // Modlists overlap by half so the merge sees duplicate keys
+    let start = index * ARCHIVES_PER_MODLIST / 2;
+    let names: HashSet<String> = (start..start + ARCHIVES_PER_MODLIST)
+        .map(archive_name)
+        .collect();
+    ModlistInfo {
+        name: format!("Modlist {}", index),
+        mod_count: names.len(),
+        used_mod_keys: (start..start + ARCHIVES_PER_MODLIST)
+            .map(|i| format!("{}:mod {}", 10_000 + i, i))
+            .collect(),
+        used_file_names: names,
+        ..Default::default()
+    }
+}
+
+#[test]
+#[ignore]
+fn bench_detect_orphaned_mods_100k() {
+    let files = synthetic_files(FILES_ON_DISK);
+    let modlists: Vec<ModlistInfo> = (0..MODLISTS).map(synthetic_modlist).collect();
+
+    let start = Instant::now();
+    let result = detect_orphaned_mods(&files, &modlists);
+    let elapsed = start.elapsed();
+
+    let used = ARCHIVES_PER_MODLIST * (MODLISTS + 1) / 2;
+    assert_eq!(result.used_mods.len(), used);
+    assert_eq!(result.orphaned_mods.len(), FILES_ON_DISK - used);
+    println!(
+        "detect_orphaned_mods: {} files, {} modlists of {} archives in {:?}",
+        FILES_ON_DISK, MODLISTS, ARCHIVES_PER_MODLIST, elapsed
+    );
+}
+
+#[test]
+#[ignore]
+fn bench_get_all_mod_files_100k() {
+    let temp = TempDir::new().unwrap();
+    let folder = temp.path().join("Skyrim");
+    std::fs::create_dir(&folder).unwrap();
+    for i in 0..FILES_ON_DISK {
+        File::create(folder.join(archive_name(i))).unwrap();
+    }
+
+    let start = Instant::now();
+    let files = get_all_mod_files(&[folder]).unwrap();
+    let elapsed = start.elapsed();
+
+    assert_eq!(files.len(), FILES_ON_DISK);
+    println!(
+        "get_all_mod_files: {} files in {:?}",
+        FILES_ON_DISK, elapsed
+    );
+}